@@ -0,0 +1,283 @@
+// Команда loadtest — нагрузочный стенд: N клиентов в M комнатах шлют курсоры,
+// правки и чат, а в конце печатается JSON-отчёт о подключениях, задержке
+// рассылки, отвалившихся клиентах и памяти.
+//
+//	go run ./cmd/loadtest -clients 200 -rooms 20 -duration 30s > run.json
+//
+// Без -server стенд поднимает сервер в том же процессе.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/server"
+	sdk "table_collab/pkg/websocket"
+)
+
+type options struct {
+	Server     string        `json:"server"`
+	Clients    int           `json:"clients"`
+	Rooms      int           `json:"rooms"`
+	RoomType   string        `json:"room_type"`
+	Duration   time.Duration `json:"duration_ns"`
+	RampUp     time.Duration `json:"ramp_up_ns"`
+	CursorRate float64       `json:"cursor_rate"`
+	EditRate   float64       `json:"edit_rate"`
+	ChatRate   float64       `json:"chat_rate"`
+	InProcess  bool          `json:"in_process"`
+	Output     string        `json:"-"`
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.Server, "server", "", "server URL (default: start an in-process server)")
+	flag.IntVar(&opts.Clients, "clients", 100, "number of simulated clients")
+	flag.IntVar(&opts.Rooms, "rooms", 10, "number of rooms the clients are spread across")
+	flag.StringVar(&opts.RoomType, "room-type", "document", "room type: document, whiteboard or table")
+	flag.DurationVar(&opts.Duration, "duration", 30*time.Second, "how long to generate load")
+	flag.DurationVar(&opts.RampUp, "ramp-up", 5*time.Second, "period over which clients connect")
+	flag.Float64Var(&opts.CursorRate, "cursor-rate", 5, "cursor moves per client per second")
+	flag.Float64Var(&opts.EditRate, "edit-rate", 0.5, "edits per client per second")
+	flag.Float64Var(&opts.ChatRate, "chat-rate", 0.1, "chat messages per client per second")
+	flag.StringVar(&opts.Output, "o", "", "write the report to a file instead of stdout")
+	verbose := flag.Bool("v", false, "keep server and client logs")
+	flag.Parse()
+
+	// Отчёт идёт в stdout, поэтому логи — только в stderr
+	logOutput := io.Writer(os.Stderr)
+	if !*verbose {
+		logOutput = io.Discard
+	}
+	log.SetOutput(logOutput)
+	middleware.DefaultLogger = middleware.RequestLogger(&middleware.DefaultLogFormatter{
+		Logger: log.New(logOutput, "", log.LstdFlags),
+	})
+
+	if opts.Clients <= 0 || opts.Rooms <= 0 {
+		fmt.Fprintln(os.Stderr, "clients and rooms must be positive")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if opts.Server == "" {
+		cfg, err := config.Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			os.Exit(1)
+		}
+		// Не трогаем сохранённые комнаты и не шлём webhook-и настоящим подписчикам
+		cfg.App.SnapshotPath = ""
+		cfg.App.TemplatePath = ""
+		cfg.Webhook.StorePath = ""
+		cfg.EventLog.Dir = ""
+
+		ts := httptest.NewServer(server.New(cfg).Handler())
+		defer ts.Close()
+
+		opts.Server = ts.URL
+		opts.InProcess = true
+	}
+
+	report := run(ctx, opts)
+
+	out := os.Stdout
+	if opts.Output != "" {
+		f, err := os.Create(opts.Output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// probe — служебные поля, которые стенд добавляет в payload, чтобы
+// получатели могли посчитать задержку рассылки.
+type probe struct {
+	Sender string `json:"lt_sender"`
+	SentAt int64  `json:"lt_sent_at"`
+}
+
+func run(ctx context.Context, opts options) *Report {
+	stats := newStats()
+	memBefore := readMemory()
+	started := time.Now()
+
+	loadCtx, cancel := context.WithTimeout(ctx, opts.RampUp+opts.Duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// Подключения растягиваются на ramp-up, чтобы не мерить шторм рукопожатий
+			delay := time.Duration(int64(opts.RampUp) * int64(i) / int64(opts.Clients))
+			select {
+			case <-time.After(delay):
+			case <-loadCtx.Done():
+				return
+			}
+
+			simulate(loadCtx, opts, stats, i)
+		}(i)
+	}
+
+	// Память снимаем на пике, пока все клиенты ещё подключены
+	var memPeak Memory
+	select {
+	case <-loadCtx.Done():
+	case <-time.After(opts.RampUp + opts.Duration*9/10):
+		memPeak = readMemory()
+	}
+
+	wg.Wait()
+
+	return stats.report(opts, time.Since(started), memBefore, memPeak)
+}
+
+func simulate(ctx context.Context, opts options, stats *Stats, i int) {
+	username := fmt.Sprintf("load_%d", i)
+	roomID := fmt.Sprintf("load-room-%d", i%opts.Rooms)
+
+	connectStart := time.Now()
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	client, err := sdk.Dial(dialCtx, sdk.Options{
+		URL:         opts.Server,
+		RoomID:      roomID,
+		Username:    username,
+		RoomType:    sdk.RoomType(opts.RoomType),
+		EventBuffer: 1,
+	})
+	cancel()
+	if err != nil {
+		stats.connectFailed(err)
+		return
+	}
+	stats.connected(time.Since(connectStart))
+
+	record := func(event sdk.Event) {
+		var p probe
+		if event.Decode(&p) != nil || p.SentAt == 0 || p.Sender == username {
+			return
+		}
+		stats.received(event.Type, time.Duration(time.Now().UnixNano()-p.SentAt))
+	}
+	client.On(sdk.EventCursorMove, record)
+	client.On(sdk.EventTextUpdate, record)
+	client.On(sdk.EventCellUpdate, record)
+	client.On(sdk.EventChatMessage, record)
+
+	defer func() {
+		select {
+		case <-client.Done():
+			stats.closed(client.Err())
+		default:
+			client.Close()
+		}
+	}()
+
+	// Раньше, чем закончится нагрузка, правки перестают ждать ack, поэтому
+	// стенд завершается вовремя даже на перегруженном сервере
+	rng := rand.New(rand.NewPCG(uint64(i), uint64(time.Now().UnixNano())))
+	total := opts.CursorRate + opts.EditRate + opts.ChatRate
+	if total <= 0 {
+		<-ctx.Done()
+		return
+	}
+
+	for seq := 0; ; seq++ {
+		// Пуассоновский поток: интервалы экспоненциальные
+		wait := time.Duration(rng.ExpFloat64() / total * float64(time.Second))
+		select {
+		case <-time.After(wait):
+		case <-client.Done():
+			return
+		case <-ctx.Done():
+			return
+		}
+
+		p := probe{Sender: username, SentAt: time.Now().UnixNano()}
+		switch pick := rng.Float64() * total; {
+		case pick < opts.CursorRate:
+			err = client.Send(sdk.EventCursorMove, map[string]interface{}{
+				"x": rng.Float64() * 1920, "y": rng.Float64() * 1080,
+				"lt_sender": p.Sender, "lt_sent_at": p.SentAt,
+			})
+			stats.sent(sdk.EventCursorMove, err)
+
+		case pick < opts.CursorRate+opts.EditRate:
+			eventType, payload := edit(opts.RoomType, username, seq, p)
+			ackStart := time.Now()
+			_, err = client.SendEdit(ctx, eventType, payload)
+			if ctx.Err() != nil {
+				return
+			}
+			stats.sent(eventType, err)
+			if err == nil {
+				stats.acked(time.Since(ackStart))
+			}
+
+		default:
+			err = client.Send(sdk.EventChatMessage, map[string]interface{}{
+				"text":      fmt.Sprintf("message %d from %s", seq, username),
+				"lt_sender": p.Sender, "lt_sent_at": p.SentAt,
+			})
+			stats.sent(sdk.EventChatMessage, err)
+		}
+	}
+}
+
+func edit(roomType, username string, seq int, p probe) (sdk.EventType, map[string]interface{}) {
+	if roomType == string(sdk.RoomTypeTable) {
+		return sdk.EventCellUpdate, map[string]interface{}{
+			"cell":      fmt.Sprintf("%c%d", 'A'+rune(seq%8), seq%50+1),
+			"value":     fmt.Sprintf("%s:%d", username, seq),
+			"lt_sender": p.Sender, "lt_sent_at": p.SentAt,
+		}
+	}
+	return sdk.EventTextUpdate, map[string]interface{}{
+		"text":      fmt.Sprintf("edit %d by %s", seq, username),
+		"lt_sender": p.Sender, "lt_sent_at": p.SentAt,
+	}
+}
+
+func readMemory() Memory {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return Memory{
+		HeapAllocBytes: m.HeapAlloc,
+		HeapInuseBytes: m.HeapInuse,
+		SysBytes:       m.Sys,
+		NumGC:          m.NumGC,
+		Goroutines:     runtime.NumGoroutine(),
+	}
+}
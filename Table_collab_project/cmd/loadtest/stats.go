@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	sdk "table_collab/pkg/websocket"
+)
+
+// maxSamples ограничивает число сохранённых замеров на тип события.
+const maxSamples = 1 << 20
+
+// Report — результат прогона. Поля стабильны, чтобы отчёты можно было сравнивать.
+type Report struct {
+	Options  options          `json:"options"`
+	Started  time.Time        `json:"started"`
+	Elapsed  float64          `json:"elapsed_seconds"`
+	Connect  ConnectReport    `json:"connect"`
+	Sent     map[string]int64 `json:"sent"`
+	SendErrs map[string]int64 `json:"send_errors"`
+	Received map[string]int64 `json:"received"`
+	// FanOut — задержка от отправки до получения другим участником комнаты.
+	FanOut map[string]Latency `json:"fanout_latency_ms"`
+	Ack    Latency            `json:"edit_ack_latency_ms"`
+	Closed ClosedReport       `json:"closed_clients"`
+	// Память процесса стенда: при встроенном сервере сюда входит и сервер.
+	MemoryBefore Memory `json:"memory_before"`
+	MemoryPeak   Memory `json:"memory_peak"`
+}
+
+type ConnectReport struct {
+	Attempted int64          `json:"attempted"`
+	Succeeded int64          `json:"succeeded"`
+	Failed    int64          `json:"failed"`
+	Errors    map[string]int `json:"errors,omitempty"`
+	Latency   Latency        `json:"latency_ms"`
+}
+
+type ClosedReport struct {
+	Total   int64          `json:"total"`
+	Reasons map[string]int `json:"reasons,omitempty"`
+}
+
+type Latency struct {
+	Count int64   `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	P999  float64 `json:"p999"`
+	Max   float64 `json:"max"`
+}
+
+type Memory struct {
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	HeapInuseBytes uint64 `json:"heap_inuse_bytes"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	NumGC          uint32 `json:"num_gc"`
+	Goroutines     int    `json:"goroutines"`
+}
+
+// Stats собирает замеры со всех клиентов.
+type Stats struct {
+	mu sync.Mutex
+
+	connectOK    int64
+	connectErrs  map[string]int
+	connectTimes []time.Duration
+
+	sentCount map[string]int64
+	sendErrs  map[string]int64
+	recvCount map[string]int64
+	fanout    map[string][]time.Duration
+	ackTimes  []time.Duration
+
+	closedReasons map[string]int
+}
+
+func newStats() *Stats {
+	return &Stats{
+		connectErrs:   make(map[string]int),
+		sentCount:     make(map[string]int64),
+		sendErrs:      make(map[string]int64),
+		recvCount:     make(map[string]int64),
+		fanout:        make(map[string][]time.Duration),
+		closedReasons: make(map[string]int),
+	}
+}
+
+func (s *Stats) connected(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connectOK++
+	s.connectTimes = appendSample(s.connectTimes, d)
+}
+
+func (s *Stats) connectFailed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connectErrs[err.Error()]++
+}
+
+func (s *Stats) sent(eventType sdk.EventType, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		var nack *sdk.NackError
+		key := string(eventType)
+		if errors.As(err, &nack) {
+			key += ":" + nack.Code
+		}
+		s.sendErrs[key]++
+		return
+	}
+	s.sentCount[string(eventType)]++
+}
+
+func (s *Stats) received(eventType sdk.EventType, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recvCount[string(eventType)]++
+	s.fanout[string(eventType)] = appendSample(s.fanout[string(eventType)], d)
+}
+
+func (s *Stats) acked(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ackTimes = appendSample(s.ackTimes, d)
+}
+
+func (s *Stats) closed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reason := "unknown"
+	if err != nil {
+		reason = err.Error()
+	}
+	s.closedReasons[reason]++
+}
+
+func (s *Stats) report(opts options, elapsed time.Duration, before, peak Memory) *Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &Report{
+		Options:  opts,
+		Started:  time.Now().Add(-elapsed).UTC(),
+		Elapsed:  elapsed.Seconds(),
+		Sent:     s.sentCount,
+		SendErrs: s.sendErrs,
+		Received: s.recvCount,
+		FanOut:   make(map[string]Latency),
+		Ack:      summarize(s.ackTimes),
+		Closed:   ClosedReport{Reasons: s.closedReasons},
+
+		MemoryBefore: before,
+		MemoryPeak:   peak,
+	}
+
+	var failed int64
+	for _, n := range s.connectErrs {
+		failed += int64(n)
+	}
+	r.Connect = ConnectReport{
+		Attempted: s.connectOK + failed,
+		Succeeded: s.connectOK,
+		Failed:    failed,
+		Errors:    s.connectErrs,
+		Latency:   summarize(s.connectTimes),
+	}
+
+	for eventType, samples := range s.fanout {
+		r.FanOut[eventType] = summarize(samples)
+	}
+	for _, n := range s.closedReasons {
+		r.Closed.Total += int64(n)
+	}
+
+	return r
+}
+
+func appendSample(samples []time.Duration, d time.Duration) []time.Duration {
+	if len(samples) >= maxSamples {
+		return samples
+	}
+	return append(samples, d)
+}
+
+func summarize(samples []time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+
+	at := func(q float64) float64 {
+		return ms(sorted[int(q*float64(len(sorted)-1))])
+	}
+
+	return Latency{
+		Count: int64(len(sorted)),
+		Mean:  ms(sum / time.Duration(len(sorted))),
+		P50:   at(0.50),
+		P90:   at(0.90),
+		P99:   at(0.99),
+		P999:  at(0.999),
+		Max:   ms(sorted[len(sorted)-1]),
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -11,11 +12,25 @@ type Config struct {
 	Server    ServerConfig
 	WebSocket WebSocketConfig
 	App       AppConfig
+	Admin     AdminConfig
+	Security  SecurityConfig
+	Webhook   WebhookConfig
+	Plugins   PluginConfig
+	EventLog  EventLogConfig
+	Tracing   TracingConfig
+	Uploads   UploadConfig
 }
 
 type ServerConfig struct {
-	Address string
-	Env     string
+	Address         string
+	Env             string
+	ShutdownTimeout int
+	ReconnectDelay  int
+	// Уровень логов: debug, info, warn, error. Пустой — debug в development,
+	// info в остальных окружениях
+	LogLevel string
+	// В лог попадает одно из LogCursorSample событий cursor_move; 0 — ни одного
+	LogCursorSample int
 }
 
 type WebSocketConfig struct {
@@ -23,12 +38,116 @@ type WebSocketConfig struct {
 	WriteBufferSize int
 	MaxMessageSize  int64
 	PingPeriod      int
+
+	ResumeGracePeriod int
+	ResumeBufferSize  int
+
+	LongPollTimeout int
+
+	SendBufferSize     int
+	OverflowBufferSize int
+	// Политика медленного потребителя по типу комнаты: disconnect, drop_oldest, coalesce_cursor, spill
+	SlowConsumerPolicies map[string]string
 }
 
 type AppConfig struct {
 	MaxRooms          int
 	MaxClientsPerRoom int
 	RoomTTL           int
+	SnapshotPath      string
+	TemplatePath      string
+	// Блокировка снимается, если владелец столько секунд не правил и не продлевал её
+	LockIdleTimeout int
+	// Сколько последних версий комнаты хранить в памяти для форков
+	HistorySize int
+	// Сколько последних сообщений чата на комнату держать в поисковом индексе
+	SearchChatHistory int
+	// Зрители по ссылкам share считаются отдельно от MaxClientsPerRoom
+	MaxSpectatorsPerRoom int
+	// Файл ссылок share; пустой путь — ссылки живут до перезапуска
+	SharePath string
+}
+
+// SecurityConfig — единая политика для WebSocket-апгрейда и CORS REST API.
+type SecurityConfig struct {
+	AllowedOrigins    []string
+	EnableCompression bool
+	Subprotocols      []string
+	HandshakeTimeout  int
+}
+
+// WebhookConfig — доставка исходящих webhook-ов.
+type WebhookConfig struct {
+	Workers          int
+	QueueSize        int
+	MaxAttempts      int
+	InitialBackoffMs int
+	MaxBackoffMs     int
+	Timeout          int
+	LogSize          int
+	StorePath        string
+}
+
+// PluginConfig включает встроенные плагины по комнатам. Rooms сопоставляет
+// ID комнаты или glob-шаблон ("team-*") со списком плагинов и заменяет
+// Default для подходящих комнат.
+type PluginConfig struct {
+	Default         []string
+	Rooms           map[string][]string
+	TickInterval    int
+	SummaryInterval int
+}
+
+// EventLogConfig — журнал принятых событий по комнатам. Пустой Dir отключает
+// журнал, и комнаты переживают рестарт только через снапшот App.SnapshotPath.
+type EventLogConfig struct {
+	Dir string
+	// fsync после каждой записи: медленнее, но запись переживает и сбой ОС
+	Sync bool
+	// Раз в CompactInterval секунд комнаты, набравшие CompactThreshold записей
+	// после последнего снапшота, получают новый снапшот, а журнал обрезается
+	CompactInterval  int
+	CompactThreshold int
+	// Сколько снапшотов хранить: пересобрать комнату можно на любом смещении
+	// начиная с самого старого из них
+	KeepSnapshots int
+}
+
+// TracingConfig — экспорт трасс OpenTelemetry. Exporter: "otlp" (OTLP/HTTP,
+// например в локальный collector), "stdout" или пустая строка — трассы не
+// собираются, но пришедший от клиентов контекст всё равно передаётся дальше.
+type TracingConfig struct {
+	Exporter string
+	// host:port OTLP/HTTP-приёмника; пустой — из OTEL_EXPORTER_OTLP_ENDPOINT
+	// или localhost:4318
+	Endpoint    string
+	Insecure    bool
+	ServiceName string
+	// Доля трасс, которые начинает сервер; трассы клиентов следуют их решению
+	SampleRatio float64
+}
+
+// UploadConfig — вложения комнат: файлы хранятся в Dir под своим SHA-256.
+// Пустой Dir отключает загрузку.
+type UploadConfig struct {
+	Dir string
+	// Предельный размер файла в байтах
+	MaxSize    int64
+	MaxPerRoom int
+	// Разрешённые MIME-типы. Тип определяется по содержимому файла, а не по
+	// тому, что прислал клиент
+	AllowedTypes []string
+	// Длинная сторона уменьшенной копии картинки в пикселях
+	ThumbnailSize int
+	// Раз в CleanupInterval секунд удаляются файлы, на которые не ссылается ни
+	// одна комната и которые не менялись CleanupGrace секунд
+	CleanupInterval int
+	CleanupGrace    int
+}
+
+type AdminConfig struct {
+	Token        string
+	AuditLogSize int
 }
 
 func Load() (*Config, error) {
@@ -36,19 +155,97 @@ func Load() (*Config, error) {
 
 	return &Config{
 		Server: ServerConfig{
-			Address: getEnv("SERVER_ADDRESS", ":8080"),
-			Env:     getEnv("ENVIRONMENT", "development"),
+			Address:         getEnv("SERVER_ADDRESS", ":8080"),
+			Env:             getEnv("ENVIRONMENT", "development"),
+			ShutdownTimeout: getEnvAsInt("SHUTDOWN_TIMEOUT", 10),
+			ReconnectDelay:  getEnvAsInt("SHUTDOWN_RECONNECT_DELAY", 5),
+			LogLevel:        getEnv("LOG_LEVEL", ""),
+			LogCursorSample: getEnvAsInt("LOG_CURSOR_SAMPLE", 100),
 		},
 		WebSocket: WebSocketConfig{
 			ReadBufferSize:  getEnvAsInt("WS_READ_BUFFER_SIZE", 1024),
 			WriteBufferSize: getEnvAsInt("WS_WRITE_BUFFER_SIZE", 1024),
-			MaxMessageSize:  getEnvAsInt64("WS_MAX_MESSAGE_SIZE", 512),
+			MaxMessageSize:  getEnvAsInt64("WS_MAX_MESSAGE_SIZE", 65536),
 			PingPeriod:      getEnvAsInt("WS_PING_PERIOD", 60),
+
+			ResumeGracePeriod: getEnvAsInt("WS_RESUME_GRACE_PERIOD", 30),
+			ResumeBufferSize:  getEnvAsInt("WS_RESUME_BUFFER_SIZE", 256),
+
+			LongPollTimeout: getEnvAsInt("LONG_POLL_TIMEOUT", 25),
+
+			SendBufferSize:     getEnvAsInt("WS_SEND_BUFFER_SIZE", 256),
+			OverflowBufferSize: getEnvAsInt("WS_OVERFLOW_BUFFER_SIZE", 1024),
+			SlowConsumerPolicies: map[string]string{
+				"document":   getEnv("WS_SLOW_POLICY_DOCUMENT", "coalesce_cursor"),
+				"whiteboard": getEnv("WS_SLOW_POLICY_WHITEBOARD", "drop_oldest"),
+				"table":      getEnv("WS_SLOW_POLICY_TABLE", "spill"),
+			},
 		},
 		App: AppConfig{
 			MaxRooms:          getEnvAsInt("MAX_ROOMS", 100),
 			MaxClientsPerRoom: getEnvAsInt("MAX_CLIENTS_PER_ROOM", 50),
 			RoomTTL:           getEnvAsInt("ROOM_TTL", 3600),
+			SnapshotPath:      getEnv("ROOM_SNAPSHOT_PATH", "data/rooms.json"),
+			LockIdleTimeout:   getEnvAsInt("LOCK_IDLE_TIMEOUT", 30),
+			HistorySize:       getEnvAsInt("ROOM_HISTORY_SIZE", 100),
+			TemplatePath:      getEnv("ROOM_TEMPLATE_PATH", "data/templates.json"),
+			SearchChatHistory: getEnvAsInt("SEARCH_CHAT_HISTORY", 5000),
+			// Ссылки share
+			MaxSpectatorsPerRoom: getEnvAsInt("MAX_SPECTATORS_PER_ROOM", 1000),
+			SharePath:            getEnv("ROOM_SHARE_PATH", "data/shares.json"),
+		},
+		Admin: AdminConfig{
+			Token:        getEnv("ADMIN_TOKEN", ""),
+			AuditLogSize: getEnvAsInt("ADMIN_AUDIT_LOG_SIZE", 1000),
+		},
+		Security: SecurityConfig{
+			AllowedOrigins: getEnvAsList("ALLOWED_ORIGINS",
+				[]string{"http://localhost:3000", "http://127.0.0.1:3000"}),
+			EnableCompression: getEnvAsBool("WS_ENABLE_COMPRESSION", true),
+			Subprotocols:      getEnvAsList("WS_SUBPROTOCOLS", []string{"tablecollab.v1"}),
+			HandshakeTimeout:  getEnvAsInt("WS_HANDSHAKE_TIMEOUT", 10),
+		},
+		Webhook: WebhookConfig{
+			Workers:          getEnvAsInt("WEBHOOK_WORKERS", 4),
+			QueueSize:        getEnvAsInt("WEBHOOK_QUEUE_SIZE", 1000),
+			MaxAttempts:      getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 6),
+			InitialBackoffMs: getEnvAsInt("WEBHOOK_INITIAL_BACKOFF_MS", 1000),
+			MaxBackoffMs:     getEnvAsInt("WEBHOOK_MAX_BACKOFF_MS", 300000),
+			Timeout:          getEnvAsInt("WEBHOOK_TIMEOUT", 10),
+			LogSize:          getEnvAsInt("WEBHOOK_LOG_SIZE", 500),
+			StorePath:        getEnv("WEBHOOK_STORE_PATH", "data/webhooks.json"),
+		},
+		Plugins: PluginConfig{
+			Default:         getEnvAsList("PLUGINS_DEFAULT", nil),
+			Rooms:           getEnvAsRoomLists("PLUGINS_ROOMS"),
+			TickInterval:    getEnvAsInt("PLUGIN_TICK_INTERVAL", 60),
+			SummaryInterval: getEnvAsInt("PLUGIN_SUMMARY_INTERVAL", 86400),
+		},
+		EventLog: EventLogConfig{
+			Dir:              getEnv("EVENT_LOG_DIR", "data/events"),
+			Sync:             getEnvAsBool("EVENT_LOG_SYNC", false),
+			CompactInterval:  getEnvAsInt("EVENT_LOG_COMPACT_INTERVAL", 300),
+			CompactThreshold: getEnvAsInt("EVENT_LOG_COMPACT_THRESHOLD", 1000),
+			KeepSnapshots:    getEnvAsInt("EVENT_LOG_KEEP_SNAPSHOTS", 3),
+		},
+		Tracing: TracingConfig{
+			Exporter:    getEnv("TRACING_EXPORTER", ""),
+			Endpoint:    getEnv("TRACING_OTLP_ENDPOINT", ""),
+			Insecure:    getEnvAsBool("TRACING_OTLP_INSECURE", true),
+			ServiceName: getEnv("TRACING_SERVICE_NAME", "table_collab"),
+			SampleRatio: getEnvAsFloat("TRACING_SAMPLE_RATIO", 1),
+		},
+		Uploads: UploadConfig{
+			Dir:        getEnv("UPLOAD_DIR", "data/uploads"),
+			MaxSize:    getEnvAsInt64("UPLOAD_MAX_SIZE", 10<<20),
+			MaxPerRoom: getEnvAsInt("UPLOAD_MAX_PER_ROOM", 500),
+			AllowedTypes: getEnvAsList("UPLOAD_ALLOWED_TYPES", []string{
+				"image/png", "image/jpeg", "image/gif", "image/webp",
+				"application/pdf", "text/plain", "application/zip",
+			}),
+			ThumbnailSize:   getEnvAsInt("UPLOAD_THUMBNAIL_SIZE", 256),
+			CleanupInterval: getEnvAsInt("UPLOAD_CLEANUP_INTERVAL", 3600),
+			CleanupGrace:    getEnvAsInt("UPLOAD_CLEANUP_GRACE", 3600),
 		},
 	}, nil
 }
@@ -77,3 +274,56 @@ func getEnvAsInt64(key string, defaultValue int64) int64 {
 	}
 	return defaultValue
 }
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getEnvAsRoomLists разбирает "room-a=poll,formatter;team-*=summary".
+func getEnvAsRoomLists(key string) map[string][]string {
+	result := make(map[string][]string)
+	for _, entry := range strings.Split(os.Getenv(key), ";") {
+		room, list, ok := strings.Cut(entry, "=")
+		if room = strings.TrimSpace(room); !ok || room == "" {
+			continue
+		}
+
+		items := []string{}
+		for _, item := range strings.Split(list, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		result[room] = items
+	}
+	return result
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
+	"os"
+	"time"
 
 	"table_collab/cmd/server/config"
+	"table_collab/internal/logging"
 	"table_collab/internal/server"
+	"table_collab/internal/tracing"
 )
 
 func main() {
@@ -12,11 +18,28 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	slog.SetDefault(logging.New(cfg.Server, os.Stderr))
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, os.Stdout)
+	if err != nil {
+		slog.Error("Failed to set up tracing", logging.Err(err))
+		os.Exit(1)
+	}
 
 	srv := server.New(cfg)
 
-	log.Printf("🚀 Starting TableCollab on %s", cfg.Server.Address)
-	if err := srv.Start(); err != nil {
-		log.Fatal(err)
+	slog.Info("🚀 Starting TableCollab", "address", cfg.Server.Address, "tracing", cfg.Tracing.Exporter)
+	err = srv.Start()
+
+	// Дописываем спаны, накопленные к остановке
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Failed to flush traces", logging.Err(err))
+	}
+
+	if err != nil {
+		slog.Error("Server failed", logging.Err(err))
+		os.Exit(1)
 	}
 }
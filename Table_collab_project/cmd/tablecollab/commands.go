@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	sdk "table_collab/pkg/websocket"
+)
+
+func runRooms(ctx context.Context, g *globals, args []string) error {
+	var rooms []struct {
+		ID          string    `json:"id"`
+		Type        string    `json:"type"`
+		ReadOnly    bool      `json:"read_only"`
+		ClientCount int       `json:"client_count"`
+		Version     int       `json:"version"`
+		CreatedAt   time.Time `json:"created_at"`
+	}
+	if err := g.adminGet(ctx, "/api/admin/rooms", &rooms); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTYPE\tCLIENTS\tVERSION\tREAD-ONLY\tCREATED")
+	for _, room := range rooms {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%t\t%s\n", room.ID, room.Type, room.ClientCount,
+			room.Version, room.ReadOnly, room.CreatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// runTail печатает события комнаты по одному JSON-объекту в строке,
+// переподключаясь при обрывах.
+func runTail(ctx context.Context, g *globals, args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	types := flags.String("type", "", "comma-separated event types to print (default: all)")
+	roomID, err := roomArg(flags, args)
+	if err != nil {
+		return err
+	}
+
+	filter := make(map[sdk.EventType]bool)
+	for _, t := range strings.Split(*types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			filter[sdk.EventType(t)] = true
+		}
+	}
+
+	client, err := g.dial(ctx, roomID, true)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	out := json.NewEncoder(os.Stdout)
+	for {
+		select {
+		case event := <-client.Events():
+			if len(filter) > 0 && !filter[event.Type] {
+				continue
+			}
+			if err := out.Encode(event); err != nil {
+				return err
+			}
+		case <-client.Done():
+			return client.Err()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// runSend отправляет данные из stdin: chat — каждая строка отдельным
+// сообщением, text — весь ввод как новый текст документа, cell — строки
+// вида "B3=value".
+func runSend(ctx context.Context, g *globals, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected chat, text or cell")
+	}
+	mode := args[0]
+
+	roomID, err := roomArg(flag.NewFlagSet("send", flag.ContinueOnError), args[1:])
+	if err != nil {
+		return err
+	}
+
+	client, err := g.dial(ctx, roomID, false)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	switch mode {
+	case "chat":
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				if err := client.SendChat(line); err != nil {
+					return err
+				}
+			}
+		}
+		return scanner.Err()
+
+	case "text":
+		text, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		ack, err := client.SendText(ctx, string(text))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "saved, version %d\n", ack.Version)
+		return nil
+
+	case "cell":
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			cell, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return fmt.Errorf("invalid line %q, expected CELL=value", line)
+			}
+			if _, err := client.SendCell(ctx, strings.TrimSpace(cell), value); err != nil {
+				return fmt.Errorf("%s: %w", cell, err)
+			}
+		}
+		return scanner.Err()
+
+	default:
+		return fmt.Errorf("unknown send mode %q", mode)
+	}
+}
+
+// roomExport — формат файла, который пишет export.
+type roomExport struct {
+	RoomID     string          `json:"room_id"`
+	Server     string          `json:"server"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Room       sdk.SyncPayload `json:"room"`
+}
+
+func runExport(ctx context.Context, g *globals, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := flags.String("o", "", "output file (default: stdout)")
+	roomID, err := roomArg(flags, args)
+	if err != nil {
+		return err
+	}
+
+	client, err := g.dial(ctx, roomID, false)
+	if err != nil {
+		return err
+	}
+	state := client.State()
+	client.Close()
+
+	data, err := json.MarshalIndent(roomExport{
+		RoomID:     roomID,
+		Server:     g.server,
+		ExportedAt: time.Now().UTC(),
+		Room:       state,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %s (version %d) to %s\n", roomID, state.Version, *output)
+	return nil
+}
+
+// replayable — события, которые имеет смысл повторять в другой комнате.
+var replayable = map[sdk.EventType]bool{
+	sdk.EventTextUpdate:  true,
+	sdk.EventCellUpdate:  true,
+	sdk.EventElementAdd:  true,
+	sdk.EventChatMessage: true,
+	sdk.EventCursorMove:  true,
+}
+
+// runReplay читает вывод tail и повторяет правки и сообщения в комнате,
+// сохраняя исходные интервалы между событиями (с учётом -speed).
+func runReplay(ctx context.Context, g *globals, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	input := flags.String("i", "", "event log written by tail (default: stdin)")
+	speed := flags.Float64("speed", 1, "playback speed multiplier, 0 sends without delays")
+	roomID, err := roomArg(flags, args)
+	if err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	client, err := g.dial(ctx, roomID, true)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var sent, skipped int
+	var prev int64
+	decoder := json.NewDecoder(bufio.NewReader(in))
+	for {
+		var event sdk.Event
+		if err := decoder.Decode(&event); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("event %d: %w", sent+skipped+1, err)
+		}
+
+		if !replayable[event.Type] {
+			skipped++
+			continue
+		}
+
+		if *speed > 0 && prev > 0 && event.Timestamp > prev {
+			delay := time.Duration(float64(event.Timestamp-prev)/(*speed)) * time.Millisecond
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		prev = event.Timestamp
+
+		switch event.Type {
+		case sdk.EventTextUpdate, sdk.EventCellUpdate, sdk.EventElementAdd:
+			if _, err := client.SendEdit(ctx, event.Type, event.Payload); err != nil {
+				return fmt.Errorf("replay %s: %w", event.Type, err)
+			}
+		default:
+			if err := client.Send(event.Type, event.Payload); err != nil {
+				return err
+			}
+		}
+		sent++
+	}
+
+	fmt.Fprintf(os.Stderr, "replayed %d events into %s, skipped %d\n", sent, roomID, skipped)
+	return nil
+}
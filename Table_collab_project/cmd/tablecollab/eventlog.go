@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/service/collaboration"
+	"table_collab/internal/storage/file"
+)
+
+// runLog печатает записи журнала событий комнаты в виде JSON lines: через
+// admin API или, с -dir, прямо из каталога журнала.
+func runLog(ctx context.Context, g *globals, args []string) error {
+	flags := flag.NewFlagSet("log", flag.ContinueOnError)
+	from := flags.Uint64("from", 0, "first offset to print")
+	limit := flags.Int("limit", 100, "max entries to print (0 with -dir: all)")
+	dir := flags.String("dir", "", "read the event log directory directly instead of the admin API")
+	roomID, err := roomArg(flags, args)
+	if err != nil {
+		return err
+	}
+
+	var entries []file.LogEntry
+	if *dir != "" {
+		entries, err = file.NewEventLog(*dir, false).Entries(roomID, *from, *limit)
+	} else {
+		query := url.Values{"from": {strconv.FormatUint(*from, 10)}, "limit": {strconv.Itoa(*limit)}}
+		err = g.adminGet(ctx, "/api/admin/rooms/"+url.PathEscape(roomID)+"/log?"+query.Encode(), &entries)
+	}
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuiltRoom — ответ rebuild, совпадает с форматом admin API.
+type rebuiltRoom struct {
+	RoomID string       `json:"room_id"`
+	Offset uint64       `json:"offset"`
+	Closed bool         `json:"closed"`
+	Room   *domain.Room `json:"room,omitempty"`
+}
+
+// runRebuild пересобирает состояние комнаты на заданном смещении журнала.
+// С -dir работает без сервера: удобно разбирать копию каталога журнала.
+func runRebuild(ctx context.Context, g *globals, args []string) error {
+	flags := flag.NewFlagSet("rebuild", flag.ContinueOnError)
+	offset := flags.Uint64("offset", 0, "offset to rebuild at (default: end of the log)")
+	dir := flags.String("dir", "", "read the event log directory directly instead of the admin API")
+	output := flags.String("o", "", "output file (default: stdout)")
+	roomID, err := roomArg(flags, args)
+	if err != nil {
+		return err
+	}
+
+	result := rebuiltRoom{RoomID: roomID}
+	if *dir != "" {
+		collab := collaboration.NewService()
+		result.Room, result.Offset, err = file.NewEventLog(*dir, false).Rebuild(roomID, *offset, collab.Replay)
+		result.Closed = err == nil && result.Room == nil
+	} else {
+		path := "/api/admin/rooms/" + url.PathEscape(roomID) + "/log/rebuild"
+		if *offset > 0 {
+			path += "?offset=" + strconv.FormatUint(*offset, 10)
+		}
+		err = g.adminGet(ctx, path, &result)
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "rebuilt %s at offset %d to %s\n", roomID, result.Offset, *output)
+	return nil
+}
+
+// adminGet выполняет GET к admin API и разбирает JSON-ответ в out.
+func (g *globals) adminGet(ctx context.Context, path string, out interface{}) error {
+	if g.token == "" {
+		return errors.New("admin API calls need the admin token (-token or TABLECOLLAB_TOKEN)")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(g.server, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.token)
+	req.Header.Set("X-Admin-User", g.username)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
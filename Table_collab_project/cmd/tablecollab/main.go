@@ -0,0 +1,126 @@
+// Команда tablecollab — консольный клиент TableCollab для отладки комнат:
+//
+//	tablecollab rooms                      список комнат (admin API)
+//	tablecollab tail ROOM                  события комнаты в виде JSON lines
+//	tablecollab send chat|text|cell ROOM   отправка из stdin
+//	tablecollab export ROOM                состояние комнаты в файл
+//	tablecollab replay ROOM                воспроизведение записанного tail
+//	tablecollab log ROOM                   записи журнала событий комнаты
+//	tablecollab rebuild [-offset N] ROOM   состояние комнаты на смещении журнала
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	sdk "table_collab/pkg/websocket"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, g *globals, args []string) error
+}
+
+var commands = []command{
+	{"rooms", "rooms", runRooms},
+	{"tail", "tail [-type t1,t2] ROOM", runTail},
+	{"send", "send chat|text|cell ROOM < input", runSend},
+	{"export", "export [-o file] ROOM", runExport},
+	{"replay", "replay [-i file] [-speed x] ROOM", runReplay},
+	{"log", "log [-from offset] [-limit n] [-dir path] ROOM", runLog},
+	{"rebuild", "rebuild [-offset n] [-dir path] [-o file] ROOM", runRebuild},
+}
+
+// globals — общие флаги всех подкоманд.
+type globals struct {
+	server   string
+	token    string
+	username string
+	timeout  time.Duration
+}
+
+func main() {
+	g := &globals{}
+
+	flags := flag.NewFlagSet("tablecollab", flag.ExitOnError)
+	flags.StringVar(&g.server, "server", envOr("TABLECOLLAB_SERVER", "http://localhost:8080"), "server URL")
+	flags.StringVar(&g.token, "token", os.Getenv("TABLECOLLAB_TOKEN"), "admin token for REST calls")
+	flags.StringVar(&g.username, "user", envOr("TABLECOLLAB_USER", "cli"), "username shown to other participants")
+	flags.DurationVar(&g.timeout, "timeout", 10*time.Second, "connect and request timeout")
+	flags.Usage = func() { usage(flags) }
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		usage(flags)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	name := flags.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(ctx, g, flags.Args()[1:]); err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Fprintf(os.Stderr, "tablecollab %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+	usage(flags)
+	os.Exit(2)
+}
+
+func usage(flags *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, "Usage: tablecollab [flags] COMMAND [args]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %s\n", cmd.usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nFlags:")
+	flags.PrintDefaults()
+}
+
+// dial подключается к комнате от имени пользователя CLI.
+func (g *globals) dial(ctx context.Context, roomID string, reconnect bool) (*sdk.Client, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+
+	return sdk.Dial(dialCtx, sdk.Options{
+		URL:         g.server,
+		RoomID:      roomID,
+		Username:    g.username,
+		Token:       g.token,
+		Reconnect:   reconnect,
+		EventBuffer: 1024,
+	})
+}
+
+// roomArg разбирает флаги подкоманды и возвращает единственный аргумент — комнату.
+func roomArg(flags *flag.FlagSet, args []string) (string, error) {
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+	if flags.NArg() != 1 {
+		return "", errors.New("expected exactly one room id")
+	}
+	return flags.Arg(0), nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
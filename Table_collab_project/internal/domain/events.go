@@ -1,5 +1,7 @@
 package domain
 
+import "encoding/json"
+
 type EventType string
 
 const (
@@ -8,11 +10,56 @@ const (
 	EventCursorMove  EventType = "cursor_move"
 	EventTextUpdate  EventType = "text_update"
 	EventElementAdd  EventType = "element_add"
+	EventCellUpdate  EventType = "cell_update"
 	EventChatMessage EventType = "chat_message"
 	EventError       EventType = "error"
 	EventSync        EventType = "sync"
+	EventSystem      EventType = "system_message"
+	EventSession     EventType = "session"
+	EventAck         EventType = "ack"
+	EventNack        EventType = "nack"
+	EventConnected   EventType = "connected"
+	EventClose       EventType = "close"
+
+	EventCommentAdd     EventType = "comment_add"
+	EventCommentReply   EventType = "comment_reply"
+	EventCommentResolve EventType = "comment_resolve"
+	EventCommentThread  EventType = "comment_thread"
+	EventCommentAnchors EventType = "comment_anchors"
+
+	EventLockAcquire  EventType = "lock_acquire"
+	EventLockRelease  EventType = "lock_release"
+	EventLockAcquired EventType = "lock_acquired"
+	EventLockReleased EventType = "lock_released"
+
+	EventSheetAdd       EventType = "sheet_add"
+	EventSheetRename    EventType = "sheet_rename"
+	EventSheetMove      EventType = "sheet_move"
+	EventSheetDuplicate EventType = "sheet_duplicate"
+	EventSheetDelete    EventType = "sheet_delete"
+	EventColumnUpdate   EventType = "column_update"
+	EventSheetView      EventType = "sheet_view"
+	EventCellsComputed  EventType = "cells_computed"
+
+	EventViewSave    EventType = "view_save"
+	EventViewDelete  EventType = "view_delete"
+	EventViewUpdated EventType = "view_updated"
+	EventViewRows    EventType = "view_rows"
+
+	// Вложения загружаются и удаляются через REST API, клиенты получают
+	// только эти события
+	EventAttachmentAdded   EventType = "attachment_added"
+	EventAttachmentRemoved EventType = "attachment_removed"
+
+	// События жизненного цикла комнаты существуют только в журнале событий,
+	// клиентам они не рассылаются.
+	EventRoomCreated EventType = "room_created"
+	EventRoomUpdated EventType = "room_updated"
+	EventRoomClosed  EventType = "room_closed"
 )
 
+const SystemUserID = "system"
+
 type Event struct {
 	Type      EventType   `json:"type"`
 	RoomID    string      `json:"room_id,omitempty"`
@@ -20,14 +67,228 @@ type Event struct {
 	Payload   interface{} `json:"payload,omitempty"`
 	Timestamp int64       `json:"timestamp"`
 	Version   int         `json:"version,omitempty"`
+	Seq       uint64      `json:"seq,omitempty"`
+	OpID      string      `json:"op_id,omitempty"`
+	// Контекст трассировки W3C. Клиент может передать его, чтобы правка
+	// продолжила его трассу; в исходящих событиях сервер указывает свой спан.
+	TraceParent string `json:"traceparent,omitempty"`
+	TraceState  string `json:"tracestate,omitempty"`
 }
 
 type JoinRoomPayload struct {
-	Username string `json:"username"`
-	Color    string `json:"color,omitempty"`
+	Username string   `json:"username"`
+	Color    string   `json:"color,omitempty"`
+	RoomType RoomType `json:"room_type,omitempty"`
+}
+
+// DecodePayload разбирает Payload события (после ReadJSON это map) в типизированную структуру.
+func DecodePayload(event Event, v interface{}) error {
+	data, err := json.Marshal(event.Payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// CellUpdatePayload — изменение ячейки таблицы по адресу вида "B3". Пустой
+// SheetID — первый лист; в рассылке сервер всегда указывает лист явно.
+type CellUpdatePayload struct {
+	SheetID string `json:"sheet_id,omitempty"`
+	Cell    string `json:"cell"`
+	Value   string `json:"value"`
 }
 
 type TextUpdatePayload struct {
 	Text    string `json:"text"`
 	Version int    `json:"version"`
 }
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type SystemMessagePayload struct {
+	Text string `json:"text"`
+}
+
+type SessionPayload struct {
+	ClientID     string `json:"client_id"`
+	ResumeToken  string `json:"resume_token"`
+	GraceSeconds int    `json:"grace_seconds"`
+	Resumed      bool   `json:"resumed"`
+	LastSeq      uint64 `json:"last_seq"`
+}
+
+type AckPayload struct {
+	OpID    string `json:"op_id,omitempty"`
+	Version int    `json:"version"`
+}
+
+type NackPayload struct {
+	OpID   string `json:"op_id,omitempty"`
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+	// Для code "validation_failed": ячейка и нарушенное правило столбца
+	Cell string `json:"cell,omitempty"`
+	Rule string `json:"rule,omitempty"`
+}
+
+type Participant struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Color    string `json:"color"`
+	// Лист, который участник сейчас смотрит (только в табличных комнатах)
+	Sheet string `json:"sheet,omitempty"`
+}
+
+type SyncPayload struct {
+	Name         string                 `json:"name"`
+	Type         RoomType               `json:"type"`
+	Content      string                 `json:"content"`
+	Table        map[string]interface{} `json:"table,omitempty"`
+	Sheets       []*Sheet               `json:"sheets,omitempty"`
+	Version      int                    `json:"version"`
+	ReadOnly     bool                   `json:"read_only"`
+	Spectator    bool                   `json:"spectator,omitempty"`
+	Participants []Participant          `json:"participants"`
+	Comments     []*CommentThread       `json:"comments,omitempty"`
+	Views        []*View                `json:"views,omitempty"`
+	Attachments  []*Attachment          `json:"attachments,omitempty"`
+	Locks        []Lock                 `json:"locks,omitempty"`
+	Origin       *RoomOrigin            `json:"origin,omitempty"`
+}
+
+type ClosePayload struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// CommentAddPayload открывает новую ветку комментариев.
+type CommentAddPayload struct {
+	Anchor CommentAnchor `json:"anchor"`
+	Text   string        `json:"text"`
+}
+
+type CommentReplyPayload struct {
+	ThreadID string `json:"thread_id"`
+	Text     string `json:"text"`
+}
+
+type CommentResolvePayload struct {
+	ThreadID string `json:"thread_id"`
+	Resolved bool   `json:"resolved"`
+}
+
+// CommentAnchorsPayload — новые позиции веток, сдвинутых правкой текста.
+type CommentAnchorsPayload struct {
+	Anchors map[string]CommentAnchor `json:"anchors"`
+}
+
+// LockAcquirePayload запрашивает блокировку области. Повторный запрос той же
+// области её владельцем продлевает блокировку.
+type LockAcquirePayload struct {
+	Region LockRegion `json:"region"`
+}
+
+type LockReleasePayload struct {
+	LockID string `json:"lock_id"`
+}
+
+// Причины снятия блокировки.
+const (
+	LockReasonReleased     = "released"
+	LockReasonExpired      = "expired"
+	LockReasonDisconnected = "disconnected"
+	LockReasonSheetDeleted = "sheet_deleted"
+)
+
+type LockReleasedPayload struct {
+	LockID  string `json:"lock_id"`
+	OwnerID string `json:"owner_id"`
+	Reason  string `json:"reason"`
+}
+
+// RoomCreatedPayload — начальное состояние комнаты в журнале событий.
+type RoomCreatedPayload struct {
+	Room *Room `json:"room"`
+}
+
+// RoomUpdatedPayload — изменение настроек комнаты администратором.
+type RoomUpdatedPayload struct {
+	ReadOnly bool `json:"read_only"`
+}
+
+type RoomClosedPayload struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// SheetAddPayload добавляет пустой лист на позицию Index (nil — в конец).
+// Пустой SheetID назначает сервер, пустое Name — свободное "SheetN".
+type SheetAddPayload struct {
+	SheetID string `json:"sheet_id,omitempty"`
+	Name    string `json:"name"`
+	Index   *int   `json:"index,omitempty"`
+}
+
+type SheetRenamePayload struct {
+	SheetID string `json:"sheet_id"`
+	Name    string `json:"name"`
+}
+
+// SheetMovePayload переставляет лист на позицию Index (с нуля).
+type SheetMovePayload struct {
+	SheetID string `json:"sheet_id"`
+	Index   int    `json:"index"`
+}
+
+// SheetDuplicatePayload копирует лист SheetID сразу за ним. Пустой NewSheetID
+// назначает сервер, пустое Name — "<имя> (copy)".
+type SheetDuplicatePayload struct {
+	SheetID    string `json:"sheet_id"`
+	NewSheetID string `json:"new_sheet_id,omitempty"`
+	Name       string `json:"name,omitempty"`
+}
+
+type SheetDeletePayload struct {
+	SheetID string `json:"sheet_id"`
+}
+
+// ColumnUpdatePayload заменяет настройки столбца Column ("C") листа.
+type ColumnUpdatePayload struct {
+	SheetID  string `json:"sheet_id"`
+	Column   string `json:"column"`
+	Settings Column `json:"settings"`
+}
+
+// SheetViewPayload сообщает, какой лист смотрит участник.
+type SheetViewPayload struct {
+	SheetID string `json:"sheet_id"`
+}
+
+// CellsComputedPayload — новые значения формул по листам: sheet_id → ячейка →
+// значение. Пустое значение означает, что формулы в ячейке больше нет.
+type CellsComputedPayload struct {
+	Values map[string]map[string]string `json:"values"`
+}
+
+// ViewSavePayload создаёт представление (пустой ID) или заменяет существующее.
+// Вычисляемые поля View, Owner и OwnerID сервер заполняет сам.
+type ViewSavePayload struct {
+	View View `json:"view"`
+}
+
+type ViewDeletePayload struct {
+	ViewID string `json:"view_id"`
+}
+
+// ViewRowsPayload — новый порядок строк представления после правки ячеек.
+type ViewRowsPayload struct {
+	ViewID string      `json:"view_id"`
+	Rows   []int       `json:"rows"`
+	Groups []ViewGroup `json:"groups,omitempty"`
+}
+
+type AttachmentRemovedPayload struct {
+	AttachmentID string `json:"attachment_id"`
+}
@@ -11,18 +11,279 @@ const (
 )
 
 type Room struct {
-	ID          string
-	Name        string
-	Type        RoomType
-	OwnerID     string
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	IsActive    bool
-	MaxClients  int
-	ClientCount int
-	Content     string
-	Version     int
-	TableData   map[string]interface{}
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Type        RoomType               `json:"type"`
+	OwnerID     string                 `json:"owner_id,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+	IsActive    bool                   `json:"is_active"`
+	MaxClients  int                    `json:"max_clients"`
+	ClientCount int                    `json:"client_count"`
+	ReadOnly    bool                   `json:"read_only"`
+	Content     string                 `json:"content"`
+	Version     int                    `json:"version"`
+	TableData   map[string]interface{} `json:"table_data,omitempty"`
+	Sheets      []*Sheet               `json:"sheets,omitempty"`
+	Comments    []*CommentThread       `json:"comments,omitempty"`
+	Views       []*View                `json:"views,omitempty"`
+	Attachments []*Attachment          `json:"attachments,omitempty"`
+	Origin      *RoomOrigin            `json:"origin,omitempty"`
+	// Зрители по ссылкам share: не входят в ClientCount и не сохраняются
+	SpectatorCount int `json:"-"`
+	// Граф зависимостей формул; ведёт пакет collaboration, не сохраняется
+	Formulas interface{} `json:"-"`
+}
+
+// Sheet — лист табличной комнаты. Cells хранит введённые значения по адресам
+// ("B3"), формулы начинаются с "="; Values — вычисленные значения формул.
+type Sheet struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Cells   map[string]string `json:"cells,omitempty"`
+	Values  map[string]string `json:"values,omitempty"`
+	Columns map[string]Column `json:"columns,omitempty"`
+}
+
+// Column — настройки столбца листа; ключ в Sheet.Columns — буква столбца ("C").
+// Type и Rules задают схему: сервер проверяет по ним каждую правку ячейки.
+type Column struct {
+	Title  string      `json:"title,omitempty"`
+	Width  int         `json:"width,omitempty"`
+	Hidden bool        `json:"hidden,omitempty"`
+	Type   ColumnType  `json:"type,omitempty"`
+	Rules  ColumnRules `json:"rules,omitempty"`
+}
+
+// IsZero сообщает, что у столбца нет ни одной настройки.
+func (c Column) IsZero() bool {
+	return c.Title == "" && c.Width == 0 && !c.Hidden && c.Type == "" && c.Rules.IsZero()
+}
+
+// ColumnType — тип значений столбца; пустой тип равен ColumnText.
+type ColumnType string
+
+const (
+	ColumnText         ColumnType = "text"
+	ColumnNumber       ColumnType = "number"
+	ColumnDate         ColumnType = "date" // ГГГГ-ММ-ДД
+	ColumnCheckbox     ColumnType = "checkbox"
+	ColumnSingleSelect ColumnType = "single_select"
+	ColumnMultiSelect  ColumnType = "multi_select" // варианты через ", "
+	ColumnUser         ColumnType = "user"         // имя участника комнаты
+)
+
+// ColumnRules — правила проверки значений столбца. Min и Max зависят от типа:
+// число для number, дата для date, длина для text, число вариантов для
+// multi_select. Allowed — допустимые значения; для select-столбцов это список
+// вариантов, и он обязателен.
+type ColumnRules struct {
+	Required bool     `json:"required,omitempty"`
+	Min      string   `json:"min,omitempty"`
+	Max      string   `json:"max,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"`
+	Allowed  []string `json:"allowed,omitempty"`
+}
+
+func (r ColumnRules) IsZero() bool {
+	return !r.Required && r.Min == "" && r.Max == "" && r.Pattern == "" && len(r.Allowed) == 0
+}
+
+// Clone копирует лист вместе с ячейками и настройками столбцов.
+func (s *Sheet) Clone() *Sheet {
+	copied := *s
+	copied.Cells = cloneMap(s.Cells)
+	copied.Values = cloneMap(s.Values)
+	copied.Columns = cloneMap(s.Columns)
+	for key, column := range copied.Columns {
+		column.Rules.Allowed = append([]string(nil), column.Rules.Allowed...)
+		copied.Columns[key] = column
+	}
+	return &copied
+}
+
+func cloneMap[V any](m map[string]V) map[string]V {
+	if m == nil {
+		return nil
+	}
+	copied := make(map[string]V, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+	return copied
+}
+
+// View — сохранённое представление листа: сортировка, фильтр, скрытые столбцы
+// и группировка. Столбцы указываются буквами ("C"). Личное представление
+// (Private) видит и меняет только сессия автора OwnerID, а не любой, кто
+// назвался его именем Owner; общее видят все участники.
+type View struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	SheetID   string    `json:"sheet_id"`
+	Private   bool      `json:"private,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	OwnerID   string    `json:"owner_id,omitempty"`
+	Sort      []SortKey `json:"sort,omitempty"`
+	Filter    string    `json:"filter,omitempty"` // например: B > 10 AND C = "Open"
+	Hidden    []string  `json:"hidden,omitempty"`
+	GroupBy   string    `json:"group_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Вычисляет сервер: номера видимых строк по порядку и, при группировке,
+	// группы подряд идущих строк из Rows
+	Rows   []int       `json:"rows"`
+	Groups []ViewGroup `json:"groups,omitempty"`
+}
+
+type SortKey struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc,omitempty"`
+}
+
+// ViewGroup — Count строк подряд в View.Rows со значением Value в столбце группировки.
+type ViewGroup struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// VisibleTo сообщает, видит ли представление участник с таким ID. Личное
+// представление без автора не видит никто.
+func (v *View) VisibleTo(clientID string) bool {
+	return !v.Private || (v.OwnerID != "" && v.OwnerID == clientID)
+}
+
+// Clone копирует представление, чтобы отправлять его клиентам, не разделяя
+// память с комнатой.
+func (v *View) Clone() *View {
+	copied := *v
+	copied.Sort = append([]SortKey(nil), v.Sort...)
+	copied.Hidden = append([]string(nil), v.Hidden...)
+	copied.Rows = append([]int{}, v.Rows...)
+	copied.Groups = append([]ViewGroup(nil), v.Groups...)
+	return &copied
+}
+
+// RoomOrigin — откуда взялась комната: создана из шаблона или форком другой
+// комнаты на определённой версии.
+type RoomOrigin struct {
+	TemplateID string    `json:"template_id,omitempty"`
+	RoomID     string    `json:"room_id,omitempty"`
+	Version    int       `json:"version,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// RoomVersion — состояние содержимого комнаты на определённой версии.
+type RoomVersion struct {
+	Version   int                    `json:"version"`
+	Content   string                 `json:"content"`
+	TableData map[string]interface{} `json:"table_data,omitempty"`
+	Sheets    []*Sheet               `json:"sheets,omitempty"`
+	At        time.Time              `json:"at"`
+}
+
+// ShareLink — ссылка только для чтения: по Token к комнате подключаются
+// анонимные зрители.
+type ShareLink struct {
+	Token     string     `json:"token"`
+	RoomID    string     `json:"room_id"`
+	Label     string     `json:"label,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired сообщает, истёк ли срок действия ссылки к моменту now.
+func (l *ShareLink) Expired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// Attachment — файл, прикреплённый к комнате. Содержимое лежит в хранилище
+// под своим SHA-256, поэтому одинаковые файлы хранятся один раз; вложение
+// не меняется после загрузки.
+type Attachment struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Hash        string `json:"hash"`
+	// Размеры и хеш уменьшенной копии есть только у картинок
+	Width      int       `json:"width,omitempty"`
+	Height     int       `json:"height,omitempty"`
+	Thumbnail  string    `json:"thumbnail,omitempty"`
+	UploadedBy string    `json:"uploaded_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// RoomTemplate — заготовка комнаты. RoomName, Content и значения ячеек могут
+// содержать плейсхолдеры вида {{sprint}}, которые заполняются при создании
+// комнаты из шаблона.
+type RoomTemplate struct {
+	ID           string                 `json:"id"`
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description,omitempty"`
+	Type         RoomType               `json:"type"`
+	RoomName     string                 `json:"room_name"`
+	Content      string                 `json:"content"`
+	TableData    map[string]interface{} `json:"table_data,omitempty"`
+	Sheets       []*Sheet               `json:"sheets,omitempty"`
+	Placeholders []string               `json:"placeholders"`
+	SourceRoomID string                 `json:"source_room_id,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+// CommentAnchor привязывает ветку комментариев либо к ячейке таблицы (Cell на
+// листе Sheet; пустой Sheet — первый лист), либо к диапазону текста
+// [Start, End), считая в символах.
+type CommentAnchor struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Sheet string `json:"sheet,omitempty"`
+	Cell  string `json:"cell,omitempty"`
+}
+
+type Comment struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CommentThread — ветка обсуждения фрагмента комнаты: первый комментарий и ответы.
+type CommentThread struct {
+	ID         string        `json:"id"`
+	Anchor     CommentAnchor `json:"anchor"`
+	Comments   []Comment     `json:"comments"`
+	Resolved   bool          `json:"resolved"`
+	ResolvedBy string        `json:"resolved_by,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
+
+// Clone копирует ветку, чтобы отправлять её клиентам, не разделяя память с комнатой.
+func (t *CommentThread) Clone() *CommentThread {
+	copied := *t
+	copied.Comments = append([]Comment(nil), t.Comments...)
+	return &copied
+}
+
+// LockRegion — область мягкой блокировки: диапазон ячеек таблицы
+// ("B3", "A1:C5") на листе Sheet или фрагмент текста [Start, End), считая в символах.
+type LockRegion struct {
+	Sheet string `json:"sheet,omitempty"`
+	Range string `json:"range,omitempty"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// Lock — мягкая блокировка области участником на время редактирования.
+// Блокировки живут только в памяти и не попадают в снапшот.
+type Lock struct {
+	ID         string     `json:"id"`
+	OwnerID    string     `json:"owner_id"`
+	Username   string     `json:"username"`
+	Color      string     `json:"color,omitempty"`
+	Region     LockRegion `json:"region"`
+	AcquiredAt time.Time  `json:"acquired_at"`
 }
 
 type User struct {
@@ -38,3 +299,61 @@ type CursorPosition struct {
 	X float64 `json:"x"`
 	Y float64 `json:"y"`
 }
+
+type ClientInfo struct {
+	ID          string    `json:"id"`
+	RoomID      string    `json:"room_id"`
+	Username    string    `json:"username"`
+	Color       string    `json:"color"`
+	RemoteAddr  string    `json:"remote_addr"`
+	ConnectedAt time.Time `json:"connected_at"`
+	Muted       bool      `json:"muted"`
+	// Курсоры, отброшенные из-за переполнения очереди клиента
+	Dropped int `json:"dropped_cursors"`
+}
+
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`
+	RemoteAddr string    `json:"remote_addr"`
+	Action     string    `json:"action"`
+	RoomID     string    `json:"room_id,omitempty"`
+	ClientID   string    `json:"client_id,omitempty"`
+	Details    string    `json:"details,omitempty"`
+}
+
+// Webhook — подписка внешней системы на события комнат.
+// Пустой RoomID — все комнаты, пустой Events — все типы событий.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	RoomID    string    `json:"room_id,omitempty"`
+	Events    []string  `json:"events,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliveryRetrying  WebhookDeliveryStatus = "retrying"
+	DeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	DeliveryDead      WebhookDeliveryStatus = "dead"
+)
+
+type WebhookDelivery struct {
+	ID             string                `json:"id"`
+	WebhookID      string                `json:"webhook_id"`
+	EventID        string                `json:"event_id"`
+	Event          string                `json:"event"`
+	RoomID         string                `json:"room_id,omitempty"`
+	URL            string                `json:"url"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	LastStatusCode int                   `json:"last_status_code,omitempty"`
+	LastError      string                `json:"last_error,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+	NextAttemptAt  *time.Time            `json:"next_attempt_at,omitempty"`
+}
@@ -0,0 +1,94 @@
+// Package logging настраивает структурные логи сервера на log/slog: формат и
+// уровень по окружению, общие имена атрибутов и выборку частых событий.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"table_collab/cmd/server/config"
+)
+
+// Имена атрибутов, по которым логи связываются с запросом, комнатой и клиентом.
+const (
+	KeyRequestID = "request_id"
+	KeyRoom      = "room"
+	KeyClient    = "client"
+	KeyEvent     = "event"
+	KeyError     = "error"
+)
+
+// New создаёт логгер: JSON в production, читаемый текст в остальных
+// окружениях. Уровень берётся из cfg.LogLevel, а если он не задан — из
+// окружения.
+func New(cfg config.ServerConfig, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: Level(cfg)}
+	if IsProduction(cfg.Env) {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// Level разбирает cfg.LogLevel; неизвестное или пустое значение даёт уровень
+// по умолчанию для окружения.
+func Level(cfg config.ServerConfig) slog.Level {
+	var level slog.Level
+	if cfg.LogLevel != "" && level.UnmarshalText([]byte(cfg.LogLevel)) == nil {
+		return level
+	}
+	if IsProduction(cfg.Env) {
+		return slog.LevelInfo
+	}
+	return slog.LevelDebug
+}
+
+// FromContext возвращает логгер по умолчанию с ID запроса из ctx, если
+// middleware.RequestID его туда положил.
+func FromContext(ctx context.Context) *slog.Logger {
+	if id := middleware.GetReqID(ctx); id != "" {
+		return slog.Default().With(KeyRequestID, id)
+	}
+	return slog.Default()
+}
+
+// IsProduction сообщает, относится ли env к боевому окружению.
+func IsProduction(env string) bool {
+	switch strings.ToLower(env) {
+	case "production", "prod":
+		return true
+	default:
+		return false
+	}
+}
+
+// Err — атрибут с ошибкой.
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+// Sampler пропускает в лог одно событие из every. Безопасен для
+// одновременного использования.
+type Sampler struct {
+	every uint64
+	count atomic.Uint64
+}
+
+// NewSampler создаёт выборку; every <= 0 не пропускает ничего.
+func NewSampler(every int) *Sampler {
+	if every < 0 {
+		every = 0
+	}
+	return &Sampler{every: uint64(every)}
+}
+
+// Allow сообщает, нужно ли логировать очередное событие, и возвращает его
+// номер среди всех учтённых.
+func (s *Sampler) Allow() (uint64, bool) {
+	n := s.count.Add(1)
+	return n, s.every > 0 && (n-1)%s.every == 0
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"table_collab/cmd/server/config"
+)
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		cfg  config.ServerConfig
+		want slog.Level
+	}{
+		{config.ServerConfig{Env: "development"}, slog.LevelDebug},
+		{config.ServerConfig{Env: "Production"}, slog.LevelInfo},
+		{config.ServerConfig{Env: "prod", LogLevel: "warn"}, slog.LevelWarn},
+		{config.ServerConfig{Env: "development", LogLevel: "ERROR"}, slog.LevelError},
+		{config.ServerConfig{Env: "prod", LogLevel: "verbose"}, slog.LevelInfo},
+	}
+	for _, tt := range tests {
+		if got := Level(tt.cfg); got != tt.want {
+			t.Errorf("%+v: level = %s, want %s", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestNewFormat(t *testing.T) {
+	var buf bytes.Buffer
+	New(config.ServerConfig{Env: "production"}, &buf).Info("joined", KeyRoom, "r1")
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil || entry[KeyRoom] != "r1" {
+		t.Fatalf("production log %q: %v", buf.String(), err)
+	}
+
+	buf.Reset()
+	New(config.ServerConfig{Env: "development"}, &buf).Debug("joined", KeyRoom, "r1")
+	if !bytes.Contains(buf.Bytes(), []byte("room=r1")) {
+		t.Fatalf("development log %q", buf.String())
+	}
+}
+
+func TestSampler(t *testing.T) {
+	s := NewSampler(3)
+	var allowed []uint64
+	for i := 0; i < 7; i++ {
+		if n, ok := s.Allow(); ok {
+			allowed = append(allowed, n)
+		}
+	}
+	if len(allowed) != 3 || allowed[0] != 1 || allowed[1] != 4 || allowed[2] != 7 {
+		t.Fatalf("allowed = %v", allowed)
+	}
+
+	if _, ok := NewSampler(0).Allow(); ok {
+		t.Fatal("disabled sampler allowed an event")
+	}
+}
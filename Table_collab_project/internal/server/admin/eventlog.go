@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/storage/file"
+)
+
+const (
+	defaultLogLimit = 100
+	maxLogLimit     = 1000
+)
+
+func (h *Handler) eventLogRoutes(r chi.Router) {
+	r.Get("/", h.handleRoomLog)
+	r.Get("/rebuild", h.handleRebuildRoom)
+	r.Post("/compact", h.handleCompactLog)
+}
+
+// handleRoomLog отдаёт записи журнала комнаты: ?from=<offset>&limit=<n>.
+func (h *Handler) handleRoomLog(w http.ResponseWriter, r *http.Request) {
+	from, ok := parseOffset(w, r, "from")
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = defaultLogLimit
+	}
+	if limit > maxLogLimit {
+		limit = maxLogLimit
+	}
+
+	entries, err := h.hub.RoomLog(chi.URLParam(r, "roomID"), from, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if entries == nil {
+		entries = []file.LogEntry{}
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+type rebuildResponse struct {
+	RoomID string       `json:"room_id"`
+	Offset uint64       `json:"offset"`
+	Closed bool         `json:"closed"`
+	Room   *domain.Room `json:"room,omitempty"`
+}
+
+// handleRebuildRoom пересобирает комнату из журнала на смещении ?offset=
+// (без параметра — на последнем).
+func (h *Handler) handleRebuildRoom(w http.ResponseWriter, r *http.Request) {
+	offset, ok := parseOffset(w, r, "offset")
+	if !ok {
+		return
+	}
+
+	roomID := chi.URLParam(r, "roomID")
+	room, reached, err := h.hub.RebuildRoom(roomID, offset)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rebuildResponse{
+		RoomID: roomID,
+		Offset: reached,
+		Closed: room == nil,
+		Room:   room,
+	})
+}
+
+func (h *Handler) handleCompactLog(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	err := h.hub.CompactRoomLog(roomID)
+	h.record(r, "log_compact", roomID, "", "", err)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseOffset(w http.ResponseWriter, r *http.Request, name string) (uint64, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, true
+	}
+
+	offset, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": name + " must be a non-negative integer"})
+		return 0, false
+	}
+	return offset, true
+}
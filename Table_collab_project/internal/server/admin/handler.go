@@ -0,0 +1,297 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/logging"
+	"table_collab/internal/service"
+	"table_collab/internal/service/webhook"
+	"table_collab/internal/storage/file"
+	"table_collab/internal/storage/memory"
+)
+
+// Предельный размер JSON-тела запроса к admin API.
+const maxBodySize = 64 << 10
+
+type Handler struct {
+	hub   *service.Hub
+	audit *memory.AuditStore
+}
+
+func NewHandler(hub *service.Hub, audit *memory.AuditStore) *Handler {
+	return &Handler{hub: hub, audit: audit}
+}
+
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/rooms", h.handleListRooms)
+	r.Get("/rooms/{roomID}/clients", h.handleListClients)
+	r.Post("/rooms/{roomID}/clients/{clientID}/kick", h.handleKick)
+	r.Post("/rooms/{roomID}/clients/{clientID}/mute", h.handleMute(true))
+	r.Delete("/rooms/{roomID}/clients/{clientID}/mute", h.handleMute(false))
+	r.Post("/rooms/{roomID}/broadcast", h.handleBroadcast)
+	r.Post("/rooms/{roomID}/readonly", h.handleReadOnly(true))
+	r.Delete("/rooms/{roomID}/readonly", h.handleReadOnly(false))
+	r.Delete("/rooms/{roomID}", h.handleCloseRoom)
+	r.Route("/rooms/{roomID}/log", h.eventLogRoutes)
+	r.Route("/rooms/{roomID}/shares", h.shareRoutes)
+	r.Get("/audit", h.handleAudit)
+	r.Route("/webhooks", h.webhookRoutes)
+	r.Post("/uploads/cleanup", h.handleCleanupUploads)
+
+	return r
+}
+
+type roomResponse struct {
+	ID          string              `json:"id"`
+	Name        string              `json:"name"`
+	Type        domain.RoomType     `json:"type"`
+	ReadOnly    bool                `json:"read_only"`
+	ClientCount int                 `json:"client_count"`
+	Spectators  int                 `json:"spectator_count"` // зрители по ссылкам share
+	Version     int                 `json:"version"`
+	CreatedAt   time.Time           `json:"created_at"`
+	Origin      *domain.RoomOrigin  `json:"origin,omitempty"`
+	Clients     []domain.ClientInfo `json:"clients"`
+}
+
+func (h *Handler) handleListRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := h.hub.ListRooms()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	clients, err := h.hub.ListClients("")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	byRoom := make(map[string][]domain.ClientInfo)
+	for _, client := range clients {
+		byRoom[client.RoomID] = append(byRoom[client.RoomID], client)
+	}
+
+	response := make([]roomResponse, 0, len(rooms))
+	for _, room := range rooms {
+		response = append(response, roomResponse{
+			ID:          room.ID,
+			Name:        room.Name,
+			Type:        room.Type,
+			ReadOnly:    room.ReadOnly,
+			ClientCount: room.ClientCount,
+			Spectators:  room.SpectatorCount,
+			Version:     room.Version,
+			CreatedAt:   room.CreatedAt,
+			Origin:      room.Origin,
+			Clients:     byRoom[room.ID],
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) handleListClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.hub.ListClients(chi.URLParam(r, "roomID"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if clients == nil {
+		clients = []domain.ClientInfo{}
+	}
+
+	writeJSON(w, http.StatusOK, clients)
+}
+
+type reasonRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (h *Handler) handleKick(w http.ResponseWriter, r *http.Request) {
+	var req reasonRequest
+	if !decodeOptional(w, r, &req) {
+		return
+	}
+
+	roomID, clientID := chi.URLParam(r, "roomID"), chi.URLParam(r, "clientID")
+	err := h.hub.KickClient(roomID, clientID, req.Reason)
+	h.record(r, "kick", roomID, clientID, req.Reason, err)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleMute(muted bool) http.HandlerFunc {
+	action := "unmute"
+	if muted {
+		action = "mute"
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, clientID := chi.URLParam(r, "roomID"), chi.URLParam(r, "clientID")
+		err := h.hub.MuteClient(roomID, clientID, muted)
+		h.record(r, action, roomID, clientID, "", err)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type broadcastRequest struct {
+	Text string `json:"text"`
+}
+
+func (h *Handler) handleBroadcast(w http.ResponseWriter, r *http.Request) {
+	var req broadcastRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Text == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "text is required"})
+		return
+	}
+
+	roomID := chi.URLParam(r, "roomID")
+	err := h.hub.BroadcastSystem(roomID, req.Text)
+	h.record(r, "broadcast", roomID, "", req.Text, err)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleReadOnly(readOnly bool) http.HandlerFunc {
+	action := "read_write"
+	if readOnly {
+		action = "read_only"
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID := chi.URLParam(r, "roomID")
+		err := h.hub.SetReadOnly(roomID, readOnly)
+		h.record(r, action, roomID, "", "", err)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) handleCloseRoom(w http.ResponseWriter, r *http.Request) {
+	var req reasonRequest
+	if !decodeOptional(w, r, &req) {
+		return
+	}
+
+	roomID := chi.URLParam(r, "roomID")
+	err := h.hub.CloseRoom(roomID, req.Reason)
+	h.record(r, "close_room", roomID, "", req.Reason, err)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCleanupUploads сразу удаляет файлы, на которые не ссылается ни одна
+// комната, не дожидаясь очистки по таймеру.
+func (h *Handler) handleCleanupUploads(w http.ResponseWriter, r *http.Request) {
+	removed, err := h.hub.CleanupAttachments()
+	h.record(r, "uploads_cleanup", "", "", strconv.Itoa(removed)+" removed", err)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"removed": removed})
+}
+
+func (h *Handler) handleAudit(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	writeJSON(w, http.StatusOK, h.audit.List(limit))
+}
+
+func (h *Handler) record(r *http.Request, action, roomID, clientID, details string, err error) {
+	if err != nil {
+		details = "failed: " + err.Error()
+	}
+
+	actor := r.Header.Get("X-Admin-User")
+	if actor == "" {
+		actor = "admin"
+	}
+
+	entry := domain.AuditEntry{
+		Time:       time.Now(),
+		Actor:      actor,
+		RemoteAddr: r.RemoteAddr,
+		Action:     action,
+		RoomID:     roomID,
+		ClientID:   clientID,
+		Details:    details,
+	}
+	h.audit.Append(entry)
+
+	logging.FromContext(r.Context()).Info("Audit",
+		"actor", entry.Actor, "remote", entry.RemoteAddr, "action", entry.Action,
+		logging.KeyRoom, entry.RoomID, logging.KeyClient, entry.ClientID, "details", entry.Details)
+}
+
+// decodeOptional разбирает тело запроса, если оно есть.
+func decodeOptional(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrClientNotFound), errors.Is(err, service.ErrRoomNotFound),
+		errors.Is(err, webhook.ErrWebhookNotFound), errors.Is(err, webhook.ErrDeliveryNotFound),
+		errors.Is(err, service.ErrShareNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, file.ErrLogNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, webhook.ErrInvalidWebhook), errors.Is(err, file.ErrOffsetOutOfRange):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrTooManyShares):
+		status = http.StatusConflict
+	case errors.Is(err, file.ErrOffsetCompacted):
+		status = http.StatusGone
+	case errors.Is(err, service.ErrEventLogDisabled), errors.Is(err, service.ErrUploadsDisabled):
+		status = http.StatusNotImplemented
+	case errors.Is(err, service.ErrHubStopped):
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,87 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"table_collab/internal/domain"
+)
+
+func (h *Handler) shareRoutes(r chi.Router) {
+	r.Get("/", h.handleListShares)
+	r.Post("/", h.handleCreateShare)
+	r.Delete("/{token}", h.handleRevokeShare)
+}
+
+func (h *Handler) handleListShares(w http.ResponseWriter, r *http.Request) {
+	links, err := h.hub.ListShares(chi.URLParam(r, "roomID"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if links == nil {
+		writeJSON(w, http.StatusOK, []struct{}{})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, links)
+}
+
+type shareRequest struct {
+	Label string `json:"label"`
+	// 0 — бессрочная ссылка
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+// shareResponse — созданная ссылка и адреса, по которым подключаются зрители.
+// ID комнаты в адресах нет: зная его, можно войти участником.
+type shareResponse struct {
+	domain.ShareLink
+	WebSocket string `json:"websocket"`
+	SSE       string `json:"sse"`
+	LongPoll  string `json:"long_poll"`
+}
+
+// handleCreateShare создаёт ссылку только для чтения: зрители подключаются по
+// /ws/share/<token> и таким же адресам SSE и long-polling.
+func (h *Handler) handleCreateShare(w http.ResponseWriter, r *http.Request) {
+	var req shareRequest
+	if !decodeOptional(w, r, &req) {
+		return
+	}
+	if req.TTLSeconds < 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ttl_seconds must not be negative"})
+		return
+	}
+
+	roomID := chi.URLParam(r, "roomID")
+	link, err := h.hub.CreateShare(roomID, req.Label, time.Duration(req.TTLSeconds)*time.Second)
+	h.record(r, "share_create", roomID, "", req.Label, err)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, shareResponse{
+		ShareLink: link,
+		WebSocket: "/ws/share/" + link.Token,
+		SSE:       "/sse/share/" + link.Token,
+		LongPoll:  "/poll/share/" + link.Token,
+	})
+}
+
+func (h *Handler) handleRevokeShare(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	token := chi.URLParam(r, "token")
+	err := h.hub.RevokeShare(roomID, token)
+	// Токен даёт доступ к комнате, поэтому в аудит попадает только его начало
+	h.record(r, "share_revoke", roomID, "", token[:min(len(token), 8)], err)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
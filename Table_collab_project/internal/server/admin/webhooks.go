@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"table_collab/internal/domain"
+)
+
+func (h *Handler) webhookRoutes(r chi.Router) {
+	r.Get("/", h.handleListWebhooks)
+	r.Post("/", h.handleCreateWebhook)
+	r.Delete("/{webhookID}", h.handleDeleteWebhook)
+	r.Get("/deliveries", h.handleDeliveries)
+	r.Get("/dead-letters", h.handleDeadLetters)
+	r.Post("/dead-letters/{deliveryID}/retry", h.handleRedeliver)
+}
+
+func (h *Handler) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.hub.Webhooks().List())
+}
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	RoomID string   `json:"room_id"`
+	Events []string `json:"events"`
+}
+
+// handleCreateWebhook возвращает подписку вместе с секретом — больше его
+// через API получить нельзя.
+func (h *Handler) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+		return
+	}
+
+	webhook, err := h.hub.Webhooks().Subscribe(domain.Webhook{
+		URL:    req.URL,
+		Secret: req.Secret,
+		RoomID: req.RoomID,
+		Events: req.Events,
+	})
+	h.record(r, "webhook_create", req.RoomID, "", req.URL, err)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, webhook)
+}
+
+func (h *Handler) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "webhookID")
+	err := h.hub.Webhooks().Unsubscribe(id)
+	h.record(r, "webhook_delete", "", "", id, err)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	writeJSON(w, http.StatusOK, h.hub.Webhooks().Deliveries(r.URL.Query().Get("webhook_id"), limit))
+}
+
+func (h *Handler) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	writeJSON(w, http.StatusOK, h.hub.Webhooks().DeadLetters(r.URL.Query().Get("webhook_id"), limit))
+}
+
+func (h *Handler) handleRedeliver(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "deliveryID")
+	delivery, err := h.hub.Webhooks().Redeliver(id)
+	h.record(r, "webhook_redeliver", delivery.RoomID, "", id, err)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, delivery)
+}
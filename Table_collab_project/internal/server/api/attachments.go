@@ -0,0 +1,143 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/service"
+)
+
+// Запас на заголовки частей multipart сверх предельного размера файла.
+const multipartOverhead = 64 << 10
+
+// SessionHeader несёт токен сессии участника (resume_token из события
+// session), от имени которого меняются вложения.
+const SessionHeader = "X-Session-Token"
+
+func (h *Handler) attachmentRoutes(r chi.Router) {
+	r.Get("/", h.handleListAttachments)
+	r.Post("/", h.handleUpload)
+	r.Get("/{attachmentID}", h.handleDownload(urlRoom, false))
+	r.Get("/{attachmentID}/thumbnail", h.handleDownload(urlRoom, true))
+	r.Delete("/{attachmentID}", h.handleRemoveAttachment)
+}
+
+func (h *Handler) handleListAttachments(w http.ResponseWriter, r *http.Request) {
+	attachments, err := h.hub.ListAttachments(chi.URLParam(r, "roomID"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if attachments == nil {
+		attachments = []domain.Attachment{}
+	}
+
+	writeJSON(w, http.StatusOK, attachments)
+}
+
+// handleUpload принимает multipart/form-data с частью file. Заголовок
+// X-Session-Token называет участника комнаты, который загружает файл; без него
+// загрузить может только администратор. Тело читается потоком, без временных
+// файлов.
+func (h *Handler) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if h.uploads.MaxSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.uploads.MaxSize+multipartOverhead)
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "multipart/form-data body is required"})
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if errors.As(err, new(*http.MaxBytesError)) {
+				writeError(w, err)
+			} else {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid multipart body"})
+			}
+			return
+		}
+
+		if part.FormName() == "file" {
+			attachment, err := h.hub.UploadAttachment(chi.URLParam(r, "roomID"), service.AttachmentUpload{
+				Name:    part.FileName(),
+				Session: r.Header.Get(SessionHeader),
+				Admin:   h.isAdmin(r),
+				Body:    part,
+			})
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusCreated, attachment)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": "file is required"})
+}
+
+// urlRoom берёт комнату из пути запроса.
+func urlRoom(r *http.Request) (string, error) {
+	return chi.URLParam(r, "roomID"), nil
+}
+
+// shareRoom находит комнату по токену ссылки share из пути запроса.
+func (h *Handler) shareRoom(r *http.Request) (string, error) {
+	return h.hub.ShareRoom(chi.URLParam(r, "token"))
+}
+
+// handleDownload отдаёт файл с типом, определённым при загрузке. Картинки
+// открываются в браузере, остальное скачивается: чужой HTML или PDF не должен
+// исполняться в контексте сервера. Комнату определяет room.
+func (h *Handler) handleDownload(room func(*http.Request) (string, error), thumbnail bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, err := room(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		attachment, content, err := h.hub.OpenAttachment(roomID, chi.URLParam(r, "attachmentID"), thumbnail)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		defer content.Close()
+
+		disposition := "attachment"
+		if strings.HasPrefix(attachment.ContentType, "image/") {
+			disposition = "inline"
+		}
+		w.Header().Set("Content-Type", attachment.ContentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Name}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// Содержимое по этому адресу не меняется: у вложения фиксированный хеш
+		w.Header().Set("ETag", `"`+attachment.Hash+`"`)
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+
+		http.ServeContent(w, r, "", attachment.CreatedAt, content)
+	}
+}
+
+// handleRemoveAttachment удаляет вложение от имени участника из заголовка
+// X-Session-Token или администратора.
+func (h *Handler) handleRemoveAttachment(w http.ResponseWriter, r *http.Request) {
+	roomID, id := chi.URLParam(r, "roomID"), chi.URLParam(r, "attachmentID")
+	if err := h.hub.RemoveAttachment(roomID, id, r.Header.Get(SessionHeader), h.isAdmin(r)); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,272 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+	"table_collab/internal/service"
+	"table_collab/internal/service/attachment"
+)
+
+// Handler — публичный REST API для работы с комнатами, шаблонами и вложениями.
+type Handler struct {
+	hub *service.Hub
+	// Токен администратора снимает ограничение поиска по комнатам
+	adminToken string
+	uploads    config.UploadConfig
+}
+
+func NewHandler(hub *service.Hub, cfg *config.Config) *Handler {
+	return &Handler{hub: hub, adminToken: cfg.Admin.Token, uploads: cfg.Uploads}
+}
+
+func (h *Handler) TemplateRoutes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/", h.handleListTemplates)
+	r.Post("/", h.handleCreateTemplate)
+	r.Get("/{templateID}", h.handleGetTemplate)
+	r.Delete("/{templateID}", h.handleDeleteTemplate)
+	r.Post("/{templateID}/rooms", h.handleCreateFromTemplate)
+
+	return r
+}
+
+func (h *Handler) RoomRoutes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/{roomID}/versions", h.handleListVersions)
+	r.Get("/{roomID}/versions/{version}", h.handleGetVersion)
+	r.Post("/{roomID}/fork", h.handleFork)
+	r.Route("/{roomID}/attachments", h.attachmentRoutes)
+
+	return r
+}
+
+// ShareRoutes отдаёт вложения зрителям по ссылке share: комната определяется
+// по токену, её ID зритель не знает.
+func (h *Handler) ShareRoutes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/{token}/attachments/{attachmentID}", h.handleDownload(h.shareRoom, false))
+	r.Get("/{token}/attachments/{attachmentID}/thumbnail", h.handleDownload(h.shareRoom, true))
+
+	return r
+}
+
+func (h *Handler) SearchRoutes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/", h.handleSearch)
+
+	return r
+}
+
+type templateRequest struct {
+	RoomID      string                 `json:"room_id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	RoomName    string                 `json:"room_name"`
+	Type        domain.RoomType        `json:"type"`
+	Content     string                 `json:"content"`
+	TableData   map[string]interface{} `json:"table_data"`
+	Sheets      []*domain.Sheet        `json:"sheets"`
+}
+
+func (h *Handler) handleListTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.hub.ListTemplates()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if templates == nil {
+		templates = []*domain.RoomTemplate{}
+	}
+
+	writeJSON(w, http.StatusOK, templates)
+}
+
+// handleCreateTemplate сохраняет комнату room_id как шаблон или создаёт шаблон
+// из переданного содержимого.
+func (h *Handler) handleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var req templateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+		return
+	}
+
+	template, err := h.hub.CreateTemplate(service.TemplateRequest(req))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, template)
+}
+
+func (h *Handler) handleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	template, err := h.hub.GetTemplate(chi.URLParam(r, "templateID"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, template)
+}
+
+func (h *Handler) handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	if err := h.hub.DeleteTemplate(chi.URLParam(r, "templateID")); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type newRoomRequest struct {
+	RoomID  string            `json:"room_id"`
+	Name    string            `json:"name"`
+	Values  map[string]string `json:"values"`
+	Version int               `json:"version"`
+}
+
+type roomResponse struct {
+	ID        string             `json:"id"`
+	Name      string             `json:"name"`
+	Type      domain.RoomType    `json:"type"`
+	Version   int                `json:"version"`
+	CreatedAt time.Time          `json:"created_at"`
+	Origin    *domain.RoomOrigin `json:"origin,omitempty"`
+	URL       string             `json:"url"`
+}
+
+func newRoomResponse(room *domain.Room) roomResponse {
+	return roomResponse{
+		ID:        room.ID,
+		Name:      room.Name,
+		Type:      room.Type,
+		Version:   room.Version,
+		CreatedAt: room.CreatedAt,
+		Origin:    room.Origin,
+		URL:       "/room/" + room.ID,
+	}
+}
+
+func (h *Handler) handleCreateFromTemplate(w http.ResponseWriter, r *http.Request) {
+	var req newRoomRequest
+	if !decodeOptional(w, r, &req) {
+		return
+	}
+
+	room, err := h.hub.CreateRoomFromTemplate(chi.URLParam(r, "templateID"), service.NewRoomRequest{
+		RoomID: req.RoomID,
+		Name:   req.Name,
+		Values: req.Values,
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newRoomResponse(room))
+}
+
+func (h *Handler) handleFork(w http.ResponseWriter, r *http.Request) {
+	var req newRoomRequest
+	if !decodeOptional(w, r, &req) {
+		return
+	}
+
+	room, err := h.hub.ForkRoom(chi.URLParam(r, "roomID"), service.NewRoomRequest{
+		RoomID:  req.RoomID,
+		Name:    req.Name,
+		Version: req.Version,
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newRoomResponse(room))
+}
+
+func (h *Handler) handleListVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := h.hub.RoomVersions(chi.URLParam(r, "roomID"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if versions == nil {
+		versions = []domain.RoomVersion{}
+	}
+
+	writeJSON(w, http.StatusOK, versions)
+}
+
+func (h *Handler) handleGetVersion(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "version must be a number"})
+		return
+	}
+
+	snapshot, err := h.hub.RoomVersion(chi.URLParam(r, "roomID"), version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrRoomNotFound), errors.Is(err, service.ErrTemplateNotFound),
+		errors.Is(err, service.ErrVersionNotAvailable):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidTemplate), errors.Is(err, service.ErrMissingPlaceholders),
+		errors.Is(err, service.ErrInvalidRoomID):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrAttachmentNotFound), errors.Is(err, service.ErrShareNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrRoomExists), errors.Is(err, service.ErrTooManyAttachments):
+		status = http.StatusConflict
+	case errors.Is(err, service.ErrRoomReadOnly), errors.Is(err, service.ErrMuted),
+		errors.Is(err, service.ErrNotParticipant):
+		status = http.StatusForbidden
+	case errors.Is(err, attachment.ErrTooLarge), errors.As(err, new(*http.MaxBytesError)):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, attachment.ErrType):
+		status = http.StatusUnsupportedMediaType
+	case errors.Is(err, service.ErrUploadsDisabled):
+		status = http.StatusNotImplemented
+	case errors.Is(err, service.ErrHubStopped):
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// decodeOptional разбирает тело запроса, если оно есть.
+func decodeOptional(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+		return false
+	}
+	return true
+}
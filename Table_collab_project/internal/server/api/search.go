@@ -0,0 +1,71 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"table_collab/internal/service/search"
+)
+
+type searchResponse struct {
+	Query string       `json:"query"`
+	Total int          `json:"total"`
+	Hits  []search.Hit `json:"hits"`
+}
+
+// handleSearch ищет по ?q= в комнатах ?rooms=a,b. Учётных записей нет:
+// доступ к комнате даёт знание её ID (по нему же подключаются к /ws), поэтому
+// поиск ограничен перечисленными комнатами. С токеном администратора rooms
+// можно не указывать — тогда поиск идёт по всем комнатам.
+func (h *Handler) handleSearch(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	text := strings.TrimSpace(params.Get("q"))
+	if text == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "q is required"})
+		return
+	}
+
+	query := search.Query{Text: text, Rooms: splitList(params.Get("rooms"))}
+	if query.Rooms == nil && !h.isAdmin(r) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "rooms is required"})
+		return
+	}
+
+	for _, kind := range splitList(params.Get("kind")) {
+		switch search.Kind(kind) {
+		case search.KindRoom, search.KindText, search.KindCell, search.KindChat:
+			query.Kinds = append(query.Kinds, search.Kind(kind))
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown kind " + strconv.Quote(kind)})
+			return
+		}
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be a positive integer"})
+			return
+		}
+		query.Limit = limit
+	}
+
+	result := h.hub.Search(query)
+	writeJSON(w, http.StatusOK, searchResponse{Query: text, Total: result.Total, Hits: result.Hits})
+}
+
+func (h *Handler) isAdmin(r *http.Request) bool {
+	provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return h.adminToken != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(h.adminToken)) == 1
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,277 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+	"table_collab/internal/server/api"
+)
+
+func withUploads(t *testing.T) func(*config.Config) {
+	dir := t.TempDir()
+	return func(cfg *config.Config) {
+		cfg.Admin.Token = "admin-token"
+		cfg.Uploads = config.UploadConfig{
+			Dir:           dir,
+			MaxSize:       64 << 10,
+			MaxPerRoom:    10,
+			AllowedTypes:  []string{"image/png", "text/plain"},
+			ThumbnailSize: 32,
+		}
+	}
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// upload отправляет файл multipart-формой от имени сессии session и
+// возвращает статус ответа.
+func upload(t *testing.T, ts *testServer, roomID, session, name string, content []byte) (domain.Attachment, int) {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", name)
+	part.Write(content)
+	form.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/rooms/"+roomID+"/attachments", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if session != "" {
+		req.Header.Set(api.SessionHeader, session)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var attachment domain.Attachment
+	if resp.StatusCode == http.StatusCreated {
+		if err := json.NewDecoder(resp.Body).Decode(&attachment); err != nil {
+			t.Fatalf("decode upload: %v", err)
+		}
+	}
+	return attachment, resp.StatusCode
+}
+
+// removeAttachment удаляет вложение от имени сессии session, без токена
+// администратора.
+func removeAttachment(t *testing.T, ts *testServer, roomID, id, session string) int {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/rooms/"+roomID+"/attachments/"+id, nil)
+	if session != "" {
+		req.Header.Set(api.SessionHeader, session)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func download(t *testing.T, ts *testServer, path string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	return resp, data
+}
+
+func TestAttachments(t *testing.T) {
+	ts := startServer(t, withUploads(t))
+
+	alice := joinTable(t, ts, "board", "alice")
+	picture := testPNG(t, 100, 50)
+
+	logo, status := upload(t, ts, "board", alice.token, "logo.png", picture)
+	if status != http.StatusCreated {
+		t.Fatalf("upload: status %d", status)
+	}
+	if logo.UploadedBy != "alice" || logo.ContentType != "image/png" || logo.Size != int64(len(picture)) ||
+		logo.Width != 100 || logo.Height != 50 || logo.Thumbnail == "" || logo.Thumbnail == logo.Hash {
+		t.Fatalf("uploaded %+v", logo)
+	}
+	var added domain.Attachment
+	alice.expect(domain.EventAttachmentAdded).decode(t, &added)
+	if added.ID != logo.ID || added.Hash != logo.Hash {
+		t.Fatalf("alice got %+v", added)
+	}
+
+	bob := joinTable(t, ts, "board", "bob")
+	if len(bob.sync.Attachments) != 1 || bob.sync.Attachments[0].ID != logo.ID {
+		t.Fatalf("bob sync attachments %+v", bob.sync.Attachments)
+	}
+
+	path := "/api/rooms/board/attachments/" + logo.ID
+	resp, data := download(t, ts, path, nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(data, picture) {
+		t.Fatalf("download: status %d, %d bytes", resp.StatusCode, len(data))
+	}
+	if resp.Header.Get("Content-Type") != "image/png" || resp.Header.Get("X-Content-Type-Options") != "nosniff" ||
+		resp.Header.Get("Content-Disposition") != `inline; filename=logo.png` {
+		t.Fatalf("download headers %v", resp.Header)
+	}
+	if again, _ := download(t, ts, path, http.Header{"If-None-Match": {resp.Header.Get("ETag")}}); again.StatusCode != http.StatusNotModified {
+		t.Fatalf("conditional download: status %d", again.StatusCode)
+	}
+
+	resp, data = download(t, ts, path+"/thumbnail", nil)
+	thumb, err := png.DecodeConfig(bytes.NewReader(data))
+	if resp.StatusCode != http.StatusOK || err != nil || thumb.Width != 32 || thumb.Height != 16 {
+		t.Fatalf("thumbnail: status %d, %dx%d, %v", resp.StatusCode, thumb.Width, thumb.Height, err)
+	}
+
+	// То же содержимое хранится один раз; путь в имени файла отбрасывается
+	copied, status := upload(t, ts, "board", bob.token, "../../copy.png", picture)
+	if status != http.StatusCreated || copied.Hash != logo.Hash || copied.Name != "copy.png" || copied.UploadedBy != "bob" {
+		t.Fatalf("second upload: status %d, %+v", status, copied)
+	}
+	bob.expect(domain.EventAttachmentAdded)
+
+	if _, status := upload(t, ts, "board", alice.token, "page.png", []byte("<html><script>alert(1)</script></html>")); status != http.StatusUnsupportedMediaType {
+		t.Fatalf("html upload: status %d", status)
+	}
+	if _, status := upload(t, ts, "board", alice.token, "big.txt", []byte(strings.Repeat("a", 65<<10))); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized upload: status %d", status)
+	}
+	if _, status := upload(t, ts, "missing", alice.token, "logo.png", picture); status != http.StatusNotFound {
+		t.Fatalf("upload to a missing room: status %d", status)
+	}
+
+	var listed []domain.Attachment
+	if status := ts.request(t, http.MethodGet, "/api/rooms/board/attachments", nil, &listed); status != http.StatusOK || len(listed) != 2 {
+		t.Fatalf("list: status %d, %+v", status, listed)
+	}
+
+	var cleanup struct {
+		Removed int `json:"removed"`
+	}
+	remove := func(id string) {
+		t.Helper()
+
+		if status := removeAttachment(t, ts, "board", id, bob.token); status != http.StatusNoContent {
+			t.Fatalf("remove %s: status %d", id, status)
+		}
+		var removed domain.AttachmentRemovedPayload
+		alice.expect(domain.EventAttachmentRemoved).decode(t, &removed)
+		if removed.AttachmentID != id {
+			t.Fatalf("alice got removal of %s, want %s", removed.AttachmentID, id)
+		}
+		if status := ts.request(t, http.MethodPost, "/api/admin/uploads/cleanup", nil, &cleanup); status != http.StatusOK {
+			t.Fatalf("cleanup: status %d", status)
+		}
+	}
+
+	// Пока на файл ссылается второе вложение, очистка его не трогает
+	remove(logo.ID)
+	if cleanup.Removed != 0 {
+		t.Fatalf("cleanup removed %d files still in use", cleanup.Removed)
+	}
+	if resp, _ := download(t, ts, "/api/rooms/board/attachments/"+copied.ID, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("download after removing the duplicate: status %d", resp.StatusCode)
+	}
+
+	remove(copied.ID)
+	if cleanup.Removed != 2 {
+		t.Fatalf("cleanup removed %d files, want the picture and its thumbnail", cleanup.Removed)
+	}
+	if resp, _ := download(t, ts, path, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("download after removal: status %d", resp.StatusCode)
+	}
+}
+
+// Загружать и удалять вложения могут только участники комнаты и
+// администратор: ни ID комнаты, ни ссылки share, ни публичного ID клиента для
+// этого недостаточно.
+func TestAttachmentPermissions(t *testing.T) {
+	ts := startServer(t, withUploads(t), withShares)
+
+	alice := joinTable(t, ts, "board", "alice")
+	mallory := joinTable(t, ts, "other", "mallory")
+	link := createShare(t, ts, "board")
+	viewer := spectate(t, ts, link)
+	picture := testPNG(t, 4, 4)
+
+	for _, session := range []string{"", "bogus", mallory.token, alice.id} {
+		if _, status := upload(t, ts, "board", session, "logo.png", picture); status != http.StatusForbidden {
+			t.Fatalf("upload as %q: status %d", session, status)
+		}
+	}
+
+	logo, status := upload(t, ts, "board", alice.token, "logo.png", picture)
+	if status != http.StatusCreated {
+		t.Fatalf("upload: status %d", status)
+	}
+	alice.expect(domain.EventAttachmentAdded)
+	viewer.expect(domain.EventAttachmentAdded)
+
+	// Зритель скачивает файл и миниатюру по токену ссылки, не зная ID комнаты
+	shared := "/api/shares/" + link.Token + "/attachments/" + logo.ID
+	if resp, data := download(t, ts, shared, nil); resp.StatusCode != http.StatusOK || !bytes.Equal(data, picture) {
+		t.Fatalf("download by share: status %d, %d bytes", resp.StatusCode, len(data))
+	}
+	if resp, _ := download(t, ts, shared+"/thumbnail", nil); resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("thumbnail by share: status %d", resp.StatusCode)
+	}
+	if resp, _ := download(t, ts, "/api/shares/bogus/attachments/"+logo.ID, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("download by an unknown share: status %d", resp.StatusCode)
+	}
+	if resp, _ := download(t, ts, "/api/shares/"+createShare(t, ts, "other").Token+"/attachments/"+logo.ID, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("download through another room's share: status %d", resp.StatusCode)
+	}
+
+	for _, session := range []string{"", "bogus", mallory.token, alice.id} {
+		if status := removeAttachment(t, ts, "board", logo.ID, session); status != http.StatusForbidden {
+			t.Fatalf("remove as %q: status %d", session, status)
+		}
+	}
+
+	// Администратору участник не нужен
+	if status := ts.request(t, http.MethodDelete, "/api/rooms/board/attachments/"+logo.ID, nil, nil); status != http.StatusNoContent {
+		t.Fatalf("admin remove: status %d", status)
+	}
+	alice.expect(domain.EventAttachmentRemoved)
+	viewer.expect(domain.EventAttachmentRemoved)
+}
+
+func TestUploadsDisabled(t *testing.T) {
+	ts := startServer(t)
+
+	alice := joinTable(t, ts, "board", "alice")
+	if _, status := upload(t, ts, "board", alice.token, "logo.png", testPNG(t, 4, 4)); status != http.StatusNotImplemented {
+		t.Fatalf("upload: status %d", status)
+	}
+}
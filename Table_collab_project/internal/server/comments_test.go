@@ -0,0 +1,121 @@
+package server_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+func expectThread(t *testing.T, c *testClient) (domain.CommentThread, event) {
+	t.Helper()
+
+	e := c.expect(domain.EventCommentThread)
+	var thread domain.CommentThread
+	e.decode(t, &thread)
+	return thread, e
+}
+
+func TestCommentThreads(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.join(t, "doc", "alice")
+	alice.send(domain.EventTextUpdate, domain.TextUpdatePayload{Text: "Hello world"}, "op-1")
+	alice.expect(domain.EventAck)
+
+	bob := ts.join(t, "doc", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	// Ветку получают все, автор — со своим op_id
+	alice.send(domain.EventCommentAdd, domain.CommentAddPayload{
+		Anchor: domain.CommentAnchor{Start: 6, End: 11},
+		Text:   "Which world?",
+	}, "c-1")
+	created, e := expectThread(t, alice)
+	if e.OpID != "c-1" || created.ID == "" || created.Anchor.Start != 6 || created.Comments[0].Username != "alice" {
+		t.Fatalf("alice got %+v (op_id %q)", created, e.OpID)
+	}
+	if got, _ := expectThread(t, bob); got.ID != created.ID {
+		t.Fatalf("bob got thread %s, want %s", got.ID, created.ID)
+	}
+
+	bob.send(domain.EventCommentReply, domain.CommentReplyPayload{ThreadID: created.ID, Text: "This one"}, "")
+	for _, c := range []*testClient{alice, bob} {
+		if got, _ := expectThread(t, c); len(got.Comments) != 2 || got.Comments[1].Username != "bob" {
+			t.Fatalf("reply: got %+v", got.Comments)
+		}
+	}
+
+	// Вставка перед якорем сдвигает его у всех, включая автора правки
+	alice.send(domain.EventTextUpdate, domain.TextUpdatePayload{Text: "Oh, Hello world"}, "op-2")
+	for _, c := range []*testClient{alice, bob} {
+		var moved domain.CommentAnchorsPayload
+		c.expect(domain.EventCommentAnchors).decode(t, &moved)
+		if anchor := moved.Anchors[created.ID]; anchor.Start != 10 || anchor.End != 15 {
+			t.Fatalf("moved anchor: %+v", moved.Anchors)
+		}
+	}
+
+	bob.send(domain.EventCommentResolve, domain.CommentResolvePayload{ThreadID: created.ID, Resolved: true}, "")
+	for _, c := range []*testClient{alice, bob} {
+		if got, _ := expectThread(t, c); !got.Resolved || got.ResolvedBy != bob.id {
+			t.Fatalf("resolve: got %+v", got)
+		}
+	}
+	alice.send(domain.EventCommentResolve, domain.CommentResolvePayload{ThreadID: created.ID, Resolved: false}, "")
+	if got, _ := expectThread(t, bob); got.Resolved || got.ResolvedBy != "" {
+		t.Fatalf("unresolve: got %+v", got)
+	}
+
+	// Новый участник получает ветки в sync
+	carol := ts.join(t, "doc", "carol")
+	if len(carol.sync.Comments) != 1 || carol.sync.Comments[0].Anchor.Start != 10 {
+		t.Fatalf("sync comments: %+v", carol.sync.Comments)
+	}
+
+	invalid := []struct {
+		eventType domain.EventType
+		payload   interface{}
+		code      string
+	}{
+		{domain.EventCommentAdd, domain.CommentAddPayload{Anchor: domain.CommentAnchor{Start: 5, End: 99}, Text: "x"}, "invalid_comment"},
+		{domain.EventCommentAdd, domain.CommentAddPayload{Anchor: domain.CommentAnchor{Cell: "A1"}, Text: "x"}, "invalid_comment"},
+		{domain.EventCommentAdd, domain.CommentAddPayload{Text: "   "}, "invalid_comment"},
+		{domain.EventCommentReply, domain.CommentReplyPayload{ThreadID: "missing", Text: "x"}, "thread_not_found"},
+	}
+	for _, tt := range invalid {
+		carol.send(tt.eventType, tt.payload, "")
+		var failure domain.ErrorPayload
+		carol.expect(domain.EventError).decode(t, &failure)
+		if failure.Code != tt.code {
+			t.Fatalf("%s %+v: got %+v, want %s", tt.eventType, tt.payload, failure, tt.code)
+		}
+	}
+}
+
+func TestCellCommentsArePersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rooms.json")
+	withSnapshots := func(cfg *config.Config) { cfg.App.SnapshotPath = path }
+
+	ts := startServer(t, withSnapshots)
+	alice := ts.dial(t, "sheet", "")
+	alice.send(domain.EventJoinRoom, domain.JoinRoomPayload{Username: "alice", RoomType: domain.RoomTypeTable}, "")
+	alice.expect(domain.EventSync)
+
+	alice.send(domain.EventCommentAdd, domain.CommentAddPayload{Anchor: domain.CommentAnchor{Cell: "b7"}, Text: "Check this total"}, "")
+	if thread, _ := expectThread(t, alice); thread.Anchor.Cell != "B7" {
+		t.Fatalf("cell anchor: %+v", thread.Anchor)
+	}
+
+	if err := ts.app.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	restarted := startServer(t, withSnapshots)
+	bob := restarted.join(t, "sheet", "bob")
+	if len(bob.sync.Comments) != 1 || bob.sync.Comments[0].Comments[0].Text != "Check this total" {
+		t.Fatalf("restored comments: %+v", bob.sync.Comments)
+	}
+}
@@ -0,0 +1,389 @@
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+func TestJoinNotifiesOthersAndSyncsParticipants(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.join(t, "room", "alice")
+	bob := ts.join(t, "room", "bob")
+
+	joined := alice.expect(domain.EventJoinRoom)
+	var payload domain.JoinRoomPayload
+	joined.decode(t, &payload)
+	if joined.UserID != bob.id || payload.Username != "bob" {
+		t.Fatalf("alice got join of %s (%q), want %s (bob)", joined.UserID, payload.Username, bob.id)
+	}
+
+	if len(bob.sync.Participants) != 2 {
+		t.Fatalf("bob's sync lists %d participants, want 2", len(bob.sync.Participants))
+	}
+}
+
+// Повторный join не меняет имя и тип комнаты: их читает Run, а под -race
+// запись из ReadPump рядом с входом других участников стала бы гонкой.
+func TestRepeatedJoinKeepsIdentity(t *testing.T) {
+	ts := startServer(t)
+
+	ts.join(t, "room", "alice")
+	bob := ts.join(t, "room", "bob")
+	for i := 0; i < 5; i++ {
+		bob.send(domain.EventJoinRoom, domain.JoinRoomPayload{Username: "mallory", RoomType: domain.RoomTypeTable}, "")
+		carol := ts.join(t, "room", "carol"+strconv.Itoa(i))
+		if carol.sync.Type != domain.RoomTypeDocument {
+			t.Fatalf("room type changed to %s", carol.sync.Type)
+		}
+		for _, p := range carol.sync.Participants {
+			if p.ID == bob.id && p.Username != "bob" {
+				t.Fatalf("bob is listed as %q", p.Username)
+			}
+		}
+	}
+}
+
+func TestLeaveNotifiesRoom(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.join(t, "room", "alice")
+	bob := ts.join(t, "room", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	bob.leave()
+
+	if left := alice.expect(domain.EventLeaveRoom); left.UserID != bob.id {
+		t.Fatalf("leave_room for %s, want %s", left.UserID, bob.id)
+	}
+}
+
+func TestBroadcastStaysInRoom(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.join(t, "first", "alice")
+	bob := ts.join(t, "first", "bob")
+	carol := ts.join(t, "second", "carol")
+	dave := ts.join(t, "second", "dave")
+	alice.expect(domain.EventJoinRoom)
+	carol.expect(domain.EventJoinRoom)
+
+	alice.chat("hello first")
+	dave.chat("hello second")
+
+	if got := bob.expect(domain.EventChatMessage); got.UserID != alice.id {
+		t.Fatalf("bob got chat from %s, want %s", got.UserID, alice.id)
+	}
+	// Следующее событие carol — чат своей комнаты, а не чужой
+	if got := carol.next(); got.Type != domain.EventChatMessage || got.UserID != dave.id {
+		t.Fatalf("carol got %s from %s, want chat from %s", got.Type, got.UserID, dave.id)
+	}
+}
+
+func TestSenderDoesNotReceiveOwnBroadcast(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.join(t, "room", "alice")
+	bob := ts.join(t, "room", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	alice.chat("one")
+	bob.expect(domain.EventChatMessage)
+	bob.chat("two")
+
+	if got := alice.next(); got.Type != domain.EventChatMessage || got.UserID != bob.id {
+		t.Fatalf("alice got %s from %s, want bob's chat", got.Type, got.UserID)
+	}
+}
+
+func TestMessagesArriveInSendOrder(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.join(t, "room", "alice")
+	bob := ts.join(t, "room", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	const count = 200
+	for i := 0; i < count; i++ {
+		alice.chat(strconv.Itoa(i))
+	}
+
+	for i := 0; i < count; i++ {
+		var payload struct{ Text string }
+		bob.expect(domain.EventChatMessage).decode(t, &payload)
+		if payload.Text != strconv.Itoa(i) {
+			t.Fatalf("message %d arrived as %q", i, payload.Text)
+		}
+	}
+}
+
+// Выход идёт через ту же очередь, что и сообщения, поэтому сообщения,
+// отправленные перед закрытием соединения, не теряются.
+func TestMessagesBeforeLeaveAreDelivered(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.join(t, "room", "alice")
+
+	const count = 50
+	for i := 0; i < 5; i++ {
+		bob := ts.join(t, "room", "bob")
+		alice.expect(domain.EventJoinRoom)
+
+		for m := 0; m < count; m++ {
+			bob.chat(strconv.Itoa(m))
+		}
+		bob.leave()
+
+		for m := 0; m < count; m++ {
+			if got := alice.next(); got.Type != domain.EventChatMessage {
+				t.Fatalf("iteration %d: got %s after %d of %d messages", i, got.Type, m, count)
+			}
+		}
+		if got := alice.next(); got.Type != domain.EventLeaveRoom || got.UserID != bob.id {
+			t.Fatalf("iteration %d: got %s, want leave_room of %s", i, got.Type, bob.id)
+		}
+	}
+}
+
+func TestMessageBeforeJoinIsRejected(t *testing.T) {
+	ts := startServer(t)
+
+	c := ts.dial(t, "room", "")
+	c.chat("too early")
+
+	var payload domain.ErrorPayload
+	c.expect(domain.EventError).decode(t, &payload)
+	if payload.Code != "not_joined" {
+		t.Fatalf("error code %q, want not_joined", payload.Code)
+	}
+}
+
+func TestEditAckIsIdempotent(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.join(t, "room", "alice")
+	bob := ts.join(t, "room", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	edit := domain.TextUpdatePayload{Text: "draft"}
+	alice.send(domain.EventTextUpdate, edit, "op-1")
+	alice.send(domain.EventTextUpdate, edit, "op-1")
+
+	var first, second domain.AckPayload
+	alice.expect(domain.EventAck).decode(t, &first)
+	alice.expect(domain.EventAck).decode(t, &second)
+	if first != second || first.OpID != "op-1" {
+		t.Fatalf("retry got a different ack: %+v then %+v", first, second)
+	}
+
+	update := bob.expect(domain.EventTextUpdate)
+	if update.Version != first.Version {
+		t.Fatalf("broadcast version %d, ack version %d", update.Version, first.Version)
+	}
+
+	// Повтор не разослан второй раз: после правки bob получает сразу чат
+	alice.chat("done")
+	if got := bob.next(); got.Type != domain.EventChatMessage {
+		t.Fatalf("bob got %s, want only one text_update", got.Type)
+	}
+}
+
+func TestRetryAfterTransientNack(t *testing.T) {
+	ts := startServer(t)
+
+	alice := joinTable(t, ts, "sheet", "alice")
+	bob := joinTable(t, ts, "sheet", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	alice.send(domain.EventLockAcquire, domain.LockAcquirePayload{Region: domain.LockRegion{Range: "A1"}}, "")
+	lock, _ := expectLock(t, alice)
+	expectLock(t, bob)
+
+	edit := domain.CellUpdatePayload{Cell: "A1", Value: "1"}
+	bob.send(domain.EventCellUpdate, edit, "op-1")
+	var rejected domain.NackPayload
+	bob.expect(domain.EventNack).decode(t, &rejected)
+	if rejected.Code != "locked" {
+		t.Fatalf("edit of a locked cell: got %+v", rejected)
+	}
+
+	alice.send(domain.EventLockRelease, domain.LockReleasePayload{LockID: lock.ID}, "")
+	expectReleased(t, bob, lock.ID, domain.LockReasonReleased)
+
+	// Nack из-за блокировки не запоминается: повтор с тем же op_id проходит
+	bob.send(domain.EventCellUpdate, edit, "op-1")
+	var ack domain.AckPayload
+	bob.expect(domain.EventAck).decode(t, &ack)
+	if ack.OpID != "op-1" {
+		t.Fatalf("retry acked %+v", ack)
+	}
+
+	// Ack же запоминается, и повтор не применяется второй раз
+	bob.send(domain.EventCellUpdate, edit, "op-1")
+	var again domain.AckPayload
+	bob.expect(domain.EventAck).decode(t, &again)
+	if again != ack {
+		t.Fatalf("second retry got %+v, want %+v", again, ack)
+	}
+}
+
+func TestResumeReplaysMissedEvents(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.join(t, "room", "alice")
+	bob := ts.join(t, "room", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	bob.drop()
+	alice.chat("while you were away")
+
+	resumed := ts.resume(t, "room", bob)
+
+	var session domain.SessionPayload
+	resumed.expect(domain.EventSession).decode(t, &session)
+	if !session.Resumed || session.ClientID != bob.id {
+		t.Fatalf("session not resumed: %+v", session)
+	}
+
+	var payload struct{ Text string }
+	resumed.expect(domain.EventChatMessage).decode(t, &payload)
+	if payload.Text != "while you were away" {
+		t.Fatalf("replayed %q", payload.Text)
+	}
+
+	// Для alice bob не выходил из комнаты
+	resumed.chat("back")
+	if got := alice.next(); got.Type != domain.EventChatMessage {
+		t.Fatalf("alice got %s, want bob's chat without leave/join", got.Type)
+	}
+}
+
+func TestResumeKeepsPresence(t *testing.T) {
+	ts := startServer(t)
+
+	alice := joinTable(t, ts, "budget", "alice")
+	bob := joinTable(t, ts, "budget", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	alice.send(domain.EventSheetAdd, domain.SheetAddPayload{Name: "Totals"}, "add-1")
+	var added domain.SheetAddPayload
+	alice.expect(domain.EventSheetAdd).decode(t, &added)
+	bob.expect(domain.EventSheetAdd)
+	bob.send(domain.EventSheetView, domain.SheetViewPayload{SheetID: added.SheetID}, "")
+	alice.expect(domain.EventSheetView)
+
+	bob.drop()
+	resumed := ts.resume(t, "budget", bob)
+	resumed.expect(domain.EventSession)
+
+	// Новый участник видит bob на том же листе, что и до обрыва
+	carol := joinTable(t, ts, "budget", "carol")
+	for _, p := range carol.sync.Participants {
+		if p.ID == bob.id {
+			if p.Sheet != added.SheetID {
+				t.Fatalf("bob is on sheet %q after resume, want %q", p.Sheet, added.SheetID)
+			}
+			return
+		}
+	}
+	t.Fatalf("bob is missing from participants %+v", carol.sync.Participants)
+}
+
+func TestShutdownAsksClientsToReconnect(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.join(t, "room", "alice")
+
+	if err := ts.app.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	if closeErr := alice.expectClose(); closeErr.Code != websocket.CloseServiceRestart {
+		t.Fatalf("close code %d, want %d", closeErr.Code, websocket.CloseServiceRestart)
+	}
+}
+
+func TestDetachedClientLeavesAfterGracePeriod(t *testing.T) {
+	ts := startServer(t, func(cfg *config.Config) {
+		cfg.WebSocket.ResumeGracePeriod = 1
+	})
+
+	alice := ts.join(t, "room", "alice")
+	bob := ts.join(t, "room", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	bob.drop()
+
+	if left := alice.expect(domain.EventLeaveRoom); left.UserID != bob.id {
+		t.Fatalf("leave_room for %s, want %s", left.UserID, bob.id)
+	}
+}
+
+func TestConcurrentClientsReceiveEveryMessage(t *testing.T) {
+	ts := startServer(t)
+
+	const (
+		clients  = 10
+		messages = 20
+	)
+
+	members := make([]*testClient, clients)
+	for i := range members {
+		members[i] = ts.join(t, "busy", fmt.Sprintf("user%d", i))
+	}
+	// Каждый ждёт входа всех, кто подключился после него
+	for i, c := range members {
+		for j := i + 1; j < clients; j++ {
+			c.expect(domain.EventJoinRoom)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+	for i, c := range members {
+		wg.Add(1)
+		go func(i int, c *testClient) {
+			defer wg.Done()
+
+			for m := 0; m < messages; m++ {
+				err := c.conn.WriteJSON(map[string]interface{}{
+					"type":    domain.EventChatMessage,
+					"payload": map[string]string{"text": fmt.Sprintf("%d:%d", i, m)},
+				})
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	for _, c := range members {
+		perSender := make(map[string]int)
+		for n := 0; n < (clients-1)*messages; n++ {
+			var payload struct{ Text string }
+			got := c.expect(domain.EventChatMessage)
+			got.decode(t, &payload)
+
+			want := fmt.Sprintf("%d", perSender[got.UserID])
+			if _, m, _ := strings.Cut(payload.Text, ":"); m != want {
+				t.Fatalf("from %s got %q, want message %s: per-sender order broken", got.UserID, payload.Text, want)
+			}
+			perSender[got.UserID]++
+		}
+	}
+}
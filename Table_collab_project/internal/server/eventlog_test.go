@@ -0,0 +1,200 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+	"table_collab/internal/storage/file"
+)
+
+type rebuildResult struct {
+	Offset uint64       `json:"offset"`
+	Closed bool         `json:"closed"`
+	Room   *domain.Room `json:"room"`
+}
+
+func setCell(t *testing.T, c *testClient, cell, value string) {
+	t.Helper()
+
+	c.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: cell, Value: value}, "op-"+cell+value)
+	c.expect(domain.EventAck)
+}
+
+// cells возвращает ячейки первого листа комнаты.
+func cells(room *domain.Room) map[string]string {
+	if room == nil || len(room.Sheets) == 0 {
+		return nil
+	}
+	return room.Sheets[0].Cells
+}
+
+func TestEventLogReplay(t *testing.T) {
+	dir := t.TempDir()
+	withLog := func(cfg *config.Config) {
+		cfg.Admin.Token = "admin-token"
+		cfg.EventLog = config.EventLogConfig{Dir: dir, CompactThreshold: 1000, KeepSnapshots: 1}
+	}
+
+	ts := startServer(t, withLog)
+	alice := joinTable(t, ts, "ledger", "alice")
+	setCell(t, alice, "A1", "1")
+	setCell(t, alice, "A2", "2")
+	alice.chat("totals are in")
+	alice.send(domain.EventCommentAdd, domain.CommentAddPayload{Anchor: domain.CommentAnchor{Cell: "A2"}, Text: "double-check"}, "")
+	expectThread(t, alice)
+
+	var entries []file.LogEntry
+	if status := ts.request(t, http.MethodGet, "/api/admin/rooms/ledger/log", nil, &entries); status != http.StatusOK {
+		t.Fatalf("log: status %d", status)
+	}
+	want := []domain.EventType{domain.EventRoomCreated, domain.EventCellUpdate, domain.EventCellUpdate,
+		domain.EventChatMessage, domain.EventCommentThread}
+	if len(entries) != len(want) {
+		t.Fatalf("log has %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, entry := range entries {
+		if entry.Offset != uint64(i+1) || entry.Event.Type != want[i] {
+			t.Fatalf("entry %d: offset %d type %s, want %d %s", i, entry.Offset, entry.Event.Type, i+1, want[i])
+		}
+	}
+
+	var rebuilt rebuildResult
+	if status := ts.request(t, http.MethodGet, "/api/admin/rooms/ledger/log/rebuild?offset=2", nil, &rebuilt); status != http.StatusOK {
+		t.Fatalf("rebuild: status %d", status)
+	}
+	if got := cells(rebuilt.Room); rebuilt.Offset != 2 || len(got) != 1 || got["A1"] != "1" {
+		t.Fatalf("rebuilt at 2: %+v", rebuilt)
+	}
+	if status := ts.request(t, http.MethodGet, "/api/admin/rooms/ledger/log/rebuild?offset=99", nil, nil); status != http.StatusBadRequest {
+		t.Fatalf("rebuild past the end: status %d", status)
+	}
+
+	// Остановка снимает снапшот, и журнал обрезается до него
+	if err := ts.app.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	restarted := startServer(t, withLog)
+	bob := joinTable(t, restarted, "ledger", "bob")
+	if got := cells(&domain.Room{Sheets: bob.sync.Sheets}); got["A1"] != "1" || got["A2"] != "2" {
+		t.Fatalf("replayed cells: %v", bob.sync.Table)
+	}
+	if bob.sync.Version != 2 || len(bob.sync.Comments) != 1 {
+		t.Fatalf("replayed room: version %d, comments %+v", bob.sync.Version, bob.sync.Comments)
+	}
+
+	setCell(t, bob, "A3", "3")
+
+	if status := restarted.request(t, http.MethodGet, "/api/admin/rooms/ledger/log/rebuild?offset=2", nil, nil); status != http.StatusGone {
+		t.Fatalf("rebuild before the snapshot: status %d", status)
+	}
+	if status := restarted.request(t, http.MethodGet, "/api/admin/rooms/ledger/log/rebuild", nil, &rebuilt); status != http.StatusOK {
+		t.Fatalf("rebuild: status %d", status)
+	}
+	if rebuilt.Offset != 6 || len(cells(rebuilt.Room)) != 3 || rebuilt.Room.Version != 3 {
+		t.Fatalf("rebuilt at head: %+v", rebuilt)
+	}
+}
+
+func TestEventLogCompaction(t *testing.T) {
+	dir := t.TempDir()
+	withLog := func(cfg *config.Config) {
+		cfg.Admin.Token = "admin-token"
+		cfg.EventLog = config.EventLogConfig{Dir: dir, CompactThreshold: 1000, KeepSnapshots: 2}
+	}
+
+	ts := startServer(t, withLog)
+	alice := joinTable(t, ts, "grid", "alice")
+	setCell(t, alice, "A1", "1")
+	if status := ts.request(t, http.MethodPost, "/api/admin/rooms/grid/log/compact", nil, nil); status != http.StatusNoContent {
+		t.Fatalf("compact: status %d", status)
+	}
+	setCell(t, alice, "A1", "2")
+	setCell(t, alice, "A1", "3")
+	if status := ts.request(t, http.MethodPost, "/api/admin/rooms/grid/log/compact", nil, nil); status != http.StatusNoContent {
+		t.Fatalf("compact: status %d", status)
+	}
+	setCell(t, alice, "A1", "4")
+
+	// Оба снапшота (смещения 2 и 4) хранятся, журнал начинается после старшего из них
+	var entries []file.LogEntry
+	ts.request(t, http.MethodGet, "/api/admin/rooms/grid/log", nil, &entries)
+	if len(entries) != 3 || entries[0].Offset != 3 {
+		t.Fatalf("log after compaction: %+v", entries)
+	}
+
+	for offset, value := range map[uint64]string{2: "1", 3: "2", 4: "3", 5: "4"} {
+		var rebuilt rebuildResult
+		path := "/api/admin/rooms/grid/log/rebuild?offset=" + strconv.FormatUint(offset, 10)
+		if status := ts.request(t, http.MethodGet, path, nil, &rebuilt); status != http.StatusOK {
+			t.Fatalf("rebuild at %d: status %d", offset, status)
+		}
+		if got := cells(rebuilt.Room)["A1"]; got != value {
+			t.Fatalf("rebuild at %d: A1 = %v, want %s", offset, got, value)
+		}
+	}
+	if status := ts.request(t, http.MethodGet, "/api/admin/rooms/grid/log/rebuild?offset=1", nil, nil); status != http.StatusGone {
+		t.Fatalf("rebuild at 1: status %d", status)
+	}
+
+	if status := ts.request(t, http.MethodDelete, "/api/admin/rooms/grid", nil, nil); status != http.StatusNoContent {
+		t.Fatalf("close room: status %d", status)
+	}
+	var closed rebuildResult
+	ts.request(t, http.MethodGet, "/api/admin/rooms/grid/log/rebuild", nil, &closed)
+	if !closed.Closed || closed.Offset != 6 {
+		t.Fatalf("rebuilt closed room: %+v", closed)
+	}
+}
+
+// Заход в комнату без правок не оставляет на диске журнала, а опустевшая
+// комната удаляется; число комнат, которые можно создать входом, ограничено.
+func TestEventLogLazyRooms(t *testing.T) {
+	dir := t.TempDir()
+	ts := startServer(t, func(cfg *config.Config) {
+		cfg.Admin.Token = "admin-token"
+		cfg.App.MaxRooms = 2
+		cfg.EventLog = config.EventLogConfig{Dir: dir, CompactThreshold: 1000, KeepSnapshots: 1}
+	})
+
+	ts.join(t, "probe", "visitor").leave()
+	for deadline := time.Now().Add(waitTimeout); ; time.Sleep(10 * time.Millisecond) {
+		var rooms []struct{ ID string }
+		ts.request(t, http.MethodGet, "/api/admin/rooms", nil, &rooms)
+		if len(rooms) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("empty room was kept: %+v", rooms)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("visit without edits left %d entries in the log dir", len(entries))
+	}
+
+	alice := joinTable(t, ts, "ledger", "alice")
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatal("log created before the first edit")
+	}
+	setCell(t, alice, "A1", "1")
+	var entries []file.LogEntry
+	ts.request(t, http.MethodGet, "/api/admin/rooms/ledger/log", nil, &entries)
+	if len(entries) != 2 || entries[0].Event.Type != domain.EventRoomCreated || entries[1].Event.Type != domain.EventCellUpdate {
+		t.Fatalf("log after the first edit: %+v", entries)
+	}
+
+	ts.join(t, "second", "bob")
+	third := ts.dial(t, "third", "")
+	third.send(domain.EventJoinRoom, domain.JoinRoomPayload{Username: "carol"}, "")
+	if closed := third.expectClose(); closed.Code != websocket.ClosePolicyViolation || closed.Text != "too many rooms" {
+		t.Fatalf("join over the room limit: %v", closed)
+	}
+}
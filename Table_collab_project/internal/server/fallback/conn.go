@@ -0,0 +1,97 @@
+package fallback
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/service"
+	"table_collab/pkg/utils"
+)
+
+var (
+	errConnectionLost = errors.New("connection lost")
+	errConnClosed     = errors.New("connection closed")
+	errInboxBusy      = errors.New("client is not reading events")
+)
+
+// conn — общая часть HTTP-транспортов: события от клиента приходят отдельными
+// POST-запросами и складываются в inbox, откуда их забирает ReadPump.
+type conn struct {
+	id         string
+	target     Target
+	remoteAddr string
+	inbox      chan domain.Event
+	done       chan struct{}
+	closeOnce  sync.Once
+	peerClosed atomic.Bool
+}
+
+func newConn(target Target, remoteAddr string) *conn {
+	return &conn{
+		id:         utils.GenerateToken(),
+		target:     target,
+		remoteAddr: remoteAddr,
+		inbox:      make(chan domain.Event, 64),
+		done:       make(chan struct{}),
+	}
+}
+
+func (c *conn) base() *conn {
+	return c
+}
+
+func (c *conn) RemoteAddr() string {
+	return c.remoteAddr
+}
+
+func (c *conn) ReadEvent() (domain.Event, error) {
+	select {
+	case event := <-c.inbox:
+		return event, nil
+	case <-c.done:
+		if c.peerClosed.Load() {
+			return domain.Event{}, service.ErrTransportClosed
+		}
+		return domain.Event{}, errConnectionLost
+	}
+}
+
+func (c *conn) receive(event domain.Event) error {
+	select {
+	case c.inbox <- event:
+		return nil
+	case <-c.done:
+		return errConnClosed
+	case <-time.After(5 * time.Second):
+		return errInboxBusy
+	}
+}
+
+// finish завершает соединение; byPeer — клиент ушёл сам, а не потерялся.
+func (c *conn) finish(byPeer bool) {
+	if byPeer {
+		c.peerClosed.Store(true)
+	}
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+func (c *conn) isDone() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func closeEvent(roomID string, code int, reason string) domain.Event {
+	return domain.Event{
+		Type:      domain.EventClose,
+		RoomID:    roomID,
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   domain.ClosePayload{Code: code, Reason: reason},
+	}
+}
@@ -0,0 +1,279 @@
+package fallback
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+	"table_collab/internal/logging"
+	"table_collab/internal/server/middleware"
+	"table_collab/internal/service"
+)
+
+// Handler обслуживает транспорты для клиентов, у которых не работает WebSocket:
+// SSE (поток вниз + POST вверх) и long-polling.
+type Handler struct {
+	hub     *service.Hub
+	cfg     *config.Config
+	origins *middleware.OriginPolicy
+
+	mu    sync.Mutex
+	conns map[string]transport
+}
+
+type transport interface {
+	service.Transport
+	base() *conn
+}
+
+func NewHandler(hub *service.Hub, cfg *config.Config, origins *middleware.OriginPolicy) *Handler {
+	return &Handler{
+		hub:     hub,
+		cfg:     cfg,
+		origins: origins,
+		conns:   make(map[string]transport),
+	}
+}
+
+const writeGrace = 10 * time.Second
+
+// Target — к чему подключается соединение: к комнате участником или по ссылке
+// share зрителем. Ссылка не раскрывает ID комнаты, поэтому у зрителя RoomID
+// пуст, а комнату hub находит по токену.
+type Target struct {
+	RoomID string
+	Share  string
+}
+
+type connectedPayload struct {
+	ConnID    string `json:"conn_id"`
+	Transport string `json:"transport"`
+}
+
+// ServeSSE открывает поток событий. Первым сообщением приходит conn_id для POST-запросов.
+func (h *Handler) ServeSSE(target Target, w http.ResponseWriter, r *http.Request) {
+	if !h.checkOrigin(w, r) {
+		return
+	}
+	roomID, ok := h.room(w, r, target)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// Поток живёт дольше WriteTimeout сервера
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	t := &sseTransport{conn: newConn(target, r.RemoteAddr), w: w, flusher: flusher}
+	h.add(t)
+	defer h.remove(t.id)
+
+	data, _ := json.Marshal(domain.Event{
+		Type:      domain.EventConnected,
+		RoomID:    target.RoomID,
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   connectedPayload{ConnID: t.id, Transport: t.Name()},
+	})
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	flusher.Flush()
+
+	lastSeq := r.URL.Query().Get("last_seq")
+	if lastSeq == "" {
+		lastSeq = r.Header.Get("Last-Event-ID")
+	}
+	seq, _ := strconv.ParseUint(lastSeq, 10, 64)
+	h.connect(r, t, roomID, seq)
+
+	select {
+	case <-r.Context().Done():
+		t.stop()
+		t.finish(false)
+	case <-t.done:
+		t.stop()
+	}
+}
+
+// ServeLongPollOpen создаёт long-polling соединение и возвращает его conn_id.
+func (h *Handler) ServeLongPollOpen(target Target, w http.ResponseWriter, r *http.Request) {
+	if !h.checkOrigin(w, r) {
+		return
+	}
+	roomID, ok := h.room(w, r, target)
+	if !ok {
+		return
+	}
+
+	timeout := time.Duration(h.cfg.WebSocket.LongPollTimeout) * time.Second
+	t := newPollTransport(newConn(target, r.RemoteAddr), 2*timeout)
+	h.add(t)
+
+	// Запись остаётся в реестре ещё на один таймаут, чтобы клиент успел забрать close-событие
+	go func() {
+		<-t.done
+		time.AfterFunc(timeout, func() { h.remove(t.id) })
+	}()
+
+	seq, _ := strconv.ParseUint(r.URL.Query().Get("last_seq"), 10, 64)
+	h.connect(r, t, roomID, seq)
+
+	writeJSON(w, http.StatusOK, connectedPayload{ConnID: t.id, Transport: t.Name()})
+}
+
+// ServeLongPoll отдаёт события long-polling соединения. Параметр cursor —
+// сколько событий клиент уже получил; неподтверждённые отдаются повторно.
+func (h *Handler) ServeLongPoll(target Target, connID string, w http.ResponseWriter, r *http.Request) {
+	t, ok := h.lookup(target, connID).(*pollTransport)
+	if !ok {
+		http.Error(w, "not a long-polling connection", http.StatusBadRequest)
+		return
+	}
+
+	timeout := time.Duration(h.cfg.WebSocket.LongPollTimeout) * time.Second
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + writeGrace))
+	if requested, err := strconv.Atoi(r.URL.Query().Get("timeout")); err == nil && requested >= 0 {
+		timeout = min(timeout, time.Duration(requested)*time.Second)
+	}
+
+	cursor, err := strconv.ParseInt(r.URL.Query().Get("cursor"), 10, 64)
+	if err != nil || cursor < 0 {
+		cursor = noCursor
+	}
+
+	events, gone := t.poll(r.Context(), cursor, timeout)
+	if gone {
+		http.Error(w, "connection closed", http.StatusGone)
+		return
+	}
+	if events == nil {
+		events = []domain.Event{}
+	}
+
+	writeJSON(w, http.StatusOK, events)
+}
+
+// ServeSend принимает событие от клиента SSE или long-polling.
+func (h *Handler) ServeSend(target Target, connID string, w http.ResponseWriter, r *http.Request) {
+	t := h.lookup(target, connID)
+	if t == nil {
+		http.Error(w, "unknown connection", http.StatusGone)
+		return
+	}
+
+	var event domain.Event
+	body := http.MaxBytesReader(w, r.Body, h.cfg.WebSocket.MaxMessageSize)
+	if err := json.NewDecoder(body).Decode(&event); err != nil {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+
+	if err := t.base().receive(event); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ServeClose — клиент уходит сам, сессию продолжать не нужно.
+func (h *Handler) ServeClose(target Target, connID string, w http.ResponseWriter, r *http.Request) {
+	t := h.lookup(target, connID)
+	if t == nil {
+		http.Error(w, "unknown connection", http.StatusGone)
+		return
+	}
+
+	t.base().finish(true)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) checkOrigin(w http.ResponseWriter, r *http.Request) bool {
+	if ok, reason := h.origins.Check(r); !ok {
+		logging.FromContext(r.Context()).Warn("Fallback connection rejected",
+			"path", r.URL.Path, "remote", r.RemoteAddr, "origin", r.Header.Get("Origin"), "reason", reason)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// room возвращает комнату, к которой подключается соединение. Зрителю с
+// недействительной ссылкой share отказывает до открытия соединения, а запрос
+// к комнате со старым параметром share — чтобы он не стал подключением
+// участника.
+func (h *Handler) room(w http.ResponseWriter, r *http.Request, target Target) (string, bool) {
+	if target.Share == "" {
+		if r.URL.Query().Has("share") {
+			http.Error(w, "share links are served at /sse/share/{token} and /poll/share/{token}", http.StatusBadRequest)
+			return "", false
+		}
+		return target.RoomID, true
+	}
+
+	roomID, err := h.hub.ShareRoom(target.Share)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("Fallback connection rejected",
+			"path", r.URL.Path, "remote", r.RemoteAddr, "reason", err)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return "", false
+	}
+	return roomID, true
+}
+
+// connect подключает транспорт к hub: по ссылке share — зрителем, иначе
+// обычным клиентом.
+func (h *Handler) connect(r *http.Request, t transport, roomID string, lastSeq uint64) {
+	if share := t.base().target.Share; share != "" {
+		h.hub.ConnectSpectator(r.Context(), t, roomID, share)
+		return
+	}
+	h.hub.Connect(r.Context(), t, roomID, r.URL.Query().Get("resume"), lastSeq)
+}
+
+func (h *Handler) add(t transport) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.conns[t.base().id] = t
+}
+
+func (h *Handler) remove(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.conns, id)
+}
+
+// lookup находит соединение по адресу, с которым его открыли: соединение
+// зрителя не доступно по адресу комнаты, и наоборот.
+func (h *Handler) lookup(target Target, connID string) transport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, ok := h.conns[connID]
+	if !ok || t.base().target != target {
+		return nil
+	}
+	return t
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
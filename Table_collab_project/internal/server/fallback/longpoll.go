@@ -0,0 +1,141 @@
+package fallback
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"table_collab/internal/domain"
+)
+
+const maxPollQueue = 1024
+
+var errPollTimeout = errors.New("client stopped polling")
+
+// pollTransport копит исходящие события, пока клиент не заберёт их запросом
+// GET /poll/{roomID}/{connID}. Клиент, переставший опрашивать, считается потерянным.
+//
+// События нумеруются по порядку с нуля. Отданные события остаются в очереди,
+// пока клиент не подтвердит их параметром cursor следующего опроса — числом
+// уже полученных событий. Так ответ, потерянный по дороге, приходит повторно.
+type pollTransport struct {
+	*conn
+	mu          sync.Mutex
+	queue       []domain.Event
+	first       uint64 // номер queue[0]
+	sent        uint64 // номер события после последнего отданного
+	notify      chan struct{}
+	lastPoll    time.Time
+	idleTimeout time.Duration
+}
+
+// noCursor — клиент не прислал cursor: всё отданное раньше считается полученным.
+const noCursor = -1
+
+func newPollTransport(c *conn, idleTimeout time.Duration) *pollTransport {
+	return &pollTransport{
+		conn:        c,
+		notify:      make(chan struct{}, 1),
+		lastPoll:    time.Now(),
+		idleTimeout: idleTimeout,
+	}
+}
+
+func (t *pollTransport) Name() string {
+	return "longpoll"
+}
+
+func (t *pollTransport) WriteEvent(event domain.Event) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.isDone() {
+		return errConnClosed
+	}
+	if len(t.queue) >= maxPollQueue {
+		return errInboxBusy
+	}
+
+	t.queue = append(t.queue, event)
+	t.signal()
+	return nil
+}
+
+func (t *pollTransport) Ping() error {
+	t.mu.Lock()
+	idle := time.Since(t.lastPoll)
+	t.mu.Unlock()
+
+	if idle > t.idleTimeout {
+		t.finish(false)
+		return errPollTimeout
+	}
+	return nil
+}
+
+func (t *pollTransport) Close(code int, reason string) error {
+	t.mu.Lock()
+	if code != 0 && !t.isDone() {
+		t.queue = append(t.queue, closeEvent(t.target.RoomID, code, reason))
+		t.signal()
+	}
+	t.mu.Unlock()
+
+	t.finish(false)
+	return nil
+}
+
+// poll подтверждает события до cursor, ждёт новых не дольше timeout и
+// возвращает все неподтверждённые. gone == true, если соединение закрыто и
+// отдавать больше нечего.
+func (t *pollTransport) poll(ctx context.Context, cursor int64, timeout time.Duration) (events []domain.Event, gone bool) {
+	t.confirm(cursor)
+	if events, gone = t.take(); len(events) > 0 || gone {
+		return events, gone
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-t.notify:
+	case <-t.done:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	return t.take()
+}
+
+// confirm убирает из очереди события, которые клиент уже получил.
+func (t *pollTransport) confirm(cursor int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	received := t.sent
+	if cursor != noCursor {
+		received = min(max(uint64(cursor), t.first), t.first+uint64(len(t.queue)))
+	}
+	t.queue = t.queue[received-t.first:]
+	t.first = received
+}
+
+func (t *pollTransport) take() ([]domain.Event, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lastPoll = time.Now()
+	events := slices.Clone(t.queue)
+	t.sent = t.first + uint64(len(events))
+
+	return events, len(events) == 0 && t.isDone()
+}
+
+func (t *pollTransport) signal() {
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
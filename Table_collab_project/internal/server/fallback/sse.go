@@ -0,0 +1,85 @@
+package fallback
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"table_collab/internal/domain"
+)
+
+// sseTransport отправляет события потоком Server-Sent Events,
+// а принимает их через POST /sse/{roomID}/{connID}.
+type sseTransport struct {
+	*conn
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	closed  bool
+}
+
+func (t *sseTransport) Name() string {
+	return "sse"
+}
+
+func (t *sseTransport) WriteEvent(event domain.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return errConnClosed
+	}
+
+	// id позволяет EventSource прислать Last-Event-ID при переподключении
+	if event.Seq > 0 {
+		fmt.Fprintf(t.w, "id: %d\n", event.Seq)
+	}
+	if _, err := fmt.Fprintf(t.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+func (t *sseTransport) Ping() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return errConnClosed
+	}
+	if _, err := fmt.Fprint(t.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+func (t *sseTransport) Close(code int, reason string) error {
+	t.mu.Lock()
+	if !t.closed {
+		if code != 0 {
+			data, _ := json.Marshal(closeEvent(t.target.RoomID, code, reason))
+			fmt.Fprintf(t.w, "data: %s\n\n", data)
+			t.flusher.Flush()
+		}
+		t.closed = true
+	}
+	t.mu.Unlock()
+
+	t.finish(false)
+	return nil
+}
+
+// stop запрещает запись после выхода из HTTP-обработчика.
+func (t *sseTransport) stop() {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+}
@@ -0,0 +1,303 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+	"table_collab/internal/server"
+)
+
+const waitTimeout = 5 * time.Second
+
+func testConfig() *config.Config {
+	return &config.Config{
+		Server: config.ServerConfig{
+			Env:             "test",
+			ShutdownTimeout: 5,
+			ReconnectDelay:  1,
+		},
+		WebSocket: config.WebSocketConfig{
+			ReadBufferSize:     1024,
+			WriteBufferSize:    1024,
+			MaxMessageSize:     65536,
+			PingPeriod:         60,
+			ResumeGracePeriod:  30,
+			ResumeBufferSize:   256,
+			LongPollTimeout:    5,
+			SendBufferSize:     256,
+			OverflowBufferSize: 1024,
+			SlowConsumerPolicies: map[string]string{
+				"document":   "coalesce_cursor",
+				"whiteboard": "drop_oldest",
+				"table":      "spill",
+			},
+		},
+		App: config.AppConfig{
+			MaxRooms:          100,
+			MaxClientsPerRoom: 50,
+			RoomTTL:           3600,
+		},
+		Admin: config.AdminConfig{AuditLogSize: 100},
+		Security: config.SecurityConfig{
+			AllowedOrigins:   []string{"http://localhost:3000"},
+			Subprotocols:     []string{"tablecollab.v1"},
+			HandshakeTimeout: 5,
+		},
+	}
+}
+
+type testServer struct {
+	*httptest.Server
+	app *server.Server
+	// Токен admin API, если тест его включил; request подставляет его сам
+	adminToken string
+}
+
+// startServer поднимает server.New на httptest и по завершении теста
+// останавливает его и проверяет, что не осталось лишних горутин.
+func startServer(t *testing.T, configure ...func(*config.Config)) *testServer {
+	t.Helper()
+
+	baseline := runtime.NumGoroutine()
+
+	cfg := testConfig()
+	for _, fn := range configure {
+		fn(cfg)
+	}
+
+	app := server.New(cfg)
+	ts := &testServer{Server: httptest.NewServer(app.Handler()), app: app, adminToken: cfg.Admin.Token}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+		defer cancel()
+
+		app.Shutdown(ctx)
+		ts.Close()
+		checkGoroutines(t, baseline)
+	})
+
+	return ts
+}
+
+// checkGoroutines ждёт, пока число горутин вернётся к исходному.
+func checkGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			n := runtime.Stack(buf, true)
+			t.Fatalf("goroutine leak: %d running, %d at start\n%s",
+				runtime.NumGoroutine(), baseline, buf[:n])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// event — событие так, как его видит клиент: payload остаётся сырым JSON.
+type event struct {
+	Type    domain.EventType `json:"type"`
+	RoomID  string           `json:"room_id"`
+	UserID  string           `json:"user_id"`
+	Payload json.RawMessage  `json:"payload"`
+	Version int              `json:"version"`
+	Seq     uint64           `json:"seq"`
+	OpID    string           `json:"op_id"`
+
+	TraceParent string `json:"traceparent"`
+}
+
+func (e event) decode(t *testing.T, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		t.Fatalf("decode %s payload: %v", e.Type, err)
+	}
+}
+
+// request выполняет JSON-запрос к API и разбирает ответ в out, если он передан.
+func (ts *testServer) request(t *testing.T, method, path string, body, out interface{}) int {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ts.adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ts.adminToken)
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decode: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+type testClient struct {
+	t       *testing.T
+	conn    *websocket.Conn
+	id      string
+	token   string
+	lastSeq uint64
+	sync    domain.SyncPayload
+}
+
+// dial подключается к комнате без входа в неё.
+func (ts *testServer) dial(t *testing.T, roomID, query string) *testClient {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws/" + roomID + query
+	dialer := websocket.Dialer{
+		HandshakeTimeout: waitTimeout,
+		Subprotocols:     []string{"tablecollab.v1"},
+	}
+
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", url, err)
+	}
+
+	c := &testClient{t: t, conn: conn}
+	t.Cleanup(func() { conn.Close() })
+
+	return c
+}
+
+// join подключается к комнате, входит в неё и дожидается sync.
+func (ts *testServer) join(t *testing.T, roomID, username string) *testClient {
+	t.Helper()
+
+	c := ts.dial(t, roomID, "")
+	c.send(domain.EventJoinRoom, domain.JoinRoomPayload{Username: username}, "")
+
+	c.expect(domain.EventSession)
+	c.expect(domain.EventSync).decode(t, &c.sync)
+
+	return c
+}
+
+// resume переподключает клиента с его resume-токеном.
+func (ts *testServer) resume(t *testing.T, roomID string, old *testClient) *testClient {
+	t.Helper()
+
+	c := ts.dial(t, roomID, "?resume="+old.token+"&last_seq="+strconv.FormatUint(old.lastSeq, 10))
+	c.token = old.token
+	c.lastSeq = old.lastSeq
+
+	return c
+}
+
+func (c *testClient) send(eventType domain.EventType, payload interface{}, opID string) {
+	c.t.Helper()
+
+	c.conn.SetWriteDeadline(time.Now().Add(waitTimeout))
+	err := c.conn.WriteJSON(map[string]interface{}{
+		"type":    eventType,
+		"payload": payload,
+		"op_id":   opID,
+	})
+	if err != nil {
+		c.t.Fatalf("send %s: %v", eventType, err)
+	}
+}
+
+func (c *testClient) chat(text string) {
+	c.send(domain.EventChatMessage, map[string]string{"text": text}, "")
+}
+
+// next читает следующее событие и запоминает данные сессии.
+func (c *testClient) next() event {
+	c.t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(waitTimeout))
+	var e event
+	if err := c.conn.ReadJSON(&e); err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+
+	if e.Seq > 0 {
+		if e.Seq <= c.lastSeq {
+			c.t.Fatalf("seq went backwards: %d after %d (%s)", e.Seq, c.lastSeq, e.Type)
+		}
+		c.lastSeq = e.Seq
+	}
+	if e.Type == domain.EventSession {
+		var session domain.SessionPayload
+		e.decode(c.t, &session)
+		c.id, c.token = session.ClientID, session.ResumeToken
+	}
+
+	return e
+}
+
+// expect пропускает события других типов и возвращает первое событие нужного типа.
+func (c *testClient) expect(eventType domain.EventType) event {
+	c.t.Helper()
+
+	for {
+		if e := c.next(); e.Type == eventType {
+			return e
+		}
+	}
+}
+
+// expectClose ждёт закрытия соединения сервером и возвращает код закрытия.
+func (c *testClient) expectClose() *websocket.CloseError {
+	c.t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(waitTimeout))
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			closeErr, ok := err.(*websocket.CloseError)
+			if !ok {
+				c.t.Fatalf("expected a close frame, got %v", err)
+			}
+			return closeErr
+		}
+	}
+}
+
+// leave закрывает соединение штатно: сессию после этого продолжить нельзя.
+func (c *testClient) leave() {
+	c.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.conn.Close()
+}
+
+// drop рвёт TCP-соединение без close-фрейма, как при обрыве сети.
+func (c *testClient) drop() {
+	c.conn.NetConn().Close()
+}
@@ -0,0 +1,147 @@
+package server_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+func joinTable(t *testing.T, ts *testServer, roomID, username string) *testClient {
+	t.Helper()
+
+	c := ts.dial(t, roomID, "")
+	c.send(domain.EventJoinRoom, domain.JoinRoomPayload{Username: username, RoomType: domain.RoomTypeTable}, "")
+	c.expect(domain.EventSession)
+	c.expect(domain.EventSync).decode(t, &c.sync)
+	return c
+}
+
+func expectLock(t *testing.T, c *testClient) (domain.Lock, event) {
+	t.Helper()
+
+	e := c.expect(domain.EventLockAcquired)
+	var lock domain.Lock
+	e.decode(t, &lock)
+	return lock, e
+}
+
+func expectReleased(t *testing.T, c *testClient, lockID, reason string) {
+	t.Helper()
+
+	var released domain.LockReleasedPayload
+	c.expect(domain.EventLockReleased).decode(t, &released)
+	if released.LockID != lockID || released.Reason != reason {
+		t.Fatalf("got release %+v, want %s (%s)", released, lockID, reason)
+	}
+}
+
+func TestCellLocks(t *testing.T) {
+	ts := startServer(t)
+
+	alice := joinTable(t, ts, "sheet", "alice")
+	bob := joinTable(t, ts, "sheet", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	alice.send(domain.EventLockAcquire, domain.LockAcquirePayload{Region: domain.LockRegion{Range: "c3:b2"}}, "l-1")
+	lock, e := expectLock(t, alice)
+	if e.OpID != "l-1" || lock.Region.Range != "B2:C3" || lock.OwnerID != alice.id {
+		t.Fatalf("alice got %+v (op_id %q)", lock, e.OpID)
+	}
+	if seen, _ := expectLock(t, bob); seen.ID != lock.ID || seen.Username != "alice" {
+		t.Fatalf("bob sees %+v", seen)
+	}
+
+	bob.send(domain.EventLockAcquire, domain.LockAcquirePayload{Region: domain.LockRegion{Range: "C3:D4"}}, "")
+	var failure domain.ErrorPayload
+	bob.expect(domain.EventError).decode(t, &failure)
+	if failure.Code != "locked" || !strings.Contains(failure.Message, "alice") {
+		t.Fatalf("overlapping lock: got %+v", failure)
+	}
+
+	bob.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: "c2", Value: "1"}, "e-1")
+	var rejected domain.NackPayload
+	bob.expect(domain.EventNack).decode(t, &rejected)
+	if rejected.Code != "locked" || !strings.Contains(rejected.Reason, "C2") || !strings.Contains(rejected.Reason, "alice") {
+		t.Fatalf("locked cell edit: got %+v", rejected)
+	}
+	bob.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: "D5", Value: "1"}, "e-2")
+	bob.expect(domain.EventAck)
+
+	alice.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: "B2", Value: "2"}, "e-3")
+	alice.expect(domain.EventAck)
+
+	carol := joinTable(t, ts, "sheet", "carol")
+	if len(carol.sync.Locks) != 1 || carol.sync.Locks[0].ID != lock.ID {
+		t.Fatalf("sync locks: %+v", carol.sync.Locks)
+	}
+
+	alice.send(domain.EventLockRelease, domain.LockReleasePayload{LockID: lock.ID}, "")
+	expectReleased(t, alice, lock.ID, domain.LockReasonReleased)
+	expectReleased(t, bob, lock.ID, domain.LockReasonReleased)
+	bob.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: "C2", Value: "3"}, "e-4")
+	bob.expect(domain.EventAck)
+
+	// Отключение владельца снимает его блокировки
+	bob.send(domain.EventLockAcquire, domain.LockAcquirePayload{Region: domain.LockRegion{Range: "A1"}}, "")
+	held, _ := expectLock(t, bob)
+	bob.drop()
+	expectReleased(t, alice, held.ID, domain.LockReasonDisconnected)
+}
+
+func TestTextLocks(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.join(t, "doc", "alice")
+	alice.send(domain.EventTextUpdate, domain.TextUpdatePayload{Text: "Hello brave new world"}, "op-1")
+	alice.expect(domain.EventAck)
+	bob := ts.join(t, "doc", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	alice.send(domain.EventLockAcquire, domain.LockAcquirePayload{Region: domain.LockRegion{Start: 6, End: 11}}, "")
+	lock, _ := expectLock(t, alice)
+	expectLock(t, bob)
+
+	bob.send(domain.EventTextUpdate, domain.TextUpdatePayload{Text: "Hello bold new world"}, "op-2")
+	var rejected domain.NackPayload
+	bob.expect(domain.EventNack).decode(t, &rejected)
+	if rejected.Code != "locked" {
+		t.Fatalf("edit inside locked text: got %+v", rejected)
+	}
+
+	// Правка вне блокировки проходит, а блокировка сдвигается у всех
+	bob.send(domain.EventTextUpdate, domain.TextUpdatePayload{Text: "Oh, Hello brave new world"}, "op-3")
+	for _, c := range []*testClient{alice, bob} {
+		moved, _ := expectLock(t, c)
+		if moved.ID != lock.ID || moved.Region.Start != 10 || moved.Region.End != 15 {
+			t.Fatalf("moved lock: %+v", moved.Region)
+		}
+	}
+	bob.expect(domain.EventAck)
+}
+
+func TestIdleLockExpires(t *testing.T) {
+	ts := startServer(t, func(cfg *config.Config) {
+		cfg.App.LockIdleTimeout = 1
+	})
+
+	alice := joinTable(t, ts, "sheet", "alice")
+	bob := joinTable(t, ts, "sheet", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	alice.send(domain.EventLockAcquire, domain.LockAcquirePayload{Region: domain.LockRegion{Range: "A1:A9"}}, "")
+	lock, _ := expectLock(t, alice)
+	acquired := time.Now()
+
+	// Правка владельца продлевает блокировку
+	time.Sleep(600 * time.Millisecond)
+	alice.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: "A2", Value: "x"}, "e-1")
+	alice.expect(domain.EventAck)
+
+	expectReleased(t, bob, lock.ID, domain.LockReasonExpired)
+	if elapsed := time.Since(acquired); elapsed < 1500*time.Millisecond {
+		t.Fatalf("lock expired after %s despite activity", elapsed)
+	}
+}
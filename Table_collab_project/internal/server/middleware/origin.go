@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OriginPolicy — общий список разрешённых Origin для WebSocket и CORS.
+type OriginPolicy struct {
+	allowAll bool
+	origins  map[string]bool
+}
+
+func NewOriginPolicy(origins []string) *OriginPolicy {
+	p := &OriginPolicy{origins: make(map[string]bool)}
+	for _, origin := range origins {
+		origin = strings.TrimRight(strings.ToLower(strings.TrimSpace(origin)), "/")
+		switch origin {
+		case "":
+		case "*":
+			p.allowAll = true
+		default:
+			p.origins[origin] = true
+		}
+	}
+	return p
+}
+
+// Allowed проверяет Origin по списку, без учёта same-origin.
+func (p *OriginPolicy) Allowed(origin string) bool {
+	return p.allowAll || p.origins[strings.ToLower(origin)]
+}
+
+// Check решает, можно ли принять запрос, и объясняет отказ.
+// Запросы без Origin (не из браузера) и same-origin разрешены всегда.
+func (p *OriginPolicy) Check(r *http.Request) (bool, string) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true, ""
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false, "malformed Origin header"
+	}
+	if strings.EqualFold(u.Host, r.Host) || p.Allowed(origin) {
+		return true, ""
+	}
+
+	return false, "origin " + origin + " is not in the allowlist"
+}
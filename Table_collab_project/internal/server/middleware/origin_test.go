@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginPolicyCheck(t *testing.T) {
+	policy := NewOriginPolicy([]string{" https://App.example.com/ ", ""})
+
+	tests := []struct {
+		origin string
+		host   string
+		want   bool
+	}{
+		{"", "collab.example.com", true},
+		{"https://app.example.com", "collab.example.com", true},
+		{"https://APP.example.com", "collab.example.com", true},
+		{"https://collab.example.com", "collab.example.com", true},
+		{"https://evil.example.com", "collab.example.com", false},
+		{"null", "collab.example.com", false},
+		{"://bad", "collab.example.com", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "http://"+tt.host+"/ws/room", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		ok, reason := policy.Check(r)
+		if ok != tt.want || ok != (reason == "") {
+			t.Errorf("origin %q: allowed %v (%q), want %v", tt.origin, ok, reason, tt.want)
+		}
+	}
+
+	if !NewOriginPolicy([]string{"*"}).Allowed("https://anything.example") {
+		t.Error("wildcard must allow any origin")
+	}
+}
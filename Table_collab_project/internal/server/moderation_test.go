@@ -0,0 +1,150 @@
+package server_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+func withAdmin(cfg *config.Config) {
+	cfg.Admin.Token = "admin-token"
+}
+
+// audit возвращает журнал действий администратора.
+func audit(t *testing.T, ts *testServer) []domain.AuditEntry {
+	t.Helper()
+
+	var entries []domain.AuditEntry
+	if status := ts.request(t, http.MethodGet, "/api/admin/audit", nil, &entries); status != http.StatusOK {
+		t.Fatalf("audit: status %d", status)
+	}
+	return entries
+}
+
+func TestModerationMuteAndKick(t *testing.T) {
+	ts := startServer(t, withAdmin)
+
+	alice := ts.join(t, "doc", "alice")
+	bob := ts.join(t, "doc", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	var clients []domain.ClientInfo
+	if status := ts.request(t, http.MethodGet, "/api/admin/rooms/doc/clients", nil, &clients); status != http.StatusOK || len(clients) != 2 {
+		t.Fatalf("clients: status %d, %+v", status, clients)
+	}
+
+	mute := "/api/admin/rooms/doc/clients/" + bob.id + "/mute"
+	if status := ts.request(t, http.MethodPost, mute, nil, nil); status != http.StatusNoContent {
+		t.Fatalf("mute: status %d", status)
+	}
+	bob.chat("spam")
+	var failure domain.ErrorPayload
+	if bob.expect(domain.EventError).decode(t, &failure); failure.Message != "you are muted" {
+		t.Fatalf("muted chat: %+v", failure)
+	}
+	bob.send(domain.EventTextUpdate, domain.TextUpdatePayload{Text: "spam"}, "op-1")
+	var nack domain.NackPayload
+	if bob.expect(domain.EventNack).decode(t, &nack); nack.Code != "muted" {
+		t.Fatalf("muted edit: %+v", nack)
+	}
+
+	if status := ts.request(t, http.MethodDelete, mute, nil, nil); status != http.StatusNoContent {
+		t.Fatalf("unmute: status %d", status)
+	}
+	bob.chat("sorry")
+	var chat struct{ Text string }
+	if alice.expect(domain.EventChatMessage).decode(t, &chat); chat.Text != "sorry" {
+		t.Fatalf("alice got %q", chat.Text)
+	}
+
+	// Клиент другой комнаты по этому пути не найти
+	if status := ts.request(t, http.MethodPost, "/api/admin/rooms/other/clients/"+bob.id+"/kick", nil, nil); status != http.StatusNotFound {
+		t.Fatalf("kick from another room: status %d", status)
+	}
+	kick := "/api/admin/rooms/doc/clients/" + bob.id + "/kick"
+	if status := ts.request(t, http.MethodPost, kick, map[string]string{"reason": "flood"}, nil); status != http.StatusNoContent {
+		t.Fatalf("kick: status %d", status)
+	}
+	if closeErr := bob.expectClose(); closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != "flood" {
+		t.Fatalf("kicked client closed with %v", closeErr)
+	}
+	if e := alice.expect(domain.EventLeaveRoom); e.UserID != bob.id {
+		t.Fatalf("alice saw leave of %s", e.UserID)
+	}
+}
+
+func TestModerationRoomActions(t *testing.T) {
+	ts := startServer(t, withAdmin)
+
+	alice := joinTable(t, ts, "deck", "alice")
+	bob := joinTable(t, ts, "deck", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	if status := ts.request(t, http.MethodPost, "/api/admin/rooms/deck/broadcast", map[string]string{"text": "maintenance at 5"}, nil); status != http.StatusNoContent {
+		t.Fatalf("broadcast: status %d", status)
+	}
+	for _, c := range []*testClient{alice, bob} {
+		var message domain.SystemMessagePayload
+		e := c.expect(domain.EventSystem)
+		if e.decode(t, &message); e.UserID != domain.SystemUserID || message.Text != "maintenance at 5" {
+			t.Fatalf("system message from %s: %+v", e.UserID, message)
+		}
+	}
+
+	if status := ts.request(t, http.MethodPost, "/api/admin/rooms/deck/readonly", nil, nil); status != http.StatusNoContent {
+		t.Fatalf("read-only: status %d", status)
+	}
+	alice.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: "A1", Value: "1"}, "op-1")
+	var nack domain.NackPayload
+	if alice.expect(domain.EventNack).decode(t, &nack); nack.Code != "read_only" {
+		t.Fatalf("edit in a read-only room: %+v", nack)
+	}
+	if status := ts.request(t, http.MethodDelete, "/api/admin/rooms/deck/readonly", nil, nil); status != http.StatusNoContent {
+		t.Fatalf("read-write: status %d", status)
+	}
+	setCell(t, alice, "A1", "2")
+
+	if status := ts.request(t, http.MethodDelete, "/api/admin/rooms/deck", map[string]string{"reason": "done"}, nil); status != http.StatusNoContent {
+		t.Fatalf("close room: status %d", status)
+	}
+	for _, c := range []*testClient{alice, bob} {
+		if closeErr := c.expectClose(); closeErr.Code != websocket.CloseNormalClosure || closeErr.Text != "done" {
+			t.Fatalf("closed with %v", closeErr)
+		}
+	}
+
+	// Действия над несуществующей комнатой не удаются, и журнал это записывает
+	for _, action := range []struct{ method, path string }{
+		{http.MethodPost, "/api/admin/rooms/deck/broadcast"},
+		{http.MethodPost, "/api/admin/rooms/deck/readonly"},
+		{http.MethodDelete, "/api/admin/rooms/deck"},
+	} {
+		if status := ts.request(t, action.method, action.path, map[string]string{"text": "hello"}, nil); status != http.StatusNotFound {
+			t.Fatalf("%s %s after close: status %d", action.method, action.path, status)
+		}
+	}
+
+	entries := audit(t, ts)
+	want := []string{"broadcast", "read_only", "read_write", "close_room", "broadcast", "read_only", "close_room"}
+	if len(entries) != len(want) {
+		t.Fatalf("audit: %+v", entries)
+	}
+	for i, entry := range entries {
+		failed := strings.HasPrefix(entry.Details, "failed: ")
+		if entry.Action != want[i] || entry.RoomID != "deck" || entry.Actor != "admin" || failed != (i >= 4) {
+			t.Fatalf("audit entry %d: %+v", i, entry)
+		}
+	}
+
+	// Слишком большое тело отклоняется
+	long := strings.Repeat("a", 128<<10)
+	joinTable(t, ts, "deck", "carol")
+	if status := ts.request(t, http.MethodPost, "/api/admin/rooms/deck/broadcast", map[string]string{"text": long}, nil); status != http.StatusBadRequest {
+		t.Fatalf("oversized broadcast: status %d", status)
+	}
+}
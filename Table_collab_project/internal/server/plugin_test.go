@@ -0,0 +1,64 @@
+package server_test
+
+import (
+	"strings"
+	"testing"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+func TestPluginsInRoom(t *testing.T) {
+	ts := startServer(t, func(cfg *config.Config) {
+		cfg.Plugins.Rooms = map[string][]string{"sheet-*": {"formatter", "poll"}}
+	})
+
+	alice := ts.dial(t, "sheet-1", "")
+	alice.send(domain.EventJoinRoom, domain.JoinRoomPayload{Username: "alice", RoomType: domain.RoomTypeTable}, "")
+	alice.expect(domain.EventSync)
+	bob := ts.join(t, "sheet-1", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	// Formatter нормализует значение до рассылки, и ack, и bob видят итог
+	alice.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: "B2", Value: " 1,250 "}, "op-1")
+	alice.expect(domain.EventAck)
+	var cell domain.CellUpdatePayload
+	bob.expect(domain.EventCellUpdate).decode(t, &cell)
+	if cell.Cell != "B2" || cell.Value != "1250" {
+		t.Fatalf("bob got cell %+v, want B2=1250", cell)
+	}
+
+	// Команда опроса не попадает в чат, а ответ бота видят все, включая автора
+	alice.chat("/poll Deploy today? | Yes | No")
+	for _, c := range []*testClient{alice, bob} {
+		e := c.expect(domain.EventChatMessage)
+		var payload struct{ Text, Username string }
+		e.decode(t, &payload)
+		if e.UserID != "bot:poll" || payload.Username != "poll" || !strings.Contains(payload.Text, "Deploy today?") {
+			t.Fatalf("got chat %+v (%+v), want poll announcement", e, payload)
+		}
+	}
+
+	bob.chat("/vote 3")
+	var failure domain.ErrorPayload
+	bob.expect(domain.EventError).decode(t, &failure)
+	if failure.Code != "vetoed" || !strings.Contains(failure.Message, "from 1 to 2") {
+		t.Fatalf("invalid vote: got %+v", failure)
+	}
+
+	// Обычные сообщения проходят без изменений
+	bob.chat("hello")
+	e := alice.expect(domain.EventChatMessage)
+	if e.UserID != bob.id {
+		t.Fatalf("got chat from %s, want %s", e.UserID, bob.id)
+	}
+
+	// В комнатах без плагинов команды — обычный текст
+	carol := ts.join(t, "plain", "carol")
+	dave := ts.join(t, "plain", "dave")
+	carol.expect(domain.EventJoinRoom)
+	dave.chat("/poll A | B | C")
+	if e := carol.expect(domain.EventChatMessage); e.UserID != dave.id {
+		t.Fatalf("got chat from %s, want %s", e.UserID, dave.id)
+	}
+}
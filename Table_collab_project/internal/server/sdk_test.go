@@ -0,0 +1,154 @@
+package server_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+
+	"table_collab/pkg/websocket"
+)
+
+// sdkClient — клиент из pkg/websocket; drop рвёт его текущее TCP-соединение,
+// как обрыв сети.
+type sdkClient struct {
+	*websocket.Client
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (c *sdkClient) drop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn.Close()
+}
+
+// connect подключает клиента SDK с автоматическим переподключением.
+func (ts *testServer) connect(t *testing.T, roomID, username string) *sdkClient {
+	t.Helper()
+
+	c := &sdkClient{}
+	dialer := &gws.Dialer{
+		HandshakeTimeout: waitTimeout,
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err == nil {
+				c.mu.Lock()
+				c.conn = conn
+				c.mu.Unlock()
+			}
+			return conn, err
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	client, err := websocket.Dial(ctx, websocket.Options{
+		URL:            ts.URL,
+		RoomID:         roomID,
+		Username:       username,
+		Dialer:         dialer,
+		Reconnect:      true,
+		ReconnectDelay: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("dial %s as %s: %v", roomID, username, err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	c.Client = client
+	return c
+}
+
+func (c *sdkClient) expect(t *testing.T, eventType websocket.EventType) websocket.Event {
+	t.Helper()
+
+	timeout := time.After(waitTimeout)
+	for {
+		select {
+		case event := <-c.Events():
+			if event.Type == eventType {
+				return event
+			}
+		case <-c.Done():
+			t.Fatalf("client stopped: %v", c.Err())
+		case <-timeout:
+			t.Fatalf("no %s event", eventType)
+		}
+	}
+}
+
+func TestSDKEditsAndPresence(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.connect(t, "doc", "alice")
+	bob := ts.connect(t, "doc", "bob")
+	if joined := alice.expect(t, websocket.EventJoinRoom); joined.UserID != bob.ClientID() {
+		t.Fatalf("alice saw join of %s", joined.UserID)
+	}
+	if n := len(bob.State().Participants); n != 2 {
+		t.Fatalf("bob sees %d participants", n)
+	}
+
+	ack, err := alice.SendText(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update := bob.expect(t, websocket.EventTextUpdate); update.Version != ack.Version {
+		t.Fatalf("bob got v%d, ack v%d", update.Version, ack.Version)
+	}
+	if state := bob.State(); state.Content != "hello" || state.Version != ack.Version {
+		t.Fatalf("bob state %q v%d", state.Content, state.Version)
+	}
+
+	bob.SendChat("hi")
+	var chat websocket.ChatPayload
+	if alice.expect(t, websocket.EventChatMessage).Decode(&chat); chat.Text != "hi" {
+		t.Fatalf("alice got %q", chat.Text)
+	}
+}
+
+// После обрыва SDK продолжает сессию: для других участника не было выхода,
+// пропущенное досылается, правки продолжают подтверждаться.
+func TestSDKResumesAfterDrop(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.connect(t, "doc", "alice")
+	bob := ts.connect(t, "doc", "bob")
+	alice.expect(t, websocket.EventJoinRoom)
+	id := bob.ClientID()
+
+	bob.drop()
+	alice.SendChat("while you were away")
+
+	var chat websocket.ChatPayload
+	if bob.expect(t, websocket.EventChatMessage).Decode(&chat); chat.Text != "while you were away" {
+		t.Fatalf("bob got %q", chat.Text)
+	}
+	if bob.ClientID() != id {
+		t.Fatalf("bob is %s after resume, was %s", bob.ClientID(), id)
+	}
+
+	if _, err := bob.SendText(context.Background(), "back"); err != nil {
+		t.Fatalf("edit after resume: %v", err)
+	}
+	timeout := time.After(waitTimeout)
+	for {
+		select {
+		case event := <-alice.Events():
+			switch {
+			case event.Type == websocket.EventLeaveRoom || event.Type == websocket.EventJoinRoom:
+				t.Fatalf("alice saw %s of %s across bob's resume", event.Type, event.UserID)
+			case event.Type == websocket.EventTextUpdate && event.UserID == id:
+				return
+			}
+		case <-timeout:
+			t.Fatal("alice did not get bob's edit")
+		}
+	}
+}
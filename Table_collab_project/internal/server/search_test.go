@@ -0,0 +1,102 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+	"table_collab/internal/service/search"
+)
+
+type searchResult struct {
+	Total int          `json:"total"`
+	Hits  []search.Hit `json:"hits"`
+}
+
+func (ts *testServer) search(t *testing.T, query string) searchResult {
+	t.Helper()
+
+	var result searchResult
+	if status := ts.request(t, http.MethodGet, "/api/search?"+query, nil, &result); status != http.StatusOK {
+		t.Fatalf("search %s: status %d", query, status)
+	}
+	return result
+}
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	withSearch := func(cfg *config.Config) {
+		cfg.Admin.Token = "admin-token"
+		cfg.App.SearchChatHistory = 100
+		cfg.EventLog = config.EventLogConfig{Dir: dir, KeepSnapshots: 1}
+	}
+
+	ts := startServer(t, withSearch)
+	alice := ts.join(t, "launch", "alice")
+	alice.send(domain.EventTextUpdate, domain.TextUpdatePayload{Text: "Launch checklist: verify the <rollback> plan"}, "op-1")
+	alice.expect(domain.EventAck)
+	alice.chat("who owns the rollback?")
+
+	bob := joinTable(t, ts, "tracker", "bob")
+	setCell(t, bob, "c4", "Rollback owner: Dana")
+
+	result := ts.search(t, "q=rollback&rooms=launch")
+	if result.Total != 2 {
+		t.Fatalf("search in launch: %+v", result)
+	}
+	text, chat := result.Hits[0], result.Hits[1]
+	if text.Kind == search.KindChat {
+		text, chat = chat, text
+	}
+	if text.Kind != search.KindText || text.Highlighted != "Launch checklist: verify the &lt;<mark>rollback</mark>&gt; plan" {
+		t.Fatalf("text hit: %+v", text)
+	}
+	if chat.Kind != search.KindChat || chat.Username != "alice" || chat.UserID != alice.id {
+		t.Fatalf("chat hit: %+v", chat)
+	}
+
+	cell := ts.search(t, "q=dana&rooms=launch,tracker")
+	if cell.Total != 1 || cell.Hits[0].Key != "sheet1!C4" || cell.Hits[0].RoomName != "tracker" {
+		t.Fatalf("cell hit: %+v", cell)
+	}
+
+	// Без токена администратора нужно явно перечислить комнаты
+	ts.adminToken = ""
+	if status := ts.request(t, http.MethodGet, "/api/search?q=rollback", nil, nil); status != http.StatusBadRequest {
+		t.Fatalf("search without rooms: status %d", status)
+	}
+	ts.adminToken = "admin-token"
+	if all := ts.search(t, "q=rollback&kind=text,cell"); all.Total != 2 {
+		t.Fatalf("admin search: %+v", all)
+	}
+
+	// Правка заменяет прежний текст в индексе
+	alice.send(domain.EventTextUpdate, domain.TextUpdatePayload{Text: "Launch postponed"}, "op-2")
+	alice.expect(domain.EventAck)
+	if got := ts.search(t, "q=checklist&rooms=launch"); got.Total != 0 {
+		t.Fatalf("stale text found: %+v", got)
+	}
+
+	if err := ts.app.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	// Чат не входит в состояние комнаты и восстанавливается из журнала
+	restarted := startServer(t, withSearch)
+	if got := restarted.search(t, "q=owns&rooms=launch"); got.Total != 1 || !strings.Contains(got.Hits[0].Highlighted, "<mark>owns</mark>") {
+		t.Fatalf("chat after restart: %+v", got)
+	}
+	if got := restarted.search(t, "q=postp*&rooms=launch"); got.Total != 1 {
+		t.Fatalf("text after restart: %+v", got)
+	}
+
+	if status := restarted.request(t, http.MethodDelete, "/api/admin/rooms/launch", nil, nil); status != http.StatusNoContent {
+		t.Fatalf("close room: status %d", status)
+	}
+	if got := restarted.search(t, "q=launch"); got.Total != 0 {
+		t.Fatalf("closed room found: %+v", got)
+	}
+}
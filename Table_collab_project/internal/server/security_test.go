@@ -0,0 +1,70 @@
+package server_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func preflight(t *testing.T, ts *testServer, origin string) http.Header {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodOptions, ts.URL+"/api/rooms", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.Header
+}
+
+// CORS и апгрейд WebSocket следуют одному списку разрешённых Origin.
+func TestSecurityPolicy(t *testing.T) {
+	ts := startServer(t)
+
+	allowed := preflight(t, ts, "http://localhost:3000")
+	if allowed.Get("Access-Control-Allow-Origin") != "http://localhost:3000" ||
+		allowed.Get("Access-Control-Allow-Credentials") != "true" ||
+		!strings.Contains(allowed.Get("Access-Control-Allow-Methods"), http.MethodPost) {
+		t.Fatalf("allowed preflight headers %v", allowed)
+	}
+	if denied := preflight(t, ts, "https://evil.example.com"); denied.Get("Access-Control-Allow-Origin") != "" ||
+		denied.Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("denied preflight headers %v", denied)
+	}
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws/room"
+	dialer := websocket.Dialer{Subprotocols: []string{"chat.v2", "tablecollab.v1"}}
+	conn, resp, err := dialer.Dial(url, http.Header{"Origin": {"http://localhost:3000"}})
+	if err != nil {
+		t.Fatalf("dial from an allowed origin: %v", err)
+	}
+	conn.Close()
+	if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != "tablecollab.v1" {
+		t.Fatalf("negotiated subprotocol %q", got)
+	}
+
+	for _, tt := range []struct {
+		origin    string
+		protocols []string
+		status    int
+	}{
+		{"https://evil.example.com", []string{"tablecollab.v1"}, http.StatusForbidden},
+		{"http://localhost:3000", []string{"chat.v2"}, http.StatusBadRequest},
+	} {
+		dialer := websocket.Dialer{Subprotocols: tt.protocols}
+		conn, resp, err := dialer.Dial(url, http.Header{"Origin": {tt.origin}})
+		if err == nil {
+			conn.Close()
+			t.Fatalf("%s %v: connected", tt.origin, tt.protocols)
+		}
+		if resp == nil || resp.StatusCode != tt.status {
+			t.Fatalf("%s %v: %v", tt.origin, tt.protocols, err)
+		}
+	}
+}
@@ -3,10 +3,12 @@ package server
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -15,14 +17,29 @@ import (
 	"github.com/go-chi/cors"
 
 	"table_collab/cmd/server/config"
+	"table_collab/internal/logging"
+	"table_collab/internal/server/admin"
+	"table_collab/internal/server/api"
+	"table_collab/internal/server/fallback"
+	appmiddleware "table_collab/internal/server/middleware"
 	"table_collab/internal/server/ws"
 	"table_collab/internal/service"
+	"table_collab/internal/storage/memory"
+	"table_collab/internal/tracing"
 )
 
 type Server struct {
-	router *chi.Mux
-	config *config.Config
-	hub    *service.Hub
+	router   *chi.Mux
+	config   *config.Config
+	hub      *service.Hub
+	audit    *memory.AuditStore
+	ws       *ws.Handler
+	fallback *fallback.Handler
+	api      *api.Handler
+
+	origins *appmiddleware.OriginPolicy
+
+	draining atomic.Bool
 }
 
 func New(cfg *config.Config) *Server {
@@ -30,7 +47,13 @@ func New(cfg *config.Config) *Server {
 		router: chi.NewRouter(),
 		config: cfg,
 		hub:    service.NewHub(cfg),
+		audit:  memory.NewAuditStore(cfg.Admin.AuditLogSize),
+
+		origins: appmiddleware.NewOriginPolicy(cfg.Security.AllowedOrigins),
 	}
+	s.ws = ws.NewHandler(s.hub, cfg, s.origins)
+	s.fallback = fallback.NewHandler(s.hub, cfg, s.origins)
+	s.api = api.NewHandler(s.hub, cfg)
 
 	s.setupMiddleware()
 	s.setupRoutes()
@@ -43,29 +66,69 @@ func New(cfg *config.Config) *Server {
 func (s *Server) setupMiddleware() {
 	s.router.Use(middleware.RequestID)
 	s.router.Use(middleware.RealIP)
-	s.router.Use(middleware.Logger)
+	s.router.Use(appmiddleware.Tracing(tracing.Tracer()))
+	s.router.Use(appmiddleware.RequestLogger)
 	s.router.Use(middleware.Recoverer)
-	s.router.Use(middleware.Timeout(60 * time.Second))
-
-	if s.config.Server.Env == "development" {
-		s.router.Use(cors.Handler(cors.Options{
-			AllowedOrigins:   []string{"http://localhost:3000", "http://127.0.0.1:3000"},
-			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-			AllowCredentials: true,
-			MaxAge:           300,
-		}))
-	}
+
+	s.router.Use(cors.Handler(cors.Options{
+		AllowOriginFunc: func(r *http.Request, origin string) bool {
+			return s.origins.Allowed(origin)
+		},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", api.SessionHeader},
+		AllowCredentials: true,
+		MaxAge:           300,
+	}))
 }
 
 func (s *Server) setupRoutes() {
-	s.router.Handle("/static/*", http.StripPrefix("/static/",
-		http.FileServer(http.Dir("./web/static"))))
+	// Долгоживущие соединения идут без общего таймаута запроса
+	s.router.With(s.acceptingConnections).Get("/ws/{roomID}", s.handleWebSocket)
+	s.router.With(s.acceptingConnections).Get("/sse/{roomID}", s.handleSSE)
+	s.router.With(s.acceptingConnections).Post("/poll/{roomID}", s.handleLongPollOpen)
+	s.router.Get("/poll/{roomID}/{connID}", s.handleLongPoll)
+	s.router.Post("/sse/{roomID}/{connID}", s.handleTransportSend)
+	s.router.Post("/poll/{roomID}/{connID}", s.handleTransportSend)
+	s.router.Delete("/sse/{roomID}/{connID}", s.handleTransportClose)
+	s.router.Delete("/poll/{roomID}/{connID}", s.handleTransportClose)
+
+	// Зрители по ссылкам share: комната определяется по токену
+	s.router.With(s.acceptingConnections).Get("/ws/share/{token}", s.handleWebSocket)
+	s.router.With(s.acceptingConnections).Get("/sse/share/{token}", s.handleSSE)
+	s.router.With(s.acceptingConnections).Post("/poll/share/{token}", s.handleLongPollOpen)
+	s.router.Get("/poll/share/{token}/{connID}", s.handleLongPoll)
+	s.router.Post("/sse/share/{token}/{connID}", s.handleTransportSend)
+	s.router.Post("/poll/share/{token}/{connID}", s.handleTransportSend)
+	s.router.Delete("/sse/share/{token}/{connID}", s.handleTransportClose)
+	s.router.Delete("/poll/share/{token}/{connID}", s.handleTransportClose)
+
+	s.router.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(60 * time.Second))
+
+		r.Handle("/static/*", http.StripPrefix("/static/",
+			http.FileServer(http.Dir("./web/static"))))
+
+		r.Get("/api/health", s.handleHealth)
+		r.Mount("/api/templates", s.api.TemplateRoutes())
+		r.Mount("/api/rooms", s.api.RoomRoutes())
+		r.Mount("/api/shares", s.api.ShareRoutes())
+		r.Mount("/api/search", s.api.SearchRoutes())
+		r.Get("/", s.handleHome)
+		r.Get("/room/{roomID}", s.handleRoomPage)
+
+		if s.config.Admin.Token != "" {
+			r.With(appmiddleware.AdminAuth(s.config.Admin.Token)).
+				Mount("/api/admin", admin.NewHandler(s.hub, s.audit).Routes())
+		} else {
+			slog.Warn("ADMIN_TOKEN is not set, admin API disabled")
+		}
+	})
+}
 
-	s.router.Get("/api/health", s.handleHealth)
-	s.router.Get("/ws/{roomID}", s.handleWebSocket)
-	s.router.Get("/", s.handleHome)
-	s.router.Get("/room/{roomID}", s.handleRoomPage)
+// Handler возвращает HTTP-обработчик сервера — для запуска внутри тестов
+// и нагрузочного стенда без ListenAndServe.
+func (s *Server) Handler() http.Handler {
+	return s.router
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -81,10 +144,50 @@ func (s *Server) handleRoomPage(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "./web/templates/room.html")
 }
 
+// acceptingConnections не пускает новые подключения во время остановки сервера.
+func (s *Server) acceptingConnections(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.draining.Load() {
+			w.Header().Set("Retry-After", strconv.Itoa(s.config.Server.ReconnectDelay))
+			http.Error(w, "server is restarting", http.StatusServiceUnavailable)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	roomID := chi.URLParam(r, "roomID")
-	wsHandler := ws.NewHandler(s.hub)
-	wsHandler.ServeWebSocket(roomID, w, r)
+	if token := chi.URLParam(r, "token"); token != "" {
+		s.ws.ServeShare(token, w, r)
+		return
+	}
+	s.ws.ServeWebSocket(chi.URLParam(r, "roomID"), w, r)
+}
+
+func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
+	s.fallback.ServeSSE(target(r), w, r)
+}
+
+func (s *Server) handleLongPollOpen(w http.ResponseWriter, r *http.Request) {
+	s.fallback.ServeLongPollOpen(target(r), w, r)
+}
+
+func (s *Server) handleLongPoll(w http.ResponseWriter, r *http.Request) {
+	s.fallback.ServeLongPoll(target(r), chi.URLParam(r, "connID"), w, r)
+}
+
+func (s *Server) handleTransportSend(w http.ResponseWriter, r *http.Request) {
+	s.fallback.ServeSend(target(r), chi.URLParam(r, "connID"), w, r)
+}
+
+func (s *Server) handleTransportClose(w http.ResponseWriter, r *http.Request) {
+	s.fallback.ServeClose(target(r), chi.URLParam(r, "connID"), w, r)
+}
+
+// target — комната из адреса или ссылка share для маршрутов зрителей.
+func target(r *http.Request) fallback.Target {
+	return fallback.Target{RoomID: chi.URLParam(r, "roomID"), Share: chi.URLParam(r, "token")}
 }
 
 func (s *Server) Start() error {
@@ -100,24 +203,38 @@ func (s *Server) Start() error {
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
-		log.Printf("Server running on %s", srv.Addr)
+		slog.Info("Server running", "address", srv.Addr, "env", s.config.Server.Env)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server error: %v", err)
+			slog.Error("Server error", logging.Err(err))
+			os.Exit(1)
 		}
 	}()
 
 	<-stop
-	log.Println("Shutting down...")
+	slog.Info("Shutting down")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	timeout := time.Duration(s.config.Server.ShutdownTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	s.hub.Stop()
+	if err := s.Shutdown(ctx); err != nil {
+		slog.Error("Hub shutdown failed", logging.Err(err))
+	}
 
 	if err := srv.Shutdown(ctx); err != nil {
 		return fmt.Errorf("shutdown failed: %v", err)
 	}
 
-	log.Println("Server stopped")
+	slog.Info("Server stopped")
 	return nil
 }
+
+// Shutdown перестаёт принимать подключения, сохраняет комнаты и закрывает
+// соединения клиентов с просьбой переподключиться. HTTP-сервер при этом не
+// останавливается — это забота вызывающего.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.draining.Store(true)
+
+	reconnectIn := time.Duration(s.config.Server.ReconnectDelay) * time.Second
+	return s.hub.Shutdown(ctx, reconnectIn)
+}
@@ -0,0 +1,226 @@
+package server_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+func withShares(cfg *config.Config) {
+	cfg.Admin.Token = "admin-token"
+	cfg.App.MaxSpectatorsPerRoom = 2
+}
+
+// shareLink — ответ на создание ссылки: сама ссылка и адреса для зрителей.
+type shareLink struct {
+	domain.ShareLink
+	WebSocket string `json:"websocket"`
+	SSE       string `json:"sse"`
+	LongPoll  string `json:"long_poll"`
+}
+
+func createShare(t *testing.T, ts *testServer, roomID string) shareLink {
+	t.Helper()
+
+	var link shareLink
+	status := ts.request(t, http.MethodPost, "/api/admin/rooms/"+roomID+"/shares", map[string]string{"label": "all-hands"}, &link)
+	if status != http.StatusCreated || link.Token == "" {
+		t.Fatalf("create share: status %d, link %+v", status, link)
+	}
+	return link
+}
+
+// spectate подключается по ссылке share и дожидается sync.
+func spectate(t *testing.T, ts *testServer, link shareLink) *testClient {
+	t.Helper()
+
+	c := ts.dial(t, "share/"+link.Token, "")
+	c.expect(domain.EventSync).decode(t, &c.sync)
+	return c
+}
+
+type adminRoom struct {
+	ID         string `json:"id"`
+	Clients    int    `json:"client_count"`
+	Spectators int    `json:"spectator_count"`
+}
+
+// waitSpectators ждёт, пока admin API покажет n зрителей в комнате.
+func waitSpectators(t *testing.T, ts *testServer, roomID string, n int) adminRoom {
+	t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		var rooms []adminRoom
+		ts.request(t, http.MethodGet, "/api/admin/rooms", nil, &rooms)
+		for _, room := range rooms {
+			if room.ID == roomID && room.Spectators == n {
+				return room
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("room %s: want %d spectators, rooms %+v", roomID, n, rooms)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSpectators(t *testing.T) {
+	ts := startServer(t, withShares)
+
+	alice := joinTable(t, ts, "deck", "alice")
+	setCell(t, alice, "A1", "1")
+	setCell(t, alice, "B1", "=A1*2")
+	link := createShare(t, ts, "deck")
+
+	viewer := spectate(t, ts, link)
+	sync := viewer.sync
+	if !sync.Spectator || !sync.ReadOnly || len(sync.Participants) != 0 {
+		t.Fatalf("spectator sync: spectator %v, read-only %v, participants %+v", sync.Spectator, sync.ReadOnly, sync.Participants)
+	}
+	if len(sync.Sheets) == 0 || sync.Sheets[0].Cells["B1"] != "=A1*2" || sync.Sheets[0].Values["B1"] != "2" {
+		t.Fatalf("spectator sync sheets: %+v", sync.Sheets)
+	}
+
+	// Зритель не входит в присутствие и не видит его
+	bob := joinTable(t, ts, "deck", "bob")
+	if len(bob.sync.Participants) != 2 {
+		t.Fatalf("bob sees participants %+v", bob.sync.Participants)
+	}
+	alice.expect(domain.EventJoinRoom)
+	bob.send(domain.EventCursorMove, map[string]int{"x": 1, "y": 2}, "")
+	alice.expect(domain.EventCursorMove)
+
+	setCell(t, alice, "A1", "5")
+	update := viewer.next()
+	if update.Type != domain.EventCellUpdate {
+		t.Fatalf("spectator got %s, want cell_update", update.Type)
+	}
+	var computed domain.CellsComputedPayload
+	if e := viewer.next(); e.Type != domain.EventCellsComputed {
+		t.Fatalf("spectator got %s, want cells_computed", e.Type)
+	} else {
+		e.decode(t, &computed)
+	}
+	if computed.Values[sync.Sheets[0].ID]["B1"] != "10" {
+		t.Fatalf("spectator computed %+v", computed.Values)
+	}
+
+	viewer.chat("hello")
+	var failure domain.ErrorPayload
+	viewer.expect(domain.EventError).decode(t, &failure)
+	if failure.Code != "spectator" {
+		t.Fatalf("spectator chat: %+v", failure)
+	}
+
+	if room := waitSpectators(t, ts, "deck", 1); room.Clients != 2 {
+		t.Fatalf("admin rooms: %+v", room)
+	}
+
+	// Лимит зрителей отдельный от участников
+	spectate(t, ts, link)
+	third := ts.dial(t, "share/"+link.Token, "")
+	if closeErr := third.expectClose(); closeErr.Code != websocket.ClosePolicyViolation ||
+		!strings.Contains(closeErr.Text, "too many spectators") {
+		t.Fatalf("third spectator closed with %v", closeErr)
+	}
+
+	if status := ts.request(t, http.MethodDelete, "/api/admin/rooms/deck/shares/"+link.Token, nil, nil); status != http.StatusNoContent {
+		t.Fatalf("revoke: status %d", status)
+	}
+	if closeErr := viewer.expectClose(); closeErr.Code != websocket.ClosePolicyViolation {
+		t.Fatalf("revoked spectator closed with %v", closeErr)
+	}
+	waitSpectators(t, ts, "deck", 0)
+
+	var links []domain.ShareLink
+	if status := ts.request(t, http.MethodGet, "/api/admin/rooms/deck/shares", nil, &links); status != http.StatusOK || len(links) != 0 {
+		t.Fatalf("shares after revoke: status %d, %+v", status, links)
+	}
+}
+
+func TestSpectatorRejected(t *testing.T) {
+	ts := startServer(t, withShares)
+
+	joinTable(t, ts, "deck", "alice")
+	link := createShare(t, ts, "deck")
+
+	if status := ts.request(t, http.MethodPost, "/api/admin/rooms/missing/shares", nil, nil); status != http.StatusNotFound {
+		t.Fatalf("share for a missing room: status %d", status)
+	}
+
+	// Неизвестный токен отклоняется до апгрейда, а старый вид ссылки с ID
+	// комнаты не пускает ни зрителем, ни участником
+	rejected := map[string]int{
+		"/ws/share/bogus":               http.StatusForbidden,
+		"/ws/deck?share=" + link.Token:  http.StatusBadRequest,
+		"/ws/deck?share=bogus":          http.StatusBadRequest,
+		"/sse/share/bogus":              http.StatusForbidden,
+		"/sse/deck?share=" + link.Token: http.StatusBadRequest,
+	}
+	for path, want := range rejected {
+		if strings.HasPrefix(path, "/sse/") {
+			if status := ts.request(t, http.MethodGet, path, nil, nil); status != want {
+				t.Fatalf("%s: status %d, want %d", path, status, want)
+			}
+			continue
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+path, nil)
+		if err == nil {
+			conn.Close()
+			t.Fatalf("%s: connected", path)
+		}
+		if resp == nil || resp.StatusCode != want {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+}
+
+// Ссылка share не содержит ID комнаты, и ни одно событие зрителю его не
+// показывает: по ссылке нельзя подключиться к комнате участником.
+func TestShareHidesRoom(t *testing.T) {
+	ts := startServer(t, withShares, func(cfg *config.Config) {
+		cfg.App.MaxSpectatorsPerRoom = 3
+	})
+
+	alice := joinTable(t, ts, "deck", "alice")
+	link := createShare(t, ts, "deck")
+	for _, path := range []string{link.WebSocket, link.SSE, link.LongPoll} {
+		if strings.Contains(path, "deck") {
+			t.Fatalf("share link %s reveals the room", path)
+		}
+	}
+
+	viewers := map[string]peer{
+		"websocket": spectate(t, ts, link),
+		"sse":       ts.dialSSE(t, "share/"+link.Token),
+		"longpoll":  ts.dialLongPoll(t, "share/"+link.Token),
+	}
+	waitSpectators(t, ts, "deck", 3)
+
+	setCell(t, alice, "A1", "1")
+	for name, viewer := range viewers {
+		if name != "websocket" {
+			expectPeer(t, viewer, domain.EventSync)
+		}
+		if e := expectPeer(t, viewer, domain.EventCellUpdate); e.RoomID != "" {
+			t.Fatalf("%s: spectator got room_id %q", name, e.RoomID)
+		}
+
+		// Вход из соединения зрителя не делает его участником
+		viewer.send(domain.EventJoinRoom, domain.JoinRoomPayload{Username: "mallory"}, "")
+		var failure domain.ErrorPayload
+		if expectPeer(t, viewer, domain.EventError).decode(t, &failure); failure.Code != "spectator" {
+			t.Fatalf("%s: join from a spectator: %+v", name, failure)
+		}
+	}
+	if room := waitSpectators(t, ts, "deck", 3); room.Clients != 1 {
+		t.Fatalf("spectators joined as participants: %+v", room)
+	}
+}
@@ -0,0 +1,233 @@
+package server_test
+
+import (
+	"testing"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/service/collaboration"
+)
+
+func TestSheets(t *testing.T) {
+	ts := startServer(t)
+
+	alice := joinTable(t, ts, "budget", "alice")
+	if len(alice.sync.Sheets) != 1 || alice.sync.Sheets[0].ID != collaboration.DefaultSheetID {
+		t.Fatalf("new table room sheets: %+v", alice.sync.Sheets)
+	}
+	bob := joinTable(t, ts, "budget", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	// Автор получает лист с назначенным сервером ID вместе со своим op_id
+	alice.send(domain.EventSheetAdd, domain.SheetAddPayload{Name: "Totals"}, "add-1")
+	var added domain.SheetAddPayload
+	e := alice.expect(domain.EventSheetAdd)
+	e.decode(t, &added)
+	if e.OpID != "add-1" || added.SheetID == "" || added.Name != "Totals" || *added.Index != 1 {
+		t.Fatalf("alice got %+v (op_id %q)", added, e.OpID)
+	}
+	alice.expect(domain.EventAck)
+	var seen domain.SheetAddPayload
+	bob.expect(domain.EventSheetAdd).decode(t, &seen)
+	if seen.SheetID != added.SheetID {
+		t.Fatalf("bob sees %+v", seen)
+	}
+
+	bob.send(domain.EventSheetView, domain.SheetViewPayload{SheetID: added.SheetID}, "")
+	var view domain.SheetViewPayload
+	if e := alice.expect(domain.EventSheetView); e.UserID != bob.id {
+		t.Fatalf("sheet_view from %s", e.UserID)
+	} else {
+		e.decode(t, &view)
+	}
+	if view.SheetID != added.SheetID {
+		t.Fatalf("bob views %+v", view)
+	}
+
+	// Формула на новом листе ссылается на первый и пересчитывается у всех
+	setCell(t, alice, "A1", "40")
+	alice.send(domain.EventCellUpdate, domain.CellUpdatePayload{SheetID: added.SheetID, Cell: "b2", Value: "=Sheet1!A1+2"}, "f-1")
+	var computed domain.CellsComputedPayload
+	alice.expect(domain.EventCellsComputed).decode(t, &computed)
+	if computed.Values[added.SheetID]["B2"] != "42" {
+		t.Fatalf("alice computed %+v", computed)
+	}
+	alice.expect(domain.EventAck)
+
+	var update domain.CellUpdatePayload
+	bob.expect(domain.EventCellUpdate) // A1 на первом листе
+	bob.expect(domain.EventCellUpdate).decode(t, &update)
+	if update.SheetID != added.SheetID || update.Cell != "B2" {
+		t.Fatalf("bob got %+v", update)
+	}
+	bob.expect(domain.EventCellsComputed).decode(t, &computed)
+	if computed.Values[added.SheetID]["B2"] != "42" {
+		t.Fatalf("bob computed %+v", computed)
+	}
+
+	alice.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: "A1", Value: "1"}, "f-2")
+	alice.expect(domain.EventCellsComputed).decode(t, &computed)
+	if computed.Values[added.SheetID]["B2"] != "3" {
+		t.Fatalf("recomputed %+v", computed)
+	}
+	alice.expect(domain.EventAck)
+
+	// Переименование переписывает ссылки в формулах
+	alice.send(domain.EventSheetRename, domain.SheetRenamePayload{SheetID: collaboration.DefaultSheetID, Name: "Raw data"}, "r-1")
+	alice.expect(domain.EventAck)
+	alice.send(domain.EventSheetRename, domain.SheetRenamePayload{SheetID: added.SheetID, Name: "raw DATA"}, "r-2")
+	var rejected domain.NackPayload
+	alice.expect(domain.EventNack).decode(t, &rejected)
+	if rejected.Code != "sheet_name_taken" {
+		t.Fatalf("duplicate name: %+v", rejected)
+	}
+
+	alice.send(domain.EventSheetMove, domain.SheetMovePayload{SheetID: added.SheetID, Index: 0}, "m-1")
+	alice.expect(domain.EventAck)
+	alice.send(domain.EventColumnUpdate, domain.ColumnUpdatePayload{SheetID: added.SheetID, Column: "b", Settings: domain.Column{Title: "Sum", Width: 80}}, "c-1")
+	alice.expect(domain.EventAck)
+
+	carol := joinTable(t, ts, "budget", "carol")
+	sheets := carol.sync.Sheets
+	if len(sheets) != 2 || sheets[0].ID != added.SheetID || sheets[1].Name != "Raw data" {
+		t.Fatalf("carol sync sheets: %+v", sheets)
+	}
+	if sheets[0].Cells["B2"] != "='Raw data'!A1+2" || sheets[0].Values["B2"] != "3" || sheets[0].Columns["B"].Title != "Sum" {
+		t.Fatalf("carol sync totals: %+v", sheets[0])
+	}
+	for _, p := range carol.sync.Participants {
+		if p.ID == bob.id && p.Sheet != added.SheetID {
+			t.Fatalf("bob's presence: %+v", p)
+		}
+	}
+
+	// Удаление листа, на который ссылается формула, даёт #REF!
+	alice.send(domain.EventSheetDelete, domain.SheetDeletePayload{SheetID: collaboration.DefaultSheetID}, "d-1")
+	alice.expect(domain.EventCellsComputed).decode(t, &computed)
+	if computed.Values[added.SheetID]["B2"] != "#REF!" {
+		t.Fatalf("after delete %+v", computed)
+	}
+	alice.expect(domain.EventAck)
+
+	alice.send(domain.EventSheetDelete, domain.SheetDeletePayload{SheetID: added.SheetID}, "d-2")
+	alice.expect(domain.EventNack).decode(t, &rejected)
+	if rejected.Code != "last_sheet" {
+		t.Fatalf("deleting the last sheet: %+v", rejected)
+	}
+}
+
+func TestSheetsRequireTableRoom(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.join(t, "doc", "alice")
+	alice.send(domain.EventSheetAdd, domain.SheetAddPayload{Name: "Extra"}, "add-1")
+	var rejected domain.NackPayload
+	alice.expect(domain.EventNack).decode(t, &rejected)
+	if rejected.Code != "wrong_room_type" {
+		t.Fatalf("sheet_add in a document room: %+v", rejected)
+	}
+}
+
+func TestColumnValidation(t *testing.T) {
+	ts := startServer(t)
+
+	alice := joinTable(t, ts, "tracker", "alice")
+	bob := joinTable(t, ts, "tracker", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	alice.send(domain.EventColumnUpdate, domain.ColumnUpdatePayload{Column: "A", Settings: domain.Column{
+		Title: "Status", Type: domain.ColumnSingleSelect,
+		Rules: domain.ColumnRules{Required: true, Allowed: []string{"Open", "Done"}},
+	}}, "c-1")
+	alice.expect(domain.EventAck)
+	alice.send(domain.EventColumnUpdate, domain.ColumnUpdatePayload{Column: "B", Settings: domain.Column{Type: domain.ColumnUser}}, "c-2")
+	alice.expect(domain.EventAck)
+	bob.expect(domain.EventColumnUpdate)
+	bob.expect(domain.EventColumnUpdate)
+
+	// Принятое значение рассылается в нормализованном виде
+	alice.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: "A2", Value: "open"}, "e-1")
+	alice.expect(domain.EventAck)
+	var update domain.CellUpdatePayload
+	bob.expect(domain.EventCellUpdate).decode(t, &update)
+	if update.Value != "Open" {
+		t.Fatalf("bob got %+v", update)
+	}
+
+	rejects := []struct {
+		cell, value, rule string
+	}{
+		{"A3", "Later", collaboration.RuleAllowed},
+		{"B2", "mallory", collaboration.RuleType},
+	}
+	for _, tt := range rejects {
+		alice.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: tt.cell, Value: tt.value}, "bad-"+tt.cell)
+		var rejected domain.NackPayload
+		alice.expect(domain.EventNack).decode(t, &rejected)
+		if rejected.Code != "validation_failed" || rejected.Rule != tt.rule || rejected.Cell != tt.cell {
+			t.Fatalf("%s = %q: %+v", tt.cell, tt.value, rejected)
+		}
+	}
+
+	setCell(t, alice, "B2", "BOB")
+	bob.expect(domain.EventCellUpdate).decode(t, &update)
+	if update.Value != "bob" {
+		t.Fatalf("user reference: %+v", update)
+	}
+
+	alice.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: "A2"}, "clear")
+	var rejected domain.NackPayload
+	alice.expect(domain.EventNack).decode(t, &rejected)
+	if rejected.Rule != collaboration.RuleRequired {
+		t.Fatalf("clearing a required cell: %+v", rejected)
+	}
+
+	// Схема, которой не соответствуют данные, отклоняется с адресом ячейки
+	alice.send(domain.EventColumnUpdate, domain.ColumnUpdatePayload{Column: "B", Settings: domain.Column{Type: domain.ColumnNumber}}, "c-3")
+	alice.expect(domain.EventNack).decode(t, &rejected)
+	if rejected.Code != "validation_failed" || rejected.Cell != "B2" {
+		t.Fatalf("incompatible schema: %+v", rejected)
+	}
+}
+
+// Формула в числовом столбце проверяется по результату: правка, после
+// которой формула выходит за max, отклоняется и откатывается.
+func TestFormulaColumnRules(t *testing.T) {
+	ts := startServer(t)
+
+	alice := joinTable(t, ts, "budget", "alice")
+	alice.send(domain.EventColumnUpdate, domain.ColumnUpdatePayload{Column: "B", Settings: domain.Column{
+		Type: domain.ColumnNumber, Rules: domain.ColumnRules{Max: "100"},
+	}}, "c-1")
+	alice.expect(domain.EventAck)
+	setCell(t, alice, "A1", "10")
+	setCell(t, alice, "B1", "=A1*2")
+
+	rejects := []struct {
+		cell, value string
+	}{
+		{"B1", "=A1*20"},
+		{"A1", "60"},
+	}
+	for _, tt := range rejects {
+		alice.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: tt.cell, Value: tt.value}, "bad-"+tt.cell)
+		var rejected domain.NackPayload
+		alice.expect(domain.EventNack).decode(t, &rejected)
+		if rejected.Code != "validation_failed" || rejected.Rule != collaboration.RuleMax || rejected.Cell != "B1" {
+			t.Fatalf("%s = %q: %+v", tt.cell, tt.value, rejected)
+		}
+	}
+
+	bob := joinTable(t, ts, "budget", "bob")
+	if sheet := bob.sync.Sheets[0]; sheet.Cells["A1"] != "10" || sheet.Cells["B1"] != "=A1*2" || sheet.Values["B1"] != "20" {
+		t.Fatalf("rejected edits were kept: cells %v, values %v", sheet.Cells, sheet.Values)
+	}
+
+	// Схема, которой не соответствует результат формулы, не принимается
+	alice.send(domain.EventColumnUpdate, domain.ColumnUpdatePayload{Column: "B", Settings: domain.Column{
+		Type: domain.ColumnNumber, Rules: domain.ColumnRules{Max: "10"},
+	}}, "c-2")
+	var rejected domain.NackPayload
+	if alice.expect(domain.EventNack).decode(t, &rejected); rejected.Rule != collaboration.RuleMax || rejected.Cell != "B1" {
+		t.Fatalf("schema below the computed value: %+v", rejected)
+	}
+}
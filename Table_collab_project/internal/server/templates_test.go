@@ -0,0 +1,128 @@
+package server_test
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+type createdRoom struct {
+	ID     string             `json:"id"`
+	Name   string             `json:"name"`
+	Origin *domain.RoomOrigin `json:"origin"`
+}
+
+func TestRoomFromTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "templates.json")
+	withTemplates := func(cfg *config.Config) { cfg.App.TemplatePath = path }
+	ts := startServer(t, withTemplates)
+
+	alice := joinTable(t, ts, "sprint-1", "alice")
+	alice.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: "A1", Value: "Sprint {{sprint}}"}, "e-1")
+	alice.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: "B1", Value: "Owner: {{owner}}"}, "e-2")
+	alice.expect(domain.EventAck)
+	alice.expect(domain.EventAck)
+
+	var template domain.RoomTemplate
+	status := ts.request(t, http.MethodPost, "/api/templates", map[string]string{
+		"room_id":   "sprint-1",
+		"name":      "Sprint table",
+		"room_name": "Sprint {{sprint}}",
+	}, &template)
+	if status != http.StatusCreated || template.Type != domain.RoomTypeTable || len(template.Placeholders) != 2 {
+		t.Fatalf("create template: %d %+v", status, template)
+	}
+
+	rooms := "/api/templates/" + template.ID + "/rooms"
+	if status := ts.request(t, http.MethodPost, rooms, map[string]interface{}{
+		"room_id": "sprint-2",
+		"values":  map[string]string{"sprint": "2"},
+	}, nil); status != http.StatusBadRequest {
+		t.Fatalf("missing placeholder: got %d", status)
+	}
+
+	var room createdRoom
+	status = ts.request(t, http.MethodPost, rooms, map[string]interface{}{
+		"room_id": "sprint-2",
+		"values":  map[string]string{"sprint": "2", "owner": "bob"},
+	}, &room)
+	if status != http.StatusCreated || room.Name != "Sprint 2" || room.Origin == nil || room.Origin.TemplateID != template.ID {
+		t.Fatalf("create room: %d %+v", status, room)
+	}
+	if status := ts.request(t, http.MethodPost, rooms, map[string]interface{}{
+		"room_id": "sprint-2",
+		"values":  map[string]string{"sprint": "3", "owner": "carol"},
+	}, nil); status != http.StatusConflict {
+		t.Fatalf("existing room id: got %d", status)
+	}
+
+	bob := ts.join(t, "sprint-2", "bob")
+	cells := bob.sync.Sheets[0].Cells
+	if bob.sync.Name != "Sprint 2" || bob.sync.Type != domain.RoomTypeTable ||
+		cells["A1"] != "Sprint 2" || cells["B1"] != "Owner: bob" || bob.sync.Origin.TemplateID != template.ID {
+		t.Fatalf("sync of templated room: %+v", bob.sync)
+	}
+
+	// Шаблоны переживают перезапуск
+	restarted := startServer(t, withTemplates)
+	var templates []domain.RoomTemplate
+	restarted.request(t, http.MethodGet, "/api/templates", nil, &templates)
+	if len(templates) != 1 || templates[0].ID != template.ID {
+		t.Fatalf("templates after restart: %+v", templates)
+	}
+}
+
+func TestForkRoom(t *testing.T) {
+	ts := startServer(t)
+
+	alice := ts.join(t, "doc", "alice")
+	alice.send(domain.EventTextUpdate, domain.TextUpdatePayload{Text: "one"}, "op-1")
+	alice.expect(domain.EventAck)
+	alice.send(domain.EventTextUpdate, domain.TextUpdatePayload{Text: "one two"}, "op-2")
+	alice.expect(domain.EventAck)
+
+	var versions []domain.RoomVersion
+	ts.request(t, http.MethodGet, "/api/rooms/doc/versions", nil, &versions)
+	if len(versions) != 3 || versions[1].Version != 1 || versions[1].Content != "" {
+		t.Fatalf("versions: %+v", versions)
+	}
+
+	var old domain.RoomVersion
+	ts.request(t, http.MethodGet, "/api/rooms/doc/versions/1", nil, &old)
+	if old.Content != "one" {
+		t.Fatalf("version 1: %+v", old)
+	}
+
+	var fork createdRoom
+	status := ts.request(t, http.MethodPost, "/api/rooms/doc/fork", map[string]interface{}{"version": 1}, &fork)
+	if status != http.StatusCreated || fork.Origin == nil || fork.Origin.RoomID != "doc" || fork.Origin.Version != 1 {
+		t.Fatalf("fork at version 1: %d %+v", status, fork)
+	}
+	bob := ts.join(t, fork.ID, "bob")
+	if bob.sync.Content != "one" || bob.sync.Version != 0 {
+		t.Fatalf("forked room: %+v", bob.sync)
+	}
+
+	// Форк независим от исходной комнаты
+	bob.send(domain.EventTextUpdate, domain.TextUpdatePayload{Text: "three"}, "op-3")
+	bob.expect(domain.EventAck)
+	var current createdRoom
+	ts.request(t, http.MethodPost, "/api/rooms/doc/fork", map[string]string{"room_id": "doc-copy", "name": "Copy"}, &current)
+	carol := ts.join(t, "doc-copy", "carol")
+	if carol.sync.Content != "one two" || carol.sync.Name != "Copy" || carol.sync.Origin.Version != 2 {
+		t.Fatalf("fork of current version: %+v", carol.sync)
+	}
+
+	if status := ts.request(t, http.MethodPost, "/api/rooms/doc/fork", map[string]int{"version": 99}, nil); status != http.StatusNotFound {
+		t.Fatalf("fork of an unknown version: got %d", status)
+	}
+	if status := ts.request(t, http.MethodPost, "/api/rooms/missing/fork", nil, nil); status != http.StatusNotFound {
+		t.Fatalf("fork of a missing room: got %d", status)
+	}
+	if status := ts.request(t, http.MethodPost, "/api/rooms/doc/fork", map[string]string{"room_id": "bad id!"}, nil); status != http.StatusBadRequest {
+		t.Fatalf("invalid room id: got %d", status)
+	}
+}
@@ -0,0 +1,97 @@
+package server_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/tracing"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+
+	ts := startServer(t)
+	alice := joinTable(t, ts, "traced", "alice")
+	bob := joinTable(t, ts, "traced", "bob")
+
+	// Клиент продолжает свою трассу, передав контекст в конверте события
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	alice.conn.WriteJSON(domain.Event{
+		Type:        domain.EventCellUpdate,
+		Payload:     domain.CellUpdatePayload{Cell: "A1", Value: "traced"},
+		OpID:        "e-1",
+		TraceParent: "00-" + traceID + "-00f067aa0ba902b7-01",
+	})
+	if e := alice.expect(domain.EventAck); !strings.Contains(e.TraceParent, traceID) {
+		t.Fatalf("ack traceparent %q", e.TraceParent)
+	}
+	if e := bob.expect(domain.EventCellUpdate); !strings.Contains(e.TraceParent, traceID) {
+		t.Fatalf("update traceparent %q", e.TraceParent)
+	}
+
+	// Спан отправки закрывается после записи, поэтому может чуть отстать от события
+	var receive, process, send sdktrace.ReadOnlySpan
+	deadline := time.Now().Add(waitTimeout)
+	for send == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		for _, span := range recorder.Ended() {
+			if span.SpanContext().TraceID().String() != traceID {
+				continue
+			}
+			switch span.Name() {
+			case "receive cell_update":
+				receive = span
+			case "process cell_update":
+				process = span
+			case "send cell_update":
+				send = span
+			}
+		}
+	}
+	if receive == nil || process == nil || send == nil {
+		t.Fatalf("spans: receive %v, process %v, send %v", receive != nil, process != nil, send != nil)
+	}
+
+	if process.Parent().SpanID() != receive.SpanContext().SpanID() || send.Parent().SpanID() != process.SpanContext().SpanID() {
+		t.Fatal("spans are not chained receive -> process -> send")
+	}
+	if !hasAttr(receive, tracing.AttrClient, alice.id) || !hasAttr(send, tracing.AttrClient, bob.id) || !hasAttr(process, tracing.AttrRoom, "traced") {
+		t.Fatalf("attributes: receive %v, send %v", receive.Attributes(), send.Attributes())
+	}
+
+	// Спаны событий ссылаются на HTTP-запрос, открывший соединение
+	if len(receive.Links()) != 1 {
+		t.Fatalf("receive links: %v", receive.Links())
+	}
+	var upgrade bool
+	for _, span := range recorder.Ended() {
+		upgrade = upgrade || span.SpanContext().SpanID() == receive.Links()[0].SpanContext.SpanID() && span.Name() == "GET /ws/{roomID}"
+	}
+	if !upgrade {
+		t.Fatal("receive span is not linked to the upgrade request")
+	}
+}
+
+func hasAttr(span sdktrace.ReadOnlySpan, key attribute.Key, value string) bool {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value.AsString() == value
+		}
+	}
+	return false
+}
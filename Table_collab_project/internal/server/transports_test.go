@@ -0,0 +1,285 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"table_collab/internal/domain"
+)
+
+// peer — клиент любого транспорта так, как его видят тесты паритета.
+type peer interface {
+	send(eventType domain.EventType, payload interface{}, opID string)
+	next() event
+	leave()
+}
+
+// httpPeer — клиент SSE или long-polling: события приходят из фоновой
+// горутины, а отправляются POST-запросами на sendURL.
+type httpPeer struct {
+	t       *testing.T
+	ts      *testServer
+	sendURL string
+	events  chan event
+	lastSeq uint64
+}
+
+func newHTTPPeer(t *testing.T, ts *testServer, sendURL string) *httpPeer {
+	return &httpPeer{t: t, ts: ts, sendURL: sendURL, events: make(chan event, 256)}
+}
+
+func (p *httpPeer) send(eventType domain.EventType, payload interface{}, opID string) {
+	p.t.Helper()
+
+	data, _ := json.Marshal(map[string]interface{}{"type": eventType, "payload": payload, "op_id": opID})
+	resp, err := p.ts.Client().Post(p.sendURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		p.t.Fatalf("send %s: %v", eventType, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		p.t.Fatalf("send %s: status %d", eventType, resp.StatusCode)
+	}
+}
+
+// leave закрывает соединение штатно, как закрытие WebSocket.
+func (p *httpPeer) leave() {
+	req, _ := http.NewRequest(http.MethodDelete, p.sendURL, nil)
+	if resp, err := p.ts.Client().Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+func (p *httpPeer) next() event {
+	p.t.Helper()
+
+	select {
+	case e, ok := <-p.events:
+		if !ok {
+			p.t.Fatal("connection closed")
+		}
+		if e.Seq > 0 {
+			if e.Seq <= p.lastSeq {
+				p.t.Fatalf("seq went backwards: %d after %d (%s)", e.Seq, p.lastSeq, e.Type)
+			}
+			p.lastSeq = e.Seq
+		}
+		return e
+	case <-time.After(waitTimeout):
+		p.t.Fatal("no event")
+		return event{}
+	}
+}
+
+// dialSSE открывает поток SSE и возвращает клиента после события connected.
+func (ts *testServer) dialSSE(t *testing.T, roomID string) *httpPeer {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/sse/"+roomID, nil)
+	resp, err := ts.Client().Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		cancel()
+		t.Fatalf("open sse: %v", err)
+	}
+
+	p := newHTTPPeer(t, ts, "")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(p.events)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var e event
+			if json.Unmarshal([]byte(data), &e) == nil {
+				p.events <- e
+			}
+		}
+	}()
+	t.Cleanup(func() { cancel(); <-done })
+
+	var connected struct {
+		ConnID string `json:"conn_id"`
+	}
+	if e := p.next(); e.Type != domain.EventConnected {
+		t.Fatalf("sse started with %s", e.Type)
+	} else {
+		e.decode(t, &connected)
+	}
+	p.sendURL = ts.URL + "/sse/" + roomID + "/" + connected.ConnID
+	return p
+}
+
+// dialLongPoll открывает long-polling соединение и опрашивает его в фоне,
+// подтверждая полученное курсором.
+func (ts *testServer) dialLongPoll(t *testing.T, roomID string) *httpPeer {
+	t.Helper()
+
+	var connected struct {
+		ConnID string `json:"conn_id"`
+	}
+	resp, err := ts.Client().Post(ts.URL+"/poll/"+roomID, "application/json", nil)
+	if err != nil {
+		t.Fatalf("open long-poll: %v", err)
+	}
+	json.NewDecoder(resp.Body).Decode(&connected)
+	resp.Body.Close()
+
+	url := ts.URL + "/poll/" + roomID + "/" + connected.ConnID
+	p := newHTTPPeer(t, ts, url)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(p.events)
+
+		cursor := 0
+		for ctx.Err() == nil {
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url+"?timeout=1&cursor="+strconv.Itoa(cursor), nil)
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				return
+			}
+			var events []event
+			err = json.NewDecoder(resp.Body).Decode(&events)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || err != nil {
+				return
+			}
+			for _, e := range events {
+				p.events <- e
+			}
+			cursor += len(events)
+		}
+	}()
+	t.Cleanup(func() {
+		p.leave()
+		cancel()
+		<-done
+	})
+
+	return p
+}
+
+func expectPeer(t *testing.T, p peer, eventType domain.EventType) event {
+	t.Helper()
+
+	for {
+		if e := p.next(); e.Type == eventType {
+			return e
+		}
+	}
+}
+
+// Один и тот же сценарий на всех транспортах: вход и присутствие, порядок
+// событий, ack правки и дедупликация повтора, выход.
+func TestTransportParity(t *testing.T) {
+	transports := map[string]func(t *testing.T, ts *testServer) peer{
+		"websocket": func(t *testing.T, ts *testServer) peer { return ts.dial(t, "room", "") },
+		"sse":       func(t *testing.T, ts *testServer) peer { return ts.dialSSE(t, "room") },
+		"longpoll":  func(t *testing.T, ts *testServer) peer { return ts.dialLongPoll(t, "room") },
+	}
+
+	for name, dial := range transports {
+		t.Run(name, func(t *testing.T) {
+			ts := startServer(t)
+
+			bob := ts.join(t, "room", "bob")
+
+			alice := dial(t, ts)
+			alice.send(domain.EventJoinRoom, domain.JoinRoomPayload{Username: "alice"}, "")
+			var session domain.SessionPayload
+			expectPeer(t, alice, domain.EventSession).decode(t, &session)
+			var sync domain.SyncPayload
+			expectPeer(t, alice, domain.EventSync).decode(t, &sync)
+			if len(sync.Participants) != 2 {
+				t.Fatalf("alice sees participants %+v", sync.Participants)
+			}
+			if e := bob.expect(domain.EventJoinRoom); e.UserID != session.ClientID {
+				t.Fatalf("bob saw join of %s, want %s", e.UserID, session.ClientID)
+			}
+
+			for i := 0; i < 5; i++ {
+				bob.chat(strconv.Itoa(i))
+			}
+			for i := 0; i < 5; i++ {
+				var chat struct{ Text string }
+				e := alice.next()
+				if e.Type != domain.EventChatMessage || e.UserID != bob.id {
+					t.Fatalf("message %d: got %s from %s", i, e.Type, e.UserID)
+				}
+				if e.decode(t, &chat); chat.Text != strconv.Itoa(i) {
+					t.Fatalf("message %d: got %q", i, chat.Text)
+				}
+			}
+
+			edit := domain.TextUpdatePayload{Text: "hello"}
+			alice.send(domain.EventTextUpdate, edit, "op-1")
+			var ack domain.AckPayload
+			expectPeer(t, alice, domain.EventAck).decode(t, &ack)
+			if update := bob.expect(domain.EventTextUpdate); update.UserID != session.ClientID || update.Version != ack.Version {
+				t.Fatalf("bob got update v%d from %s, ack v%d", update.Version, update.UserID, ack.Version)
+			}
+			alice.send(domain.EventTextUpdate, edit, "op-1")
+			var again domain.AckPayload
+			if expectPeer(t, alice, domain.EventAck).decode(t, &again); again != ack {
+				t.Fatalf("retry got %+v, want %+v", again, ack)
+			}
+
+			alice.leave()
+			if e := bob.expect(domain.EventLeaveRoom); e.UserID != session.ClientID {
+				t.Fatalf("bob saw leave of %s", e.UserID)
+			}
+		})
+	}
+}
+
+// Ответ long-polling, не дошедший до клиента, отдаётся снова, пока клиент не
+// подтвердит его курсором.
+func TestLongPollRedeliversUnconfirmed(t *testing.T) {
+	ts := startServer(t)
+
+	var connected struct {
+		ConnID string `json:"conn_id"`
+	}
+	if status := ts.request(t, http.MethodPost, "/poll/room", nil, &connected); status != http.StatusOK {
+		t.Fatalf("open: status %d", status)
+	}
+	url := "/poll/room/" + connected.ConnID
+	if status := ts.request(t, http.MethodPost, url, map[string]interface{}{"type": domain.EventJoinRoom}, nil); status != http.StatusAccepted {
+		t.Fatalf("join: status %d", status)
+	}
+	t.Cleanup(func() { ts.request(t, http.MethodDelete, url, nil, nil) })
+
+	var first, second, rest []event
+	ts.request(t, http.MethodGet, url+"?cursor=0&timeout=1", nil, &first)
+	if len(first) < 2 || first[0].Type != domain.EventSession {
+		t.Fatalf("first poll: %+v", first)
+	}
+
+	// Ответ «потерялся»: клиент опрашивает с тем же курсором
+	ts.request(t, http.MethodGet, url+"?cursor=0&timeout=0", nil, &second)
+	if len(second) != len(first) || second[0].Type != first[0].Type {
+		t.Fatalf("repeated poll: got %d events, want %d", len(second), len(first))
+	}
+
+	ts.request(t, http.MethodGet, url+"?timeout=0&cursor="+strconv.Itoa(len(first)), nil, &rest)
+	if len(rest) != 0 {
+		t.Fatalf("confirmed events came back: %+v", rest)
+	}
+}
@@ -0,0 +1,161 @@
+package server_test
+
+import (
+	"reflect"
+	"testing"
+
+	"table_collab/internal/domain"
+)
+
+func TestViews(t *testing.T) {
+	ts := startServer(t)
+
+	alice := joinTable(t, ts, "tracker", "alice")
+	bob := joinTable(t, ts, "tracker", "bob")
+	alice.expect(domain.EventJoinRoom)
+
+	setCell(t, alice, "A1", "Login")
+	setCell(t, alice, "B1", "3")
+	setCell(t, alice, "A2", "Search")
+	setCell(t, alice, "B2", "8")
+
+	alice.send(domain.EventViewSave, domain.ViewSavePayload{View: domain.View{
+		Name: "Big first", Sort: []domain.SortKey{{Column: "b", Desc: true}}, Filter: "B > 1",
+	}}, "v-1")
+	var shared domain.View
+	e := alice.expect(domain.EventViewUpdated)
+	e.decode(t, &shared)
+	if e.OpID != "v-1" || shared.ID == "" || shared.Owner != "alice" || !reflect.DeepEqual(shared.Rows, []int{2, 1}) {
+		t.Fatalf("alice got %+v (op_id %q)", shared, e.OpID)
+	}
+	var seen domain.View
+	bob.expect(domain.EventViewUpdated).decode(t, &seen)
+	if seen.ID != shared.ID || seen.Sort[0].Column != "B" {
+		t.Fatalf("bob sees %+v", seen)
+	}
+
+	// Личное представление другие участники не получают
+	alice.send(domain.EventViewSave, domain.ViewSavePayload{View: domain.View{Name: "Mine", Private: true, Sort: []domain.SortKey{{Column: "A"}}}}, "v-2")
+	var private domain.View
+	alice.expect(domain.EventViewUpdated).decode(t, &private)
+	alice.chat("done")
+	if e := bob.expect(domain.EventChatMessage); e.UserID != alice.id {
+		t.Fatalf("chat from %s", e.UserID)
+	}
+
+	bob.send(domain.EventViewDelete, domain.ViewDeletePayload{ViewID: private.ID}, "d-1")
+	var failure domain.ErrorPayload
+	bob.expect(domain.EventError).decode(t, &failure)
+	if failure.Code != "view_not_found" {
+		t.Fatalf("bob deleting alice's private view: %+v", failure)
+	}
+
+	// Правка ячейки меняет порядок строк у всех, кто видит представление
+	bob.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: "B1", Value: "20"}, "e-1")
+	var rows domain.ViewRowsPayload
+	bob.expect(domain.EventViewRows).decode(t, &rows)
+	if rows.ViewID != shared.ID || !reflect.DeepEqual(rows.Rows, []int{1, 2}) {
+		t.Fatalf("bob rows %+v", rows)
+	}
+	bob.expect(domain.EventAck)
+	alice.expect(domain.EventViewRows).decode(t, &rows)
+	if rows.ViewID != shared.ID {
+		t.Fatalf("alice rows %+v", rows)
+	}
+
+	// Сортировка личного представления по A от правки B не меняется
+	bob.send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: "A3", Value: "Export"}, "e-2")
+	bob.expect(domain.EventAck)
+	alice.expect(domain.EventViewRows).decode(t, &rows)
+	if rows.ViewID != private.ID || !reflect.DeepEqual(rows.Rows, []int{3, 1, 2}) {
+		t.Fatalf("alice private rows %+v", rows)
+	}
+
+	carol := joinTable(t, ts, "tracker", "carol")
+	if len(carol.sync.Views) != 1 || carol.sync.Views[0].ID != shared.ID || !reflect.DeepEqual(carol.sync.Views[0].Rows, []int{1, 2}) {
+		t.Fatalf("carol sync views: %+v", carol.sync.Views)
+	}
+	// Личное представление привязано к сессии, а не к имени
+	if again := joinTable(t, ts, "tracker", "Alice"); len(again.sync.Views) != 1 {
+		t.Fatalf("a client named Alice sees %d views", len(again.sync.Views))
+	}
+
+	bob.send(domain.EventViewDelete, domain.ViewDeletePayload{ViewID: shared.ID}, "d-2")
+	var removed domain.ViewDeletePayload
+	if e := bob.expect(domain.EventViewDelete); e.OpID != "d-2" {
+		t.Fatalf("bob got op_id %q", e.OpID)
+	}
+	carol.expect(domain.EventViewDelete).decode(t, &removed)
+	if removed.ViewID != shared.ID {
+		t.Fatalf("carol got %+v", removed)
+	}
+}
+
+// Личное представление клиента без имени не достаётся ни другим участникам
+// без имени, ни зрителям, у которых имени тоже нет.
+func TestPrivateViewsHiddenFromUnnamed(t *testing.T) {
+	ts := startServer(t, withShares)
+
+	owner := joinTable(t, ts, "tracker", "")
+	other := joinTable(t, ts, "tracker", "")
+	owner.expect(domain.EventJoinRoom)
+	link := createShare(t, ts, "tracker")
+	spectator := spectate(t, ts, link)
+	waitSpectators(t, ts, "tracker", 1)
+
+	owner.send(domain.EventViewSave, domain.ViewSavePayload{View: domain.View{Name: "Mine", Private: true}}, "v-1")
+	var private domain.View
+	if owner.expect(domain.EventViewUpdated).decode(t, &private); private.OwnerID != owner.id {
+		t.Fatalf("private view owner %q, want %q", private.OwnerID, owner.id)
+	}
+	setCell(t, owner, "A1", "after")
+	for name, c := range map[string]*testClient{"participant": other, "spectator": spectator} {
+		if e := c.next(); e.Type != domain.EventCellUpdate {
+			t.Fatalf("%s got %s before the edit", name, e.Type)
+		}
+	}
+
+	if late := joinTable(t, ts, "tracker", ""); len(late.sync.Views) != 0 {
+		t.Fatalf("unnamed participant sync views: %+v", late.sync.Views)
+	}
+	if late := spectate(t, ts, link); len(late.sync.Views) != 0 {
+		t.Fatalf("spectator sync views: %+v", late.sync.Views)
+	}
+	other.send(domain.EventViewDelete, domain.ViewDeletePayload{ViewID: private.ID}, "d-1")
+	var failure domain.ErrorPayload
+	if other.expect(domain.EventError).decode(t, &failure); failure.Code != "view_not_found" {
+		t.Fatalf("deleting another client's private view: %+v", failure)
+	}
+}
+
+func TestViewsRejects(t *testing.T) {
+	ts := startServer(t)
+
+	alice := joinTable(t, ts, "tracker", "alice")
+	tests := []struct {
+		view domain.View
+		code string
+	}{
+		{domain.View{Name: "Bad", Filter: "B >"}, "invalid_view"},
+		{domain.View{Name: "Bad", Sort: []domain.SortKey{{Column: "B2"}}}, "invalid_view"},
+		{domain.View{Name: " "}, "invalid_view"},
+		{domain.View{Name: "Nowhere", SheetID: "missing"}, "sheet_not_found"},
+		{domain.View{ID: "view_missing", Name: "Ghost"}, "view_not_found"},
+	}
+	for _, tt := range tests {
+		alice.send(domain.EventViewSave, domain.ViewSavePayload{View: tt.view}, "")
+		var failure domain.ErrorPayload
+		alice.expect(domain.EventError).decode(t, &failure)
+		if failure.Code != tt.code {
+			t.Errorf("%+v: got %+v, want %s", tt.view, failure, tt.code)
+		}
+	}
+
+	doc := ts.join(t, "notes", "alice")
+	doc.send(domain.EventViewSave, domain.ViewSavePayload{View: domain.View{Name: "Doc"}}, "")
+	var failure domain.ErrorPayload
+	doc.expect(domain.EventError).decode(t, &failure)
+	if failure.Code != "wrong_room_type" {
+		t.Fatalf("view in a document room: %+v", failure)
+	}
+}
@@ -0,0 +1,93 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+	"table_collab/internal/service/webhook"
+)
+
+func TestWebhooksForRoomActivity(t *testing.T) {
+	ts := startServer(t, func(cfg *config.Config) {
+		cfg.Admin.Token = "admin-token"
+	})
+
+	events := make(chan webhook.Payload, 16)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify("hook-secret", r.Header.Get(webhook.SignatureHeader), body, time.Minute); err != nil {
+			t.Errorf("receiver: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var payload webhook.Payload
+		json.Unmarshal(body, &payload)
+		events <- payload
+	}))
+	t.Cleanup(receiver.Close)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"url":     receiver.URL,
+		"secret":  "hook-secret",
+		"room_id": "watched",
+	})
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/admin/webhooks", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-token")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create webhook: %s", resp.Status)
+	}
+
+	// Воркеры доставляют параллельно, поэтому порядок событий не гарантирован
+	expect := func(wants ...string) map[string]webhook.Payload {
+		t.Helper()
+
+		got := make(map[string]webhook.Payload)
+		for range wants {
+			select {
+			case payload := <-events:
+				got[payload.Event] = payload
+			case <-time.After(waitTimeout):
+				t.Fatalf("got webhooks %v, want %v", got, wants)
+			}
+		}
+		for _, want := range wants {
+			if _, ok := got[want]; !ok {
+				t.Fatalf("got webhooks %v, want %v", got, wants)
+			}
+		}
+		return got
+	}
+
+	ts.join(t, "ignored", "nobody")
+	alice := ts.join(t, "watched", "alice")
+	expect(webhook.EventRoomCreated, webhook.EventUserJoined)
+
+	bob := ts.join(t, "watched", "bob")
+	alice.expect(domain.EventJoinRoom)
+	expect(webhook.EventUserJoined)
+
+	alice.chat("ping @Bob, please review")
+	mention := expect(webhook.EventChatMention)[webhook.EventChatMention]
+	data, _ := json.Marshal(mention.Data)
+	var mentionData webhook.MentionData
+	json.Unmarshal(data, &mentionData)
+	if len(mentionData.Mentioned) != 1 || mentionData.Mentioned[0] != "bob" {
+		t.Fatalf("mentioned %v, want [bob]", mentionData.Mentioned)
+	}
+
+	bob.leave()
+	expect(webhook.EventUserLeft)
+}
@@ -1,41 +1,116 @@
 package ws
 
 import (
-	"log"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 
+	"table_collab/cmd/server/config"
+	"table_collab/internal/logging"
+	"table_collab/internal/server/middleware"
 	"table_collab/internal/service"
 
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
 type Handler struct {
-	hub *service.Hub
+	hub      *service.Hub
+	cfg      config.WebSocketConfig
+	origins  *middleware.OriginPolicy
+	upgrader websocket.Upgrader
 }
 
-func NewHandler(hub *service.Hub) *Handler {
-	return &Handler{hub: hub}
+func NewHandler(hub *service.Hub, cfg *config.Config, origins *middleware.OriginPolicy) *Handler {
+	h := &Handler{hub: hub, cfg: cfg.WebSocket, origins: origins}
+
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:    cfg.WebSocket.ReadBufferSize,
+		WriteBufferSize:   cfg.WebSocket.WriteBufferSize,
+		HandshakeTimeout:  time.Duration(cfg.Security.HandshakeTimeout) * time.Second,
+		EnableCompression: cfg.Security.EnableCompression,
+		Subprotocols:      cfg.Security.Subprotocols,
+		CheckOrigin: func(r *http.Request) bool {
+			ok, _ := origins.Check(r)
+			return ok
+		},
+		Error: h.reject,
+	}
+
+	return h
 }
 
 func (h *Handler) ServeWebSocket(roomID string, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	if !h.check(w, r) {
+		return
+	}
+	// Ссылки share раньше выглядели как /ws/{roomID}?share=<token>: такой
+	// запрос не должен молча стать подключением участника
+	if r.URL.Query().Has("share") {
+		h.reject(w, r, http.StatusBadRequest, reasonError("share links are served at /ws/share/{token}"))
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
+		// Ответ клиенту и лог уже сделал h.reject
 		return
 	}
 
-	client := service.NewClient(conn, h.hub, roomID)
+	lastSeq, _ := strconv.ParseUint(r.URL.Query().Get("last_seq"), 10, 64)
+	h.hub.Connect(r.Context(), newTransport(conn, h.cfg, r.RemoteAddr), roomID, r.URL.Query().Get("resume"), lastSeq)
+}
+
+// ServeShare подключает зрителя по ссылке share. Комната определяется по
+// токену: ссылка не раскрывает её ID, а без ID нельзя подключиться участником.
+func (h *Handler) ServeShare(token string, w http.ResponseWriter, r *http.Request) {
+	if !h.check(w, r) {
+		return
+	}
+	roomID, err := h.hub.ShareRoom(token)
+	if err != nil {
+		h.reject(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	h.hub.ConnectSpectator(r.Context(), newTransport(conn, h.cfg, r.RemoteAddr), roomID, token)
+}
+
+// check проверяет origin и подпротокол до апгрейда.
+func (h *Handler) check(w http.ResponseWriter, r *http.Request) bool {
+	if ok, reason := h.origins.Check(r); !ok {
+		h.reject(w, r, http.StatusForbidden, reasonError(reason))
+		return false
+	}
+
+	if requested := websocket.Subprotocols(r); len(requested) > 0 &&
+		!slices.ContainsFunc(requested, h.supportsSubprotocol) {
+		h.reject(w, r, http.StatusBadRequest, reasonError("no supported subprotocol in request"))
+		return false
+	}
+	return true
+}
+
+func (h *Handler) supportsSubprotocol(protocol string) bool {
+	return slices.Contains(h.upgrader.Subprotocols, protocol)
+}
+
+// reject логирует каждый отклонённый апгрейд с причиной.
+func (h *Handler) reject(w http.ResponseWriter, r *http.Request, status int, reason error) {
+	logging.FromContext(r.Context()).Warn("WebSocket upgrade rejected",
+		"path", r.URL.Path, "remote", r.RemoteAddr, "origin", r.Header.Get("Origin"),
+		"status", status, "reason", reason)
+
+	http.Error(w, http.StatusText(status), status)
+}
 
-	go client.WritePump()
-	go client.ReadPump()
+type reasonError string
 
-	log.Printf("Client connected to room %s", roomID)
+func (e reasonError) Error() string {
+	return string(e)
 }
@@ -0,0 +1,75 @@
+package ws
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/server/middleware"
+)
+
+// captureLogs направляет логи по умолчанию в буфер до конца теста.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func upgradeRequest(origin string, protocols ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "http://collab.example.com/ws/room", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	if len(protocols) > 0 {
+		r.Header.Set("Sec-WebSocket-Protocol", strings.Join(protocols, ", "))
+	}
+	return r
+}
+
+// Отказы происходят до обращения к hub, поэтому он не нужен.
+func TestUpgradeRejected(t *testing.T) {
+	cfg := &config.Config{Security: config.SecurityConfig{
+		AllowedOrigins: []string{"https://app.example.com"},
+		Subprotocols:   []string{"tablecollab.v1"},
+	}}
+	h := NewHandler(nil, cfg, middleware.NewOriginPolicy(cfg.Security.AllowedOrigins))
+
+	tests := []struct {
+		name   string
+		r      *http.Request
+		status int
+		reason string
+	}{
+		{"foreign origin", upgradeRequest("https://evil.example.com", "tablecollab.v1"), http.StatusForbidden, "not in the allowlist"},
+		{"malformed origin", upgradeRequest("null"), http.StatusForbidden, "malformed Origin"},
+		{"unsupported subprotocol", upgradeRequest("https://app.example.com", "chat.v2"), http.StatusBadRequest, "no supported subprotocol"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			for _, serve := range []func(http.ResponseWriter, *http.Request){
+				func(w http.ResponseWriter, r *http.Request) { h.ServeWebSocket("room", w, r) },
+				func(w http.ResponseWriter, r *http.Request) { h.ServeShare("token", w, r) },
+			} {
+				w := httptest.NewRecorder()
+				serve(w, tt.r)
+				if w.Code != tt.status {
+					t.Fatalf("status %d, want %d", w.Code, tt.status)
+				}
+			}
+			if out := logs.String(); strings.Count(out, "WebSocket upgrade rejected") != 2 || !strings.Contains(out, tt.reason) {
+				t.Fatalf("log %q", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package ws
+
+import (
+	"log/slog"
+	"time"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+	"table_collab/internal/logging"
+	"table_collab/internal/service"
+
+	"github.com/gorilla/websocket"
+)
+
+const writeWait = 10 * time.Second
+
+type transport struct {
+	conn       *websocket.Conn
+	remoteAddr string
+}
+
+// remoteAddr берётся из запроса: после middleware.RealIP там адрес клиента, а не прокси.
+func newTransport(conn *websocket.Conn, cfg config.WebSocketConfig, remoteAddr string) *transport {
+	// Понг продлевает дедлайн на два периода пинга, чтобы не обрывать соединение на границе
+	pongWait := 2 * time.Duration(cfg.PingPeriod) * time.Second
+
+	conn.SetReadLimit(cfg.MaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	return &transport{conn: conn, remoteAddr: remoteAddr}
+}
+
+func (t *transport) Name() string {
+	return "websocket"
+}
+
+func (t *transport) RemoteAddr() string {
+	return t.remoteAddr
+}
+
+func (t *transport) ReadEvent() (domain.Event, error) {
+	var event domain.Event
+	err := t.conn.ReadJSON(&event)
+	if err == nil {
+		return event, nil
+	}
+
+	if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		return event, service.ErrTransportClosed
+	}
+	if websocket.IsUnexpectedCloseError(err, websocket.CloseAbnormalClosure) {
+		slog.Warn("WebSocket read error", "remote", t.remoteAddr, logging.Err(err))
+	}
+	return event, err
+}
+
+func (t *transport) WriteEvent(event domain.Event) error {
+	t.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return t.conn.WriteJSON(event)
+}
+
+func (t *transport) Ping() error {
+	return t.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+}
+
+func (t *transport) Close(code int, reason string) error {
+	if code != 0 {
+		t.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	}
+	return t.conn.Close()
+}
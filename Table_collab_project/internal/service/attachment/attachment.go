@@ -0,0 +1,71 @@
+// Package attachment — файлы, прикреплённые к комнатам: хранилище по хешу
+// содержимого, проверка типа и размера при загрузке и уменьшенные копии картинок.
+package attachment
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"time"
+)
+
+var (
+	ErrTooLarge = errors.New("file is too large")
+	ErrType     = errors.New("file type is not allowed")
+)
+
+// Store хранит содержимое вложений под его SHA-256 в hex. Отсутствующий
+// объект Open и Remove сообщают ошибкой, совместимой с fs.ErrNotExist.
+type Store interface {
+	// Put сохраняет содержимое целиком или не сохраняет ничего. Повторная
+	// запись того же содержимого обновляет время изменения объекта.
+	Put(r io.Reader) (hash string, size int64, err error)
+	Open(hash string) (io.ReadSeekCloser, error)
+	Remove(hash string) error
+	// List возвращает хеши всех объектов со временем их последней записи.
+	List() (map[string]time.Time, error)
+}
+
+// SniffLen — сколько первых байт файла нужно Detect.
+const SniffLen = 512
+
+// Detect определяет тип файла по первым байтам и проверяет его по списку
+// разрешённых MIME-типов (без параметров вроде charset).
+func Detect(head []byte, allowed []string) (string, error) {
+	contentType := http.DetectContentType(head)
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !slices.Contains(allowed, mediaType) {
+		return "", fmt.Errorf("%w: %s", ErrType, contentType)
+	}
+	return contentType, nil
+}
+
+// LimitReader читает из r не больше limit байт и возвращает ErrTooLarge, если
+// в r есть ещё данные.
+func LimitReader(r io.Reader, limit int64) io.Reader {
+	return &limitedReader{r: r, left: limit}
+}
+
+type limitedReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.left < 0 {
+		return 0, ErrTooLarge
+	}
+	// Читаем на байт больше лимита, чтобы отличить файл ровно в лимит от большего
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+	if l.left < 0 {
+		return 0, ErrTooLarge
+	}
+	return n, err
+}
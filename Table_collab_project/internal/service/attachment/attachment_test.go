@@ -0,0 +1,107 @@
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+var allowed = []string{"image/png", "image/jpeg", "text/plain"}
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+		err     error
+	}{
+		{"png", encodePNG(t, 2, 2), "image/png", nil},
+		{"text", []byte("just notes"), "text/plain; charset=utf-8", nil},
+		// HTML под видом картинки не проходит: тип берётся из содержимого
+		{"html", []byte("<!DOCTYPE html><script>alert(1)</script>"), "", ErrType},
+		{"pdf", []byte("%PDF-1.7\n"), "", ErrType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Detect(tt.content, allowed)
+			if got != tt.want || !errors.Is(err, tt.err) {
+				t.Fatalf("Detect = %q, %v; want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestLimitReader(t *testing.T) {
+	data, err := io.ReadAll(LimitReader(strings.NewReader("12345"), 5))
+	if err != nil || string(data) != "12345" {
+		t.Fatalf("exactly at the limit: %q, %v", data, err)
+	}
+
+	if _, err := io.ReadAll(LimitReader(strings.NewReader("123456"), 5)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("over the limit: %v", err)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	img, err := Thumbnail(bytes.NewReader(encodePNG(t, 600, 300)), 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Width != 600 || img.Height != 300 {
+		t.Fatalf("size = %dx%d", img.Width, img.Height)
+	}
+	thumb, format, err := image.Decode(bytes.NewReader(img.Thumbnail))
+	if err != nil || format != "png" {
+		t.Fatalf("thumbnail: %s, %v", format, err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 256 || b.Dy() != 128 {
+		t.Fatalf("thumbnail size = %dx%d", b.Dx(), b.Dy())
+	}
+
+	// Копия JPEG остаётся JPEG, высокая картинка ограничивается по высоте
+	var buf bytes.Buffer
+	src, _ := png.Decode(bytes.NewReader(encodePNG(t, 100, 400)))
+	if err := jpeg.Encode(&buf, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	img, err = Thumbnail(&buf, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(img.Thumbnail))
+	if err != nil || format != "jpeg" || cfg.Width != 50 || cfg.Height != 200 {
+		t.Fatalf("jpeg thumbnail: %s %dx%d, %v", format, cfg.Width, cfg.Height, err)
+	}
+
+	// Маленькой картинке копия не нужна
+	if img, err := Thumbnail(bytes.NewReader(encodePNG(t, 64, 64)), 256); err != nil || img.Thumbnail != nil || img.Width != 64 {
+		t.Fatalf("small image: %+v, %v", img, err)
+	}
+
+	if _, err := Thumbnail(strings.NewReader("not an image"), 256); !errors.Is(err, ErrNotImage) {
+		t.Fatalf("text: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif" // декодер GIF для image.Decode
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// maxPixels ограничивает картинки, которые декодируются ради уменьшенной
+// копии: маленький файл может распаковаться в гигабайты.
+const maxPixels = 40_000_000
+
+var ErrNotImage = errors.New("not a supported image")
+
+// Image — размеры картинки и её уменьшенная копия.
+type Image struct {
+	Width  int
+	Height int
+	// Thumbnail пуст, если картинка не больше запрошенного размера
+	Thumbnail []byte
+}
+
+// Thumbnail читает картинку PNG, JPEG или GIF и уменьшает её так, чтобы
+// длинная сторона была не больше size. Копия JPEG остаётся JPEG, остальные
+// форматы сохраняются в PNG, чтобы не потерять прозрачность.
+func Thumbnail(r io.Reader, size int) (Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Image{}, err
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrNotImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return Image{}, ErrNotImage
+	}
+
+	result := Image{Width: cfg.Width, Height: cfg.Height}
+	if size <= 0 || (cfg.Width <= size && cfg.Height <= size) {
+		return result, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrNotImage
+	}
+
+	width, height := size, cfg.Height*size/cfg.Width
+	if cfg.Height > cfg.Width {
+		width, height = cfg.Width*size/cfg.Height, size
+	}
+	thumb := scale(src, max(width, 1), max(height, 1))
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return Image{}, err
+	}
+	result.Thumbnail = buf.Bytes()
+	return result, nil
+}
+
+// scale уменьшает src до width×height, усредняя пиксели, которые попадают
+// в каждый пиксель результата.
+func scale(src image.Image, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	b := src.Bounds()
+
+	for y := 0; y < height; y++ {
+		y0, y1 := span(b.Min.Y, b.Dy(), height, y)
+		for x := 0; x < width; x++ {
+			x0, x1 := span(b.Min.X, b.Dx(), width, x)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// span возвращает диапазон исходных координат для i-го из n пикселей результата.
+func span(origin, length, n, i int) (int, int) {
+	from, to := origin+i*length/n, origin+(i+1)*length/n
+	if to <= from {
+		to = from + 1
+	}
+	return from, to
+}
@@ -0,0 +1,416 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/logging"
+	"table_collab/internal/service/attachment"
+	"table_collab/internal/service/collaboration"
+	"table_collab/pkg/utils"
+)
+
+const maxAttachmentName = 255
+
+var (
+	ErrUploadsDisabled    = errors.New("uploads are disabled")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrTooManyAttachments = errors.New("too many attachments in the room")
+	ErrNotParticipant     = errors.New("only room participants can change attachments")
+)
+
+// AttachmentUpload — файл, который загружают в комнату.
+type AttachmentUpload struct {
+	Name string
+	// Токен сессии участника комнаты (resume_token из события session): ID
+	// клиента рассылается всем, а токен знает только сама сессия. Имя
+	// участника попадёт в uploaded_by
+	Session string
+	// Загрузка от администратора: участник для неё не нужен
+	Admin bool
+	Body  io.Reader
+}
+
+// UploadAttachment сохраняет файл в хранилище и прикрепляет его к комнате.
+// Файл пишется на диск вне Run; в комнату он попадает одним действием hub,
+// после которого участники получают attachment_added.
+func (h *Hub) UploadAttachment(roomID string, upload AttachmentUpload) (domain.Attachment, error) {
+	if h.blobs == nil {
+		return domain.Attachment{}, ErrUploadsDisabled
+	}
+	cfg := h.config.Uploads
+
+	// Заведомо отклонённый файл не стоит даже читать
+	if err := h.checkUpload(roomID, upload); err != nil {
+		return domain.Attachment{}, err
+	}
+
+	body := bufio.NewReaderSize(upload.Body, attachment.SniffLen)
+	head, err := body.Peek(attachment.SniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return domain.Attachment{}, err
+	}
+	contentType, err := attachment.Detect(head, cfg.AllowedTypes)
+	if err != nil {
+		return domain.Attachment{}, err
+	}
+
+	var content io.Reader = body
+	if cfg.MaxSize > 0 {
+		content = attachment.LimitReader(body, cfg.MaxSize)
+	}
+	hash, size, err := h.blobs.Put(content)
+	if err != nil {
+		return domain.Attachment{}, err
+	}
+
+	created := &domain.Attachment{
+		ID:          "att_" + utils.GenerateID(),
+		Name:        attachmentName(upload.Name),
+		ContentType: contentType,
+		Size:        size,
+		Hash:        hash,
+		CreatedAt:   time.Now(),
+	}
+	if strings.HasPrefix(contentType, "image/") {
+		h.preview(created)
+	}
+
+	var result error
+	if err := h.do(func() { result = h.addAttachment(roomID, upload, created) }); err != nil {
+		return domain.Attachment{}, err
+	}
+	if result != nil {
+		return domain.Attachment{}, result
+	}
+	return *created, nil
+}
+
+// preview заполняет размеры картинки и хеш её уменьшенной копии. Без копии
+// вложение остаётся рабочим, поэтому ошибки только логируются.
+func (h *Hub) preview(a *domain.Attachment) {
+	content, err := h.blobs.Open(a.Hash)
+	if err != nil {
+		slog.Error("Failed to open upload for thumbnail", "hash", a.Hash, logging.Err(err))
+		return
+	}
+	defer content.Close()
+
+	img, err := attachment.Thumbnail(content, h.config.Uploads.ThumbnailSize)
+	if errors.Is(err, attachment.ErrNotImage) {
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to make thumbnail", "hash", a.Hash, logging.Err(err))
+		return
+	}
+
+	a.Width, a.Height = img.Width, img.Height
+	if img.Thumbnail == nil {
+		// Картинка и так не больше копии
+		a.Thumbnail = a.Hash
+		return
+	}
+	if a.Thumbnail, _, err = h.blobs.Put(bytes.NewReader(img.Thumbnail)); err != nil {
+		slog.Error("Failed to save thumbnail", "hash", a.Hash, logging.Err(err))
+	}
+}
+
+func (h *Hub) checkUpload(roomID string, upload AttachmentUpload) error {
+	var result error
+	err := h.do(func() {
+		room, err := h.rooms.Get(roomID)
+		if err != nil {
+			result = ErrRoomNotFound
+			return
+		}
+		if _, result = h.attachmentEditor(room.ID, upload.Session, upload.Admin); result == nil {
+			result = h.canAttach(room)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+func (h *Hub) canAttach(room *domain.Room) error {
+	if room.ReadOnly {
+		return ErrRoomReadOnly
+	}
+	if limit := h.config.Uploads.MaxPerRoom; limit > 0 && len(room.Attachments) >= limit {
+		return ErrTooManyAttachments
+	}
+	return nil
+}
+
+// attachmentEditor вызывается из Run: по токену сессии возвращает участника
+// комнаты, который меняет вложения. Сессии есть только у вошедших участников,
+// так что ни зритель по ссылке share, ни знающий чужой ID клиента файл не
+// загрузит и не удалит. Администратору участник не нужен, но если сессия
+// указана, то тоже проверяется.
+func (h *Hub) attachmentEditor(roomID, token string, admin bool) (*Client, error) {
+	if token == "" && admin {
+		return nil, nil
+	}
+	var client *Client
+	if s, ok := h.sessions[token]; ok {
+		client = h.clients[s.clientID]
+	}
+	if client == nil || client.RoomID != roomID || client.share != "" {
+		return nil, ErrNotParticipant
+	}
+	if client.muted {
+		return nil, ErrMuted
+	}
+	return client, nil
+}
+
+// addAttachment вызывается из Run.
+func (h *Hub) addAttachment(roomID string, upload AttachmentUpload, a *domain.Attachment) error {
+	room, err := h.rooms.Get(roomID)
+	if err != nil {
+		return ErrRoomNotFound
+	}
+	// Участник мог выйти, пока файл писался на диск
+	client, err := h.attachmentEditor(roomID, upload.Session, upload.Admin)
+	if err != nil {
+		return err
+	}
+	if err := h.canAttach(room); err != nil {
+		return err
+	}
+	if client != nil {
+		a.UploadedBy = client.Username
+	}
+
+	room.Attachments = append(room.Attachments, a)
+	room.UpdatedAt = a.CreatedAt
+	h.rooms.Save(room)
+
+	added := domain.Event{
+		Type:      domain.EventAttachmentAdded,
+		RoomID:    roomID,
+		Timestamp: a.CreatedAt.UnixMilli(),
+		Payload:   *a,
+	}
+	h.handleBroadcast(added)
+	h.accept(added)
+
+	slog.Info("Attachment added", logging.KeyRoom, roomID, "attachment", a.ID, "type", a.ContentType, "size", a.Size)
+	return nil
+}
+
+// ListAttachments возвращает вложения комнаты в порядке загрузки.
+func (h *Hub) ListAttachments(roomID string) ([]domain.Attachment, error) {
+	var attachments []domain.Attachment
+	var result error
+	err := h.do(func() {
+		room, err := h.rooms.Get(roomID)
+		if err != nil {
+			result = ErrRoomNotFound
+			return
+		}
+		for _, a := range room.Attachments {
+			attachments = append(attachments, *a)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attachments, result
+}
+
+// OpenAttachment открывает содержимое вложения или его уменьшенной копии.
+// Для копии в возвращённом вложении стоят её хеш и тип.
+func (h *Hub) OpenAttachment(roomID, id string, thumbnail bool) (domain.Attachment, io.ReadSeekCloser, error) {
+	if h.blobs == nil {
+		return domain.Attachment{}, nil, ErrUploadsDisabled
+	}
+
+	var found domain.Attachment
+	var result error
+	err := h.do(func() {
+		room, err := h.rooms.Get(roomID)
+		if err != nil {
+			result = ErrRoomNotFound
+			return
+		}
+		a, _ := collaboration.FindAttachment(room, id)
+		if a == nil {
+			result = ErrAttachmentNotFound
+			return
+		}
+		found = *a
+	})
+	if err == nil {
+		err = result
+	}
+	if err != nil {
+		return domain.Attachment{}, nil, err
+	}
+
+	if thumbnail {
+		if found.Thumbnail == "" {
+			return domain.Attachment{}, nil, ErrAttachmentNotFound
+		}
+		if found.Thumbnail != found.Hash && found.ContentType != "image/jpeg" {
+			found.ContentType = "image/png"
+		}
+		found.Hash = found.Thumbnail
+	}
+
+	content, err := h.blobs.Open(found.Hash)
+	if errors.Is(err, fs.ErrNotExist) {
+		return domain.Attachment{}, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return domain.Attachment{}, nil, err
+	}
+	return found, content, nil
+}
+
+// RemoveAttachment открепляет файл от комнаты по просьбе участника с токеном
+// сессии token или администратора. Из хранилища файл пропадёт при очистке, если на него не
+// ссылаются другие комнаты.
+func (h *Hub) RemoveAttachment(roomID, id, token string, admin bool) error {
+	var result error
+	err := h.do(func() {
+		room, err := h.rooms.Get(roomID)
+		if err != nil {
+			result = ErrRoomNotFound
+			return
+		}
+		if _, result = h.attachmentEditor(roomID, token, admin); result != nil {
+			return
+		}
+		if room.ReadOnly {
+			result = ErrRoomReadOnly
+			return
+		}
+		if !collaboration.RemoveAttachment(room, id) {
+			result = ErrAttachmentNotFound
+			return
+		}
+		room.UpdatedAt = time.Now()
+		h.rooms.Save(room)
+
+		removed := domain.Event{
+			Type:      domain.EventAttachmentRemoved,
+			RoomID:    roomID,
+			Timestamp: room.UpdatedAt.UnixMilli(),
+			Payload:   domain.AttachmentRemovedPayload{AttachmentID: id},
+		}
+		h.handleBroadcast(removed)
+		h.accept(removed)
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// CleanupAttachments удаляет из хранилища файлы, на которые не ссылается ни
+// одна комната, и возвращает их число.
+func (h *Hub) CleanupAttachments() (int, error) {
+	if h.blobs == nil {
+		return 0, ErrUploadsDisabled
+	}
+
+	var referenced map[string]bool
+	if err := h.do(func() { referenced = h.referencedBlobs() }); err != nil {
+		return 0, err
+	}
+	return h.sweepBlobs(referenced)
+}
+
+// cleanupTick запускает очистку по таймеру. Вызывается из Run; сама очистка
+// читает каталог и идёт в отдельной горутине.
+func (h *Hub) cleanupTick() {
+	if !h.sweeping.CompareAndSwap(false, true) {
+		return
+	}
+	referenced := h.referencedBlobs()
+	go func() {
+		defer h.sweeping.Store(false)
+		if _, err := h.sweepBlobs(referenced); err != nil {
+			slog.Error("Upload cleanup failed", logging.Err(err))
+		}
+	}()
+}
+
+// referencedBlobs вызывается из Run.
+func (h *Hub) referencedBlobs() map[string]bool {
+	referenced := make(map[string]bool)
+	rooms, _ := h.rooms.GetAll()
+	for _, room := range rooms {
+		for _, a := range room.Attachments {
+			referenced[a.Hash] = true
+			if a.Thumbnail != "" {
+				referenced[a.Thumbnail] = true
+			}
+		}
+	}
+	return referenced
+}
+
+// sweepBlobs не трогает недавно записанные файлы: их могли загрузить уже
+// после того, как был собран referenced.
+func (h *Hub) sweepBlobs(referenced map[string]bool) (int, error) {
+	blobs, err := h.blobs.List()
+	if err != nil {
+		return 0, err
+	}
+
+	grace := time.Duration(h.config.Uploads.CleanupGrace) * time.Second
+	removed := 0
+	for hash, modified := range blobs {
+		if referenced[hash] || time.Since(modified) < grace {
+			continue
+		}
+		if err := h.blobs.Remove(hash); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("Failed to remove upload", "hash", hash, logging.Err(err))
+			continue
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		slog.Info("Removed unreferenced uploads", "count", removed)
+	}
+	return removed, nil
+}
+
+// attachmentName оставляет от имени файла, присланного клиентом, только
+// базовое имя без управляющих символов.
+func attachmentName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == ".." || name == "/" || strings.TrimSpace(name) == "" {
+		return "file"
+	}
+	if runes := []rune(name); len(runes) > maxAttachmentName {
+		name = string(runes[:maxAttachmentName])
+	}
+	return name
+}
+
+func cloneAttachments(attachments []*domain.Attachment) []*domain.Attachment {
+	// Вложения не меняются после загрузки, поэтому достаточно копии среза
+	return slices.Clone(attachments)
+}
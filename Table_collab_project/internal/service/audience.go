@@ -0,0 +1,159 @@
+package service
+
+import (
+	"encoding/json"
+	"sync"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+// audience раздаёт события зрителям одной комнаты в отдельной горутине: Run
+// только ставит событие в очередь, поэтому сотни зрителей не задерживают
+// обработку правок. Payload кодируется один раз на всех зрителей.
+//
+// Вход и выход зрителя идут через ту же очередь, что и события: зритель
+// получает ровно те события, которых ещё нет в его sync.
+type audience struct {
+	mu      sync.Mutex
+	queue   []audienceItem
+	limit   int
+	notify  chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+
+	clients map[*Client]struct{} // меняется только в Hub.Run
+	members map[*Client]struct{} // меняется только в горутине run
+}
+
+// audienceItem — событие для всех зрителей либо вход (sync != nil) или выход
+// одного зрителя.
+type audienceItem struct {
+	event  domain.Event
+	client *Client
+	sync   *domain.Event
+}
+
+func newAudience(cfg config.WebSocketConfig) *audience {
+	limit := cfg.SendBufferSize + cfg.OverflowBufferSize
+	if limit <= 0 {
+		limit = 256
+	}
+	return &audience{
+		limit:   limit,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		clients: make(map[*Client]struct{}),
+		members: make(map[*Client]struct{}),
+	}
+}
+
+// add регистрирует зрителя; sync он получит раньше любого следующего события.
+func (a *audience) add(client *Client, sync domain.Event) {
+	a.clients[client] = struct{}{}
+	a.enqueue(audienceItem{client: client, sync: &sync}, true)
+}
+
+// remove возвращает false, если зритель уже удалён.
+func (a *audience) remove(client *Client) bool {
+	if _, ok := a.clients[client]; !ok {
+		return false
+	}
+	delete(a.clients, client)
+	a.enqueue(audienceItem{client: client}, true)
+	return true
+}
+
+// push возвращает false, если горутина раздачи не успевает и очередь полна.
+func (a *audience) push(event domain.Event) bool {
+	return a.enqueue(audienceItem{event: event}, false)
+}
+
+func (a *audience) enqueue(item audienceItem, force bool) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Вход и выход не теряются: иначе зритель останется без sync или в рассылке
+	if !force && len(a.queue) >= a.limit {
+		return false
+	}
+	a.queue = append(a.queue, item)
+	select {
+	case a.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (a *audience) list() []*Client {
+	clients := make([]*Client, 0, len(a.clients))
+	for client := range a.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+func (a *audience) size() int {
+	return len(a.clients)
+}
+
+// stop завершает горутину раздачи, когда она разошлёт уже поставленное в очередь.
+func (a *audience) stop() {
+	close(a.done)
+}
+
+func (a *audience) run() {
+	defer close(a.stopped)
+
+	for {
+		select {
+		case <-a.notify:
+			a.drain()
+		case <-a.done:
+			a.drain()
+			return
+		}
+	}
+}
+
+func (a *audience) drain() {
+	for {
+		a.mu.Lock()
+		items := a.queue
+		a.queue = nil
+		a.mu.Unlock()
+
+		if len(items) == 0 {
+			return
+		}
+		for _, item := range items {
+			a.handle(item)
+		}
+	}
+}
+
+func (a *audience) handle(item audienceItem) {
+	switch {
+	case item.client != nil && item.sync != nil:
+		a.members[item.client] = struct{}{}
+		a.deliver(item.client, *item.sync)
+	case item.client != nil:
+		delete(a.members, item.client)
+	default:
+		event := item.event
+		if payload, err := json.Marshal(event.Payload); err == nil {
+			event.Payload = json.RawMessage(payload)
+		}
+		for client := range a.members {
+			a.deliver(client, event)
+		}
+	}
+}
+
+func (a *audience) deliver(client *Client, event domain.Event) {
+	if !client.send.push(event) {
+		client.logger().Warn("Spectator is too slow, disconnecting", "queued", client.send.len())
+		go client.CloseWithReason(CloseTooSlow, "too slow, resync")
+	}
+}
@@ -1,58 +1,84 @@
 package service
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"sync"
 	"time"
 
-	"table_collab/internal/domain"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
-	"github.com/gorilla/websocket"
+	"table_collab/internal/domain"
+	"table_collab/internal/logging"
+	"table_collab/internal/tracing"
+	"table_collab/pkg/utils"
 )
 
 type Client struct {
-	ID       string
-	RoomID   string
-	Username string
-	Color    string
-	Conn     *websocket.Conn
-	hub      *Hub
-	send     chan domain.Event
-	mu       sync.Mutex
-	closed   bool
+	ID          string
+	RoomID      string
+	Username    string
+	Color       string
+	RemoteAddr  string
+	ConnectedAt time.Time
+	Transport   Transport
+	hub         *Hub
+	send        *outbox
+	done        chan struct{}
+	mu          sync.Mutex
+	closed      bool
+	muted       bool     // меняется только в Hub.Run
+	session     *session // меняется только в Hub.Run
+	resumable   bool
+	sheet       string       // лист, который смотрит клиент; меняется только в Hub.Run
+	log         *slog.Logger // логгер HTTP-запроса, открывшего соединение
+	conn        trace.Link   // спан HTTP-запроса, открывшего соединение
+	share       string       // токен ссылки share, если это зритель
 }
 
-func NewClient(conn *websocket.Conn, hub *Hub, roomID string) *Client {
+func NewClient(transport Transport, hub *Hub, roomID string) *Client {
+	cfg := hub.config.WebSocket
 	return &Client{
-		ID:     generateID(),
-		RoomID: roomID,
-		Conn:   conn,
-		hub:    hub,
-		send:   make(chan domain.Event, 256),
-		Color:  generateColor(),
+		ID:          generateID(),
+		RoomID:      roomID,
+		RemoteAddr:  transport.RemoteAddr(),
+		ConnectedAt: time.Now(),
+		Transport:   transport,
+		hub:         hub,
+		send:        newOutbox(cfg.SendBufferSize, cfg.OverflowBufferSize, PolicyDisconnect),
+		done:        make(chan struct{}),
+		Color:       generateColor(),
+		log:         slog.Default(),
 	}
 }
 
+// logger возвращает логгер с комнатой и ID клиента. ID берётся при каждом
+// вызове: resume заменяет его на ID прежней сессии.
+func (c *Client) logger() *slog.Logger {
+	return c.log.With(logging.KeyRoom, c.RoomID, logging.KeyClient, c.ID)
+}
+
 func (c *Client) ReadPump() {
+	var readErr error
 	defer func() {
-		c.hub.unregister <- c
+		// Обрыв сети можно пережить через resume, а явное закрытие — нет
+		c.mu.Lock()
+		c.resumable = !c.closed && !errors.Is(readErr, ErrTransportClosed)
+		c.mu.Unlock()
+
+		submit(c.hub, c.hub.incoming, clientEvent{
+			client: c,
+			event:  domain.Event{Type: domain.EventLeaveRoom, UserID: c.ID, RoomID: c.RoomID},
+		})
 		c.Close()
 	}()
 
-	c.Conn.SetReadLimit(c.hub.config.WebSocket.MaxMessageSize)
-
-	c.Conn.SetPongHandler(func(string) error {
-		c.Conn.SetReadDeadline(time.Now().Add(time.Duration(c.hub.config.WebSocket.PingPeriod) * time.Second))
-		return nil
-	})
-
 	for {
-		var event domain.Event
-		err := c.Conn.ReadJSON(&event)
+		event, err := c.Transport.ReadEvent()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket read error: %v", err)
-			}
+			readErr = err
 			break
 		}
 
@@ -69,77 +95,155 @@ func (c *Client) WritePump() {
 
 	for {
 		select {
-		case event, ok := <-c.send:
-			if !ok {
-				c.write(websocket.CloseMessage, []byte{})
-				return
-			}
-
-			if err := c.Conn.WriteJSON(event); err != nil {
-				log.Printf("Write error: %v", err)
-				return
+		case <-c.send.notify:
+			for {
+				event, ok := c.send.pop()
+				if !ok {
+					break
+				}
+				if err := c.write(event); err != nil {
+					c.logger().Warn("Write error", "transport", c.Transport.Name(), logging.Err(err))
+					return
+				}
 			}
 
 		case <-ticker.C:
-			c.mu.Lock()
-			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				c.mu.Unlock()
+			if err := c.Transport.Ping(); err != nil {
 				return
 			}
-			c.mu.Unlock()
+
+		case <-c.done:
+			return
 		}
 	}
 }
 
+// write отправляет событие клиенту. Событие с контекстом трассы получает спан
+// отправки — последнее звено трассы, а клиент — контекст этого спана.
+func (c *Client) write(event domain.Event) error {
+	// Ссылка share не раскрывает ID комнаты, и события зрителю его не показывают
+	if c.share != "" {
+		event.RoomID = ""
+	}
+	if event.TraceParent == "" {
+		return c.Transport.WriteEvent(event)
+	}
+
+	attrs := append(tracing.EventAttrs(c.RoomID, c.ID, event), tracing.AttrSeq.Int64(int64(event.Seq)))
+	ctx, span := c.hub.tracer.Start(tracing.Extract(context.Background(), event), "send "+string(event.Type),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attrs...),
+		trace.WithAttributes(tracing.AttrTransport.String(c.Transport.Name())))
+	defer span.End()
+
+	tracing.Inject(ctx, &event)
+	err := c.Transport.WriteEvent(event)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "write failed")
+	}
+	return err
+}
+
 func (c *Client) handleEvent(event domain.Event) {
 	event.UserID = c.ID
 	event.RoomID = c.RoomID
 	event.Timestamp = time.Now().UnixMilli()
+	c.logEvent(event)
+
+	ctx, span := c.receiveSpan(event)
+	defer span.End()
+
+	// Зритель только смотрит: его события до хаба не доходят
+	if c.share != "" {
+		span.SetStatus(codes.Error, "spectator")
+		c.send.push(domain.Event{
+			Type:      domain.EventError,
+			RoomID:    c.RoomID,
+			Timestamp: event.Timestamp,
+			Payload:   domain.ErrorPayload{Code: "spectator", Message: ErrSpectator.Error()},
+		})
+		return
+	}
 
-	switch event.Type {
-	case domain.EventJoinRoom:
-		if payload, ok := event.Payload.(map[string]interface{}); ok {
-			if username, ok := payload["username"].(string); ok {
-				c.Username = username
-			}
-		}
-		c.hub.register <- c
+	if !c.hub.collab.ValidateEvent(event) {
+		span.SetStatus(codes.Error, "unknown event type")
+		c.logger().Warn("Unknown event type", logging.KeyEvent, event.Type)
+		return
+	}
 
-	case domain.EventCursorMove:
-		c.hub.broadcast <- event
+	// Имя и тип комнаты из join разбирает Run: поля клиента он читает без
+	// блокировок. Правку, не принятую из-за остановки, клиент повторит после
+	// переподключения.
+	if !submit(c.hub, c.hub.incoming, clientEvent{client: c, event: event, ctx: ctx}) && isEdit(event.Type) {
+		span.SetStatus(codes.Error, "hub stopped")
+		c.send.push(nack(event, "shutting_down", ErrHubStopped.Error()))
+	}
+}
 
-	default:
-		log.Printf("Unknown event type: %s", event.Type)
+// receiveSpan открывает спан получения события. Если клиент передал контекст
+// трассы в конверте, спан продолжает его трассу, иначе начинает новую; в обоих
+// случаях спан ссылается на HTTP-запрос, открывший соединение.
+func (c *Client) receiveSpan(event domain.Event) (context.Context, trace.Span) {
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(tracing.EventAttrs(c.RoomID, c.ID, event)...),
+		trace.WithAttributes(tracing.AttrTransport.String(c.Transport.Name())),
+	}
+	if c.conn.SpanContext.IsValid() {
+		opts = append(opts, trace.WithLinks(c.conn))
 	}
+	return c.hub.tracer.Start(tracing.Extract(context.Background(), event), "receive "+string(event.Type), opts...)
 }
 
-func (c *Client) write(messageType int, data []byte) error {
+// logEvent пишет входящее событие в debug-лог. Движения курсора идут
+// непрерывным потоком, поэтому из них в лог попадает только выборка.
+func (c *Client) logEvent(event domain.Event) {
+	ctx := context.Background()
+	if !c.log.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	attrs := []slog.Attr{slog.String(logging.KeyEvent, string(event.Type))}
+	if event.Type == domain.EventCursorMove {
+		n, ok := c.hub.cursorLog.Allow()
+		if !ok {
+			return
+		}
+		attrs = append(attrs, slog.Uint64("cursor_total", n))
+	}
+	if event.OpID != "" {
+		attrs = append(attrs, slog.String("op_id", event.OpID))
+	}
+	c.logger().LogAttrs(ctx, slog.LevelDebug, "Event received", attrs...)
+}
+
+func (c *Client) isClosed() bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.closed {
-		return nil
-	}
-
-	c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-	return c.Conn.WriteMessage(messageType, data)
+	return c.closed
 }
 
 func (c *Client) Close() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.CloseWithReason(0, "")
+}
 
+// CloseWithReason сообщает клиенту код и причину закрытия, затем закрывает транспорт.
+func (c *Client) CloseWithReason(code int, reason string) {
+	c.mu.Lock()
 	if c.closed {
+		c.mu.Unlock()
 		return
 	}
-
 	c.closed = true
-	close(c.send)
-	c.Conn.Close()
+	close(c.done)
+	c.mu.Unlock()
+
+	c.Transport.Close(code, reason)
 }
 
 func generateID() string {
-	return "client_" + time.Now().Format("150405")
+	return "client_" + utils.GenerateID()
 }
 
 func generateColor() string {
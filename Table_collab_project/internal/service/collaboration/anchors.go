@@ -0,0 +1,89 @@
+package collaboration
+
+import "table_collab/internal/domain"
+
+// TextDiff описывает правку текста как замену одного фрагмента: символы
+// [Start, OldEnd) старого текста заменены на [Start, NewEnd) нового. Общий
+// префикс и суффикс старого и нового текста считаются неизменными.
+type TextDiff struct {
+	Start  int
+	OldEnd int
+	NewEnd int
+}
+
+// Diff находит изменённый фрагмент; позиции считаются в символах.
+func Diff(oldText, newText string) TextDiff {
+	before, after := []rune(oldText), []rune(newText)
+
+	prefix := 0
+	for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(before)-prefix && suffix < len(after)-prefix &&
+		before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+
+	return TextDiff{Start: prefix, OldEnd: len(before) - suffix, NewEnd: len(after) - suffix}
+}
+
+// Touches сообщает, задевает ли правка диапазон [start, end) старого текста.
+// Вставка на границе диапазона его не задевает.
+func (d TextDiff) Touches(start, end int) bool {
+	if d.Start == d.OldEnd {
+		return start < d.Start && d.Start < end
+	}
+	return d.Start < end && start < d.OldEnd
+}
+
+// Shift переносит диапазон [start, end) старого текста в новый. Позиции до
+// фрагмента остаются на месте, после него сдвигаются на разницу длин, а
+// границы внутри заменённого фрагмента прижимаются к его краям так, чтобы
+// диапазон охватывал новый текст. Вставка прямо перед началом или прямо после
+// конца диапазона в него не входит.
+func (d TextDiff) Shift(start, end int) (int, int) {
+	delta := d.NewEnd - d.OldEnd
+
+	switch {
+	case start >= d.OldEnd:
+		start += delta
+	case start > d.Start:
+		start = d.Start
+	}
+	switch {
+	case end <= d.Start:
+	case end >= d.OldEnd:
+		end += delta
+	default:
+		end = d.NewEnd
+	}
+	if end < start {
+		end = start
+	}
+	return start, end
+}
+
+// ShiftAnchors переносит текстовые якоря комментариев после замены oldText на
+// newText и возвращает новые позиции изменившихся веток.
+func (s *Service) ShiftAnchors(threads []*domain.CommentThread, oldText, newText string) map[string]domain.CommentAnchor {
+	if oldText == newText || len(threads) == 0 {
+		return nil
+	}
+
+	diff := Diff(oldText, newText)
+	changed := make(map[string]domain.CommentAnchor)
+	for _, thread := range threads {
+		anchor := thread.Anchor
+		if anchor.Cell != "" {
+			continue
+		}
+
+		anchor.Start, anchor.End = diff.Shift(anchor.Start, anchor.End)
+		if anchor != thread.Anchor {
+			thread.Anchor = anchor
+			changed[thread.ID] = anchor
+		}
+	}
+	return changed
+}
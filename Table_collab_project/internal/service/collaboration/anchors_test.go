@@ -0,0 +1,72 @@
+package collaboration
+
+import (
+	"testing"
+
+	"table_collab/internal/domain"
+)
+
+func TestShiftAnchors(t *testing.T) {
+	const text = "The quick brown fox"
+	// "quick" — [4, 9)
+	tests := []struct {
+		name    string
+		newText string
+		want    domain.CommentAnchor
+	}{
+		{"edit after range", "The quick brown cat", domain.CommentAnchor{Start: 4, End: 9}},
+		{"insert before range", "Oh, the quick brown fox", domain.CommentAnchor{Start: 8, End: 13}},
+		{"insert at range start", "The very quick brown fox", domain.CommentAnchor{Start: 9, End: 14}},
+		{"insert at range end", "The quickest brown fox", domain.CommentAnchor{Start: 4, End: 9}},
+		{"edit inside range", "The quack brown fox", domain.CommentAnchor{Start: 4, End: 9}},
+		{"grow inside range", "The quiiick brown fox", domain.CommentAnchor{Start: 4, End: 11}},
+		{"delete range", "The  brown fox", domain.CommentAnchor{Start: 4, End: 4}},
+		{"overlap start", "A quick brown fox", domain.CommentAnchor{Start: 2, End: 7}},
+		{"overlap end", "The quiet fox", domain.CommentAnchor{Start: 4, End: 9}},
+		{"multibyte before range", "Тот quick brown fox", domain.CommentAnchor{Start: 4, End: 9}},
+		{"clear text", "", domain.CommentAnchor{Start: 0, End: 0}},
+	}
+
+	s := NewService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thread := &domain.CommentThread{ID: "t", Anchor: domain.CommentAnchor{Start: 4, End: 9}}
+			cell := &domain.CommentThread{ID: "c", Anchor: domain.CommentAnchor{Cell: "A1"}}
+
+			changed := s.ShiftAnchors([]*domain.CommentThread{thread, cell}, text, tt.newText)
+			if thread.Anchor != tt.want {
+				t.Fatalf("anchor = %+v, want %+v", thread.Anchor, tt.want)
+			}
+			if _, ok := changed["t"]; ok != (tt.want != domain.CommentAnchor{Start: 4, End: 9}) {
+				t.Fatalf("changed = %v", changed)
+			}
+			if _, ok := changed["c"]; ok || cell.Anchor.Cell != "A1" {
+				t.Fatalf("cell anchor moved: %+v", cell.Anchor)
+			}
+		})
+	}
+}
+
+func TestDiffTouches(t *testing.T) {
+	const text = "Hello brave new world"
+	// "brave" — [6, 11)
+	tests := []struct {
+		newText string
+		want    bool
+	}{
+		{"Hello bold new world", true},
+		{"Hello brave new world!", false},
+		{"Oh, Hello brave new world", false},
+		{"Hello brave, new world", false},
+		{"Hello xbrave new world", false},
+		{"Hello brxave new world", true},
+		{"Hello world", true},
+		{"Hellobrave new world", false},
+	}
+
+	for _, tt := range tests {
+		if got := Diff(text, tt.newText).Touches(6, 11); got != tt.want {
+			t.Errorf("%q: Touches = %v, want %v", tt.newText, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package collaboration
+
+import "table_collab/internal/domain"
+
+// FindAttachment ищет вложение комнаты по ID.
+func FindAttachment(room *domain.Room, id string) (*domain.Attachment, int) {
+	for i, attachment := range room.Attachments {
+		if attachment.ID == id {
+			return attachment, i
+		}
+	}
+	return nil, -1
+}
+
+// RemoveAttachment убирает вложение из комнаты и сообщает, было ли оно. Сам
+// файл остаётся в хранилище до очистки.
+func RemoveAttachment(room *domain.Room, id string) bool {
+	_, i := FindAttachment(room, id)
+	if i < 0 {
+		return false
+	}
+	room.Attachments = append(room.Attachments[:i:i], room.Attachments[i+1:]...)
+	return true
+}
@@ -0,0 +1,85 @@
+package collaboration
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidCell = errors.New("invalid cell address")
+
+// CellRange — прямоугольник ячеек, включая границы. Колонки и строки с единицы.
+type CellRange struct {
+	FromCol, FromRow int
+	ToCol, ToRow     int
+}
+
+// ParseCell разбирает адрес вида "B3" (регистр не важен) в номер колонки и строки.
+func ParseCell(address string) (col, row int, err error) {
+	address = strings.ToUpper(strings.TrimSpace(address))
+
+	i := 0
+	for i < len(address) && address[i] >= 'A' && address[i] <= 'Z' {
+		col = col*26 + int(address[i]-'A'+1)
+		i++
+	}
+	if i == 0 || i > 3 || i == len(address) || len(address)-i > 7 || address[i] == '0' {
+		return 0, 0, ErrInvalidCell
+	}
+	for ; i < len(address); i++ {
+		if address[i] < '0' || address[i] > '9' {
+			return 0, 0, ErrInvalidCell
+		}
+		row = row*10 + int(address[i]-'0')
+	}
+	return col, row, nil
+}
+
+// ParseRange разбирает "B3" или "A1:C5"; углы можно указывать в любом порядке.
+func ParseRange(value string) (CellRange, error) {
+	from, to, ok := strings.Cut(value, ":")
+	if !ok {
+		to = from
+	}
+
+	fromCol, fromRow, err := ParseCell(from)
+	if err != nil {
+		return CellRange{}, err
+	}
+	toCol, toRow, err := ParseCell(to)
+	if err != nil {
+		return CellRange{}, err
+	}
+
+	return CellRange{
+		FromCol: min(fromCol, toCol), FromRow: min(fromRow, toRow),
+		ToCol: max(fromCol, toCol), ToRow: max(fromRow, toRow),
+	}, nil
+}
+
+func (r CellRange) Contains(col, row int) bool {
+	return col >= r.FromCol && col <= r.ToCol && row >= r.FromRow && row <= r.ToRow
+}
+
+func (r CellRange) Overlaps(other CellRange) bool {
+	return r.FromCol <= other.ToCol && other.FromCol <= r.ToCol &&
+		r.FromRow <= other.ToRow && other.FromRow <= r.ToRow
+}
+
+// String возвращает каноничную запись диапазона: "B3" или "A1:C5".
+func (r CellRange) String() string {
+	from := CellName(r.FromCol, r.FromRow)
+	if r.FromCol == r.ToCol && r.FromRow == r.ToRow {
+		return from
+	}
+	return from + ":" + CellName(r.ToCol, r.ToRow)
+}
+
+// CellName собирает адрес ячейки из номеров колонки и строки.
+func CellName(col, row int) string {
+	var letters []byte
+	for ; col > 0; col = (col - 1) / 26 {
+		letters = append([]byte{byte('A' + (col-1)%26)}, letters...)
+	}
+	return string(letters) + strconv.Itoa(row)
+}
@@ -0,0 +1,48 @@
+package collaboration
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	tests := map[string]string{
+		"b3":     "B3",
+		"A1:C5":  "A1:C5",
+		"C5:A1":  "A1:C5",
+		"AA10":   "AA10",
+		"Z1:AB2": "Z1:AB2",
+		"B3:b3":  "B3",
+	}
+	for in, want := range tests {
+		r, err := ParseRange(in)
+		if err != nil || r.String() != want {
+			t.Errorf("ParseRange(%q) = %v, %v, want %s", in, r, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "3B", "A0", "A", "AAAA1", "A1:", "A-1", "A1:B2:C3"} {
+		if _, err := ParseRange(in); err == nil {
+			t.Errorf("ParseRange(%q) succeeded", in)
+		}
+	}
+}
+
+func TestCellRangeOverlaps(t *testing.T) {
+	block, _ := ParseRange("B2:C3")
+
+	for _, in := range []string{"C3:D4", "A1:B2", "B2", "A1:Z9"} {
+		other, _ := ParseRange(in)
+		if !block.Overlaps(other) {
+			t.Errorf("B2:C3 should overlap %s", in)
+		}
+	}
+	for _, in := range []string{"D1:D9", "A4:C4", "A1"} {
+		other, _ := ParseRange(in)
+		if block.Overlaps(other) {
+			t.Errorf("B2:C3 should not overlap %s", in)
+		}
+	}
+
+	col, row, _ := ParseCell("c2")
+	if !block.Contains(col, row) {
+		t.Errorf("B2:C3 should contain C2")
+	}
+}
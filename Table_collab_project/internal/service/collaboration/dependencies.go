@@ -0,0 +1,172 @@
+package collaboration
+
+import (
+	"strings"
+
+	"table_collab/internal/domain"
+)
+
+// formulaGraph — граф зависимостей формул комнаты: для каждой формулы её
+// ссылки и вычисленное значение. Строится полным пересчётом, а правка ячейки
+// пересчитывает по нему только формулы, которые от неё зависят. Ключи —
+// "sheetID!A1".
+type formulaGraph struct {
+	// Комната, для которой построен граф: копия комнаты его не унаследует
+	room   *domain.Room
+	values map[string]value
+	refs   map[string][]cellRef
+	// Формулы, ссылающиеся на отдельную ячейку
+	cells map[string]map[string]bool
+	// Формулы с диапазонами; диапазонов немного, их перебираем
+	ranges map[string]bool
+}
+
+// cellRef — ссылка формулы, уже привязанная к листу.
+type cellRef struct {
+	sheetID string
+	cells   CellRange
+}
+
+func newFormulaGraph(room *domain.Room) *formulaGraph {
+	g := &formulaGraph{
+		room:   room,
+		values: make(map[string]value),
+		refs:   make(map[string][]cellRef),
+		cells:  make(map[string]map[string]bool),
+		ranges: make(map[string]bool),
+	}
+	for _, sheet := range room.Sheets {
+		for cell, raw := range sheet.Cells {
+			if strings.HasPrefix(raw, "=") {
+				g.link(cellKey(sheet.ID, cell), formulaRefs(room, sheet, raw[1:]))
+			}
+		}
+	}
+	return g
+}
+
+func cellKey(sheetID, cell string) string {
+	return sheetID + "!" + cell
+}
+
+// link запоминает ссылки формулы key.
+func (g *formulaGraph) link(key string, refs []cellRef) {
+	if len(refs) == 0 {
+		return
+	}
+	g.refs[key] = refs
+	for _, ref := range refs {
+		if !ref.single() {
+			g.ranges[key] = true
+			continue
+		}
+		target := cellKey(ref.sheetID, CellName(ref.cells.FromCol, ref.cells.FromRow))
+		if g.cells[target] == nil {
+			g.cells[target] = make(map[string]bool)
+		}
+		g.cells[target][key] = true
+	}
+}
+
+// unlink забывает ссылки формулы key, например перед её заменой.
+func (g *formulaGraph) unlink(key string) {
+	for _, ref := range g.refs[key] {
+		if ref.single() {
+			target := cellKey(ref.sheetID, CellName(ref.cells.FromCol, ref.cells.FromRow))
+			delete(g.cells[target], key)
+			if len(g.cells[target]) == 0 {
+				delete(g.cells, target)
+			}
+		}
+	}
+	delete(g.refs, key)
+	delete(g.ranges, key)
+	delete(g.values, key)
+}
+
+// affected возвращает ячейку key и все формулы, которые от неё зависят
+// напрямую или через другие формулы.
+func (g *formulaGraph) affected(key string) map[string]bool {
+	found := map[string]bool{key: true}
+	queue := []string{key}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for dependent := range g.cells[current] {
+			if !found[dependent] {
+				found[dependent] = true
+				queue = append(queue, dependent)
+			}
+		}
+
+		sheetID, cell := splitKey(current)
+		col, row, err := ParseCell(cell)
+		if err != nil {
+			continue
+		}
+		for dependent := range g.ranges {
+			if found[dependent] {
+				continue
+			}
+			for _, ref := range g.refs[dependent] {
+				if ref.sheetID == sheetID && ref.cells.Contains(col, row) {
+					found[dependent] = true
+					queue = append(queue, dependent)
+					break
+				}
+			}
+		}
+	}
+	return found
+}
+
+func splitKey(key string) (sheetID, cell string) {
+	i := strings.LastIndexByte(key, '!')
+	return key[:i], key[i+1:]
+}
+
+func (r cellRef) single() bool {
+	return r.cells.FromCol == r.cells.ToCol && r.cells.FromRow == r.cells.ToRow
+}
+
+// formulaRefs возвращает ссылки формулы. Ссылки на несуществующие листы не
+// попадают в граф: лист может появиться только правкой листов, а после неё
+// граф строится заново.
+func formulaRefs(room *domain.Room, sheet *domain.Sheet, text string) []cellRef {
+	tokens, err := lexFormula(text)
+	if err != "" {
+		return nil
+	}
+	p := &parser{tokens: tokens}
+	n, perr := p.expr()
+	if perr != "" {
+		return nil
+	}
+
+	var refs []cellRef
+	var walk func(n node)
+	walk = func(n node) {
+		switch n := n.(type) {
+		case refNode:
+			target := sheet
+			if n.sheet != "" {
+				target = sheetByName(room, n.sheet)
+			}
+			if cells, err := ParseRange(n.cells); target != nil && err == nil {
+				refs = append(refs, cellRef{sheetID: target.ID, cells: cells})
+			}
+		case unaryNode:
+			walk(n.x)
+		case binaryNode:
+			walk(n.l)
+			walk(n.r)
+		case callNode:
+			for _, arg := range n.args {
+				walk(arg)
+			}
+		}
+	}
+	walk(n)
+	return refs
+}
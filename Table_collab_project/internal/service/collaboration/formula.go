@@ -0,0 +1,718 @@
+package collaboration
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"table_collab/internal/domain"
+)
+
+// Ошибки вычисления формул — в ячейке показывается сам код ошибки.
+type formulaError string
+
+const (
+	errRef    formulaError = "#REF!"
+	errDiv0   formulaError = "#DIV/0!"
+	errCycle  formulaError = "#CYCLE!"
+	errValue  formulaError = "#VALUE!"
+	errName   formulaError = "#NAME?"
+	errSyntax formulaError = "#ERROR!"
+)
+
+// Recalculate пересчитывает формулы всех листов комнаты (ячейки, значение
+// которых начинается с "=") и сохраняет результаты в Sheet.Values. Возвращает
+// изменившиеся значения: sheet_id → ячейка → значение, пустое — формулы
+// больше нет.
+//
+// Формулы поддерживают числа, + - * /, скобки, ссылки A1, Лист!A1 и
+// 'Лист с пробелом'!A1, а также SUM, AVERAGE, MIN, MAX и COUNT от ссылок и
+// диапазонов A1:B5.
+//
+// Заодно строится граф зависимостей для RecalculateCell.
+func Recalculate(room *domain.Room) map[string]map[string]string {
+	g := newFormulaGraph(room)
+	e := &evaluator{room: room, results: g.values, visiting: make(map[string]bool)}
+	room.Formulas = g
+
+	changed := make(map[string]map[string]string)
+	mark := func(sheet *domain.Sheet, cell, v string) {
+		if changed[sheet.ID] == nil {
+			changed[sheet.ID] = make(map[string]string)
+		}
+		changed[sheet.ID][cell] = v
+	}
+
+	for _, sheet := range room.Sheets {
+		values := make(map[string]string)
+		for cell, raw := range sheet.Cells {
+			if strings.HasPrefix(raw, "=") {
+				values[cell] = e.cell(sheet, cell).String()
+			}
+		}
+
+		for cell, v := range values {
+			if sheet.Values[cell] != v {
+				mark(sheet, cell, v)
+			}
+		}
+		for cell := range sheet.Values {
+			if _, ok := values[cell]; !ok {
+				mark(sheet, cell, "")
+			}
+		}
+
+		sheet.Values = values
+		if len(values) == 0 {
+			sheet.Values = nil
+		}
+	}
+	return changed
+}
+
+// RecalculateCell пересчитывает после правки ячейки только формулы, которые
+// от неё зависят, и саму ячейку, если в ней формула. Результат — как у
+// Recalculate. Без графа (комнату ещё не пересчитывали или это её копия)
+// выполняется полный пересчёт.
+func RecalculateCell(room *domain.Room, sheetID, cell string) map[string]map[string]string {
+	g, ok := room.Formulas.(*formulaGraph)
+	sheet, _, err := FindSheet(room, sheetID)
+	if !ok || g.room != room || err != nil {
+		return Recalculate(room)
+	}
+
+	key := cellKey(sheet.ID, cell)
+	g.unlink(key)
+	if raw := sheet.Cells[cell]; strings.HasPrefix(raw, "=") {
+		g.link(key, formulaRefs(room, sheet, raw[1:]))
+	}
+
+	// Затронутые формулы вычисляются заново, остальные берутся из графа
+	affected := g.affected(key)
+	for dirty := range affected {
+		delete(g.values, dirty)
+	}
+	e := &evaluator{room: room, results: make(map[string]value), visiting: make(map[string]bool), known: g.values}
+
+	changed := make(map[string]map[string]string)
+	for dirty := range affected {
+		sheetID, cell := splitKey(dirty)
+		target, _, err := FindSheet(room, sheetID)
+		if err != nil {
+			continue
+		}
+
+		v := ""
+		if strings.HasPrefix(target.Cells[cell], "=") {
+			v = e.cell(target, cell).String()
+		}
+		if target.Values[cell] == v {
+			continue
+		}
+		if changed[target.ID] == nil {
+			changed[target.ID] = make(map[string]string)
+		}
+		changed[target.ID][cell] = v
+
+		if v == "" {
+			delete(target.Values, cell)
+		} else {
+			if target.Values == nil {
+				target.Values = make(map[string]string)
+			}
+			target.Values[cell] = v
+		}
+		if len(target.Values) == 0 {
+			target.Values = nil
+		}
+	}
+	for dirty, v := range e.results {
+		g.values[dirty] = v
+	}
+	return changed
+}
+
+// RenameSheetRefs переписывает ссылки на лист oldName во всех формулах комнаты.
+func RenameSheetRefs(room *domain.Room, oldName, newName string) {
+	for _, sheet := range room.Sheets {
+		for cell, raw := range sheet.Cells {
+			if !strings.HasPrefix(raw, "=") {
+				continue
+			}
+			tokens, err := lexFormula(raw[1:])
+			if err != "" {
+				continue
+			}
+
+			var b strings.Builder
+			last := 0
+			for i, tok := range tokens {
+				isSheet := (tok.kind == tokIdent || tok.kind == tokQuoted) &&
+					i+1 < len(tokens) && tokens[i+1].kind == tokBang
+				if !isSheet || !strings.EqualFold(tok.text, oldName) {
+					continue
+				}
+				b.WriteString(raw[1+last : 1+tok.pos])
+				b.WriteString(quoteSheetName(newName))
+				last = tok.end
+			}
+			if last > 0 {
+				b.WriteString(raw[1+last:])
+				sheet.Cells[cell] = "=" + b.String()
+			}
+		}
+	}
+}
+
+// quoteSheetName записывает название листа для формулы, заключая в кавычки,
+// если без них оно не разберётся как имя.
+func quoteSheetName(name string) string {
+	plain := name != ""
+	for i, r := range name {
+		if !(unicode.IsLetter(r) || r == '_' || (i > 0 && unicode.IsDigit(r))) {
+			plain = false
+			break
+		}
+	}
+	if _, _, err := ParseCell(name); err == nil {
+		plain = false
+	}
+	if plain {
+		return name
+	}
+	return "'" + name + "'"
+}
+
+// value — значение ячейки при вычислении: число, текст, пусто или ошибка.
+type value struct {
+	num   float64
+	text  string
+	isNum bool
+	err   formulaError
+}
+
+func literal(raw string) value {
+	if raw == "" {
+		return value{}
+	}
+	if num, err := strconv.ParseFloat(strings.TrimSpace(raw), 64); err == nil && !math.IsInf(num, 0) && !math.IsNaN(num) {
+		return value{num: num, isNum: true}
+	}
+	return value{text: raw}
+}
+
+func (v value) String() string {
+	switch {
+	case v.err != "":
+		return string(v.err)
+	case v.isNum:
+		return formatNumber(v.num)
+	case v.text == "":
+		return "0"
+	default:
+		return v.text
+	}
+}
+
+// number приводит значение к числу для арифметики: пустая ячейка — ноль,
+// текст — ошибка.
+func (v value) number() (float64, formulaError) {
+	switch {
+	case v.err != "":
+		return 0, v.err
+	case v.isNum:
+		return v.num, ""
+	case v.text == "":
+		return 0, ""
+	default:
+		return 0, errValue
+	}
+}
+
+// formatNumber округляет до 15 значащих цифр, чтобы 0.1+0.2 давало 0.3.
+func formatNumber(num float64) string {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(num, 'g', 15, 64), 64)
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+type evaluator struct {
+	room     *domain.Room
+	results  map[string]value
+	visiting map[string]bool
+	// Значения формул, которые правка не затронула
+	known map[string]value
+}
+
+func (e *evaluator) cell(sheet *domain.Sheet, cell string) value {
+	raw := sheet.Cells[cell]
+	if !strings.HasPrefix(raw, "=") {
+		return literal(raw)
+	}
+
+	key := cellKey(sheet.ID, cell)
+	if v, ok := e.results[key]; ok {
+		return v
+	}
+	if v, ok := e.known[key]; ok {
+		return v
+	}
+	if e.visiting[key] {
+		return value{err: errCycle}
+	}
+
+	e.visiting[key] = true
+	v := e.formula(sheet, raw[1:])
+	delete(e.visiting, key)
+
+	e.results[key] = v
+	return v
+}
+
+func (e *evaluator) formula(sheet *domain.Sheet, text string) value {
+	tokens, err := lexFormula(text)
+	if err != "" {
+		return value{err: errSyntax}
+	}
+	p := &parser{tokens: tokens}
+	n, perr := p.expr()
+	if perr == "" && p.pos < len(tokens) {
+		perr = errSyntax
+	}
+	if perr != "" {
+		return value{err: perr}
+	}
+
+	v := e.eval(sheet, n)
+	if v.err == "" && !v.isNum && v.text == "" {
+		return value{isNum: true}
+	}
+	return v
+}
+
+func (e *evaluator) eval(sheet *domain.Sheet, n node) value {
+	switch n := n.(type) {
+	case numberNode:
+		return value{num: float64(n), isNum: true}
+
+	case refNode:
+		target, cells, err := e.resolve(sheet, n)
+		if err != "" {
+			return value{err: err}
+		}
+		if cells.FromCol != cells.ToCol || cells.FromRow != cells.ToRow {
+			// Диапазон допустим только аргументом функции
+			return value{err: errValue}
+		}
+		return e.cell(target, CellName(cells.FromCol, cells.FromRow))
+
+	case unaryNode:
+		x, err := e.eval(sheet, n.x).number()
+		if err != "" {
+			return value{err: err}
+		}
+		return value{num: -x, isNum: true}
+
+	case binaryNode:
+		l, err := e.eval(sheet, n.l).number()
+		if err != "" {
+			return value{err: err}
+		}
+		r, err := e.eval(sheet, n.r).number()
+		if err != "" {
+			return value{err: err}
+		}
+		var result float64
+		switch n.op {
+		case '+':
+			result = l + r
+		case '-':
+			result = l - r
+		case '*':
+			result = l * r
+		case '/':
+			if r == 0 {
+				return value{err: errDiv0}
+			}
+			result = l / r
+		}
+		if math.IsInf(result, 0) || math.IsNaN(result) {
+			return value{err: errValue}
+		}
+		return value{num: result, isNum: true}
+
+	case callNode:
+		return e.call(sheet, n)
+	}
+	return value{err: errSyntax}
+}
+
+func (e *evaluator) call(sheet *domain.Sheet, n callNode) value {
+	var nums []float64
+	for _, arg := range n.args {
+		ref, ok := arg.(refNode)
+		if !ok {
+			num, err := e.eval(sheet, arg).number()
+			if err != "" {
+				return value{err: err}
+			}
+			nums = append(nums, num)
+			continue
+		}
+
+		// Текст и пустые ячейки в ссылках пропускаются, как в таблицах
+		target, cells, err := e.resolve(sheet, ref)
+		if err != "" {
+			return value{err: err}
+		}
+		for _, cell := range cellsIn(target, cells) {
+			v := e.cell(target, cell)
+			if v.err != "" {
+				return v
+			}
+			if v.isNum {
+				nums = append(nums, v.num)
+			}
+		}
+	}
+
+	switch n.name {
+	case "SUM":
+		var sum float64
+		for _, num := range nums {
+			sum += num
+		}
+		return value{num: sum, isNum: true}
+	case "COUNT":
+		return value{num: float64(len(nums)), isNum: true}
+	case "AVERAGE":
+		if len(nums) == 0 {
+			return value{err: errDiv0}
+		}
+		var sum float64
+		for _, num := range nums {
+			sum += num
+		}
+		return value{num: sum / float64(len(nums)), isNum: true}
+	case "MIN", "MAX":
+		if len(nums) == 0 {
+			return value{num: 0, isNum: true}
+		}
+		result := nums[0]
+		for _, num := range nums[1:] {
+			if n.name == "MIN" {
+				result = math.Min(result, num)
+			} else {
+				result = math.Max(result, num)
+			}
+		}
+		return value{num: result, isNum: true}
+	}
+	return value{err: errName}
+}
+
+func (e *evaluator) resolve(sheet *domain.Sheet, ref refNode) (*domain.Sheet, CellRange, formulaError) {
+	target := sheet
+	if ref.sheet != "" {
+		if target = sheetByName(e.room, ref.sheet); target == nil {
+			return nil, CellRange{}, errRef
+		}
+	}
+	cells, err := ParseRange(ref.cells)
+	if err != nil {
+		return nil, CellRange{}, errRef
+	}
+	return target, cells, ""
+}
+
+// cellsIn возвращает заполненные ячейки листа внутри диапазона по строкам.
+// Диапазон меньше листа перебирается по адресам, больший — по заполненным
+// ячейкам листа.
+func cellsIn(sheet *domain.Sheet, cells CellRange) []string {
+	var found []string
+	if area := (cells.ToCol - cells.FromCol + 1) * (cells.ToRow - cells.FromRow + 1); area <= len(sheet.Cells) {
+		for row := cells.FromRow; row <= cells.ToRow; row++ {
+			for col := cells.FromCol; col <= cells.ToCol; col++ {
+				if cell := CellName(col, row); sheet.Cells[cell] != "" {
+					found = append(found, cell)
+				}
+			}
+		}
+		return found
+	}
+
+	type position struct {
+		cell     string
+		col, row int
+	}
+	var inside []position
+	for cell := range sheet.Cells {
+		if col, row, err := ParseCell(cell); err == nil && cells.Contains(col, row) {
+			inside = append(inside, position{cell, col, row})
+		}
+	}
+	sort.Slice(inside, func(i, j int) bool {
+		if inside[i].row != inside[j].row {
+			return inside[i].row < inside[j].row
+		}
+		return inside[i].col < inside[j].col
+	})
+	for _, p := range inside {
+		found = append(found, p.cell)
+	}
+	return found
+}
+
+// Разбор формулы: лексер и рекурсивный спуск в дерево узлов.
+
+type tokenKind int
+
+const (
+	tokNumber tokenKind = iota
+	tokIdent
+	tokQuoted
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+	tokColon
+	tokBang
+)
+
+type token struct {
+	kind     tokenKind
+	text     string
+	pos, end int // байтовые смещения в тексте формулы
+}
+
+func lexFormula(text string) ([]token, formulaError) {
+	var tokens []token
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			continue
+
+		case r >= '0' && r <= '9' || r == '.':
+			for i < len(text) && (text[i] >= '0' && text[i] <= '9' || text[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: text[start:i], pos: start, end: i})
+
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(text) {
+				r, size := utf8.DecodeRuneInString(text[i:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: text[start:i], pos: start, end: i})
+
+		case r == '\'':
+			closing := strings.IndexByte(text[i+1:], '\'')
+			if closing < 0 {
+				return nil, errSyntax
+			}
+			i += closing + 2
+			tokens = append(tokens, token{kind: tokQuoted, text: text[start+1 : i-1], pos: start, end: i})
+
+		default:
+			kinds := map[rune]tokenKind{
+				'+': tokOp, '-': tokOp, '*': tokOp, '/': tokOp,
+				'(': tokLParen, ')': tokRParen, ',': tokComma, ':': tokColon, '!': tokBang,
+			}
+			kind, ok := kinds[r]
+			if !ok {
+				return nil, errSyntax
+			}
+			i += size
+			tokens = append(tokens, token{kind: kind, text: text[start:i], pos: start, end: i})
+		}
+	}
+	return tokens, ""
+}
+
+type node interface{}
+
+type numberNode float64
+
+// refNode — ссылка на ячейку или диапазон; пустой sheet — текущий лист.
+type refNode struct {
+	sheet string
+	cells string
+}
+
+type unaryNode struct{ x node }
+
+type binaryNode struct {
+	op   byte
+	l, r node
+}
+
+type callNode struct {
+	name string
+	args []node
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return token{}, false
+}
+
+func (p *parser) accept(kind tokenKind) (token, bool) {
+	if tok, ok := p.peek(); ok && tok.kind == kind {
+		p.pos++
+		return tok, true
+	}
+	return token{}, false
+}
+
+func (p *parser) acceptOp(ops string) (byte, bool) {
+	if tok, ok := p.peek(); ok && tok.kind == tokOp && strings.Contains(ops, tok.text) {
+		p.pos++
+		return tok.text[0], true
+	}
+	return 0, false
+}
+
+func (p *parser) expr() (node, formulaError) {
+	l, err := p.term()
+	for err == "" {
+		op, ok := p.acceptOp("+-")
+		if !ok {
+			break
+		}
+		var r node
+		if r, err = p.term(); err == "" {
+			l = binaryNode{op: op, l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (p *parser) term() (node, formulaError) {
+	l, err := p.unary()
+	for err == "" {
+		op, ok := p.acceptOp("*/")
+		if !ok {
+			break
+		}
+		var r node
+		if r, err = p.unary(); err == "" {
+			l = binaryNode{op: op, l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (p *parser) unary() (node, formulaError) {
+	if op, ok := p.acceptOp("+-"); ok {
+		x, err := p.unary()
+		if op == '-' {
+			return unaryNode{x: x}, err
+		}
+		return binaryNode{op: '+', l: numberNode(0), r: x}, err
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, formulaError) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, errSyntax
+	}
+	p.pos++
+
+	switch tok.kind {
+	case tokNumber:
+		num, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, errSyntax
+		}
+		return numberNode(num), ""
+
+	case tokLParen:
+		n, err := p.expr()
+		if err != "" {
+			return nil, err
+		}
+		if _, ok := p.accept(tokRParen); !ok {
+			return nil, errSyntax
+		}
+		return n, ""
+
+	case tokQuoted:
+		if _, ok := p.accept(tokBang); !ok {
+			return nil, errSyntax
+		}
+		return p.ref(tok.text)
+
+	case tokIdent:
+		if _, ok := p.accept(tokBang); ok {
+			return p.ref(tok.text)
+		}
+		if _, ok := p.accept(tokLParen); ok {
+			return p.call(strings.ToUpper(tok.text))
+		}
+		p.pos--
+		return p.ref("")
+	}
+	return nil, errSyntax
+}
+
+func (p *parser) ref(sheet string) (node, formulaError) {
+	from, ok := p.accept(tokIdent)
+	if !ok {
+		return nil, errSyntax
+	}
+	if _, _, err := ParseCell(from.text); err != nil {
+		return nil, errName
+	}
+
+	cells := from.text
+	if _, ok := p.accept(tokColon); ok {
+		to, ok := p.accept(tokIdent)
+		if !ok {
+			return nil, errSyntax
+		}
+		if _, _, err := ParseCell(to.text); err != nil {
+			return nil, errName
+		}
+		cells += ":" + to.text
+	}
+	return refNode{sheet: sheet, cells: cells}, ""
+}
+
+func (p *parser) call(name string) (node, formulaError) {
+	n := callNode{name: name}
+	if _, ok := p.accept(tokRParen); ok {
+		return n, ""
+	}
+	for {
+		arg, err := p.expr()
+		if err != "" {
+			return nil, err
+		}
+		n.args = append(n.args, arg)
+
+		if _, ok := p.accept(tokComma); ok {
+			continue
+		}
+		if _, ok := p.accept(tokRParen); ok {
+			return n, ""
+		}
+		return nil, errSyntax
+	}
+}
@@ -0,0 +1,158 @@
+package collaboration
+
+import (
+	"testing"
+
+	"table_collab/internal/domain"
+)
+
+func formulaRoom() *domain.Room {
+	return &domain.Room{Type: domain.RoomTypeTable, Sheets: []*domain.Sheet{
+		{ID: "s1", Name: "Data", Cells: map[string]string{
+			"A1": "10", "A2": "20", "A3": "12.5", "A4": "n/a", "B1": "0",
+		}},
+		{ID: "s2", Name: "Q1 plan", Cells: map[string]string{"C3": "4"}},
+		{ID: "s3", Name: "Report"},
+	}}
+}
+
+func TestRecalculate(t *testing.T) {
+	tests := map[string]string{
+		"=1+2*3":                 "7",
+		"=(1+2)*3":               "9",
+		"=-A1+5":                 "-5",
+		"=0.1+0.2":               "0.3",
+		"=A1/B1":                 "#DIV/0!",
+		"=A4*2":                  "#VALUE!",
+		"=A4":                    "n/a",
+		"=Z99":                   "0",
+		"=SUM(A1:A4)":            "42.5",
+		"=sum(A1, 8, A2)":        "38",
+		"=AVERAGE(A1:A3)":        "14.1666666666667",
+		"=MIN(A1:A3)-MAX(A1:A3)": "-10",
+		"=COUNT(A1:B9)":          "4",
+		"=Data!A1+'Q1 plan'!C3":  "14",
+		"=Missing!A1":            "#REF!",
+		"=MEDIAN(A1:A3)":         "#NAME?",
+		"=foo+1":                 "#NAME?",
+		"=A1:A3":                 "#VALUE!",
+		"=1+":                    "#ERROR!",
+		"=(1":                    "#ERROR!",
+		"=1 2":                   "#ERROR!",
+		"=":                      "#ERROR!",
+	}
+
+	for formula, want := range tests {
+		room := formulaRoom()
+		data := room.Sheets[0]
+		data.Cells["D1"] = formula
+
+		Recalculate(room)
+		if got := data.Values["D1"]; got != want {
+			t.Errorf("%s = %q, want %q", formula, got, want)
+		}
+	}
+}
+
+func TestRecalculateChainsAndCycles(t *testing.T) {
+	room := formulaRoom()
+	room.Sheets[2].Cells = map[string]string{
+		"A1": "=A2+1", "A2": "=Data!A1*2",
+		"B1": "=B2", "B2": "=B1",
+	}
+
+	changed := Recalculate(room)
+	if want := map[string]string{"A1": "21", "A2": "20", "B1": "#CYCLE!", "B2": "#CYCLE!"}; !equalValues(changed["s3"], want) {
+		t.Fatalf("changed = %v, want %v", changed["s3"], want)
+	}
+
+	// Повторный пересчёт без правок ничего не меняет
+	if changed := Recalculate(room); len(changed) != 0 {
+		t.Fatalf("unexpected changes: %v", changed)
+	}
+
+	// Правка исходной ячейки на другом листе доходит по цепочке, а удалённая
+	// формула сообщается пустым значением
+	room.Sheets[0].Cells["A1"] = "1"
+	delete(room.Sheets[2].Cells, "B2")
+	changed = Recalculate(room)
+	if want := map[string]string{"A1": "3", "A2": "2", "B1": "0", "B2": ""}; !equalValues(changed["s3"], want) {
+		t.Fatalf("changed = %v, want %v", changed["s3"], want)
+	}
+}
+
+// Правка ячейки пересчитывает только зависящие от неё формулы, и результат
+// совпадает с полным пересчётом.
+func TestRecalculateCell(t *testing.T) {
+	room := formulaRoom()
+	room.Sheets[2].Cells = map[string]string{
+		"A1": "=A2+1", "A2": "=Data!A1*2", "A3": "=SUM(Data!A1:A3)",
+		"A4": "='Q1 plan'!C3*2",
+		"B1": "=B2", "B2": "=B1",
+	}
+	Recalculate(room)
+
+	graph := room.Formulas.(*formulaGraph)
+	if affected := graph.affected("s1!A1"); affected["s3!A4"] || affected["s3!B1"] || !affected["s3!A1"] || !affected["s3!A3"] {
+		t.Fatalf("affected by Data!A1: %v", affected)
+	}
+
+	room.Sheets[0].Cells["A1"] = "1"
+	changed := RecalculateCell(room, "s1", "A1")
+	if want := map[string]string{"A1": "3", "A2": "2", "A3": "33.5"}; len(changed) != 1 || !equalValues(changed["s3"], want) {
+		t.Fatalf("changed = %v, want s3: %v", changed, want)
+	}
+
+	delete(room.Sheets[2].Cells, "B2")
+	if changed := RecalculateCell(room, "s3", "B2"); !equalValues(changed["s3"], map[string]string{"B1": "0", "B2": ""}) {
+		t.Fatalf("after removing a formula: %v", changed)
+	}
+
+	room.Sheets[0].Cells["C1"] = "=A1*10"
+	if changed := RecalculateCell(room, "s1", "C1"); !equalValues(changed["s1"], map[string]string{"C1": "10"}) {
+		t.Fatalf("new formula: %v", changed)
+	}
+	room.Sheets[2].Cells["B2"] = "=Data!C1+A3"
+	RecalculateCell(room, "s3", "B2")
+
+	full := &domain.Room{Type: domain.RoomTypeTable, Sheets: CloneSheets(room.Sheets)}
+	Recalculate(full)
+	for i, sheet := range room.Sheets {
+		if !equalValues(sheet.Values, full.Sheets[i].Values) {
+			t.Fatalf("sheet %s: incremental %v, full %v", sheet.ID, sheet.Values, full.Sheets[i].Values)
+		}
+	}
+}
+
+func TestRenameSheetRefs(t *testing.T) {
+	room := formulaRoom()
+	room.Sheets[2].Cells = map[string]string{
+		"A1": "=SUM(Data!A1:A3) + data!B1",
+		"A2": "='Q1 plan'!C3",
+		"A3": "Data!A1",
+	}
+
+	RenameSheetRefs(room, "Data", "Raw data")
+	RenameSheetRefs(room, "Q1 plan", "Plan")
+
+	want := map[string]string{
+		"A1": "=SUM('Raw data'!A1:A3) + 'Raw data'!B1",
+		"A2": "=Plan!C3",
+		"A3": "Data!A1",
+	}
+	if !equalValues(room.Sheets[2].Cells, want) {
+		t.Fatalf("cells = %v, want %v", room.Sheets[2].Cells, want)
+	}
+}
+
+func equalValues(got, want map[string]string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for key, value := range want {
+		if v, ok := got[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
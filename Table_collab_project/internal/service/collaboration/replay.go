@@ -0,0 +1,122 @@
+package collaboration
+
+import (
+	"fmt"
+	"time"
+
+	"table_collab/internal/domain"
+)
+
+// Replay применяет событие из журнала к состоянию комнаты и возвращает новое
+// состояние; nil означает, что комната закрыта. События в журнале уже прошли
+// проверки hub, поэтому здесь они только воспроизводятся: результат должен
+// совпадать с тем, что hub получил при исходной обработке.
+func (s *Service) Replay(room *domain.Room, event domain.Event) (*domain.Room, error) {
+	switch event.Type {
+	case domain.EventRoomCreated:
+		var payload domain.RoomCreatedPayload
+		if err := domain.DecodePayload(event, &payload); err != nil || payload.Room == nil {
+			return room, fmt.Errorf("%s: invalid payload", event.Type)
+		}
+		EnsureSheets(payload.Room)
+		return payload.Room, nil
+
+	case domain.EventRoomClosed:
+		return nil, nil
+	}
+
+	if room == nil {
+		return nil, fmt.Errorf("%s for a room that does not exist", event.Type)
+	}
+
+	switch event.Type {
+	case domain.EventTextUpdate:
+		text, version := s.ApplyTextUpdate(room.Content, event)
+		if version == 0 {
+			return room, fmt.Errorf("%s: invalid payload", event.Type)
+		}
+		s.ShiftAnchors(room.Comments, room.Content, text)
+		room.Content = text
+		room.Version = event.Version
+
+	case domain.EventCellUpdate:
+		payload, err := s.ApplyCellUpdate(room, event)
+		if err != nil {
+			return room, fmt.Errorf("%s: %w", event.Type, err)
+		}
+		RecalculateCell(room, payload.SheetID, payload.Cell)
+		RefreshViews(room, nil)
+		room.Version = event.Version
+
+	case domain.EventSheetAdd, domain.EventSheetRename, domain.EventSheetMove,
+		domain.EventSheetDuplicate, domain.EventSheetDelete, domain.EventColumnUpdate:
+		if _, err := s.ApplySheetEdit(room, event); err != nil {
+			return room, fmt.Errorf("%s: %w", event.Type, err)
+		}
+		Recalculate(room)
+		RefreshViews(room, nil)
+		room.Version = event.Version
+
+	case domain.EventElementAdd:
+		room.Version = event.Version
+
+	case domain.EventCommentThread:
+		var thread domain.CommentThread
+		if err := domain.DecodePayload(event, &thread); err != nil || thread.ID == "" {
+			return room, fmt.Errorf("%s: invalid payload", event.Type)
+		}
+		replaceThread(room, &thread)
+
+	case domain.EventViewUpdated:
+		var view domain.View
+		if err := domain.DecodePayload(event, &view); err != nil || view.ID == "" {
+			return room, fmt.Errorf("%s: invalid payload", event.Type)
+		}
+		ReplaceView(room, &view)
+
+	case domain.EventViewDelete:
+		var payload domain.ViewDeletePayload
+		if err := domain.DecodePayload(event, &payload); err != nil {
+			return room, fmt.Errorf("%s: invalid payload", event.Type)
+		}
+		RemoveView(room, payload.ViewID)
+
+	case domain.EventAttachmentAdded:
+		var attachment domain.Attachment
+		if err := domain.DecodePayload(event, &attachment); err != nil || attachment.ID == "" {
+			return room, fmt.Errorf("%s: invalid payload", event.Type)
+		}
+		room.Attachments = append(room.Attachments, &attachment)
+
+	case domain.EventAttachmentRemoved:
+		var payload domain.AttachmentRemovedPayload
+		if err := domain.DecodePayload(event, &payload); err != nil {
+			return room, fmt.Errorf("%s: invalid payload", event.Type)
+		}
+		RemoveAttachment(room, payload.AttachmentID)
+
+	case domain.EventRoomUpdated:
+		var payload domain.RoomUpdatedPayload
+		if err := domain.DecodePayload(event, &payload); err != nil {
+			return room, fmt.Errorf("%s: invalid payload", event.Type)
+		}
+		room.ReadOnly = payload.ReadOnly
+
+	default:
+		// Чат и прочие события не меняют состояние комнаты
+		return room, nil
+	}
+
+	room.UpdatedAt = time.UnixMilli(event.Timestamp)
+	return room, nil
+}
+
+func replaceThread(room *domain.Room, thread *domain.CommentThread) {
+	for i, existing := range room.Comments {
+		if existing.ID == thread.ID {
+			room.Comments[i] = thread
+			return
+		}
+	}
+	room.Comments = append(room.Comments, thread)
+}
@@ -0,0 +1,146 @@
+package collaboration
+
+import (
+	"encoding/json"
+	"testing"
+
+	"table_collab/internal/domain"
+)
+
+// logged возвращает событие в том виде, в каком его читают из журнала:
+// после JSON payload становится map.
+func logged(t *testing.T, eventType domain.EventType, version int, payload interface{}) domain.Event {
+	t.Helper()
+
+	data, err := json.Marshal(domain.Event{Type: eventType, RoomID: "r", Version: version, Payload: payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event domain.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestReplay(t *testing.T) {
+	s := NewService()
+	events := []domain.Event{
+		logged(t, domain.EventRoomCreated, 0, domain.RoomCreatedPayload{Room: &domain.Room{ID: "r", Type: domain.RoomTypeTable}}),
+		logged(t, domain.EventTextUpdate, 1, domain.TextUpdatePayload{Text: "hello world"}),
+		logged(t, domain.EventCommentThread, 0, domain.CommentThread{ID: "t1", Anchor: domain.CommentAnchor{Start: 6, End: 11}}),
+		logged(t, domain.EventTextUpdate, 2, domain.TextUpdatePayload{Text: "oh, hello world"}),
+		logged(t, domain.EventCellUpdate, 3, domain.CellUpdatePayload{Cell: "b2", Value: "42"}),
+		logged(t, domain.EventChatMessage, 0, map[string]string{"text": "hi"}),
+		logged(t, domain.EventCommentThread, 0, domain.CommentThread{ID: "t1", Anchor: domain.CommentAnchor{Start: 10, End: 15}, Resolved: true}),
+		logged(t, domain.EventAttachmentAdded, 0, domain.Attachment{ID: "a1", Name: "logo.png"}),
+		logged(t, domain.EventAttachmentAdded, 0, domain.Attachment{ID: "a2", Name: "notes.txt"}),
+		logged(t, domain.EventAttachmentRemoved, 0, domain.AttachmentRemovedPayload{AttachmentID: "a1"}),
+		logged(t, domain.EventRoomUpdated, 0, domain.RoomUpdatedPayload{ReadOnly: true}),
+	}
+
+	var room *domain.Room
+	for i, event := range events {
+		var err error
+		if room, err = s.Replay(room, event); err != nil {
+			t.Fatalf("event %d (%s): %v", i, event.Type, err)
+		}
+	}
+
+	if room.Content != "oh, hello world" || room.Version != 3 || !room.ReadOnly {
+		t.Fatalf("room = %+v", room)
+	}
+	if cells := room.Sheets[0].Cells; cells["B2"] != "42" {
+		t.Fatalf("cells = %v", cells)
+	}
+	if len(room.Comments) != 1 || !room.Comments[0].Resolved || room.Comments[0].Anchor.Start != 10 {
+		t.Fatalf("comments = %+v", room.Comments)
+	}
+	if len(room.Attachments) != 1 || room.Attachments[0].ID != "a2" {
+		t.Fatalf("attachments = %+v", room.Attachments)
+	}
+
+	closed, err := s.Replay(room, logged(t, domain.EventRoomClosed, 0, domain.RoomClosedPayload{}))
+	if err != nil || closed != nil {
+		t.Fatalf("room_closed: %v, %v", closed, err)
+	}
+}
+
+func TestReplayShiftsAnchors(t *testing.T) {
+	s := NewService()
+	room := &domain.Room{ID: "r", Content: "hello world"}
+	room.Comments = []*domain.CommentThread{{ID: "t1", Anchor: domain.CommentAnchor{Start: 6, End: 11}}}
+
+	room, err := s.Replay(room, logged(t, domain.EventTextUpdate, 1, domain.TextUpdatePayload{Text: "oh, hello world"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anchor := room.Comments[0].Anchor; anchor.Start != 10 || anchor.End != 15 {
+		t.Fatalf("anchor = %+v", anchor)
+	}
+}
+
+func TestReplayRejects(t *testing.T) {
+	s := NewService()
+	if _, err := s.Replay(nil, logged(t, domain.EventTextUpdate, 1, domain.TextUpdatePayload{Text: "x"})); err == nil {
+		t.Fatal("edit before room_created must fail")
+	}
+	if _, err := s.Replay(&domain.Room{}, logged(t, domain.EventCellUpdate, 1, map[string]string{})); err == nil {
+		t.Fatal("cell_update without a cell must fail")
+	}
+}
+
+func TestReplaySheets(t *testing.T) {
+	s := NewService()
+	events := []domain.Event{
+		logged(t, domain.EventRoomCreated, 0, domain.RoomCreatedPayload{Room: &domain.Room{
+			ID: "r", Type: domain.RoomTypeTable,
+			TableData: map[string]interface{}{"cells": map[string]interface{}{"A1": "5"}},
+		}}),
+		logged(t, domain.EventSheetAdd, 1, domain.SheetAddPayload{SheetID: "s2", Name: "Totals"}),
+		logged(t, domain.EventCellUpdate, 2, domain.CellUpdatePayload{SheetID: "s2", Cell: "A1", Value: "=Sheet1!A1*2"}),
+		logged(t, domain.EventSheetRename, 3, domain.SheetRenamePayload{SheetID: DefaultSheetID, Name: "Input data"}),
+		logged(t, domain.EventSheetMove, 4, domain.SheetMovePayload{SheetID: "s2", Index: 0}),
+	}
+
+	var room *domain.Room
+	for i, event := range events {
+		var err error
+		if room, err = s.Replay(room, event); err != nil {
+			t.Fatalf("event %d (%s): %v", i, event.Type, err)
+		}
+	}
+
+	if len(room.Sheets) != 2 || room.Sheets[0].ID != "s2" || room.Sheets[1].Name != "Input data" || room.Version != 4 {
+		t.Fatalf("sheets = %+v, version %d", room.Sheets, room.Version)
+	}
+	totals := room.Sheets[0]
+	if totals.Cells["A1"] != "='Input data'!A1*2" || totals.Values["A1"] != "10" {
+		t.Fatalf("totals = %+v", totals)
+	}
+}
+
+func TestReplayViews(t *testing.T) {
+	s := NewService()
+	events := []domain.Event{
+		logged(t, domain.EventRoomCreated, 0, domain.RoomCreatedPayload{Room: &domain.Room{ID: "r", Type: domain.RoomTypeTable}}),
+		logged(t, domain.EventCellUpdate, 1, domain.CellUpdatePayload{Cell: "A1", Value: "2"}),
+		logged(t, domain.EventViewUpdated, 0, domain.View{ID: "v1", Name: "Desc", SheetID: DefaultSheetID, Sort: []domain.SortKey{{Column: "A", Desc: true}}, Rows: []int{1}}),
+		logged(t, domain.EventViewUpdated, 0, domain.View{ID: "v2", Name: "Gone", SheetID: DefaultSheetID, Rows: []int{1}}),
+		logged(t, domain.EventCellUpdate, 2, domain.CellUpdatePayload{Cell: "A2", Value: "5"}),
+		logged(t, domain.EventViewDelete, 0, domain.ViewDeletePayload{ViewID: "v2"}),
+	}
+
+	var room *domain.Room
+	for i, event := range events {
+		var err error
+		if room, err = s.Replay(room, event); err != nil {
+			t.Fatalf("event %d (%s): %v", i, event.Type, err)
+		}
+	}
+
+	// Строки представления пересчитываются при воспроизведении правок
+	if len(room.Views) != 1 || room.Views[0].ID != "v1" || len(room.Views[0].Rows) != 2 || room.Views[0].Rows[0] != 2 {
+		t.Fatalf("views = %+v", room.Views)
+	}
+}
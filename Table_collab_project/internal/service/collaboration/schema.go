@@ -0,0 +1,536 @@
+package collaboration
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"table_collab/internal/domain"
+)
+
+// Названия правил столбца; попадают в NackPayload.Rule
+const (
+	RuleType     = "type"
+	RuleRequired = "required"
+	RuleMin      = "min"
+	RuleMax      = "max"
+	RulePattern  = "pattern"
+	RuleAllowed  = "allowed"
+)
+
+const (
+	dateLayout       = "2006-01-02"
+	maxPatternLength = 500
+	maxAllowedValues = 500
+	maxOptionLength  = 200
+)
+
+var ErrValidation = errors.New("cell value violates column rules")
+
+// RuleError — значение ячейки нарушает правило своего столбца.
+type RuleError struct {
+	Cell   string
+	Rule   string
+	Reason string
+}
+
+func (e *RuleError) Error() string {
+	if e.Cell == "" {
+		return fmt.Sprintf("rule %s: %s", e.Rule, e.Reason)
+	}
+	return fmt.Sprintf("%s: rule %s: %s", e.Cell, e.Rule, e.Reason)
+}
+
+func (e *RuleError) Unwrap() error { return ErrValidation }
+
+// CheckCellUpdate проверяет значение ячейки по схеме её столбца и возвращает
+// payload с каноничным адресом и нормализованным значением (число в
+// каноничной записи, флажок как true/false). users ищет участника комнаты по
+// имени без учёта регистра; nil отключает проверку столбцов типа user.
+func (s *Service) CheckCellUpdate(room *domain.Room, update domain.Event, users func(string) (string, bool)) (domain.CellUpdatePayload, error) {
+	var payload domain.CellUpdatePayload
+	if err := domain.DecodePayload(update, &payload); err != nil || payload.Cell == "" {
+		return payload, ErrMissingCell
+	}
+	col, row, err := ParseCell(payload.Cell)
+	if err != nil {
+		return payload, err
+	}
+
+	EnsureSheets(room)
+	sheet, _, err := FindSheet(room, payload.SheetID)
+	if err != nil {
+		return payload, err
+	}
+
+	payload.SheetID = sheet.ID
+	payload.Cell = CellName(col, row)
+	column, ok := sheet.Columns[columnOf(payload.Cell)]
+
+	// Обязательное значение нельзя стереть, пока в строке есть другие данные;
+	// очистить строку целиком можно
+	if payload.Value == "" {
+		if column.Rules.Required && rowHasData(sheet, payload.Cell, row) {
+			return payload, &RuleError{Cell: payload.Cell, Rule: RuleRequired, Reason: "value is required"}
+		}
+		return payload, nil
+	}
+
+	// Новая строка начинается с обязательных столбцов: остальные ячейки можно
+	// заполнять, когда они уже есть
+	if !column.Rules.Required {
+		if missing := missingRequired(sheet, row); missing != "" {
+			return payload, &RuleError{Cell: missing, Rule: RuleRequired, Reason: "value is required before other cells of the row"}
+		}
+	}
+	if !ok {
+		return payload, nil
+	}
+
+	value, err := checkValue(column, payload.Value, users)
+	if err != nil {
+		err.(*RuleError).Cell = payload.Cell
+		return payload, err
+	}
+	payload.Value = value
+	return payload, nil
+}
+
+// checkSchema проверяет тип и правила столбца и приводит их к каноничному
+// виду, а затем сверяет с ними уже заполненные ячейки столбца.
+func checkSchema(sheet *domain.Sheet, column string, settings *domain.Column) error {
+	if settings.Type == domain.ColumnText {
+		settings.Type = ""
+	}
+	switch settings.Type {
+	case "", domain.ColumnNumber, domain.ColumnDate, domain.ColumnCheckbox,
+		domain.ColumnSingleSelect, domain.ColumnMultiSelect, domain.ColumnUser:
+	default:
+		return fmt.Errorf("%w: unknown column type %q", ErrInvalidColumn, settings.Type)
+	}
+
+	rules := &settings.Rules
+	if err := checkAllowed(settings.Type, rules); err != nil {
+		return err
+	}
+	if err := checkBounds(settings.Type, rules); err != nil {
+		return err
+	}
+	if rules.Pattern != "" {
+		switch settings.Type {
+		case domain.ColumnCheckbox, domain.ColumnSingleSelect, domain.ColumnMultiSelect, domain.ColumnUser:
+			return fmt.Errorf("%w: pattern is not supported for %s columns", ErrInvalidColumn, settings.Type)
+		}
+		if len(rules.Pattern) > maxPatternLength {
+			return fmt.Errorf("%w: pattern is longer than %d characters", ErrInvalidColumn, maxPatternLength)
+		}
+		if _, err := patterns.compile(rules.Pattern); err != nil {
+			return fmt.Errorf("%w: pattern: %v", ErrInvalidColumn, err)
+		}
+	}
+
+	// Обязательный столбец должен быть заполнен во всех строках с данными
+	if settings.Rules.Required {
+		rows := make(map[int]bool)
+		for cell := range sheet.Cells {
+			if _, row, err := ParseCell(cell); err == nil {
+				rows[row] = true
+			}
+		}
+		for _, row := range sortedRows(rows) {
+			if cell := column + strconv.Itoa(row); sheet.Cells[cell] == "" {
+				return &RuleError{Cell: cell, Rule: RuleRequired, Reason: "value is required"}
+			}
+		}
+	}
+
+	// Участников при смене схемы не проверяем: ссылки на ушедших участников
+	// остаются допустимыми
+	for _, cell := range cellsIn(sheet, columnRange(column)) {
+		_, err := checkValue(*settings, sheet.Cells[cell], nil)
+		if err == nil && strings.HasPrefix(sheet.Cells[cell], "=") {
+			err = checkComputed(*settings, sheet.Values[cell])
+		}
+		if err != nil {
+			err.(*RuleError).Cell = cell
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckComputed сверяет пересчитанные значения формул (результат Recalculate)
+// с правилами их столбцов: формула в числовом столбце с max не должна давать
+// больше max.
+func CheckComputed(room *domain.Room, computed map[string]map[string]string) error {
+	for sheetID, values := range computed {
+		sheet, _, err := FindSheet(room, sheetID)
+		if err != nil {
+			continue
+		}
+		for cell, v := range values {
+			column, ok := sheet.Columns[columnOf(cell)]
+			if !ok {
+				continue
+			}
+			if err := checkComputed(column, v); err != nil {
+				err.(*RuleError).Cell = cell
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkComputed проверяет результат формулы. Коды ошибок вроде #DIV/0!
+// допустимы: формула показывает их, пока не заполнены исходные данные.
+func checkComputed(column domain.Column, v string) error {
+	if v == "" || strings.HasPrefix(v, "#") {
+		return nil
+	}
+	_, err := checkValue(column, v, nil)
+	return err
+}
+
+func checkAllowed(columnType domain.ColumnType, rules *domain.ColumnRules) error {
+	switch columnType {
+	case domain.ColumnCheckbox, domain.ColumnUser:
+		if len(rules.Allowed) > 0 {
+			return fmt.Errorf("%w: allowed values are not supported for %s columns", ErrInvalidColumn, columnType)
+		}
+		return nil
+	case domain.ColumnSingleSelect, domain.ColumnMultiSelect:
+		if len(rules.Allowed) == 0 {
+			return fmt.Errorf("%w: %s columns require a list of allowed values", ErrInvalidColumn, columnType)
+		}
+	}
+	if len(rules.Allowed) > maxAllowedValues {
+		return fmt.Errorf("%w: at most %d allowed values", ErrInvalidColumn, maxAllowedValues)
+	}
+
+	seen := make(map[string]bool, len(rules.Allowed))
+	allowed := make([]string, 0, len(rules.Allowed))
+	for _, option := range rules.Allowed {
+		option = strings.TrimSpace(option)
+		switch {
+		case option == "":
+			return fmt.Errorf("%w: allowed values must not be empty", ErrInvalidColumn)
+		case utf8.RuneCountInString(option) > maxOptionLength:
+			return fmt.Errorf("%w: allowed value is longer than %d characters", ErrInvalidColumn, maxOptionLength)
+		case columnType == domain.ColumnMultiSelect && strings.Contains(option, ","):
+			return fmt.Errorf("%w: multi_select options must not contain commas", ErrInvalidColumn)
+		}
+
+		// Числа и даты в списке тоже приводятся к каноничной записи
+		switch columnType {
+		case domain.ColumnNumber:
+			num, ok := parseNumber(option)
+			if !ok {
+				return fmt.Errorf("%w: allowed value %q is not a number", ErrInvalidColumn, option)
+			}
+			option = formatNumber(num)
+		case domain.ColumnDate:
+			date, ok := parseDate(option)
+			if !ok {
+				return fmt.Errorf("%w: allowed value %q is not a date", ErrInvalidColumn, option)
+			}
+			option = date
+		}
+
+		key := strings.ToLower(option)
+		if seen[key] {
+			return fmt.Errorf("%w: duplicate allowed value %q", ErrInvalidColumn, option)
+		}
+		seen[key] = true
+		allowed = append(allowed, option)
+	}
+	if len(allowed) == 0 {
+		allowed = nil
+	}
+	rules.Allowed = allowed
+	return nil
+}
+
+// checkBounds проверяет Min и Max: числа для number, даты для date, длину
+// текста для text и число вариантов для multi_select.
+func checkBounds(columnType domain.ColumnType, rules *domain.ColumnRules) error {
+	rules.Min, rules.Max = strings.TrimSpace(rules.Min), strings.TrimSpace(rules.Max)
+	if rules.Min == "" && rules.Max == "" {
+		return nil
+	}
+
+	var parse func(string) (string, float64, bool)
+	switch columnType {
+	case domain.ColumnNumber:
+		parse = func(s string) (string, float64, bool) {
+			num, ok := parseNumber(s)
+			return formatNumber(num), num, ok
+		}
+	case domain.ColumnDate:
+		parse = func(s string) (string, float64, bool) {
+			t, err := time.Parse(dateLayout, s)
+			return t.Format(dateLayout), float64(t.Unix()), err == nil
+		}
+	case "", domain.ColumnMultiSelect:
+		parse = func(s string) (string, float64, bool) {
+			n, err := strconv.Atoi(s)
+			return strconv.Itoa(n), float64(n), err == nil && n >= 0
+		}
+	default:
+		return fmt.Errorf("%w: min and max are not supported for %s columns", ErrInvalidColumn, columnType)
+	}
+
+	var low, high float64
+	var ok bool
+	if rules.Min != "" {
+		if rules.Min, low, ok = parse(rules.Min); !ok {
+			return fmt.Errorf("%w: invalid min", ErrInvalidColumn)
+		}
+	}
+	if rules.Max != "" {
+		if rules.Max, high, ok = parse(rules.Max); !ok {
+			return fmt.Errorf("%w: invalid max", ErrInvalidColumn)
+		}
+	}
+	if rules.Min != "" && rules.Max != "" && low > high {
+		return fmt.Errorf("%w: min is greater than max", ErrInvalidColumn)
+	}
+	return nil
+}
+
+// checkValue проверяет непустое значение по схеме столбца и возвращает его
+// нормализованным. Ячейка в ошибке не заполнена — её добавляет вызывающий.
+func checkValue(column domain.Column, value string, users func(string) (string, bool)) (string, error) {
+	rules := column.Rules
+	violation := func(rule, format string, args ...interface{}) (string, error) {
+		return "", &RuleError{Rule: rule, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	// Формулы допустимы там, где их результат имеет смысл; остальные правила
+	// проверяются по результату после пересчёта, см. CheckComputed
+	if strings.HasPrefix(value, "=") {
+		if column.Type != "" && column.Type != domain.ColumnNumber {
+			return violation(RuleType, "formulas are not allowed in %s columns", column.Type)
+		}
+		return value, nil
+	}
+
+	switch column.Type {
+	case "":
+		length := utf8.RuneCountInString(value)
+		if min, _ := strconv.Atoi(rules.Min); rules.Min != "" && length < min {
+			return violation(RuleMin, "must be at least %d characters long", min)
+		}
+		if max, _ := strconv.Atoi(rules.Max); rules.Max != "" && length > max {
+			return violation(RuleMax, "must be at most %d characters long", max)
+		}
+
+	case domain.ColumnNumber:
+		num, ok := parseNumber(value)
+		if !ok {
+			return violation(RuleType, "%q is not a number", value)
+		}
+		value = formatNumber(num)
+		if min, _ := parseNumber(rules.Min); rules.Min != "" && num < min {
+			return violation(RuleMin, "must be at least %s", rules.Min)
+		}
+		if max, _ := parseNumber(rules.Max); rules.Max != "" && num > max {
+			return violation(RuleMax, "must be at most %s", rules.Max)
+		}
+
+	case domain.ColumnDate:
+		date, ok := parseDate(value)
+		if !ok {
+			return violation(RuleType, "%q is not a date in YYYY-MM-DD format", value)
+		}
+		value = date
+		// Даты в каноничной записи сравниваются как строки
+		if rules.Min != "" && value < rules.Min {
+			return violation(RuleMin, "must not be earlier than %s", rules.Min)
+		}
+		if rules.Max != "" && value > rules.Max {
+			return violation(RuleMax, "must not be later than %s", rules.Max)
+		}
+
+	case domain.ColumnCheckbox:
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "true", "yes", "1", "x":
+			return "true", nil
+		case "false", "no", "0":
+			return "false", nil
+		}
+		return violation(RuleType, "%q is not a checkbox value", value)
+
+	case domain.ColumnSingleSelect:
+		option, ok := findOption(rules.Allowed, value)
+		if !ok {
+			return violation(RuleAllowed, "%q is not one of the options", value)
+		}
+		return option, nil
+
+	case domain.ColumnMultiSelect:
+		var selected []string
+		seen := make(map[string]bool)
+		for _, part := range strings.Split(value, ",") {
+			if strings.TrimSpace(part) == "" {
+				continue
+			}
+			option, ok := findOption(rules.Allowed, part)
+			if !ok {
+				return violation(RuleAllowed, "%q is not one of the options", strings.TrimSpace(part))
+			}
+			if !seen[option] {
+				seen[option] = true
+				selected = append(selected, option)
+			}
+		}
+		if min, _ := strconv.Atoi(rules.Min); rules.Min != "" && len(selected) < min {
+			return violation(RuleMin, "select at least %d options", min)
+		}
+		if max, _ := strconv.Atoi(rules.Max); rules.Max != "" && len(selected) > max {
+			return violation(RuleMax, "select at most %d options", max)
+		}
+		return strings.Join(selected, ", "), nil
+
+	case domain.ColumnUser:
+		value = strings.TrimSpace(value)
+		if users == nil {
+			return value, nil
+		}
+		username, ok := users(value)
+		if !ok {
+			return violation(RuleType, "%q is not a participant of the room", value)
+		}
+		return username, nil
+	}
+
+	if len(rules.Allowed) > 0 {
+		if _, ok := findOption(rules.Allowed, value); !ok {
+			return violation(RuleAllowed, "%q is not one of the allowed values", value)
+		}
+	}
+	if rules.Pattern != "" {
+		if re, err := patterns.compile(rules.Pattern); err == nil && !re.MatchString(value) {
+			return violation(RulePattern, "%q does not match %s", value, rules.Pattern)
+		}
+	}
+	return value, nil
+}
+
+// findOption ищет вариант без учёта регистра и пробелов по краям и
+// возвращает его в записи из схемы.
+func findOption(options []string, value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	for _, option := range options {
+		if strings.EqualFold(option, value) {
+			return option, true
+		}
+	}
+	return "", false
+}
+
+func parseNumber(s string) (float64, bool) {
+	num, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return num, err == nil && !math.IsNaN(num) && !math.IsInf(num, 0)
+}
+
+func parseDate(s string) (string, bool) {
+	t, err := time.Parse(dateLayout, strings.TrimSpace(s))
+	return t.Format(dateLayout), err == nil
+}
+
+// compilePattern привязывает шаблон к началу и концу: он описывает значение
+// целиком.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
+
+// maxCachedPatterns ограничивает кеш: шаблоны задают клиенты, и без предела
+// смена схем могла бы копить их без конца.
+const maxCachedPatterns = 1000
+
+// patternCache хранит скомпилированные шаблоны столбцов, чтобы правка ячейки
+// не компилировала шаблон заново.
+type patternCache struct {
+	mu       sync.Mutex
+	compiled map[string]*regexp.Regexp
+}
+
+var patterns = &patternCache{compiled: make(map[string]*regexp.Regexp)}
+
+func (c *patternCache) compile(pattern string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if re, ok := c.compiled[pattern]; ok {
+		return re, nil
+	}
+	re, err := compilePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.compiled) >= maxCachedPatterns {
+		clear(c.compiled)
+	}
+	c.compiled[pattern] = re
+	return re, nil
+}
+
+// columnOf возвращает букву столбца каноничного адреса ячейки.
+func columnOf(cell string) string {
+	return strings.TrimRight(cell, "0123456789")
+}
+
+func columnRange(column string) CellRange {
+	col, _, _ := ParseCell(column + "1")
+	return CellRange{FromCol: col, FromRow: 1, ToCol: col, ToRow: math.MaxInt32}
+}
+
+// missingRequired возвращает первую пустую ячейку обязательного столбца в
+// строке row или "", если все они заполнены.
+func missingRequired(sheet *domain.Sheet, row int) string {
+	var missing []string
+	for column, settings := range sheet.Columns {
+		if cell := column + strconv.Itoa(row); settings.Rules.Required && sheet.Cells[cell] == "" {
+			missing = append(missing, cell)
+		}
+	}
+	if len(missing) == 0 {
+		return ""
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		ci, _, _ := ParseCell(missing[i])
+		cj, _, _ := ParseCell(missing[j])
+		return ci < cj
+	})
+	return missing[0]
+}
+
+func sortedRows(rows map[int]bool) []int {
+	sorted := make([]int, 0, len(rows))
+	for row := range rows {
+		sorted = append(sorted, row)
+	}
+	sort.Ints(sorted)
+	return sorted
+}
+
+// rowHasData сообщает, есть ли в строке заполненные ячейки, кроме cell.
+func rowHasData(sheet *domain.Sheet, cell string, row int) bool {
+	for other := range sheet.Cells {
+		if other == cell {
+			continue
+		}
+		if _, r, err := ParseCell(other); err == nil && r == row {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package collaboration
+
+import (
+	"errors"
+	"testing"
+
+	"table_collab/internal/domain"
+)
+
+func schemaRoom(t *testing.T, columns map[string]domain.Column) *domain.Room {
+	t.Helper()
+	s := NewService()
+	room := &domain.Room{Type: domain.RoomTypeTable}
+	for column, settings := range columns {
+		event := domain.Event{Type: domain.EventColumnUpdate, Payload: domain.ColumnUpdatePayload{Column: column, Settings: settings}}
+		if _, err := s.ApplySheetEdit(room, event); err != nil {
+			t.Fatalf("column %s: %v", column, err)
+		}
+	}
+	return room
+}
+
+func TestCheckCellUpdate(t *testing.T) {
+	room := schemaRoom(t, map[string]domain.Column{
+		"A": {Rules: domain.ColumnRules{Min: "2", Max: "5", Pattern: `[a-z]+`}},
+		"B": {Type: domain.ColumnNumber, Rules: domain.ColumnRules{Min: "0", Max: "100"}},
+		"C": {Type: domain.ColumnDate, Rules: domain.ColumnRules{Min: "2024-01-01"}},
+		"D": {Type: domain.ColumnCheckbox},
+		"E": {Type: domain.ColumnSingleSelect, Rules: domain.ColumnRules{Allowed: []string{"Open", "Done"}}},
+		"F": {Type: domain.ColumnMultiSelect, Rules: domain.ColumnRules{Allowed: []string{"ui", "api"}, Max: "1"}},
+		"G": {Type: domain.ColumnUser},
+		"H": {Type: domain.ColumnNumber, Rules: domain.ColumnRules{Allowed: []string{"1.50", "3"}}},
+	})
+	users := func(name string) (string, bool) { return "alice", name == "ALICE" || name == "alice" }
+
+	tests := []struct {
+		cell, value string
+		want        string // нормализованное значение или нарушенное правило
+		rule        bool
+	}{
+		{"A1", "abc", "abc", false},
+		{"A1", "a", RuleMin, true},
+		{"A1", "abcdef", RuleMax, true},
+		{"A1", "ABC", RulePattern, true},
+		{"B1", " 012.50 ", "12.5", false},
+		{"B1", "=A1*2", "=A1*2", false},
+		{"B1", "ten", RuleType, true},
+		{"B1", "-1", RuleMin, true},
+		{"B1", "1e3", RuleMax, true},
+		{"C1", "2024-02-29", "2024-02-29", false},
+		{"C1", "2023-12-31", RuleMin, true},
+		{"C1", "29.02.2024", RuleType, true},
+		{"C1", "=TODAY()", RuleType, true},
+		{"D1", "Yes", "true", false},
+		{"D1", "0", "false", false},
+		{"D1", "maybe", RuleType, true},
+		{"E1", "done", "Done", false},
+		{"E1", "Later", RuleAllowed, true},
+		{"F1", " API ", "api", false},
+		{"F1", "api, API", "api", false},
+		{"F1", "api, ui", RuleMax, true},
+		{"F1", "web", RuleAllowed, true},
+		{"G1", "ALICE", "alice", false},
+		{"G1", "mallory", RuleType, true},
+		{"H1", "1.5", "1.5", false},
+		{"H1", "2", RuleAllowed, true},
+		{"Z1", "anything", "anything", false},
+	}
+
+	s := NewService()
+	for _, tt := range tests {
+		event := domain.Event{Payload: domain.CellUpdatePayload{Cell: tt.cell, Value: tt.value}}
+		payload, err := s.CheckCellUpdate(room, event, users)
+
+		var violation *RuleError
+		switch {
+		case tt.rule && (!errors.As(err, &violation) || violation.Rule != tt.want || violation.Cell != tt.cell):
+			t.Errorf("%s = %q: err = %v, want rule %s", tt.cell, tt.value, err, tt.want)
+		case !tt.rule && (err != nil || payload.Value != tt.want):
+			t.Errorf("%s = %q: got %q, %v, want %q", tt.cell, tt.value, payload.Value, err, tt.want)
+		}
+	}
+}
+
+func TestCheckCellUpdateRequired(t *testing.T) {
+	s := NewService()
+	room := schemaRoom(t, map[string]domain.Column{"A": {Rules: domain.ColumnRules{Required: true}}})
+	room.Sheets[0].Cells = map[string]string{"A1": "task", "B1": "note", "A2": "alone"}
+
+	clear := func(cell string) error {
+		_, err := s.CheckCellUpdate(room, domain.Event{Payload: domain.CellUpdatePayload{Cell: cell}}, nil)
+		return err
+	}
+	var violation *RuleError
+	if err := clear("a1"); !errors.As(err, &violation) || violation.Rule != RuleRequired || violation.Cell != "A1" {
+		t.Fatalf("clearing A1 with data in the row: %v", err)
+	}
+	if err := clear("A2"); err != nil {
+		t.Fatalf("clearing the whole row: %v", err)
+	}
+
+	// Новую строку без обязательного столбца не начать
+	set := func(cell, value string) error {
+		_, err := s.CheckCellUpdate(room, domain.Event{Payload: domain.CellUpdatePayload{Cell: cell, Value: value}}, nil)
+		return err
+	}
+	if err := set("B3", "note"); !errors.As(err, &violation) || violation.Rule != RuleRequired || violation.Cell != "A3" {
+		t.Fatalf("new row without the required column: %v", err)
+	}
+	if err := set("A3", "task"); err != nil {
+		t.Fatalf("required cell of a new row: %v", err)
+	}
+	room.Sheets[0].Cells["A3"] = "task"
+	if err := set("B3", "note"); err != nil {
+		t.Fatalf("row with the required column: %v", err)
+	}
+
+	// Столбец нельзя сделать обязательным, пока в строке с данными он пуст
+	event := domain.Event{Type: domain.EventColumnUpdate, Payload: domain.ColumnUpdatePayload{
+		Column: "B", Settings: domain.Column{Rules: domain.ColumnRules{Required: true}},
+	}}
+	if _, err := s.ApplySheetEdit(room, event); !errors.As(err, &violation) || violation.Rule != RuleRequired || violation.Cell != "B2" {
+		t.Fatalf("required column with empty cells: %v", err)
+	}
+}
+
+func TestPatternCache(t *testing.T) {
+	first, err := patterns.compile(`[a-z]+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := patterns.compile(`[a-z]+`); again != first {
+		t.Fatal("pattern compiled again")
+	}
+	if _, err := patterns.compile(`(`); err == nil {
+		t.Fatal("invalid pattern compiled")
+	}
+}
+
+func TestColumnSchemaRejects(t *testing.T) {
+	s := NewService()
+	room := &domain.Room{Type: domain.RoomTypeTable}
+	EnsureSheets(room)
+	room.Sheets[0].Cells = map[string]string{"B2": "12", "B3": "n/a"}
+
+	tests := []domain.Column{
+		{Type: "money"},
+		{Type: domain.ColumnSingleSelect},
+		{Type: domain.ColumnMultiSelect, Rules: domain.ColumnRules{Allowed: []string{"a,b"}}},
+		{Type: domain.ColumnSingleSelect, Rules: domain.ColumnRules{Allowed: []string{"x", "X"}}},
+		{Type: domain.ColumnCheckbox, Rules: domain.ColumnRules{Allowed: []string{"true"}}},
+		{Type: domain.ColumnCheckbox, Rules: domain.ColumnRules{Min: "1"}},
+		{Type: domain.ColumnUser, Rules: domain.ColumnRules{Pattern: "a"}},
+		{Rules: domain.ColumnRules{Min: "5", Max: "2"}},
+		{Rules: domain.ColumnRules{Min: "-1"}},
+		{Type: domain.ColumnDate, Rules: domain.ColumnRules{Max: "tomorrow"}},
+		{Rules: domain.ColumnRules{Pattern: "(unclosed"}},
+	}
+	for _, settings := range tests {
+		event := domain.Event{Type: domain.EventColumnUpdate, Payload: domain.ColumnUpdatePayload{Column: "C", Settings: settings}}
+		if _, err := s.ApplySheetEdit(room, event); !errors.Is(err, ErrInvalidColumn) {
+			t.Errorf("%+v: err = %v, want ErrInvalidColumn", settings, err)
+		}
+	}
+
+	// Схема, которой не соответствуют уже заполненные ячейки, не принимается
+	event := domain.Event{Type: domain.EventColumnUpdate, Payload: domain.ColumnUpdatePayload{
+		Column: "B", Settings: domain.Column{Type: domain.ColumnNumber},
+	}}
+	var violation *RuleError
+	if _, err := s.ApplySheetEdit(room, event); !errors.As(err, &violation) || violation.Cell != "B3" || violation.Rule != RuleType {
+		t.Fatalf("existing cells: %v", err)
+	}
+	if _, ok := room.Sheets[0].Columns["B"]; ok {
+		t.Fatal("rejected schema was stored")
+	}
+
+	delete(room.Sheets[0].Cells, "B3")
+	result, err := s.ApplySheetEdit(room, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings := result.(domain.ColumnUpdatePayload).Settings; settings.Type != domain.ColumnNumber {
+		t.Fatalf("settings = %+v", settings)
+	}
+}
@@ -1,6 +1,8 @@
 package collaboration
 
-import "table_collab/internal/domain"
+import (
+	"table_collab/internal/domain"
+)
 
 type Service struct{}
 
@@ -17,11 +19,21 @@ func (s *Service) ApplyTextUpdate(currentText string, update domain.Event) (stri
 	return currentText, 0
 }
 
+// ValidateEvent сообщает, может ли клиент прислать событие такого типа. Это
+// единственный список допустимых типов: по нему Client.handleEvent решает,
+// передавать ли событие в hub. Выход клиент не присылает — его порождает
+// закрытие соединения.
 func (s *Service) ValidateEvent(event domain.Event) bool {
 	switch event.Type {
-	case domain.EventJoinRoom, domain.EventLeaveRoom,
-		domain.EventCursorMove, domain.EventTextUpdate,
-		domain.EventChatMessage:
+	case domain.EventJoinRoom,
+		domain.EventCursorMove, domain.EventTextUpdate, domain.EventElementAdd,
+		domain.EventCellUpdate, domain.EventChatMessage,
+		domain.EventCommentAdd, domain.EventCommentReply, domain.EventCommentResolve,
+		domain.EventLockAcquire, domain.EventLockRelease,
+		domain.EventSheetAdd, domain.EventSheetRename, domain.EventSheetMove,
+		domain.EventSheetDuplicate, domain.EventSheetDelete,
+		domain.EventColumnUpdate, domain.EventSheetView,
+		domain.EventViewSave, domain.EventViewDelete:
 		return true
 	default:
 		return false
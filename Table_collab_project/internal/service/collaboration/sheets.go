@@ -0,0 +1,472 @@
+package collaboration
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"table_collab/internal/domain"
+	"table_collab/pkg/utils"
+)
+
+const (
+	DefaultSheetID   = "sheet1"
+	DefaultSheetName = "Sheet1"
+	MaxSheets        = 50
+
+	maxSheetNameLength   = 100
+	maxColumnTitleLength = 200
+	maxColumnWidth       = 2000
+)
+
+var (
+	ErrSheetNotFound  = errors.New("sheet not found")
+	ErrInvalidSheet   = errors.New("invalid sheet")
+	ErrSheetNameTaken = errors.New("sheet name is already taken")
+	ErrLastSheet      = errors.New("cannot delete the last sheet")
+	ErrTooManySheets  = errors.New("too many sheets")
+	ErrInvalidColumn  = errors.New("invalid column")
+	ErrNotTableRoom   = errors.New("sheets exist only in table rooms")
+	ErrMissingCell    = errors.New("cell_update requires a cell address")
+)
+
+var sheetIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Символы, которые ломают ссылки вида 'Имя'!A1 в формулах
+const forbiddenSheetNameChars = `'!:[]*?/\`
+
+// IsSheetEdit сообщает, меняет ли событие структуру листов или настройки столбцов.
+func IsSheetEdit(eventType domain.EventType) bool {
+	switch eventType {
+	case domain.EventSheetAdd, domain.EventSheetRename, domain.EventSheetMove,
+		domain.EventSheetDuplicate, domain.EventSheetDelete, domain.EventColumnUpdate:
+		return true
+	default:
+		return false
+	}
+}
+
+// EnsureSheets создаёт первый лист табличной комнаты, перенося в него ячейки
+// из TableData["cells"] (формат до появления листов).
+func EnsureSheets(room *domain.Room) {
+	if room.Type != domain.RoomTypeTable || len(room.Sheets) > 0 {
+		return
+	}
+
+	sheet := &domain.Sheet{ID: DefaultSheetID, Name: DefaultSheetName}
+	if cells, ok := room.TableData["cells"].(map[string]interface{}); ok {
+		for cell, value := range cells {
+			text, ok := value.(string)
+			if !ok || text == "" {
+				continue
+			}
+			if col, row, err := ParseCell(cell); err == nil {
+				setCell(sheet, CellName(col, row), text)
+			}
+		}
+		delete(room.TableData, "cells")
+		if len(room.TableData) == 0 {
+			room.TableData = nil
+		}
+	}
+
+	room.Sheets = []*domain.Sheet{sheet}
+	Recalculate(room)
+}
+
+// ValidateSheets проверяет листы, заданные целиком (например, в шаблоне):
+// уникальные ID и названия, допустимые адреса ячеек. Адреса приводятся к
+// каноничному виду.
+func ValidateSheets(sheets []*domain.Sheet) error {
+	if len(sheets) > MaxSheets {
+		return fmt.Errorf("%w: at most %d per room", ErrTooManySheets, MaxSheets)
+	}
+
+	room := &domain.Room{Type: domain.RoomTypeTable}
+	for _, sheet := range sheets {
+		if sheet == nil || sheet.ID == "" {
+			return fmt.Errorf("%w: sheet id is required", ErrInvalidSheet)
+		}
+		id, err := newSheetID(room, sheet.ID)
+		if err != nil {
+			return err
+		}
+		name, err := checkSheetName(room, sheet.Name, nil)
+		if err != nil {
+			return err
+		}
+
+		cells, columns := sheet.Cells, sheet.Columns
+		sheet.ID, sheet.Name = id, name
+		sheet.Cells, sheet.Values, sheet.Columns = nil, nil, nil
+		for cell, value := range cells {
+			col, row, err := ParseCell(cell)
+			if err != nil {
+				return fmt.Errorf("%w: %q", err, cell)
+			}
+			setCell(sheet, CellName(col, row), value)
+		}
+		for column, settings := range columns {
+			payload := domain.ColumnUpdatePayload{Column: column, Settings: settings}
+			if err := updateColumn(sheet, &payload); err != nil {
+				return err
+			}
+		}
+		room.Sheets = append(room.Sheets, sheet)
+	}
+	return nil
+}
+
+// CloneSheets возвращает глубокую копию списка листов.
+func CloneSheets(sheets []*domain.Sheet) []*domain.Sheet {
+	if sheets == nil {
+		return nil
+	}
+	copied := make([]*domain.Sheet, len(sheets))
+	for i, sheet := range sheets {
+		copied[i] = sheet.Clone()
+	}
+	return copied
+}
+
+// MapSheets возвращает копию листов, пропуская названия и введённые значения
+// ячеек через fn. Вычисленные значения не копируются: их пересчитывает
+// Recalculate.
+func MapSheets(sheets []*domain.Sheet, fn func(string) string) []*domain.Sheet {
+	copied := CloneSheets(sheets)
+	for _, sheet := range copied {
+		sheet.Name = fn(sheet.Name)
+		for cell, value := range sheet.Cells {
+			sheet.Cells[cell] = fn(value)
+		}
+		sheet.Values = nil
+	}
+	return copied
+}
+
+// FindSheet ищет лист по ID; пустой ID означает первый лист.
+func FindSheet(room *domain.Room, id string) (*domain.Sheet, int, error) {
+	if len(room.Sheets) == 0 {
+		return nil, -1, ErrSheetNotFound
+	}
+	if id == "" {
+		return room.Sheets[0], 0, nil
+	}
+	for i, sheet := range room.Sheets {
+		if sheet.ID == id {
+			return sheet, i, nil
+		}
+	}
+	return nil, -1, fmt.Errorf("%w: %s", ErrSheetNotFound, id)
+}
+
+// requireSheet — FindSheet для структурных операций: лист нужно указать явно,
+// чтобы устаревший клиент не удалил или не переименовал первый лист по ошибке.
+func requireSheet(room *domain.Room, id string) (*domain.Sheet, int, error) {
+	if id == "" {
+		return nil, -1, fmt.Errorf("%w: sheet_id is required", ErrInvalidSheet)
+	}
+	return FindSheet(room, id)
+}
+
+// sheetByName ищет лист по названию без учёта регистра.
+func sheetByName(room *domain.Room, name string) *domain.Sheet {
+	for _, sheet := range room.Sheets {
+		if strings.EqualFold(sheet.Name, name) {
+			return sheet
+		}
+	}
+	return nil
+}
+
+// ApplyCellUpdate записывает значение ячейки на лист и возвращает payload с
+// явным листом и каноничным адресом — в таком виде правка рассылается.
+func (s *Service) ApplyCellUpdate(room *domain.Room, update domain.Event) (domain.CellUpdatePayload, error) {
+	var payload domain.CellUpdatePayload
+	if err := domain.DecodePayload(update, &payload); err != nil || payload.Cell == "" {
+		return payload, ErrMissingCell
+	}
+	col, row, err := ParseCell(payload.Cell)
+	if err != nil {
+		return payload, err
+	}
+
+	EnsureSheets(room)
+	sheet, _, err := FindSheet(room, payload.SheetID)
+	if err != nil {
+		return payload, err
+	}
+
+	payload.SheetID = sheet.ID
+	payload.Cell = CellName(col, row)
+	setCell(sheet, payload.Cell, payload.Value)
+	return payload, nil
+}
+
+// ApplySheetEdit применяет к комнате добавление, переименование, перестановку,
+// копирование или удаление листа либо изменение настроек столбца. Возвращает
+// payload с заполненными сервером полями для рассылки.
+func (s *Service) ApplySheetEdit(room *domain.Room, event domain.Event) (interface{}, error) {
+	if room.Type != domain.RoomTypeTable {
+		return nil, ErrNotTableRoom
+	}
+	EnsureSheets(room)
+
+	switch event.Type {
+	case domain.EventSheetAdd:
+		var payload domain.SheetAddPayload
+		if err := domain.DecodePayload(event, &payload); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSheet, err)
+		}
+		if err := addSheet(room, &payload); err != nil {
+			return nil, err
+		}
+		return payload, nil
+
+	case domain.EventSheetRename:
+		var payload domain.SheetRenamePayload
+		if err := domain.DecodePayload(event, &payload); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSheet, err)
+		}
+		sheet, _, err := requireSheet(room, payload.SheetID)
+		if err != nil {
+			return nil, err
+		}
+		if payload.Name, err = checkSheetName(room, payload.Name, sheet); err != nil {
+			return nil, err
+		}
+		RenameSheetRefs(room, sheet.Name, payload.Name)
+		sheet.Name = payload.Name
+		payload.SheetID = sheet.ID
+		return payload, nil
+
+	case domain.EventSheetMove:
+		var payload domain.SheetMovePayload
+		if err := domain.DecodePayload(event, &payload); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSheet, err)
+		}
+		sheet, from, err := requireSheet(room, payload.SheetID)
+		if err != nil {
+			return nil, err
+		}
+		if payload.Index < 0 || payload.Index >= len(room.Sheets) {
+			return nil, fmt.Errorf("%w: index %d is out of range", ErrInvalidSheet, payload.Index)
+		}
+		sheets := append(room.Sheets[:from:from], room.Sheets[from+1:]...)
+		room.Sheets = insertSheet(sheets, payload.Index, sheet)
+		payload.SheetID = sheet.ID
+		return payload, nil
+
+	case domain.EventSheetDuplicate:
+		var payload domain.SheetDuplicatePayload
+		if err := domain.DecodePayload(event, &payload); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSheet, err)
+		}
+		if err := duplicateSheet(room, &payload); err != nil {
+			return nil, err
+		}
+		return payload, nil
+
+	case domain.EventSheetDelete:
+		var payload domain.SheetDeletePayload
+		if err := domain.DecodePayload(event, &payload); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSheet, err)
+		}
+		_, i, err := requireSheet(room, payload.SheetID)
+		if err != nil {
+			return nil, err
+		}
+		if len(room.Sheets) == 1 {
+			return nil, ErrLastSheet
+		}
+		room.Sheets = append(room.Sheets[:i:i], room.Sheets[i+1:]...)
+		// Представления удаляются вместе с листом, отдельно о них не сообщается
+		room.Views = dropSheetViews(room.Views, payload.SheetID)
+		return payload, nil
+
+	case domain.EventColumnUpdate:
+		var payload domain.ColumnUpdatePayload
+		if err := domain.DecodePayload(event, &payload); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidColumn, err)
+		}
+		sheet, _, err := FindSheet(room, payload.SheetID)
+		if err != nil {
+			return nil, err
+		}
+		if err := updateColumn(sheet, &payload); err != nil {
+			return nil, err
+		}
+		return payload, nil
+	}
+
+	return nil, fmt.Errorf("%w: unsupported event %s", ErrInvalidSheet, event.Type)
+}
+
+func addSheet(room *domain.Room, payload *domain.SheetAddPayload) error {
+	if len(room.Sheets) >= MaxSheets {
+		return fmt.Errorf("%w: at most %d per room", ErrTooManySheets, MaxSheets)
+	}
+	id, err := newSheetID(room, payload.SheetID)
+	if err != nil {
+		return err
+	}
+
+	index := len(room.Sheets)
+	if payload.Index != nil {
+		index = *payload.Index
+		if index < 0 || index > len(room.Sheets) {
+			return fmt.Errorf("%w: index %d is out of range", ErrInvalidSheet, index)
+		}
+	}
+
+	name := payload.Name
+	if strings.TrimSpace(name) == "" {
+		name = freeSheetName(room, "Sheet", len(room.Sheets)+1)
+	}
+	if name, err = checkSheetName(room, name, nil); err != nil {
+		return err
+	}
+
+	room.Sheets = insertSheet(room.Sheets, index, &domain.Sheet{ID: id, Name: name})
+	payload.SheetID, payload.Name, payload.Index = id, name, &index
+	return nil
+}
+
+func duplicateSheet(room *domain.Room, payload *domain.SheetDuplicatePayload) error {
+	source, i, err := requireSheet(room, payload.SheetID)
+	if err != nil {
+		return err
+	}
+	if len(room.Sheets) >= MaxSheets {
+		return fmt.Errorf("%w: at most %d per room", ErrTooManySheets, MaxSheets)
+	}
+	id, err := newSheetID(room, payload.NewSheetID)
+	if err != nil {
+		return err
+	}
+
+	name := payload.Name
+	if strings.TrimSpace(name) == "" {
+		name = freeSheetName(room, source.Name+" (copy", 1)
+	}
+	if name, err = checkSheetName(room, name, nil); err != nil {
+		return err
+	}
+
+	copied := source.Clone()
+	copied.ID, copied.Name = id, name
+	room.Sheets = insertSheet(room.Sheets, i+1, copied)
+	payload.SheetID, payload.NewSheetID, payload.Name = source.ID, id, name
+	return nil
+}
+
+func updateColumn(sheet *domain.Sheet, payload *domain.ColumnUpdatePayload) error {
+	column, err := parseColumn(payload.Column)
+	if err != nil {
+		return err
+	}
+
+	settings := payload.Settings
+	settings.Title = strings.TrimSpace(settings.Title)
+	if settings.Width < 0 || settings.Width > maxColumnWidth {
+		return fmt.Errorf("%w: width must be between 0 and %d", ErrInvalidColumn, maxColumnWidth)
+	}
+	if utf8.RuneCountInString(settings.Title) > maxColumnTitleLength {
+		return fmt.Errorf("%w: title is longer than %d characters", ErrInvalidColumn, maxColumnTitleLength)
+	}
+	if err := checkSchema(sheet, column, &settings); err != nil {
+		return err
+	}
+
+	if settings.IsZero() {
+		delete(sheet.Columns, column)
+	} else {
+		if sheet.Columns == nil {
+			sheet.Columns = make(map[string]domain.Column)
+		}
+		sheet.Columns[column] = settings
+	}
+	payload.SheetID, payload.Column, payload.Settings = sheet.ID, column, settings
+	return nil
+}
+
+// parseColumn приводит букву столбца к каноничному виду ("c" → "C").
+func parseColumn(name string) (string, error) {
+	column := strings.ToUpper(strings.TrimSpace(name))
+	if col, _, err := ParseCell(column + "1"); err != nil || CellName(col, 1) != column+"1" {
+		return "", fmt.Errorf("%w: %q is not a column name", ErrInvalidColumn, name)
+	}
+	return column, nil
+}
+
+func setCell(sheet *domain.Sheet, cell, value string) {
+	if value == "" {
+		delete(sheet.Cells, cell)
+		return
+	}
+	if sheet.Cells == nil {
+		sheet.Cells = make(map[string]string)
+	}
+	sheet.Cells[cell] = value
+}
+
+// newSheetID проверяет ID, предложенный клиентом, или генерирует новый.
+// При воспроизведении журнала ID уже записан в событии.
+func newSheetID(room *domain.Room, id string) (string, error) {
+	if id == "" {
+		return "sheet_" + utils.GenerateID(), nil
+	}
+	if !sheetIDPattern.MatchString(id) {
+		return "", fmt.Errorf("%w: sheet id may contain only letters, digits, '-' and '_'", ErrInvalidSheet)
+	}
+	if _, _, err := FindSheet(room, id); err == nil {
+		return "", fmt.Errorf("%w: sheet %s already exists", ErrInvalidSheet, id)
+	}
+	return id, nil
+}
+
+// checkSheetName нормализует название и проверяет, что оно допустимо и не
+// занято другим листом (self — переименовываемый лист).
+func checkSheetName(room *domain.Room, name string, self *domain.Sheet) (string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return "", fmt.Errorf("%w: name is required", ErrInvalidSheet)
+	case utf8.RuneCountInString(name) > maxSheetNameLength:
+		return "", fmt.Errorf("%w: name is longer than %d characters", ErrInvalidSheet, maxSheetNameLength)
+	case strings.ContainsAny(name, forbiddenSheetNameChars):
+		return "", fmt.Errorf("%w: name may not contain any of %s", ErrInvalidSheet, forbiddenSheetNameChars)
+	}
+	if other := sheetByName(room, name); other != nil && other != self {
+		return "", fmt.Errorf("%w: %s", ErrSheetNameTaken, name)
+	}
+	return name, nil
+}
+
+// freeSheetName подбирает свободное название: "Sheet3", "Sheet4"… или для
+// копий "Budget (copy)", "Budget (copy 2)"…
+func freeSheetName(room *domain.Room, base string, n int) string {
+	for ; ; n++ {
+		var name string
+		switch {
+		case strings.HasSuffix(base, "(copy") && n == 1:
+			name = base + ")"
+		case strings.HasSuffix(base, "(copy"):
+			name = fmt.Sprintf("%s %d)", base, n)
+		default:
+			name = fmt.Sprintf("%s%d", base, n)
+		}
+		if sheetByName(room, name) == nil {
+			return name
+		}
+	}
+}
+
+func insertSheet(sheets []*domain.Sheet, index int, sheet *domain.Sheet) []*domain.Sheet {
+	sheets = append(sheets, nil)
+	copy(sheets[index+1:], sheets[index:])
+	sheets[index] = sheet
+	return sheets
+}
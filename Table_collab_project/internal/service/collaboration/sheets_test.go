@@ -0,0 +1,143 @@
+package collaboration
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"table_collab/internal/domain"
+)
+
+func TestEnsureSheetsMigratesCells(t *testing.T) {
+	room := &domain.Room{Type: domain.RoomTypeTable, TableData: map[string]interface{}{
+		"cells": map[string]interface{}{"b2": "7", "C1": "=B2*3", "D1": 5.0},
+	}}
+
+	EnsureSheets(room)
+	if len(room.Sheets) != 1 || room.TableData != nil {
+		t.Fatalf("room = %+v", room)
+	}
+	sheet := room.Sheets[0]
+	if sheet.ID != DefaultSheetID || sheet.Cells["B2"] != "7" || len(sheet.Cells) != 2 || sheet.Values["C1"] != "21" {
+		t.Fatalf("sheet = %+v", sheet)
+	}
+
+	document := &domain.Room{Type: domain.RoomTypeDocument}
+	EnsureSheets(document)
+	if document.Sheets != nil {
+		t.Fatal("document rooms have no sheets")
+	}
+}
+
+func TestApplySheetEdit(t *testing.T) {
+	s := NewService()
+	room := &domain.Room{Type: domain.RoomTypeTable}
+	apply := func(eventType domain.EventType, payload interface{}) (interface{}, error) {
+		return s.ApplySheetEdit(room, domain.Event{Type: eventType, Payload: payload})
+	}
+
+	result, err := apply(domain.EventSheetAdd, domain.SheetAddPayload{})
+	added := result.(domain.SheetAddPayload)
+	if err != nil || added.SheetID == "" || added.Name != "Sheet2" || *added.Index != 1 {
+		t.Fatalf("add: %+v, %v", result, err)
+	}
+
+	zero := 0
+	if _, err := apply(domain.EventSheetAdd, domain.SheetAddPayload{SheetID: "plan", Name: " Plan ", Index: &zero}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apply(domain.EventCellUpdate, nil); err == nil {
+		t.Fatal("unsupported event accepted")
+	}
+	if _, err := s.ApplyCellUpdate(room, domain.Event{Payload: domain.CellUpdatePayload{SheetID: "plan", Cell: "a1", Value: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = apply(domain.EventSheetDuplicate, domain.SheetDuplicatePayload{SheetID: "plan"})
+	if err != nil || result.(domain.SheetDuplicatePayload).Name != "Plan (copy)" {
+		t.Fatalf("duplicate: %+v, %v", result, err)
+	}
+	result, _ = apply(domain.EventSheetDuplicate, domain.SheetDuplicatePayload{SheetID: "plan"})
+	if name := result.(domain.SheetDuplicatePayload).Name; name != "Plan (copy 2)" {
+		t.Fatalf("second copy is named %q", name)
+	}
+
+	if _, err := apply(domain.EventSheetMove, domain.SheetMovePayload{SheetID: "plan", Index: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apply(domain.EventSheetDelete, domain.SheetDeletePayload{SheetID: DefaultSheetID}); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, sheet := range room.Sheets {
+		names = append(names, sheet.Name)
+	}
+	if want := "Plan (copy 2),Plan (copy),Sheet2,Plan"; strings.Join(names, ",") != want {
+		t.Fatalf("sheets = %v, want %s", names, want)
+	}
+
+	if room.Sheets[0].Cells["A1"] != "x" {
+		t.Fatalf("duplicate lost cells: %+v", room.Sheets[0])
+	}
+	room.Sheets[0].Cells["A1"] = "changed"
+	if room.Sheets[3].Cells["A1"] != "x" {
+		t.Fatal("duplicate shares cells with its source")
+	}
+}
+
+func TestApplySheetEditRejects(t *testing.T) {
+	s := NewService()
+	room := &domain.Room{Type: domain.RoomTypeTable}
+	EnsureSheets(room)
+
+	tests := []struct {
+		eventType domain.EventType
+		payload   interface{}
+		want      error
+	}{
+		{domain.EventSheetAdd, domain.SheetAddPayload{Name: "sheet1"}, ErrSheetNameTaken},
+		{domain.EventSheetAdd, domain.SheetAddPayload{Name: "Q1/Q2"}, ErrInvalidSheet},
+		{domain.EventSheetAdd, domain.SheetAddPayload{SheetID: DefaultSheetID}, ErrInvalidSheet},
+		{domain.EventSheetRename, domain.SheetRenamePayload{Name: "X"}, ErrInvalidSheet},
+		{domain.EventSheetRename, domain.SheetRenamePayload{SheetID: "nope", Name: "X"}, ErrSheetNotFound},
+		{domain.EventSheetMove, domain.SheetMovePayload{SheetID: DefaultSheetID, Index: 1}, ErrInvalidSheet},
+		{domain.EventSheetDelete, domain.SheetDeletePayload{SheetID: DefaultSheetID}, ErrLastSheet},
+		{domain.EventColumnUpdate, domain.ColumnUpdatePayload{Column: "A1"}, ErrInvalidColumn},
+		{domain.EventColumnUpdate, domain.ColumnUpdatePayload{Column: "B", Settings: domain.Column{Width: -1}}, ErrInvalidColumn},
+	}
+	for _, tt := range tests {
+		if _, err := s.ApplySheetEdit(room, domain.Event{Type: tt.eventType, Payload: tt.payload}); !errors.Is(err, tt.want) {
+			t.Errorf("%s %+v: err = %v, want %v", tt.eventType, tt.payload, err, tt.want)
+		}
+	}
+
+	if _, err := s.ApplySheetEdit(&domain.Room{Type: domain.RoomTypeDocument}, domain.Event{Type: domain.EventSheetAdd}); !errors.Is(err, ErrNotTableRoom) {
+		t.Fatalf("document room: %v", err)
+	}
+}
+
+func TestColumnUpdate(t *testing.T) {
+	s := NewService()
+	room := &domain.Room{Type: domain.RoomTypeTable}
+
+	event := domain.Event{Type: domain.EventColumnUpdate, Payload: domain.ColumnUpdatePayload{
+		Column: "c", Settings: domain.Column{Title: " Total ", Width: 120},
+	}}
+	result, err := s.ApplySheetEdit(room, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload := result.(domain.ColumnUpdatePayload); payload.SheetID != DefaultSheetID || payload.Column != "C" {
+		t.Fatalf("payload = %+v", payload)
+	}
+	if column := room.Sheets[0].Columns["C"]; column.Title != "Total" || column.Width != 120 {
+		t.Fatalf("column = %+v", column)
+	}
+
+	// Пустые настройки сбрасывают столбец
+	event.Payload = domain.ColumnUpdatePayload{Column: "C"}
+	if _, err := s.ApplySheetEdit(room, event); err != nil || len(room.Sheets[0].Columns) != 0 {
+		t.Fatalf("reset: %v, %+v", err, room.Sheets[0].Columns)
+	}
+}
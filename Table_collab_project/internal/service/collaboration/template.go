@@ -0,0 +1,81 @@
+package collaboration
+
+import (
+	"regexp"
+	"sort"
+
+	"table_collab/internal/domain"
+)
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// Placeholders возвращает имена плейсхолдеров {{name}} из текстов, строковых
+// значений таблицы, названий листов и ячеек, без повторов и по алфавиту.
+func Placeholders(table map[string]interface{}, sheets []*domain.Sheet, texts ...string) []string {
+	seen := make(map[string]bool)
+	collect := func(text string) string {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			seen[match[1]] = true
+		}
+		return text
+	}
+
+	for _, text := range texts {
+		collect(text)
+	}
+	MapStrings(table, collect)
+	MapSheets(sheets, collect)
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FillPlaceholders подставляет значения; неизвестные плейсхолдеры остаются как есть.
+func FillPlaceholders(text string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := placeholderPattern.FindStringSubmatch(match)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// MapStrings возвращает глубокую копию данных таблицы, пропуская каждую
+// строку через fn.
+func MapStrings(table map[string]interface{}, fn func(string) string) map[string]interface{} {
+	if table == nil {
+		return nil
+	}
+	return mapValue(table, fn).(map[string]interface{})
+}
+
+// CloneTable возвращает глубокую копию данных таблицы.
+func CloneTable(table map[string]interface{}) map[string]interface{} {
+	return MapStrings(table, func(s string) string { return s })
+}
+
+func mapValue(value interface{}, fn func(string) string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = mapValue(item, fn)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = mapValue(item, fn)
+		}
+		return copied
+	case string:
+		return fn(v)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,38 @@
+package collaboration
+
+import (
+	"reflect"
+	"testing"
+
+	"table_collab/internal/domain"
+)
+
+func TestPlaceholders(t *testing.T) {
+	table := map[string]interface{}{
+		"cells": map[string]interface{}{
+			"A1": "Sprint {{ sprint }}",
+			"B1": "{{owner}}",
+			"C1": 42.0,
+		},
+	}
+
+	sheets := []*domain.Sheet{{ID: "s1", Name: "{{team}} plan", Cells: map[string]string{"A1": "{{ quarter }}"}}}
+
+	got := Placeholders(table, sheets, "Notes {{date}}", "{{sprint}} goals, {{ not valid }}")
+	if want := []string{"date", "owner", "quarter", "sprint", "team"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Placeholders = %v, want %v", got, want)
+	}
+
+	filled := MapStrings(table, func(s string) string {
+		return FillPlaceholders(s, map[string]string{"sprint": "14"})
+	})
+	cells := filled["cells"].(map[string]interface{})
+	if cells["A1"] != "Sprint 14" || cells["B1"] != "{{owner}}" || cells["C1"] != 42.0 {
+		t.Fatalf("filled cells: %v", cells)
+	}
+
+	// Исходные данные не меняются
+	if table["cells"].(map[string]interface{})["A1"] != "Sprint {{ sprint }}" {
+		t.Fatalf("source table modified: %v", table)
+	}
+}
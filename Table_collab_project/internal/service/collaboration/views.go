@@ -0,0 +1,561 @@
+package collaboration
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"table_collab/internal/domain"
+)
+
+const (
+	MaxViewsPerRoom = 100
+
+	maxViewNameLength = 100
+	maxFilterLength   = 1000
+	maxSortKeys       = 10
+	maxHiddenColumns  = 500
+)
+
+var (
+	ErrViewNotFound = errors.New("view not found")
+	ErrInvalidView  = errors.New("invalid view")
+	ErrTooManyViews = errors.New("too many views")
+)
+
+// ValidateView проверяет представление и приводит его к каноничному виду:
+// лист указан явно, столбцы — заглавными буквами, фильтр разбирается.
+func ValidateView(room *domain.Room, view *domain.View) error {
+	view.Name = strings.TrimSpace(view.Name)
+	if view.Name == "" || utf8.RuneCountInString(view.Name) > maxViewNameLength {
+		return fmt.Errorf("%w: name must be 1 to %d characters long", ErrInvalidView, maxViewNameLength)
+	}
+
+	sheet, _, err := FindSheet(room, view.SheetID)
+	if err != nil {
+		return err
+	}
+	view.SheetID = sheet.ID
+
+	if len(view.Sort) > maxSortKeys {
+		return fmt.Errorf("%w: at most %d sort keys", ErrInvalidView, maxSortKeys)
+	}
+	for i := range view.Sort {
+		if view.Sort[i].Column, err = viewColumn(view.Sort[i].Column); err != nil {
+			return err
+		}
+	}
+
+	if len(view.Hidden) > maxHiddenColumns {
+		return fmt.Errorf("%w: at most %d hidden columns", ErrInvalidView, maxHiddenColumns)
+	}
+	hidden := make([]string, 0, len(view.Hidden))
+	seen := make(map[string]bool)
+	for _, name := range view.Hidden {
+		column, err := viewColumn(name)
+		if err != nil {
+			return err
+		}
+		if !seen[column] {
+			seen[column] = true
+			hidden = append(hidden, column)
+		}
+	}
+	view.Hidden = nil
+	if len(hidden) > 0 {
+		view.Hidden = hidden
+	}
+
+	if view.GroupBy != "" {
+		if view.GroupBy, err = viewColumn(view.GroupBy); err != nil {
+			return err
+		}
+	}
+
+	view.Filter = strings.TrimSpace(view.Filter)
+	if len(view.Filter) > maxFilterLength {
+		return fmt.Errorf("%w: filter is longer than %d characters", ErrInvalidView, maxFilterLength)
+	}
+	if _, err := parseFilter(view.Filter); err != nil {
+		return fmt.Errorf("%w: filter: %v", ErrInvalidView, err)
+	}
+	return nil
+}
+
+// RefreshView пересчитывает видимые строки представления и сообщает,
+// изменились ли они.
+func RefreshView(room *domain.Room, view *domain.View) bool {
+	var rows []int
+	var groups []domain.ViewGroup
+	if sheet, _, err := FindSheet(room, view.SheetID); err == nil {
+		rows, groups = computeView(sheet, view)
+	}
+
+	if view.Rows != nil && equalRows(view.Rows, rows, view.Groups, groups) {
+		return false
+	}
+	view.Rows, view.Groups = rows, groups
+	return true
+}
+
+// RefreshViews пересчитывает представления листов из sheets (nil — всех
+// листов) и возвращает те, у которых изменились видимые строки. Каждое
+// представление пересчитывается целиком: это линейно от числа ячеек листа.
+func RefreshViews(room *domain.Room, sheets map[string]bool) []*domain.View {
+	var changed []*domain.View
+	for _, view := range room.Views {
+		if sheets != nil && !sheets[view.SheetID] {
+			continue
+		}
+		if RefreshView(room, view) {
+			changed = append(changed, view)
+		}
+	}
+	return changed
+}
+
+// FindView ищет представление комнаты по ID.
+func FindView(room *domain.Room, id string) (*domain.View, int) {
+	for i, view := range room.Views {
+		if view.ID == id {
+			return view, i
+		}
+	}
+	return nil, -1
+}
+
+// ReplaceView заменяет представление с тем же ID или добавляет новое.
+func ReplaceView(room *domain.Room, view *domain.View) {
+	if _, i := FindView(room, view.ID); i >= 0 {
+		room.Views[i] = view
+		return
+	}
+	room.Views = append(room.Views, view)
+}
+
+// RemoveView удаляет представление и сообщает, было ли оно.
+func RemoveView(room *domain.Room, id string) bool {
+	_, i := FindView(room, id)
+	if i < 0 {
+		return false
+	}
+	room.Views = append(room.Views[:i:i], room.Views[i+1:]...)
+	return true
+}
+
+func dropSheetViews(views []*domain.View, sheetID string) []*domain.View {
+	kept := views[:0:0]
+	for _, view := range views {
+		if view.SheetID != sheetID {
+			kept = append(kept, view)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+func viewColumn(name string) (string, error) {
+	column, err := parseColumn(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q is not a column name", ErrInvalidView, name)
+	}
+	return column, nil
+}
+
+// computeView отбирает строки листа, в которых есть хотя бы одна ячейка,
+// фильтрует и сортирует их, а при группировке собирает строки одной группы
+// подряд. Порядок групп — по значению, в направлении ключа сортировки по тому
+// же столбцу, если он есть; значения, различающиеся только регистром, попадают
+// в одну группу с записью из её первой строки.
+func computeView(sheet *domain.Sheet, view *domain.View) ([]int, []domain.ViewGroup) {
+	value := func(column string, row int) string {
+		cell := column + strconv.Itoa(row)
+		if computed, ok := sheet.Values[cell]; ok {
+			return computed
+		}
+		return sheet.Cells[cell]
+	}
+
+	filter, _ := parseFilter(view.Filter)
+	seen := make(map[int]bool)
+	rows := []int{}
+	for cell := range sheet.Cells {
+		_, row, err := ParseCell(cell)
+		if err != nil || seen[row] {
+			continue
+		}
+		seen[row] = true
+		if filter == nil || filter.match(func(column string) string { return value(column, row) }) {
+			rows = append(rows, row)
+		}
+	}
+
+	keys := view.Sort
+	if view.GroupBy != "" {
+		group := domain.SortKey{Column: view.GroupBy}
+		for _, key := range keys {
+			if key.Column == view.GroupBy {
+				group.Desc = key.Desc
+			}
+		}
+		keys = append([]domain.SortKey{group}, keys...)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		for _, key := range keys {
+			if c := compareSortValues(value(key.Column, rows[i]), value(key.Column, rows[j]), key.Desc); c != 0 {
+				return c < 0
+			}
+		}
+		return rows[i] < rows[j]
+	})
+
+	if view.GroupBy == "" {
+		return rows, nil
+	}
+	var groups []domain.ViewGroup
+	for _, row := range rows {
+		v := value(view.GroupBy, row)
+		if n := len(groups); n > 0 && compareValues(groups[n-1].Value, v) == 0 {
+			groups[n-1].Count++
+			continue
+		}
+		groups = append(groups, domain.ViewGroup{Value: v, Count: 1})
+	}
+	return rows, groups
+}
+
+// compareSortValues сравнивает значения для сортировки; пустые значения
+// всегда идут последними, независимо от направления.
+func compareSortValues(a, b string, desc bool) int {
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	c := compareValues(a, b)
+	if desc {
+		return -c
+	}
+	return c
+}
+
+// compareValues сравнивает два числа как числа, остальное — как строки без
+// учёта регистра. Даты в записи ГГГГ-ММ-ДД при этом упорядочиваются верно.
+func compareValues(a, b string) int {
+	x, okA := parseNumber(a)
+	y, okB := parseNumber(b)
+	if okA && okB {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+func equalRows(rows, other []int, groups, otherGroups []domain.ViewGroup) bool {
+	if len(rows) != len(other) || len(groups) != len(otherGroups) {
+		return false
+	}
+	for i := range rows {
+		if rows[i] != other[i] {
+			return false
+		}
+	}
+	for i := range groups {
+		if groups[i] != otherGroups[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Фильтр представления — условия над значениями столбцов текущей строки:
+//
+//	B > 10 AND (C = "Open" OR C = "Review")
+//	NOT A CONTAINS "draft"
+//	D IS NOT EMPTY
+//
+// Операторы сравнения: = != <> < <= > >= CONTAINS. Числа сравниваются как
+// числа, строки — без учёта регистра; пустая ячейка не больше и не меньше
+// ничего. Ключевые слова пишутся в любом регистре, кавычка внутри строки
+// удваивается ("say ""hi""").
+
+type filterNode interface {
+	match(value func(column string) string) bool
+}
+
+type filterAnd struct{ left, right filterNode }
+type filterOr struct{ left, right filterNode }
+type filterNot struct{ inner filterNode }
+
+type filterCompare struct {
+	column, op, value string
+}
+
+type filterEmpty struct {
+	column string
+	negate bool
+}
+
+func (n filterAnd) match(value func(string) string) bool {
+	return n.left.match(value) && n.right.match(value)
+}
+
+func (n filterOr) match(value func(string) string) bool {
+	return n.left.match(value) || n.right.match(value)
+}
+
+func (n filterNot) match(value func(string) string) bool {
+	return !n.inner.match(value)
+}
+
+func (n filterEmpty) match(value func(string) string) bool {
+	return (value(n.column) == "") != n.negate
+}
+
+func (n filterCompare) match(value func(string) string) bool {
+	cell := value(n.column)
+	switch n.op {
+	case "CONTAINS":
+		return strings.Contains(strings.ToLower(cell), strings.ToLower(n.value))
+	case "=":
+		return cell == n.value || (cell != "" && n.value != "" && compareValues(cell, n.value) == 0)
+	case "!=":
+		return !(cell == n.value || (cell != "" && n.value != "" && compareValues(cell, n.value) == 0))
+	}
+
+	if cell == "" {
+		return false
+	}
+	c := compareValues(cell, n.value)
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default: // ">="
+		return c >= 0
+	}
+}
+
+type filterToken struct {
+	kind byte // 'w' — слово, 's' — строка, 'n' — число, 'o' — оператор, '(' или ')'
+	text string
+}
+
+func lexFilter(text string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '(' || c == ')':
+			tokens = append(tokens, filterToken{kind: c, text: string(c)})
+			i++
+
+		case c == '"':
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(text) {
+					return nil, errors.New("unterminated string")
+				}
+				if text[i] == '"' {
+					if i+1 < len(text) && text[i+1] == '"' {
+						b.WriteByte('"')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteByte(text[i])
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: 's', text: b.String()})
+
+		case strings.IndexByte("=!<>", c) >= 0:
+			op := string(c)
+			if i+1 < len(text) && (text[i+1] == '=' || (c == '<' && text[i+1] == '>')) {
+				op = text[i : i+2]
+			}
+			i += len(op)
+			switch op {
+			case "!":
+				return nil, errors.New("unexpected '!'")
+			case "<>":
+				op = "!="
+			}
+			tokens = append(tokens, filterToken{kind: 'o', text: op})
+
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			start := i
+			i++
+			for i < len(text) && (text[i] == '.' || text[i] == 'e' || text[i] == 'E' ||
+				(text[i] >= '0' && text[i] <= '9') || ((text[i] == '+' || text[i] == '-') && (text[i-1] == 'e' || text[i-1] == 'E'))) {
+				i++
+			}
+			num, ok := parseNumber(text[start:i])
+			if !ok {
+				return nil, fmt.Errorf("invalid number %q", text[start:i])
+			}
+			tokens = append(tokens, filterToken{kind: 'n', text: formatNumber(num)})
+
+		case c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z':
+			start := i
+			for i < len(text) && (text[i] >= 'A' && text[i] <= 'Z' || text[i] >= 'a' && text[i] <= 'z') {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: 'w', text: strings.ToUpper(text[start:i])})
+
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+// parseFilter разбирает фильтр; пустой фильтр — nil, он пропускает все строки.
+func parseFilter(text string) (filterNode, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	tokens, err := lexFilter(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return node, nil
+}
+
+func (p *filterParser) peek() (filterToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *filterParser) keyword(word string) bool {
+	if t, ok := p.peek(); ok && t.kind == 'w' && t.text == word {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) or() (filterNode, error) {
+	left, err := p.and()
+	for err == nil && p.keyword("OR") {
+		var right filterNode
+		if right, err = p.and(); err == nil {
+			left = filterOr{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) and() (filterNode, error) {
+	left, err := p.not()
+	for err == nil && p.keyword("AND") {
+		var right filterNode
+		if right, err = p.not(); err == nil {
+			left = filterAnd{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) not() (filterNode, error) {
+	if p.keyword("NOT") {
+		inner, err := p.not()
+		return filterNot{inner}, err
+	}
+	return p.condition()
+}
+
+func (p *filterParser) condition() (filterNode, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, errors.New("unexpected end of filter")
+	}
+	if t.kind == '(' {
+		p.pos++
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.kind != ')' {
+			return nil, errors.New("missing ')'")
+		}
+		p.pos++
+		return node, nil
+	}
+
+	if t.kind != 'w' {
+		return nil, fmt.Errorf("expected a column, got %q", t.text)
+	}
+	column, err := parseColumn(t.text)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a column", t.text)
+	}
+	p.pos++
+
+	if p.keyword("IS") {
+		negate := p.keyword("NOT")
+		if !p.keyword("EMPTY") {
+			return nil, errors.New("expected EMPTY after IS")
+		}
+		return filterEmpty{column: column, negate: negate}, nil
+	}
+
+	op, ok := p.peek()
+	switch {
+	case ok && op.kind == 'o':
+	case ok && op.kind == 'w' && op.text == "CONTAINS":
+	default:
+		return nil, fmt.Errorf("expected a comparison after %s", column)
+	}
+	p.pos++
+
+	operand, ok := p.peek()
+	switch {
+	case !ok:
+		return nil, errors.New("unexpected end of filter")
+	case operand.kind == 's' || operand.kind == 'n':
+	case operand.kind == 'w' && (operand.text == "TRUE" || operand.text == "FALSE"):
+		// Флажки хранятся как true/false
+		operand.text = strings.ToLower(operand.text)
+	default:
+		return nil, fmt.Errorf("expected a value after %s, got %q", op.text, operand.text)
+	}
+	p.pos++
+	return filterCompare{column: column, op: op.text, value: operand.text}, nil
+}
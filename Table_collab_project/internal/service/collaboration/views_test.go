@@ -0,0 +1,121 @@
+package collaboration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"table_collab/internal/domain"
+)
+
+func viewRoom() *domain.Room {
+	room := &domain.Room{Type: domain.RoomTypeTable, Sheets: []*domain.Sheet{{
+		ID: "s1", Name: "Tasks", Cells: map[string]string{
+			"A1": "Login", "B1": "5", "C1": "Open",
+			"A2": "Search", "B2": "13", "C2": "done",
+			"A3": "Export", "B3": "2", "C3": "Open",
+			"A4": "Draft: billing", "C4": "Review",
+			"A6": "Import", "B6": "=B1+B3", "C6": "Done",
+		},
+	}}}
+	Recalculate(room)
+	return room
+}
+
+func TestFilter(t *testing.T) {
+	tests := map[string][]int{
+		"":                                      {1, 2, 3, 4, 6},
+		`C = "open"`:                            {1, 3},
+		`C <> "Open"`:                           {2, 4, 6},
+		"B > 4":                                 {1, 2, 6},
+		"B >= 7 AND B <= 13":                    {2, 6},
+		"B < 100":                               {1, 2, 3, 6},
+		`NOT A contains "draft"`:                {1, 2, 3, 6},
+		`b is empty or (c = "done" and b > 10)`: {2, 4},
+		"B IS NOT EMPTY AND NOT B = 5":          {2, 3, 6},
+		`A = "Draft: billing"`:                  {4},
+		`A = """quoted"""`:                      {},
+		"D = TRUE":                              {},
+	}
+
+	for filter, want := range tests {
+		room := viewRoom()
+		view := &domain.View{Name: "v", Filter: filter}
+		if err := ValidateView(room, view); err != nil {
+			t.Errorf("%q: %v", filter, err)
+			continue
+		}
+		RefreshView(room, view)
+		// Без сортировки строки идут по номеру
+		if !reflect.DeepEqual(view.Rows, want) {
+			t.Errorf("%q: rows = %v, want %v", filter, view.Rows, want)
+		}
+	}
+}
+
+func TestFilterRejects(t *testing.T) {
+	for _, filter := range []string{
+		"B >", "B 5", `"x" = A`, "(B > 1", "B > 1)", "A1 = 2", "B IS NULL",
+		`A = "open`, "B ! 3", "B > 1 AND", "B = foo", "B @ 1",
+	} {
+		view := &domain.View{Name: "v", Filter: filter}
+		if err := ValidateView(viewRoom(), view); !errors.Is(err, ErrInvalidView) {
+			t.Errorf("%q: err = %v, want ErrInvalidView", filter, err)
+		}
+	}
+}
+
+func TestViewSortAndGroup(t *testing.T) {
+	room := viewRoom()
+
+	view := &domain.View{Name: "By estimate", Sort: []domain.SortKey{{Column: "b", Desc: true}}, Hidden: []string{"a", "A", "c"}}
+	if err := ValidateView(room, view); err != nil {
+		t.Fatal(err)
+	}
+	if view.SheetID != "s1" || view.Sort[0].Column != "B" || !reflect.DeepEqual(view.Hidden, []string{"A", "C"}) {
+		t.Fatalf("view = %+v", view)
+	}
+	// B6 — формула, сортируется по вычисленному значению; пустые в конце
+	if !RefreshView(room, view) || !reflect.DeepEqual(view.Rows, []int{2, 6, 1, 3, 4}) {
+		t.Fatalf("rows = %v", view.Rows)
+	}
+	if RefreshView(room, view) {
+		t.Fatal("unchanged view reported as changed")
+	}
+
+	grouped := &domain.View{Name: "By status", SheetID: "s1", GroupBy: "C", Sort: []domain.SortKey{{Column: "B"}}}
+	if err := ValidateView(room, grouped); err != nil {
+		t.Fatal(err)
+	}
+	RefreshView(room, grouped)
+	wantGroups := []domain.ViewGroup{{Value: "Done", Count: 2}, {Value: "Open", Count: 2}, {Value: "Review", Count: 1}}
+	if !reflect.DeepEqual(grouped.Rows, []int{6, 2, 3, 1, 4}) || !reflect.DeepEqual(grouped.Groups, wantGroups) {
+		t.Fatalf("grouped rows = %v, groups = %+v", grouped.Rows, grouped.Groups)
+	}
+
+	// Правка ячейки и пересчёт формулы меняют порядок
+	room.Views = []*domain.View{view, grouped}
+	room.Sheets[0].Cells["B3"] = "20"
+	Recalculate(room)
+	changed := RefreshViews(room, map[string]bool{"s1": true})
+	if len(changed) != 2 || !reflect.DeepEqual(view.Rows, []int{6, 3, 2, 1, 4}) {
+		t.Fatalf("after edit: %d changed, rows = %v", len(changed), view.Rows)
+	}
+	if changed := RefreshViews(room, map[string]bool{"other": true}); len(changed) != 0 {
+		t.Fatalf("views of other sheets refreshed: %v", changed)
+	}
+}
+
+func TestViewsRemovedWithSheet(t *testing.T) {
+	s := NewService()
+	room := viewRoom()
+	room.Sheets = append(room.Sheets, &domain.Sheet{ID: "s2", Name: "Other"})
+	room.Views = []*domain.View{{ID: "v1", SheetID: "s1"}, {ID: "v2", SheetID: "s2"}}
+
+	if _, err := s.ApplySheetEdit(room, domain.Event{Type: domain.EventSheetDelete, Payload: domain.SheetDeletePayload{SheetID: "s1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(room.Views) != 1 || room.Views[0].ID != "v2" {
+		t.Fatalf("views = %+v", room.Views)
+	}
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/service/collaboration"
+	"table_collab/pkg/utils"
+)
+
+const (
+	maxCommentLength  = 4000
+	maxThreadsPerRoom = 1000
+)
+
+var (
+	ErrThreadNotFound  = errors.New("comment thread not found")
+	ErrInvalidComment  = errors.New("comment text is empty or too long")
+	ErrInvalidAnchor   = errors.New("anchor is outside the content")
+	ErrTooManyThreads  = errors.New("too many comment threads in the room")
+	ErrCellAnchorTable = errors.New("cell anchors are only allowed in table rooms")
+)
+
+func isComment(eventType domain.EventType) bool {
+	switch eventType {
+	case domain.EventCommentAdd, domain.EventCommentReply, domain.EventCommentResolve:
+		return true
+	default:
+		return false
+	}
+}
+
+// handleComment вызывается из Run. Ветки меняются только здесь, а клиентам
+// всегда рассылается полная копия изменённой ветки.
+func (h *Hub) handleComment(client *Client, event domain.Event) {
+	room, err := h.rooms.Get(event.RoomID)
+	if err != nil {
+		h.sendError(client, "room_not_found", ErrRoomNotFound.Error())
+		return
+	}
+
+	var thread *domain.CommentThread
+	switch event.Type {
+	case domain.EventCommentAdd:
+		thread, err = h.addThread(client, room, event)
+	case domain.EventCommentReply:
+		thread, err = h.replyThread(client, room, event)
+	case domain.EventCommentResolve:
+		thread, err = h.resolveThread(client, room, event)
+	}
+	if err != nil {
+		code := "invalid_comment"
+		if errors.Is(err, ErrThreadNotFound) {
+			code = "thread_not_found"
+		}
+		h.sendError(client, code, err.Error())
+		return
+	}
+
+	thread.UpdatedAt = time.Now()
+	room.UpdatedAt = thread.UpdatedAt
+	h.rooms.Save(room)
+
+	h.broadcastThread(client, event, thread)
+}
+
+func (h *Hub) addThread(client *Client, room *domain.Room, event domain.Event) (*domain.CommentThread, error) {
+	var payload domain.CommentAddPayload
+	if err := domain.DecodePayload(event, &payload); err != nil {
+		return nil, ErrInvalidComment
+	}
+	if len(room.Comments) >= maxThreadsPerRoom {
+		return nil, ErrTooManyThreads
+	}
+
+	anchor, err := validateAnchor(room, payload.Anchor)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := newComment(client, payload.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	thread := &domain.CommentThread{
+		ID:        "thread_" + utils.GenerateID(),
+		Anchor:    anchor,
+		Comments:  []domain.Comment{comment},
+		CreatedAt: comment.CreatedAt,
+	}
+	room.Comments = append(room.Comments, thread)
+	return thread, nil
+}
+
+func (h *Hub) replyThread(client *Client, room *domain.Room, event domain.Event) (*domain.CommentThread, error) {
+	var payload domain.CommentReplyPayload
+	if err := domain.DecodePayload(event, &payload); err != nil {
+		return nil, ErrInvalidComment
+	}
+
+	thread := findThread(room, payload.ThreadID)
+	if thread == nil {
+		return nil, ErrThreadNotFound
+	}
+	comment, err := newComment(client, payload.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	thread.Comments = append(thread.Comments, comment)
+	return thread, nil
+}
+
+func (h *Hub) resolveThread(client *Client, room *domain.Room, event domain.Event) (*domain.CommentThread, error) {
+	var payload domain.CommentResolvePayload
+	if err := domain.DecodePayload(event, &payload); err != nil {
+		return nil, ErrInvalidComment
+	}
+
+	thread := findThread(room, payload.ThreadID)
+	if thread == nil {
+		return nil, ErrThreadNotFound
+	}
+
+	thread.Resolved = payload.Resolved
+	thread.ResolvedBy = ""
+	if payload.Resolved {
+		thread.ResolvedBy = client.ID
+	}
+	return thread, nil
+}
+
+// broadcastThread рассылает ветку всем участникам комнаты, включая автора:
+// ему событие приходит с его op_id, чтобы он узнал ID новой ветки.
+func (h *Hub) broadcastThread(author *Client, event domain.Event, thread *domain.CommentThread) {
+	update := domain.Event{
+		Type:      domain.EventCommentThread,
+		RoomID:    event.RoomID,
+		UserID:    author.ID,
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   thread.Clone(),
+	}
+
+	h.handleBroadcast(update)
+	h.accept(update)
+
+	update.OpID = event.OpID
+	h.deliver(author, update)
+}
+
+// shiftComments переносит якоря после правки текста и сообщает новые позиции
+// всем участникам, включая автора правки.
+func (h *Hub) shiftComments(room *domain.Room, oldText string) {
+	changed := h.collab.ShiftAnchors(room.Comments, oldText, room.Content)
+	if len(changed) == 0 {
+		return
+	}
+
+	event := domain.Event{
+		Type:      domain.EventCommentAnchors,
+		RoomID:    room.ID,
+		Timestamp: time.Now().UnixMilli(),
+		Version:   room.Version,
+		Payload:   domain.CommentAnchorsPayload{Anchors: changed},
+	}
+	h.handleBroadcast(event)
+}
+
+func validateAnchor(room *domain.Room, anchor domain.CommentAnchor) (domain.CommentAnchor, error) {
+	if anchor.Cell != "" {
+		if room.Type != domain.RoomTypeTable {
+			return anchor, ErrCellAnchorTable
+		}
+		col, row, err := collaboration.ParseCell(anchor.Cell)
+		if err != nil {
+			return anchor, ErrInvalidAnchor
+		}
+		sheet, _, err := collaboration.FindSheet(room, anchor.Sheet)
+		if err != nil {
+			return anchor, ErrInvalidAnchor
+		}
+		return domain.CommentAnchor{Sheet: sheet.ID, Cell: collaboration.CellName(col, row)}, nil
+	}
+
+	if anchor.Start < 0 || anchor.End < anchor.Start || anchor.End > utf8.RuneCountInString(room.Content) {
+		return anchor, ErrInvalidAnchor
+	}
+	return anchor, nil
+}
+
+func newComment(client *Client, text string) (domain.Comment, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || utf8.RuneCountInString(text) > maxCommentLength {
+		return domain.Comment{}, ErrInvalidComment
+	}
+
+	return domain.Comment{
+		ID:        "comment_" + utils.GenerateID(),
+		UserID:    client.ID,
+		Username:  client.Username,
+		Text:      text,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func findThread(room *domain.Room, threadID string) *domain.CommentThread {
+	for _, thread := range room.Comments {
+		if thread.ID == threadID {
+			return thread
+		}
+	}
+	return nil
+}
+
+func cloneThreads(threads []*domain.CommentThread) []*domain.CommentThread {
+	if len(threads) == 0 {
+		return nil
+	}
+
+	cloned := make([]*domain.CommentThread, len(threads))
+	for i, thread := range threads {
+		cloned[i] = thread.Clone()
+	}
+	return cloned
+}
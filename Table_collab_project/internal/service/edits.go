@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/service/collaboration"
+	"table_collab/internal/service/plugin"
+	"table_collab/internal/tracing"
+)
+
+const maxTrackedOps = 1024
+
+type clientEvent struct {
+	client *Client
+	event  domain.Event
+	ctx    context.Context // спан получения в ReadPump; nil для событий без трассы
+}
+
+// handleIncoming обрабатывает событие клиента в спане, дочернем к спану его
+// получения. Все события, которые hub разошлёт по ходу обработки, несут
+// контекст этого спана.
+func (h *Hub) handleIncoming(in clientEvent) {
+	ctx := in.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := h.tracer.Start(ctx, "process "+string(in.event.Type),
+		trace.WithAttributes(tracing.EventAttrs(in.event.RoomID, in.client.ID, in.event)...))
+	defer span.End()
+
+	h.traceCtx = ctx
+	defer func() { h.traceCtx = nil }()
+	tracing.Inject(ctx, &in.event)
+
+	h.routeIncoming(in.client, in.event)
+}
+
+func (h *Hub) routeIncoming(client *Client, event domain.Event) {
+	// От зрителя сюда доходит только выход: остальное отсекает handleEvent
+	if client.share != "" {
+		if event.Type == domain.EventLeaveRoom {
+			h.removeSpectator(client)
+		}
+		return
+	}
+
+	// Вход и выход идут через ту же очередь, что и остальные события клиента,
+	// поэтому hub видит их строго в порядке отправки
+	switch event.Type {
+	case domain.EventJoinRoom:
+		var payload domain.JoinRoomPayload
+		domain.DecodePayload(event, &payload)
+		h.handleRegister(client, payload)
+		return
+	case domain.EventLeaveRoom:
+		h.handleUnregister(client)
+		return
+	}
+
+	if h.clients[client.ID] != client {
+		if isEdit(event.Type) {
+			h.reply(client, nack(event, "not_joined", "join the room before editing"))
+		} else {
+			h.sendError(client, "not_joined", "join the room first")
+		}
+		return
+	}
+
+	if isEdit(event.Type) {
+		h.handleEdit(client, event)
+		return
+	}
+
+	// Выбор листа — часть присутствия, как курсор: доступен и в режиме
+	// только для чтения, и заглушённым
+	if event.Type == domain.EventSheetView {
+		h.handleSheetView(client, event)
+		return
+	}
+
+	// Права на представления зависят от того, общее оно или личное
+	if isViewEvent(event.Type) {
+		h.handleView(client, event)
+		return
+	}
+
+	if err := h.authorize(client, event); err != nil {
+		h.sendError(client, "forbidden", err.Error())
+		return
+	}
+
+	if isComment(event.Type) {
+		h.handleComment(client, event)
+		return
+	}
+
+	if isLockEvent(event.Type) {
+		h.handleLock(client, event)
+		return
+	}
+
+	// Курсоры слишком частые, плагины их не видят
+	if event.Type == domain.EventCursorMove {
+		h.handleBroadcast(event)
+		return
+	}
+
+	if err := h.runBefore(&event); err != nil {
+		if !errors.Is(err, plugin.ErrDrop) {
+			h.sendError(client, "vetoed", err.Error())
+		}
+		return
+	}
+
+	h.handleBroadcast(event)
+
+	if event.Type == domain.EventChatMessage {
+		h.accept(event)
+		h.notifyMentions(client, event)
+	}
+
+	h.runAfter(event)
+}
+
+// handleEdit применяет правку не более одного раза на op_id и отвечает отправителю ack или nack.
+func (h *Hub) handleEdit(client *Client, event domain.Event) {
+	s := client.session
+	if event.OpID != "" {
+		if reply, ok := s.ops[event.OpID]; ok {
+			h.deliver(client, reply)
+			return
+		}
+	}
+
+	reply := h.applyEdit(client, event)
+	if event.OpID != "" && final(reply) {
+		s.rememberOp(event.OpID, reply)
+	}
+	h.deliver(client, reply)
+}
+
+func (h *Hub) applyEdit(client *Client, event domain.Event) domain.Event {
+	if err := h.authorize(client, event); err != nil {
+		code := "forbidden"
+		switch err {
+		case ErrMuted:
+			code = "muted"
+		case ErrRoomReadOnly:
+			code = "read_only"
+		}
+		return nack(event, code, err.Error())
+	}
+
+	if room, err := h.rooms.Get(event.RoomID); err == nil {
+		if err := h.checkLocks(client, room, event); err != nil {
+			return nack(event, "locked", err.Error())
+		}
+	}
+
+	if err := h.runBefore(&event); err != nil {
+		code, reason := pluginRejection(err)
+		return nack(event, code, reason)
+	}
+
+	committed, reply := h.commitEdit(event)
+	if reply.Type == domain.EventAck {
+		h.touchLocks(client)
+		h.runAfter(committed)
+	}
+	return reply
+}
+
+// commitEdit применяет правку к комнате и рассылает её. Возвращает
+// применённое событие с новой версией и ответ отправителю (ack или nack).
+func (h *Hub) commitEdit(event domain.Event) (domain.Event, domain.Event) {
+	room, err := h.rooms.Get(event.RoomID)
+	if err != nil {
+		return event, nack(event, "room_not_found", ErrRoomNotFound.Error())
+	}
+
+	previous := room.Content
+	var computed map[string]map[string]string
+	switch event.Type {
+	case domain.EventTextUpdate:
+		event.Version = room.Version
+		text, version := h.collab.ApplyTextUpdate(room.Content, event)
+		if version == 0 {
+			return event, nack(event, "invalid_payload", "text_update requires a text field")
+		}
+		room.Content = text
+		room.Version = version
+
+	case domain.EventCellUpdate:
+		if room.Type != domain.RoomTypeTable {
+			return event, nack(event, "wrong_room_type", "cell_update is only allowed in table rooms")
+		}
+		payload, err := h.collab.CheckCellUpdate(room, event, h.participant(room.ID))
+		if err != nil {
+			return event, sheetNack(event, err)
+		}
+		event.Payload = payload
+		sheet, _, err := collaboration.FindSheet(room, payload.SheetID)
+		if err != nil {
+			return event, sheetNack(event, err)
+		}
+		before := domain.CellUpdatePayload{SheetID: sheet.ID, Cell: payload.Cell, Value: sheet.Cells[payload.Cell]}
+		if payload, err = h.collab.ApplyCellUpdate(room, event); err != nil {
+			return event, sheetNack(event, err)
+		}
+
+		// Правила столбцов проверяются и по результатам формул: правка,
+		// после которой формула их нарушает, откатывается
+		computed = collaboration.RecalculateCell(room, payload.SheetID, payload.Cell)
+		if err := collaboration.CheckComputed(room, computed); err != nil {
+			h.collab.ApplyCellUpdate(room, domain.Event{Payload: before})
+			collaboration.RecalculateCell(room, payload.SheetID, payload.Cell)
+			return event, sheetNack(event, err)
+		}
+		event.Payload = payload
+		room.Version++
+
+	case domain.EventSheetAdd, domain.EventSheetRename, domain.EventSheetMove,
+		domain.EventSheetDuplicate, domain.EventSheetDelete, domain.EventColumnUpdate:
+		if room.Type != domain.RoomTypeTable {
+			return event, nack(event, "wrong_room_type", string(event.Type)+" is only allowed in table rooms")
+		}
+		payload, err := h.collab.ApplySheetEdit(room, event)
+		if err != nil {
+			return event, sheetNack(event, err)
+		}
+		event.Payload = payload
+		room.Version++
+
+	default:
+		room.Version++
+	}
+
+	if collaboration.IsSheetEdit(event.Type) {
+		computed = collaboration.Recalculate(room)
+	}
+
+	h.rooms.Save(room)
+	h.recordVersion(room)
+
+	event.Version = room.Version
+	h.handleBroadcast(event)
+	h.accept(event)
+
+	if collaboration.IsSheetEdit(event.Type) {
+		h.sheetChanged(room, event)
+	}
+	if len(computed) > 0 {
+		h.broadcastComputed(room, computed)
+	}
+	if room.Type == domain.RoomTypeTable {
+		h.refreshViews(room, changedSheets(event, computed))
+	}
+
+	if room.Content != previous {
+		h.shiftComments(room, previous)
+		h.shiftLocks(room, previous)
+	}
+
+	return event, domain.Event{
+		Type:      domain.EventAck,
+		RoomID:    event.RoomID,
+		Timestamp: time.Now().UnixMilli(),
+		Version:   room.Version,
+		Payload:   domain.AckPayload{OpID: event.OpID, Version: room.Version},
+	}
+}
+
+// final сообщает, что ответ на повтор того же op_id не изменится. Nack из-за
+// блокировки, режима только для чтения, мьюта или плагина временный: после
+// снятия причины повтор с тем же op_id должен пройти.
+func final(reply domain.Event) bool {
+	if reply.Type != domain.EventNack {
+		return true
+	}
+	switch reply.Payload.(domain.NackPayload).Code {
+	case "invalid_payload", "wrong_room_type":
+		return true
+	}
+	return false
+}
+
+func nack(event domain.Event, code, reason string) domain.Event {
+	return domain.Event{
+		Type:      domain.EventNack,
+		RoomID:    event.RoomID,
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   domain.NackPayload{OpID: event.OpID, Code: code, Reason: reason},
+	}
+}
+
+func (h *Hub) reply(client *Client, event domain.Event) {
+	client.send.push(event)
+}
+
+func (h *Hub) sendError(client *Client, code, message string) {
+	event := domain.Event{
+		Type:      domain.EventError,
+		RoomID:    client.RoomID,
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   domain.ErrorPayload{Code: code, Message: message},
+	}
+
+	if h.clients[client.ID] == client {
+		h.deliver(client, event)
+		return
+	}
+	h.reply(client, event)
+}
+
+func (s *session) rememberOp(opID string, reply domain.Event) {
+	if len(s.opOrder) == maxTrackedOps {
+		delete(s.ops, s.opOrder[0])
+		s.opOrder = s.opOrder[1:]
+	}
+	s.ops[opID] = reply
+	s.opOrder = append(s.opOrder, opID)
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/logging"
+	"table_collab/internal/service/webhook"
+	"table_collab/internal/storage/file"
+)
+
+var ErrEventLogDisabled = errors.New("event log is disabled")
+
+// appendLog дописывает принятое событие в журнал комнаты. Состояние в памяти
+// к этому моменту уже изменено, поэтому ошибка записи только логируется:
+// комната сохранится снапшотом при остановке.
+//
+// Комната, созданная входом клиента, попадает в журнал вместе с первым
+// принятым событием: заход на /ws/<любой id> не оставляет файлов на диске.
+func (h *Hub) appendLog(event domain.Event) {
+	if created, ok := h.pristine[event.RoomID]; ok {
+		delete(h.pristine, event.RoomID)
+		if event.Type == domain.EventRoomClosed {
+			return
+		}
+		h.appendLog(created)
+	}
+	if h.eventLog == nil {
+		return
+	}
+
+	// Seq, OpID и трасса относятся к доставке конкретному клиенту, в журнале они не нужны
+	event.Seq = 0
+	event.OpID = ""
+	event.TraceParent, event.TraceState = "", ""
+	if _, err := h.eventLog.Append(event.RoomID, event); err != nil {
+		slog.Error("Failed to append to event log", logging.KeyRoom, event.RoomID, logging.KeyEvent, event.Type, logging.Err(err))
+	}
+}
+
+// logRoomCreated записывает начальное состояние комнаты, с которого начнётся
+// воспроизведение.
+func (h *Hub) logRoomCreated(room *domain.Room) {
+	h.accept(roomCreated(room))
+}
+
+func roomCreated(room *domain.Room) domain.Event {
+	copied := *room
+	copied.ClientCount = 0
+
+	return domain.Event{
+		Type:      domain.EventRoomCreated,
+		RoomID:    room.ID,
+		Timestamp: time.Now().UnixMilli(),
+		Version:   room.Version,
+		Payload:   domain.RoomCreatedPayload{Room: &copied},
+	}
+}
+
+// dropPristine удаляет опустевшую комнату, в которой так ничего и не
+// изменилось. Комнаты со ссылками share остаются: ссылку выдал администратор.
+func (h *Hub) dropPristine(roomID string) {
+	if _, ok := h.pristine[roomID]; !ok || h.audiences[roomID] != nil {
+		return
+	}
+	for _, link := range h.shares {
+		if link.RoomID == roomID {
+			return
+		}
+	}
+
+	delete(h.pristine, roomID)
+	h.rooms.Delete(roomID)
+	h.plugins.Forget(roomID)
+	h.dropRoomLocks(roomID)
+	delete(h.history, roomID)
+	h.search.RemoveRoom(roomID)
+
+	slog.Debug("Empty room dropped", logging.KeyRoom, roomID)
+	h.webhooks.Publish(webhook.EventRoomClosed, roomID, webhook.RoomClosedData{Reason: "room is empty"})
+}
+
+// replayLog восстанавливает комнаты из журнала: последний снапшот каждой
+// комнаты плюс записи после него. Вызывается из NewHub до запуска Run.
+func (h *Hub) replayLog() {
+	rooms, err := h.eventLog.Rooms()
+	if err != nil {
+		slog.Error("Failed to list event logs", logging.Err(err))
+		return
+	}
+
+	restored := 0
+	for _, roomID := range rooms {
+		room, offset, err := h.eventLog.Rebuild(roomID, 0, h.collab.Replay)
+		if err != nil {
+			slog.Error("Failed to replay event log", logging.KeyRoom, roomID, logging.Err(err))
+			continue
+		}
+		if room == nil {
+			continue
+		}
+
+		room.ClientCount = 0
+		h.rooms.Save(room)
+		h.recordVersion(room)
+		h.search.PutRoom(room)
+		if err := h.indexLoggedChat(roomID); err != nil {
+			slog.Error("Failed to index chat from event log", logging.KeyRoom, roomID, logging.Err(err))
+		}
+		restored++
+		slog.Debug("Room replayed", logging.KeyRoom, roomID, "offset", offset, "version", room.Version)
+	}
+
+	if restored > 0 {
+		slog.Info("Restored rooms from event log", "count", restored)
+	}
+}
+
+// compactLog снимает снапшоты комнат, набравших порог записей (force — всех с
+// новыми записями), и обрезает их журналы. Вызывается из Run: снапшот должен
+// соответствовать ровно тому смещению, на котором он записан.
+func (h *Hub) compactLog(force bool) {
+	rooms, err := h.eventLog.Rooms()
+	if err != nil {
+		slog.Error("Failed to list event logs", logging.Err(err))
+		return
+	}
+
+	for _, roomID := range rooms {
+		pending, err := h.eventLog.Pending(roomID)
+		if err != nil {
+			slog.Error("Failed to read event log", logging.KeyRoom, roomID, logging.Err(err))
+			continue
+		}
+		if pending == 0 || (!force && pending < uint64(h.config.EventLog.CompactThreshold)) {
+			continue
+		}
+
+		if err := h.compactRoomLog(roomID); err != nil {
+			slog.Error("Event log compaction failed", logging.KeyRoom, roomID, logging.Err(err))
+		}
+	}
+}
+
+func (h *Hub) compactRoomLog(roomID string) error {
+	head, err := h.eventLog.Head(roomID)
+	if err != nil {
+		return err
+	}
+
+	snapshot := file.RoomSnapshot{Offset: head, Time: time.Now().UTC()}
+	if room, err := h.rooms.Get(roomID); err == nil {
+		copied := *room
+		copied.ClientCount = 0
+		snapshot.Room = &copied
+	}
+
+	if err := h.eventLog.SaveSnapshot(roomID, snapshot); err != nil {
+		return err
+	}
+	return h.eventLog.Compact(roomID, h.config.EventLog.KeepSnapshots, h.retainChat)
+}
+
+// retainChat сохраняет при компакции последние сообщения чата: в снапшот они
+// не попадают, а поисковый индекс восстанавливает их из журнала.
+func (h *Hub) retainChat(dropped []file.LogEntry) []file.LogEntry {
+	var chat []file.LogEntry
+	for _, entry := range dropped {
+		if entry.Event.Type == domain.EventChatMessage {
+			chat = append(chat, entry)
+		}
+	}
+	if limit := h.config.App.SearchChatHistory; limit > 0 && len(chat) > limit {
+		chat = chat[len(chat)-limit:]
+	}
+	return chat
+}
+
+// RoomLog возвращает до limit записей журнала комнаты начиная со смещения from.
+func (h *Hub) RoomLog(roomID string, from uint64, limit int) ([]file.LogEntry, error) {
+	if h.eventLog == nil {
+		return nil, ErrEventLogDisabled
+	}
+	return h.eventLog.Entries(roomID, from, limit)
+}
+
+// RebuildRoom пересобирает состояние комнаты на смещении offset (0 — текущее)
+// из журнала, не трогая живую комнату. Нужна для отладки.
+func (h *Hub) RebuildRoom(roomID string, offset uint64) (*domain.Room, uint64, error) {
+	if h.eventLog == nil {
+		return nil, 0, ErrEventLogDisabled
+	}
+	return h.eventLog.Rebuild(roomID, offset, h.collab.Replay)
+}
+
+// CompactRoomLog снимает снапшот комнаты и обрезает её журнал вне расписания.
+func (h *Hub) CompactRoomLog(roomID string) error {
+	if h.eventLog == nil {
+		return ErrEventLogDisabled
+	}
+
+	var result error
+	err := h.do(func() {
+		head, err := h.eventLog.Head(roomID)
+		if err == nil && head == 0 {
+			err = file.ErrLogNotFound
+		}
+		if err != nil {
+			result = err
+			return
+		}
+		result = h.compactRoomLog(roomID)
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
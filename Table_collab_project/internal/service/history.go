@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/service/collaboration"
+)
+
+const defaultHistorySize = 100
+
+var ErrVersionNotAvailable = errors.New("version is not available")
+
+// roomHistory хранит последние версии содержимого комнаты для форков.
+// Доступ только из Hub.Run.
+type roomHistory struct {
+	versions []domain.RoomVersion
+	limit    int
+}
+
+func (r *roomHistory) record(room *domain.Room) {
+	if n := len(r.versions); n > 0 && r.versions[n-1].Version == room.Version {
+		r.versions = r.versions[:n-1]
+	}
+	if len(r.versions) == r.limit {
+		copy(r.versions, r.versions[1:])
+		r.versions = r.versions[:len(r.versions)-1]
+	}
+
+	r.versions = append(r.versions, domain.RoomVersion{
+		Version:   room.Version,
+		Content:   room.Content,
+		TableData: collaboration.CloneTable(room.TableData),
+		Sheets:    collaboration.CloneSheets(room.Sheets),
+		At:        time.Now(),
+	})
+}
+
+// get и all безопасны для nil: у комнаты может ещё не быть истории.
+func (r *roomHistory) get(version int) (domain.RoomVersion, bool) {
+	for _, v := range r.all() {
+		if v.Version == version {
+			return v, true
+		}
+	}
+	return domain.RoomVersion{}, false
+}
+
+func (r *roomHistory) all() []domain.RoomVersion {
+	if r == nil {
+		return nil
+	}
+	return r.versions
+}
+
+// recordVersion запоминает текущее состояние комнаты после изменения.
+func (h *Hub) recordVersion(room *domain.Room) {
+	history, ok := h.history[room.ID]
+	if !ok {
+		limit := h.config.App.HistorySize
+		if limit <= 0 {
+			limit = defaultHistorySize
+		}
+		history = &roomHistory{limit: limit}
+		h.history[room.ID] = history
+	}
+	history.record(room)
+}
+
+// RoomVersions возвращает доступные версии комнаты без содержимого, от старых к новым.
+func (h *Hub) RoomVersions(roomID string) ([]domain.RoomVersion, error) {
+	var versions []domain.RoomVersion
+	var result error
+	err := h.do(func() {
+		if _, err := h.rooms.Get(roomID); err != nil {
+			result = ErrRoomNotFound
+			return
+		}
+		for _, v := range h.history[roomID].all() {
+			versions = append(versions, domain.RoomVersion{Version: v.Version, At: v.At})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, result
+}
+
+// RoomVersion возвращает содержимое комнаты на указанной версии.
+func (h *Hub) RoomVersion(roomID string, version int) (domain.RoomVersion, error) {
+	var found domain.RoomVersion
+	var result error
+	err := h.do(func() {
+		found, result = h.roomVersion(roomID, version)
+	})
+	if err != nil {
+		return found, err
+	}
+	return found, result
+}
+
+func (h *Hub) roomVersion(roomID string, version int) (domain.RoomVersion, error) {
+	room, err := h.rooms.Get(roomID)
+	if err != nil {
+		return domain.RoomVersion{}, ErrRoomNotFound
+	}
+	if version == room.Version {
+		return domain.RoomVersion{
+			Version:   room.Version,
+			Content:   room.Content,
+			TableData: collaboration.CloneTable(room.TableData),
+			Sheets:    collaboration.CloneSheets(room.Sheets),
+			At:        room.UpdatedAt,
+		}, nil
+	}
+
+	v, ok := h.history[roomID].get(version)
+	if !ok {
+		return domain.RoomVersion{}, ErrVersionNotAvailable
+	}
+	v.TableData = collaboration.CloneTable(v.TableData)
+	v.Sheets = collaboration.CloneSheets(v.Sheets)
+	return v, nil
+}
@@ -1,52 +1,175 @@
 package service
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
 	"table_collab/cmd/server/config"
 	"table_collab/internal/domain"
+	"table_collab/internal/logging"
+	"table_collab/internal/service/attachment"
+	"table_collab/internal/service/collaboration"
+	"table_collab/internal/service/plugin"
+	"table_collab/internal/service/search"
+	"table_collab/internal/service/webhook"
+	"table_collab/internal/storage/file"
 	"table_collab/internal/storage/memory"
+	"table_collab/internal/tracing"
 )
 
+var ErrHubStopped = errors.New("hub stopped")
+
+type hubAction func()
+
 type Hub struct {
-	rooms      *memory.RoomStore
-	clients    map[string]*Client
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan domain.Event
-	shutdown   chan struct{}
-	mu         sync.RWMutex
-	config     *config.Config
+	rooms     *memory.RoomStore
+	clients   map[string]*Client
+	sessions  map[string]*session
+	broadcast chan domain.Event
+	incoming  chan clientEvent
+	actions   chan hubAction
+	shutdown  chan struct{}
+	stopped   chan struct{}
+	stopOnce  sync.Once
+	closing   chan struct{}
+	gate      sync.RWMutex
+	mu        sync.RWMutex
+	config    *config.Config
+	collab    *collaboration.Service
+	snapshots *file.SnapshotStore
+	webhooks  *webhook.Dispatcher
+	plugins   *plugin.Host
+	search    *search.Index
+	locks     map[string]map[string]*heldLock
+	history   map[string]*roomHistory
+	templates map[string]*domain.RoomTemplate
+	shares    map[string]*domain.ShareLink
+	// Комнаты, созданные входом клиента и ещё не изменённые: их room_created
+	// ждёт первого принятого события, до него журнал комнаты не заводится
+	pristine map[string]domain.Event
+	// Зрители по ссылкам share, по комнатам; в clients их нет
+	audiences map[string]*audience
+	cursorLog *logging.Sampler
+	tracer    trace.Tracer
+	// Контекст спана события, которое сейчас обрабатывает Run; nil вне обработки
+	traceCtx context.Context
+
+	templateStore *file.TemplateStore
+	shareStore    *file.ShareStore
+	blobs         attachment.Store
+	eventLog      *file.EventLog
+
+	// Идёт ли очистка хранилища вложений, запущенная по таймеру
+	sweeping atomic.Bool
 }
 
 func NewHub(cfg *config.Config) *Hub {
-	return &Hub{
-		rooms:      memory.NewRoomStore(),
-		clients:    make(map[string]*Client),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		broadcast:  make(chan domain.Event, 1000),
-		shutdown:   make(chan struct{}),
-		config:     cfg,
+	h := &Hub{
+		rooms:     memory.NewRoomStore(),
+		clients:   make(map[string]*Client),
+		sessions:  make(map[string]*session),
+		locks:     make(map[string]map[string]*heldLock),
+		history:   make(map[string]*roomHistory),
+		templates: make(map[string]*domain.RoomTemplate),
+		shares:    make(map[string]*domain.ShareLink),
+		pristine:  make(map[string]domain.Event),
+		audiences: make(map[string]*audience),
+		broadcast: make(chan domain.Event, 1000),
+		incoming:  make(chan clientEvent, 1000),
+		actions:   make(chan hubAction),
+		shutdown:  make(chan struct{}),
+		closing:   make(chan struct{}),
+		stopped:   make(chan struct{}),
+		config:    cfg,
+		collab:    collaboration.NewService(),
+		webhooks:  webhook.NewDispatcher(cfg.Webhook),
+		plugins:   plugin.NewHost(cfg.Plugins),
+		search:    search.NewIndex(cfg.App.SearchChatHistory),
+		cursorLog: logging.NewSampler(cfg.Server.LogCursorSample),
+		tracer:    tracing.Tracer(),
+	}
+	h.plugins.Usernames = h.username
+
+	// Журнал — основной источник состояния; снапшот rooms.json досоздаёт
+	// комнаты, которых в журнале ещё нет (данные до включения журнала)
+	if cfg.EventLog.Dir != "" {
+		h.eventLog = file.NewEventLog(cfg.EventLog.Dir, cfg.EventLog.Sync)
+		h.replayLog()
+	}
+	if cfg.App.SnapshotPath != "" {
+		h.snapshots = file.NewSnapshotStore(cfg.App.SnapshotPath)
+		h.restore()
+	}
+	if cfg.App.TemplatePath != "" {
+		h.templateStore = file.NewTemplateStore(cfg.App.TemplatePath)
+		h.loadTemplates()
+	}
+	if cfg.App.SharePath != "" {
+		h.shareStore = file.NewShareStore(cfg.App.SharePath)
+		h.loadShares()
+	}
+	if cfg.Uploads.Dir != "" {
+		h.blobs = file.NewBlobStore(cfg.Uploads.Dir)
 	}
+
+	return h
 }
 
 func (h *Hub) Run() {
-	log.Println("Hub started")
+	slog.Info("Hub started")
+	defer close(h.stopped)
 
-	for {
-		select {
-		case client := <-h.register:
-			h.handleRegister(client)
+	h.webhooks.Start()
+
+	var pluginTick <-chan time.Time
+	if h.plugins.Active() && h.config.Plugins.TickInterval > 0 {
+		ticker := time.NewTicker(time.Duration(h.config.Plugins.TickInterval) * time.Second)
+		defer ticker.Stop()
+		pluginTick = ticker.C
+	}
 
-		case client := <-h.unregister:
-			h.handleUnregister(client)
+	var compactTick <-chan time.Time
+	if h.eventLog != nil && h.config.EventLog.CompactInterval > 0 {
+		ticker := time.NewTicker(time.Duration(h.config.EventLog.CompactInterval) * time.Second)
+		defer ticker.Stop()
+		compactTick = ticker.C
+	}
+
+	var cleanupTick <-chan time.Time
+	if h.blobs != nil && h.config.Uploads.CleanupInterval > 0 {
+		ticker := time.NewTicker(time.Duration(h.config.Uploads.CleanupInterval) * time.Second)
+		defer ticker.Stop()
+		cleanupTick = ticker.C
+	}
 
+	for {
+		select {
 		case event := <-h.broadcast:
 			h.handleBroadcast(event)
 
+		case in := <-h.incoming:
+			h.handleIncoming(in)
+
+		case action := <-h.actions:
+			action()
+
+		case now := <-pluginTick:
+			h.handlePluginTick(now)
+
+		case <-compactTick:
+			h.compactLog(false)
+
+		case <-cleanupTick:
+			h.cleanupTick()
+
 		case <-h.shutdown:
 			h.handleShutdown()
 			return
@@ -54,33 +177,73 @@ func (h *Hub) Run() {
 	}
 }
 
-func (h *Hub) handleRegister(client *Client) {
+// handleRegister вводит клиента в комнату по join_room. Тип из payload
+// учитывается, только если комната создаётся этим входом.
+func (h *Hub) handleRegister(client *Client, payload domain.JoinRoomPayload) {
+	// Повторный join от уже зарегистрированного клиента (например, после resume)
+	if h.clients[client.ID] == client {
+		return
+	}
+	if payload.Username != "" {
+		client.Username = payload.Username
+	}
+
+	room, err := h.rooms.Get(client.RoomID)
+	if err != nil && h.config.App.MaxRooms > 0 && h.rooms.Count() >= h.config.App.MaxRooms {
+		client.logger().Warn("Join rejected", logging.Err(ErrTooManyRooms))
+		go client.CloseWithReason(websocket.ClosePolicyViolation, ErrTooManyRooms.Error())
+		return
+	}
+
 	h.mu.Lock()
 	h.clients[client.ID] = client
 	h.mu.Unlock()
 
-	room, err := h.rooms.Get(client.RoomID)
 	if err != nil {
+		roomType := domain.RoomTypeDocument
+		switch payload.RoomType {
+		case domain.RoomTypeWhiteboard, domain.RoomTypeTable:
+			roomType = payload.RoomType
+		}
+
 		room = &domain.Room{
 			ID:          client.RoomID,
 			Name:        client.RoomID,
-			Type:        domain.RoomTypeDocument,
+			Type:        roomType,
 			CreatedAt:   time.Now(),
 			UpdatedAt:   time.Now(),
 			IsActive:    true,
 			MaxClients:  h.config.App.MaxClientsPerRoom,
 			ClientCount: 1,
 		}
+		collaboration.EnsureSheets(room)
 		h.rooms.Save(room)
+		h.recordVersion(room)
+		created := roomCreated(room)
+		h.pristine[room.ID] = created
+		h.indexEvent(created)
+
+		h.webhooks.Publish(webhook.EventRoomCreated, room.ID, webhook.RoomData{
+			Name:      room.Name,
+			Type:      room.Type,
+			CreatedBy: client.ID,
+		})
 	} else {
 		room.ClientCount++
 		h.rooms.Save(room)
 	}
 
-	log.Printf("Client %s joined room %s", client.ID, client.RoomID)
+	client.send.setPolicy(h.slowConsumerPolicy(room.Type))
 
-	// Уведомляем других
-	h.broadcast <- domain.Event{
+	client.logger().Info("Client joined room", "username", client.Username)
+	h.webhooks.Publish(webhook.EventUserJoined, client.RoomID, client.webhookData())
+
+	h.startSession(client)
+	h.sendSync(client, room)
+
+	// Уведомляем других прямо отсюда: Run — единственный читатель h.broadcast,
+	// и отправка в канал из него самого заблокирует hub при полном буфере
+	joined := domain.Event{
 		Type:      domain.EventJoinRoom,
 		RoomID:    client.RoomID,
 		UserID:    client.ID,
@@ -90,9 +253,35 @@ func (h *Hub) handleRegister(client *Client) {
 			Color:    client.Color,
 		},
 	}
+	h.handleBroadcast(joined)
+	h.runAfter(joined)
 }
 
 func (h *Hub) handleUnregister(client *Client) {
+	// Клиент не входил в комнату или его сессию уже подхватило новое соединение
+	if h.clients[client.ID] != client {
+		return
+	}
+
+	// Блокировки не ждут возврата клиента: другие не должны простаивать
+	h.releaseClientLocks(client, domain.LockReasonDisconnected)
+
+	if client.resumable && client.session != nil && h.config.WebSocket.ResumeGracePeriod > 0 {
+		h.detach(client)
+		return
+	}
+
+	h.removeClient(client)
+}
+
+func (h *Hub) removeClient(client *Client) {
+	if s := client.session; s != nil {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		delete(h.sessions, s.token)
+	}
+
 	h.mu.Lock()
 	delete(h.clients, client.ID)
 	h.mu.Unlock()
@@ -102,17 +291,75 @@ func (h *Hub) handleUnregister(client *Client) {
 		if room.ClientCount < 0 {
 			room.ClientCount = 0
 		}
+		h.dropPrivateViews(room, client)
 		h.rooms.Save(room)
+		if room.ClientCount == 0 {
+			h.dropPristine(room.ID)
+		}
 	}
 
-	log.Printf("Client %s left room %s", client.ID, client.RoomID)
+	client.logger().Info("Client left room")
+	h.webhooks.Publish(webhook.EventUserLeft, client.RoomID, client.webhookData())
 
-	h.broadcast <- domain.Event{
+	left := domain.Event{
 		Type:      domain.EventLeaveRoom,
 		RoomID:    client.RoomID,
 		UserID:    client.ID,
 		Timestamp: time.Now().UnixMilli(),
 	}
+	h.handleBroadcast(left)
+	h.runAfter(left)
+}
+
+// sendSync отправляет подключившемуся клиенту текущее состояние комнаты.
+func (h *Hub) sendSync(client *Client, room *domain.Room) {
+	participants := make([]domain.Participant, 0)
+	for _, other := range h.clients {
+		if other.RoomID == room.ID {
+			participants = append(participants, domain.Participant{
+				ID:       other.ID,
+				Username: other.Username,
+				Color:    other.Color,
+				Sheet:    other.sheet,
+			})
+		}
+	}
+
+	h.deliver(client, domain.Event{
+		Type:      domain.EventSync,
+		RoomID:    room.ID,
+		Timestamp: time.Now().UnixMilli(),
+		Version:   room.Version,
+		Payload: domain.SyncPayload{
+			Name:         room.Name,
+			Type:         room.Type,
+			Content:      room.Content,
+			Table:        room.TableData,
+			Sheets:       collaboration.CloneSheets(room.Sheets),
+			Version:      room.Version,
+			ReadOnly:     room.ReadOnly,
+			Participants: participants,
+			Comments:     cloneThreads(room.Comments),
+			Views:        visibleViews(room, client.ID),
+			Attachments:  cloneAttachments(room.Attachments),
+			Locks:        h.roomLocks(room.ID),
+			Origin:       room.Origin,
+		},
+	})
+}
+
+func (h *Hub) slowConsumerPolicy(roomType domain.RoomType) SlowConsumerPolicy {
+	value, ok := h.config.WebSocket.SlowConsumerPolicies[string(roomType)]
+	if !ok {
+		return PolicyDisconnect
+	}
+
+	policy, err := ParseSlowConsumerPolicy(value)
+	if err != nil {
+		slog.Warn("Invalid slow consumer policy", "room_type", roomType, "fallback", PolicyDisconnect, logging.Err(err))
+		return PolicyDisconnect
+	}
+	return policy
 }
 
 func (h *Hub) handleBroadcast(event domain.Event) {
@@ -121,30 +368,88 @@ func (h *Hub) handleBroadcast(event domain.Event) {
 
 	for _, client := range h.clients {
 		if client.RoomID == event.RoomID && client.ID != event.UserID {
-			select {
-			case client.send <- event:
-			default:
-				go client.Close()
-			}
+			h.deliver(client, event)
 		}
 	}
+	h.showSpectators(event)
 }
 
-func (h *Hub) handleShutdown() {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+// deliver ставит событие в очередь клиента, присваивая ему порядковый номер сессии.
+func (h *Hub) deliver(client *Client, event domain.Event) {
+	if h.traceCtx != nil {
+		h.traceDelivery(&event)
+	}
 
-	for _, client := range h.clients {
-		client.Close()
+	if s := client.session; s != nil {
+		s.nextSeq++
+		event.Seq = s.nextSeq
+		s.record(event)
+		if s.detached {
+			return
+		}
+	}
+
+	if !client.send.push(event) {
+		client.logger().Warn("Client is too slow, disconnecting", "queued", client.send.len())
+		go client.CloseWithReason(CloseTooSlow, "too slow, resync")
+	}
+}
+
+// traceDelivery связывает исходящее событие со спаном обрабатываемого события:
+// получатель продолжит ту же трассу. Отказ автору помечает спан ошибкой.
+func (h *Hub) traceDelivery(event *domain.Event) {
+	if event.TraceParent == "" {
+		tracing.Inject(h.traceCtx, event)
+	}
+	if event.Type == domain.EventNack || event.Type == domain.EventError {
+		trace.SpanFromContext(h.traceCtx).SetStatus(codes.Error, "rejected")
 	}
+}
 
-	close(h.register)
-	close(h.unregister)
-	close(h.broadcast)
+// do выполняет action в горутине Run и ждёт завершения.
+func (h *Hub) do(action hubAction) error {
+	done := make(chan struct{})
+	select {
+	case h.actions <- func() { action(); close(done) }:
+	case <-h.shutdown:
+		return ErrHubStopped
+	}
+	<-done
+	return nil
+}
 
-	log.Println("Hub stopped")
+// Webhooks возвращает диспетчер исходящих webhook-ов.
+func (h *Hub) Webhooks() *webhook.Dispatcher {
+	return h.webhooks
 }
 
+// Stop сначала закрывает closing, чтобы новые submit отказывались, и
+// дожидается тех, что уже отправляют. Всё, что попало в очереди, попало туда
+// до закрытия shutdown, и handleShutdown это обработает.
 func (h *Hub) Stop() {
-	close(h.shutdown)
+	h.stopOnce.Do(func() {
+		close(h.closing)
+		h.gate.Lock()
+		close(h.shutdown)
+		h.gate.Unlock()
+	})
+}
+
+// submit передаёт значение в канал hub. После начала остановки значение не
+// принимается, и submit возвращает false.
+func submit[T any](h *Hub, ch chan<- T, value T) bool {
+	h.gate.RLock()
+	defer h.gate.RUnlock()
+
+	select {
+	case <-h.closing:
+		return false
+	default:
+	}
+	select {
+	case ch <- value:
+		return true
+	case <-h.closing:
+		return false
+	}
 }
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+// fakeTransport — транспорт в памяти: in — события от клиента, out — к клиенту.
+type fakeTransport struct {
+	in     chan domain.Event
+	out    chan domain.Event
+	closes atomic.Int32
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newFakeTransport() *fakeTransport {
+	return &fakeTransport{
+		in:   make(chan domain.Event, 16),
+		out:  make(chan domain.Event, 1024),
+		done: make(chan struct{}),
+	}
+}
+
+func (t *fakeTransport) Name() string       { return "fake" }
+func (t *fakeTransport) RemoteAddr() string { return "fake:0" }
+func (t *fakeTransport) Ping() error        { return nil }
+
+func (t *fakeTransport) ReadEvent() (domain.Event, error) {
+	select {
+	case event := <-t.in:
+		return event, nil
+	case <-t.done:
+		return domain.Event{}, ErrTransportClosed
+	}
+}
+
+func (t *fakeTransport) WriteEvent(event domain.Event) error {
+	select {
+	case t.out <- event:
+		return nil
+	case <-t.done:
+		return ErrTransportClosed
+	}
+}
+
+func (t *fakeTransport) Close(code int, reason string) error {
+	t.closes.Add(1)
+	t.once.Do(func() { close(t.done) })
+	return nil
+}
+
+func (t *fakeTransport) expect(tb testing.TB, eventType domain.EventType) domain.Event {
+	tb.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event := <-t.out:
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			tb.Fatalf("no %s event", eventType)
+		}
+	}
+}
+
+func testHubConfig() *config.Config {
+	return &config.Config{
+		WebSocket: config.WebSocketConfig{
+			PingPeriod:         60,
+			ResumeBufferSize:   16,
+			SendBufferSize:     16,
+			OverflowBufferSize: 16,
+		},
+	}
+}
+
+func TestClientCloseIsIdempotent(t *testing.T) {
+	transport := newFakeTransport()
+	client := NewClient(transport, NewHub(testHubConfig()), "room")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() { defer wg.Done(); client.Close() }()
+		go func() { defer wg.Done(); client.CloseWithReason(CloseTooSlow, "too slow") }()
+	}
+	wg.Wait()
+
+	if n := transport.closes.Load(); n != 1 {
+		t.Fatalf("transport closed %d times, want 1", n)
+	}
+	if !client.isClosed() {
+		t.Fatal("client is not marked closed")
+	}
+}
+
+// Уведомление о входе не должно идти через h.broadcast: Run — его единственный
+// читатель, и при полном буфере hub заблокировал бы сам себя.
+func TestRegisterWithFullBroadcastQueue(t *testing.T) {
+	h := NewHub(testHubConfig())
+	for len(h.broadcast) < cap(h.broadcast) {
+		h.broadcast <- domain.Event{Type: domain.EventChatMessage, RoomID: "elsewhere"}
+	}
+
+	go h.Run()
+	defer h.Stop()
+
+	first := newFakeTransport()
+	h.Connect(context.Background(), first, "room", "", 0)
+	first.in <- domain.Event{Type: domain.EventJoinRoom}
+	first.expect(t, domain.EventSync)
+
+	second := newFakeTransport()
+	h.Connect(context.Background(), second, "room", "", 0)
+	second.in <- domain.Event{Type: domain.EventJoinRoom}
+	second.expect(t, domain.EventSync)
+
+	first.expect(t, domain.EventJoinRoom)
+
+	second.Close(0, "")
+	first.expect(t, domain.EventLeaveRoom)
+	first.Close(0, "")
+}
+
+// Правка, пришедшая после начала остановки, не должна молча пропасть в очереди,
+// которую уже никто не прочитает: отправитель получает nack.
+func TestEditAfterStopIsNacked(t *testing.T) {
+	h := NewHub(testHubConfig())
+	go h.Run()
+
+	transport := newFakeTransport()
+	h.Connect(context.Background(), transport, "room", "", 0)
+	transport.in <- domain.Event{Type: domain.EventJoinRoom}
+	transport.expect(t, domain.EventSync)
+
+	h.Stop()
+	<-h.stopped
+
+	transport.in <- domain.Event{Type: domain.EventTextUpdate, OpID: "op-1", Payload: domain.TextUpdatePayload{Text: "late"}}
+	reply := transport.expect(t, domain.EventNack)
+	if payload := reply.Payload.(domain.NackPayload); payload.OpID != "op-1" || payload.Code != "shutting_down" {
+		t.Fatalf("got %+v", payload)
+	}
+	transport.Close(0, "")
+}
+
+// Отправитель, ждущий места в полной очереди, не мешает остановке.
+func TestStopReleasesBlockedSubmit(t *testing.T) {
+	h := NewHub(testHubConfig())
+	for len(h.incoming) < cap(h.incoming) {
+		h.incoming <- clientEvent{}
+	}
+
+	result := make(chan bool)
+	go func() { result <- submit(h, h.incoming, clientEvent{}) }()
+	time.Sleep(10 * time.Millisecond)
+
+	h.Stop()
+	select {
+	case ok := <-result:
+		if ok {
+			t.Fatal("submit accepted a value after Stop")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("submit is still blocked after Stop")
+	}
+}
+
+// Всё, что hub умеет обработать от клиента, должно проходить ValidateEvent:
+// иначе handleEvent отбросит событие раньше, чем оно дойдёт до Run.
+func TestValidateEventCoversRoutedEvents(t *testing.T) {
+	h := NewHub(testHubConfig())
+	routed := []domain.EventType{domain.EventJoinRoom, domain.EventCursorMove, domain.EventChatMessage, domain.EventSheetView}
+	for _, eventType := range []domain.EventType{
+		domain.EventTextUpdate, domain.EventElementAdd, domain.EventCellUpdate,
+		domain.EventCommentAdd, domain.EventCommentReply, domain.EventCommentResolve,
+		domain.EventLockAcquire, domain.EventLockRelease,
+		domain.EventSheetAdd, domain.EventSheetRename, domain.EventSheetMove,
+		domain.EventSheetDuplicate, domain.EventSheetDelete, domain.EventColumnUpdate,
+		domain.EventViewSave, domain.EventViewDelete,
+	} {
+		if isEdit(eventType) || isComment(eventType) || isLockEvent(eventType) || isViewEvent(eventType) {
+			routed = append(routed, eventType)
+		} else {
+			t.Errorf("%s is not routed by the hub", eventType)
+		}
+	}
+	for _, eventType := range routed {
+		if !h.collab.ValidateEvent(domain.Event{Type: eventType}) {
+			t.Errorf("%s is routed by the hub but rejected by ValidateEvent", eventType)
+		}
+	}
+
+	// Серверные события и выход клиент прислать не может
+	for _, eventType := range []domain.EventType{
+		domain.EventLeaveRoom, domain.EventSync, domain.EventAck, domain.EventSystem,
+		domain.EventLockAcquired, domain.EventViewUpdated, domain.EventAttachmentAdded, domain.EventRoomClosed,
+	} {
+		if h.collab.ValidateEvent(domain.Event{Type: eventType}) {
+			t.Errorf("clients must not send %s", eventType)
+		}
+	}
+}
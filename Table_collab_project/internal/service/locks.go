@@ -0,0 +1,339 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/logging"
+	"table_collab/internal/service/collaboration"
+	"table_collab/pkg/utils"
+)
+
+const (
+	maxLocksPerClient      = 20
+	defaultLockIdleTimeout = 30 * time.Second
+)
+
+var (
+	ErrLocked            = errors.New("region is locked")
+	ErrLockNotFound      = errors.New("lock not found")
+	ErrInvalidLockRegion = errors.New("invalid lock region")
+	ErrTooManyLocks      = errors.New("too many locks held")
+)
+
+// heldLock — блокировка вместе с разобранным диапазоном и таймером простоя.
+// Доступ только из Hub.Run.
+type heldLock struct {
+	domain.Lock
+	roomID  string
+	cells   *collaboration.CellRange
+	expires time.Time
+	timer   *time.Timer
+}
+
+func (l *heldLock) describe() string {
+	if l.cells != nil {
+		return l.Region.Sheet + "!" + l.cells.String()
+	}
+	return fmt.Sprintf("text %d-%d", l.Region.Start, l.Region.End)
+}
+
+func isLockEvent(eventType domain.EventType) bool {
+	return eventType == domain.EventLockAcquire || eventType == domain.EventLockRelease
+}
+
+func (h *Hub) handleLock(client *Client, event domain.Event) {
+	var err error
+	switch event.Type {
+	case domain.EventLockAcquire:
+		err = h.acquireLock(client, event)
+	case domain.EventLockRelease:
+		err = h.releaseOwnLock(client, event)
+	}
+	if err == nil {
+		return
+	}
+
+	code := "invalid_lock"
+	switch {
+	case errors.Is(err, ErrLocked):
+		code = "locked"
+	case errors.Is(err, ErrLockNotFound):
+		code = "lock_not_found"
+	}
+	h.sendError(client, code, err.Error())
+}
+
+func (h *Hub) acquireLock(client *Client, event domain.Event) error {
+	var payload domain.LockAcquirePayload
+	if err := domain.DecodePayload(event, &payload); err != nil {
+		return ErrInvalidLockRegion
+	}
+	room, err := h.rooms.Get(event.RoomID)
+	if err != nil {
+		return ErrRoomNotFound
+	}
+
+	candidate := &heldLock{roomID: room.ID}
+	if err := candidate.setRegion(room, payload.Region); err != nil {
+		return err
+	}
+
+	owned := 0
+	for _, lock := range h.locks[room.ID] {
+		if lock.OwnerID == client.ID {
+			// Повторный запрос той же области продлевает блокировку
+			if lock.Region == candidate.Region {
+				lock.expires = time.Now().Add(h.lockIdleTimeout())
+				h.deliver(client, lockEvent(lock, event.OpID))
+				return nil
+			}
+			owned++
+			continue
+		}
+		if lock.overlaps(candidate) {
+			return fmt.Errorf("%w: %s is being edited by %s", ErrLocked, lock.describe(), lock.Username)
+		}
+	}
+	if owned >= maxLocksPerClient {
+		return ErrTooManyLocks
+	}
+
+	candidate.Lock = domain.Lock{
+		ID:         "lock_" + utils.GenerateID(),
+		OwnerID:    client.ID,
+		Username:   client.Username,
+		Color:      client.Color,
+		Region:     candidate.Region,
+		AcquiredAt: time.Now(),
+	}
+	candidate.expires = candidate.AcquiredAt.Add(h.lockIdleTimeout())
+	candidate.timer = time.AfterFunc(h.lockIdleTimeout(), func() {
+		h.do(func() { h.expireLock(candidate) })
+	})
+
+	if h.locks[room.ID] == nil {
+		h.locks[room.ID] = make(map[string]*heldLock)
+	}
+	h.locks[room.ID][candidate.ID] = candidate
+
+	update := lockEvent(candidate, "")
+	update.UserID = client.ID
+	h.handleBroadcast(update)
+	h.deliver(client, lockEvent(candidate, event.OpID))
+	return nil
+}
+
+func (h *Hub) releaseOwnLock(client *Client, event domain.Event) error {
+	var payload domain.LockReleasePayload
+	domain.DecodePayload(event, &payload)
+
+	lock, ok := h.locks[client.RoomID][payload.LockID]
+	if !ok || lock.OwnerID != client.ID {
+		return ErrLockNotFound
+	}
+
+	h.releaseLock(lock, domain.LockReasonReleased)
+	return nil
+}
+
+// expireLock вызывается таймером: снимает блокировку, если владелец всё это
+// время не проявлял активности, иначе переносит проверку.
+func (h *Hub) expireLock(lock *heldLock) {
+	if h.locks[lock.roomID][lock.ID] != lock {
+		return
+	}
+	if remaining := time.Until(lock.expires); remaining > 0 {
+		lock.timer.Reset(remaining)
+		return
+	}
+
+	slog.Info("Lock expired", logging.KeyRoom, lock.roomID, logging.KeyClient, lock.OwnerID, "lock", lock.ID, "region", lock.describe())
+	h.releaseLock(lock, domain.LockReasonExpired)
+}
+
+func (h *Hub) releaseLock(lock *heldLock, reason string) {
+	lock.timer.Stop()
+	delete(h.locks[lock.roomID], lock.ID)
+	if len(h.locks[lock.roomID]) == 0 {
+		delete(h.locks, lock.roomID)
+	}
+
+	h.handleBroadcast(domain.Event{
+		Type:      domain.EventLockReleased,
+		RoomID:    lock.roomID,
+		Timestamp: time.Now().UnixMilli(),
+		Payload: domain.LockReleasedPayload{
+			LockID:  lock.ID,
+			OwnerID: lock.OwnerID,
+			Reason:  reason,
+		},
+	})
+}
+
+// releaseClientLocks снимает все блокировки клиента, например при отключении.
+func (h *Hub) releaseClientLocks(client *Client, reason string) {
+	for _, lock := range h.locks[client.RoomID] {
+		if lock.OwnerID == client.ID {
+			h.releaseLock(lock, reason)
+		}
+	}
+}
+
+// releaseSheetLocks снимает блокировки диапазонов удалённого листа.
+func (h *Hub) releaseSheetLocks(roomID, sheetID string) {
+	for _, lock := range h.locks[roomID] {
+		if lock.cells != nil && lock.Region.Sheet == sheetID {
+			h.releaseLock(lock, domain.LockReasonSheetDeleted)
+		}
+	}
+}
+
+// dropRoomLocks удаляет блокировки закрытой комнаты без уведомлений.
+func (h *Hub) dropRoomLocks(roomID string) {
+	for _, lock := range h.locks[roomID] {
+		lock.timer.Stop()
+	}
+	delete(h.locks, roomID)
+}
+
+// touchLocks продлевает блокировки клиента после его правки.
+func (h *Hub) touchLocks(client *Client) {
+	expires := time.Now().Add(h.lockIdleTimeout())
+	for _, lock := range h.locks[client.RoomID] {
+		if lock.OwnerID == client.ID {
+			lock.expires = expires
+		}
+	}
+}
+
+// checkLocks отклоняет правку области, заблокированной другим участником.
+func (h *Hub) checkLocks(client *Client, room *domain.Room, event domain.Event) error {
+	locks := h.locks[room.ID]
+	if len(locks) == 0 {
+		return nil
+	}
+
+	switch event.Type {
+	case domain.EventCellUpdate:
+		var payload domain.CellUpdatePayload
+		domain.DecodePayload(event, &payload)
+		col, row, err := collaboration.ParseCell(payload.Cell)
+		if err != nil {
+			return nil
+		}
+		sheet, _, err := collaboration.FindSheet(room, payload.SheetID)
+		if err != nil {
+			return nil
+		}
+		for _, lock := range locks {
+			if lock.OwnerID != client.ID && lock.cells != nil &&
+				lock.Region.Sheet == sheet.ID && lock.cells.Contains(col, row) {
+				return fmt.Errorf("%w: cell %s is being edited by %s",
+					ErrLocked, collaboration.CellName(col, row), lock.Username)
+			}
+		}
+
+	case domain.EventTextUpdate:
+		var payload domain.TextUpdatePayload
+		if domain.DecodePayload(event, &payload) != nil || payload.Text == room.Content {
+			return nil
+		}
+		diff := collaboration.Diff(room.Content, payload.Text)
+		for _, lock := range locks {
+			if lock.OwnerID != client.ID && lock.cells == nil && diff.Touches(lock.Region.Start, lock.Region.End) {
+				return fmt.Errorf("%w: %s is being edited by %s", ErrLocked, lock.describe(), lock.Username)
+			}
+		}
+	}
+	return nil
+}
+
+// shiftLocks переносит текстовые блокировки после правки и сообщает новые позиции.
+func (h *Hub) shiftLocks(room *domain.Room, oldText string) {
+	locks := h.locks[room.ID]
+	if len(locks) == 0 {
+		return
+	}
+
+	diff := collaboration.Diff(oldText, room.Content)
+	for _, lock := range locks {
+		if lock.cells != nil {
+			continue
+		}
+
+		start, end := diff.Shift(lock.Region.Start, lock.Region.End)
+		if start != lock.Region.Start || end != lock.Region.End {
+			lock.Region.Start, lock.Region.End = start, end
+			h.handleBroadcast(lockEvent(lock, ""))
+		}
+	}
+}
+
+// roomLocks возвращает блокировки комнаты для sync в порядке захвата.
+func (h *Hub) roomLocks(roomID string) []domain.Lock {
+	var locks []domain.Lock
+	for _, lock := range h.locks[roomID] {
+		locks = append(locks, lock.Lock)
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].AcquiredAt.Before(locks[j].AcquiredAt) })
+	return locks
+}
+
+func (h *Hub) lockIdleTimeout() time.Duration {
+	if h.config.App.LockIdleTimeout <= 0 {
+		return defaultLockIdleTimeout
+	}
+	return time.Duration(h.config.App.LockIdleTimeout) * time.Second
+}
+
+func (l *heldLock) setRegion(room *domain.Room, region domain.LockRegion) error {
+	if region.Range != "" {
+		if room.Type != domain.RoomTypeTable {
+			return fmt.Errorf("%w: cell ranges can only be locked in table rooms", ErrInvalidLockRegion)
+		}
+		cells, err := collaboration.ParseRange(region.Range)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidLockRegion, err)
+		}
+		sheet, _, err := collaboration.FindSheet(room, region.Sheet)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidLockRegion, err)
+		}
+		l.cells = &cells
+		l.Region = domain.LockRegion{Sheet: sheet.ID, Range: cells.String()}
+		return nil
+	}
+
+	if region.Start < 0 || region.End <= region.Start || region.End > utf8.RuneCountInString(room.Content) {
+		return fmt.Errorf("%w: text range is empty or outside the content", ErrInvalidLockRegion)
+	}
+	l.Region = domain.LockRegion{Start: region.Start, End: region.End}
+	return nil
+}
+
+func (l *heldLock) overlaps(other *heldLock) bool {
+	switch {
+	case l.cells != nil && other.cells != nil:
+		return l.Region.Sheet == other.Region.Sheet && l.cells.Overlaps(*other.cells)
+	case l.cells == nil && other.cells == nil:
+		return l.Region.Start < other.Region.End && other.Region.Start < l.Region.End
+	default:
+		return false
+	}
+}
+
+func lockEvent(lock *heldLock, opID string) domain.Event {
+	return domain.Event{
+		Type:      domain.EventLockAcquired,
+		RoomID:    lock.roomID,
+		Timestamp: time.Now().UnixMilli(),
+		OpID:      opID,
+		Payload:   lock.Lock,
+	}
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/service/webhook"
+
+	"github.com/gorilla/websocket"
+)
+
+// CloseTooSlow — код закрытия для клиента, не успевающего читать: ему нужен полный sync.
+const CloseTooSlow = 4001
+
+var (
+	ErrClientNotFound = errors.New("client not found")
+	ErrRoomNotFound   = errors.New("room not found")
+	ErrMuted          = errors.New("you are muted")
+	ErrRoomReadOnly   = errors.New("room is read-only")
+	ErrTooManyRooms   = errors.New("too many rooms")
+)
+
+// authorize вызывается из Run: проверяет, может ли клиент отправить событие в комнату.
+func (h *Hub) authorize(client *Client, event domain.Event) error {
+	switch event.Type {
+	case domain.EventJoinRoom, domain.EventLeaveRoom:
+		return nil
+	}
+
+	if client.muted && event.Type != domain.EventCursorMove {
+		return ErrMuted
+	}
+
+	if isEdit(event.Type) {
+		if room, err := h.rooms.Get(event.RoomID); err == nil && room.ReadOnly {
+			return ErrRoomReadOnly
+		}
+	}
+
+	return nil
+}
+
+func isEdit(eventType domain.EventType) bool {
+	switch eventType {
+	case domain.EventTextUpdate, domain.EventElementAdd, domain.EventCellUpdate,
+		domain.EventSheetAdd, domain.EventSheetRename, domain.EventSheetMove,
+		domain.EventSheetDuplicate, domain.EventSheetDelete, domain.EventColumnUpdate:
+		return true
+	default:
+		return false
+	}
+}
+
+func (h *Hub) ListRooms() ([]*domain.Room, error) {
+	var rooms []*domain.Room
+	err := h.do(func() {
+		all, _ := h.rooms.GetAll()
+		for _, room := range all {
+			copied := *room
+			copied.Comments = cloneThreads(room.Comments)
+			rooms = append(rooms, &copied)
+		}
+	})
+
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID < rooms[j].ID })
+	return rooms, err
+}
+
+func (h *Hub) ListClients(roomID string) ([]domain.ClientInfo, error) {
+	var clients []domain.ClientInfo
+	err := h.do(func() {
+		for _, client := range h.clients {
+			if roomID == "" || client.RoomID == roomID {
+				clients = append(clients, client.info())
+			}
+		}
+	})
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ConnectedAt.Before(clients[j].ConnectedAt)
+	})
+	return clients, err
+}
+
+func (h *Hub) KickClient(roomID, clientID, reason string) error {
+	var result error
+	err := h.do(func() {
+		client, ok := h.clients[clientID]
+		if !ok || client.RoomID != roomID {
+			result = ErrClientNotFound
+			return
+		}
+		if reason == "" {
+			reason = "kicked by administrator"
+		}
+		go client.CloseWithReason(websocket.ClosePolicyViolation, reason)
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+func (h *Hub) MuteClient(roomID, clientID string, muted bool) error {
+	var result error
+	err := h.do(func() {
+		client, ok := h.clients[clientID]
+		if !ok || client.RoomID != roomID {
+			result = ErrClientNotFound
+			return
+		}
+		client.muted = muted
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+func (h *Hub) BroadcastSystem(roomID, text string) error {
+	var result error
+	err := h.do(func() {
+		if _, err := h.rooms.Get(roomID); err != nil {
+			result = ErrRoomNotFound
+			return
+		}
+		h.handleBroadcast(domain.Event{
+			Type:      domain.EventSystem,
+			RoomID:    roomID,
+			UserID:    domain.SystemUserID,
+			Timestamp: time.Now().UnixMilli(),
+			Payload:   domain.SystemMessagePayload{Text: text},
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+func (h *Hub) SetReadOnly(roomID string, readOnly bool) error {
+	var result error
+	err := h.do(func() {
+		room, err := h.rooms.Get(roomID)
+		if err != nil {
+			result = ErrRoomNotFound
+			return
+		}
+		room.ReadOnly = readOnly
+		h.rooms.Save(room)
+
+		h.accept(domain.Event{
+			Type:      domain.EventRoomUpdated,
+			RoomID:    roomID,
+			Timestamp: time.Now().UnixMilli(),
+			Payload:   domain.RoomUpdatedPayload{ReadOnly: readOnly},
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// CloseRoom отключает всех участников комнаты и удаляет её.
+func (h *Hub) CloseRoom(roomID, reason string) error {
+	var result error
+	err := h.do(func() {
+		if _, err := h.rooms.Get(roomID); err != nil {
+			result = ErrRoomNotFound
+			return
+		}
+		if reason == "" {
+			reason = "room closed by administrator"
+		}
+
+		for _, client := range h.clients {
+			if client.RoomID == roomID {
+				go client.CloseWithReason(websocket.CloseNormalClosure, reason)
+			}
+		}
+		h.closeSpectators(roomID, websocket.CloseNormalClosure, reason)
+		h.dropRoomShares(roomID)
+		h.rooms.Delete(roomID)
+		h.plugins.Forget(roomID)
+		h.dropRoomLocks(roomID)
+		delete(h.history, roomID)
+
+		h.accept(domain.Event{
+			Type:      domain.EventRoomClosed,
+			RoomID:    roomID,
+			Timestamp: time.Now().UnixMilli(),
+			Payload:   domain.RoomClosedPayload{Reason: reason},
+		})
+
+		h.webhooks.Publish(webhook.EventRoomClosed, roomID, webhook.RoomClosedData{Reason: reason})
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+func (c *Client) info() domain.ClientInfo {
+	return domain.ClientInfo{
+		ID:          c.ID,
+		RoomID:      c.RoomID,
+		Username:    c.Username,
+		Color:       c.Color,
+		RemoteAddr:  c.RemoteAddr,
+		ConnectedAt: c.ConnectedAt,
+		Muted:       c.muted,
+		Dropped:     c.send.droppedCount(),
+	}
+}
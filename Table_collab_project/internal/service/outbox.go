@@ -0,0 +1,186 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+
+	"table_collab/internal/domain"
+)
+
+type SlowConsumerPolicy string
+
+const (
+	// PolicyDisconnect закрывает соединение, клиент переподключается и делает sync.
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"
+	// PolicyDropOldest вытесняет самые старые эфемерные события (курсоры).
+	PolicyDropOldest SlowConsumerPolicy = "drop_oldest"
+	// PolicyCoalesceCursor заменяет ожидающий курсор того же пользователя новым,
+	// а если такого нет — вытесняет самый старый ожидающий курсор.
+	PolicyCoalesceCursor SlowConsumerPolicy = "coalesce_cursor"
+	// PolicySpill складывает лишнее в ограниченную очередь переполнения.
+	PolicySpill SlowConsumerPolicy = "spill"
+)
+
+func ParseSlowConsumerPolicy(value string) (SlowConsumerPolicy, error) {
+	switch policy := SlowConsumerPolicy(value); policy {
+	case PolicyDisconnect, PolicyDropOldest, PolicyCoalesceCursor, PolicySpill:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown slow consumer policy %q", value)
+	}
+}
+
+// outbox — очередь исходящих событий клиента. push вызывается из Hub.Run
+// (зрителям — из горутины audience), pop — из WritePump; notify сигнализирует, что в очереди что-то есть.
+type outbox struct {
+	mu           sync.Mutex
+	queue        []domain.Event
+	overflow     []domain.Event
+	size         int
+	overflowSize int
+	policy       SlowConsumerPolicy
+	notify       chan struct{}
+	// Сколько курсоров отброшено из-за переполнения
+	dropped int
+}
+
+func newOutbox(size, overflowSize int, policy SlowConsumerPolicy) *outbox {
+	if size <= 0 {
+		size = 256
+	}
+	return &outbox{
+		queue:        make([]domain.Event, 0, size),
+		size:         size,
+		overflowSize: overflowSize,
+		policy:       policy,
+		notify:       make(chan struct{}, 1),
+	}
+}
+
+func (o *outbox) setPolicy(policy SlowConsumerPolicy) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.policy = policy
+}
+
+// push возвращает false, если клиент не успевает читать и его нужно отключить.
+func (o *outbox) push(event domain.Event) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.overflow) == 0 && len(o.queue) < o.size {
+		o.queue = append(o.queue, event)
+		o.signal()
+		return true
+	}
+
+	switch o.policy {
+	case PolicyDropOldest:
+		if i := o.indexOf(isEphemeral); i >= 0 {
+			o.queue = append(o.queue[:i], o.queue[i+1:]...)
+			o.queue = append(o.queue, event)
+			o.dropped++
+			return true
+		}
+		if isEphemeral(event) {
+			o.dropped++
+			return true
+		}
+		return false
+
+	case PolicyCoalesceCursor:
+		if event.Type != domain.EventCursorMove {
+			return false
+		}
+		if i := o.indexOf(func(queued domain.Event) bool {
+			return queued.Type == domain.EventCursorMove && queued.UserID == event.UserID
+		}); i >= 0 {
+			o.queue[i] = event
+			return true
+		}
+		// Пропустить курсор нельзя: если это последнее движение пользователя,
+		// его курсор так и останется старым. Место освобождает самый старый
+		// курсор, а без курсоров в очереди клиент отключается и получит sync.
+		if i := o.indexOf(isEphemeral); i >= 0 {
+			o.queue = append(o.queue[:i], o.queue[i+1:]...)
+			o.queue = append(o.queue, event)
+			o.dropped++
+			return true
+		}
+		return false
+
+	case PolicySpill:
+		if len(o.overflow) < o.overflowSize {
+			o.overflow = append(o.overflow, event)
+			return true
+		}
+		return false
+
+	default:
+		return false
+	}
+}
+
+func (o *outbox) pop() (domain.Event, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.queue) == 0 {
+		return domain.Event{}, false
+	}
+
+	event := o.queue[0]
+	o.queue = o.queue[1:]
+
+	if len(o.overflow) > 0 {
+		o.queue = append(o.queue, o.overflow[0])
+		o.overflow = o.overflow[1:]
+	}
+
+	return event, true
+}
+
+func (o *outbox) len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.queue) + len(o.overflow)
+}
+
+func (o *outbox) droppedCount() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.dropped
+}
+
+func (o *outbox) capacity() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.policy == PolicySpill {
+		return o.size + o.overflowSize
+	}
+	return o.size
+}
+
+func (o *outbox) indexOf(match func(domain.Event) bool) int {
+	for i, queued := range o.queue {
+		if match(queued) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (o *outbox) signal() {
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+func isEphemeral(event domain.Event) bool {
+	return event.Type == domain.EventCursorMove
+}
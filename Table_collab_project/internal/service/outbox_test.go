@@ -0,0 +1,183 @@
+package service
+
+import (
+	"testing"
+
+	"table_collab/internal/domain"
+)
+
+func cursor(userID string, x float64) domain.Event {
+	return domain.Event{
+		Type:    domain.EventCursorMove,
+		UserID:  userID,
+		Payload: domain.CursorPosition{X: x},
+	}
+}
+
+func chat(text string) domain.Event {
+	return domain.Event{
+		Type:    domain.EventChatMessage,
+		UserID:  "author",
+		Payload: domain.SystemMessagePayload{Text: text},
+	}
+}
+
+func drain(o *outbox) []domain.Event {
+	var events []domain.Event
+	for {
+		event, ok := o.pop()
+		if !ok {
+			return events
+		}
+		events = append(events, event)
+	}
+}
+
+func TestOutboxDisconnectWhenFull(t *testing.T) {
+	o := newOutbox(2, 10, PolicyDisconnect)
+
+	if !o.push(chat("1")) || !o.push(chat("2")) {
+		t.Fatal("push into a non-full outbox must succeed")
+	}
+	if o.push(cursor("u1", 1)) {
+		t.Fatal("expected disconnect when the buffer is full")
+	}
+	if got := o.len(); got != 2 {
+		t.Fatalf("len = %d, want 2", got)
+	}
+}
+
+func TestOutboxDropOldestEphemeral(t *testing.T) {
+	o := newOutbox(3, 0, PolicyDropOldest)
+	o.push(cursor("u1", 1))
+	o.push(chat("a"))
+	o.push(cursor("u2", 2))
+
+	if !o.push(chat("b")) {
+		t.Fatal("expected the oldest cursor to be dropped")
+	}
+
+	events := drain(o)
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	if events[0].Type != domain.EventChatMessage || events[1].UserID != "u2" || events[2].Type != domain.EventChatMessage {
+		t.Fatalf("unexpected order after drop: %+v", events)
+	}
+}
+
+func TestOutboxDropOldestWithoutEphemeral(t *testing.T) {
+	o := newOutbox(1, 0, PolicyDropOldest)
+	o.push(chat("a"))
+
+	if !o.push(cursor("u1", 1)) {
+		t.Fatal("an incoming cursor may be dropped instead of disconnecting")
+	}
+	if o.push(chat("b")) {
+		t.Fatal("content events must not be dropped silently")
+	}
+	if events := drain(o); len(events) != 1 || events[0].Type != domain.EventChatMessage {
+		t.Fatalf("unexpected queue: %+v", events)
+	}
+}
+
+func TestOutboxCoalesceCursor(t *testing.T) {
+	o := newOutbox(2, 0, PolicyCoalesceCursor)
+	o.push(cursor("u1", 1))
+	o.push(chat("a"))
+
+	if !o.push(cursor("u1", 5)) {
+		t.Fatal("expected the cursor to be coalesced")
+	}
+	if o.push(chat("b")) {
+		t.Fatal("expected disconnect for a content event")
+	}
+
+	events := drain(o)
+	if len(events) != 2 || o.droppedCount() != 0 {
+		t.Fatalf("got %d events, %d dropped", len(events), o.droppedCount())
+	}
+	if pos := events[0].Payload.(domain.CursorPosition); events[0].UserID != "u1" || pos.X != 5 {
+		t.Fatalf("cursor was not replaced with the latest position: %+v", events[0])
+	}
+}
+
+// Курсор пользователя, которого в очереди нет, не теряется: он вытесняет
+// самый старый курсор, а без курсоров в очереди клиент отключается.
+func TestOutboxCoalesceCursorWithoutMatch(t *testing.T) {
+	o := newOutbox(3, 0, PolicyCoalesceCursor)
+	o.push(cursor("u1", 1))
+	o.push(chat("a"))
+	o.push(cursor("u2", 2))
+
+	if !o.push(cursor("u3", 3)) {
+		t.Fatal("expected the oldest cursor to make room")
+	}
+	events := drain(o)
+	if len(events) != 3 || events[0].Type != domain.EventChatMessage || events[1].UserID != "u2" || events[2].UserID != "u3" {
+		t.Fatalf("unexpected queue: %+v", events)
+	}
+	if o.droppedCount() != 1 {
+		t.Fatalf("dropped = %d, want 1", o.droppedCount())
+	}
+
+	full := newOutbox(1, 0, PolicyCoalesceCursor)
+	full.push(chat("a"))
+	if full.push(cursor("u1", 1)) {
+		t.Fatal("a cursor must not vanish when no queued cursor can make room")
+	}
+}
+
+func TestOutboxSpill(t *testing.T) {
+	o := newOutbox(2, 2, PolicySpill)
+	for _, text := range []string{"1", "2", "3", "4"} {
+		if !o.push(chat(text)) {
+			t.Fatalf("push %s: expected spill to the overflow queue", text)
+		}
+	}
+	if o.push(chat("5")) {
+		t.Fatal("expected disconnect when the overflow queue is full")
+	}
+	if got := o.capacity(); got != 4 {
+		t.Fatalf("capacity = %d, want 4", got)
+	}
+
+	events := drain(o)
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4", len(events))
+	}
+	for i, event := range events {
+		want := string(rune('1' + i))
+		if text := event.Payload.(domain.SystemMessagePayload).Text; text != want {
+			t.Fatalf("event %d = %s, want %s: ordering broken", i, text, want)
+		}
+	}
+}
+
+func TestOutboxSpillKeepsOrderWhileDraining(t *testing.T) {
+	o := newOutbox(1, 2, PolicySpill)
+	o.push(chat("1"))
+	o.push(chat("2"))
+
+	o.pop()
+	o.push(chat("3"))
+
+	events := drain(o)
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if events[0].Payload.(domain.SystemMessagePayload).Text != "2" {
+		t.Fatalf("new events must not overtake spilled ones: %+v", events)
+	}
+}
+
+func TestParseSlowConsumerPolicy(t *testing.T) {
+	for _, value := range []string{"disconnect", "drop_oldest", "coalesce_cursor", "spill"} {
+		if _, err := ParseSlowConsumerPolicy(value); err != nil {
+			t.Errorf("ParseSlowConsumerPolicy(%q): %v", value, err)
+		}
+	}
+	if _, err := ParseSlowConsumerPolicy("block"); err == nil {
+		t.Error("expected error for an unknown policy")
+	}
+}
@@ -0,0 +1,64 @@
+package plugin
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+func init() {
+	Register("formatter", func(config.PluginConfig) Plugin { return &Formatter{} })
+}
+
+var (
+	numberPattern = regexp.MustCompile(`^[+-]?(\d{1,3}([ ,]\d{3})+|\d+)(\.\d+)?$`)
+	dateLayouts   = []string{"2006-01-02", "02.01.2006", "2006/01/02", "2 Jan 2006", "Jan 2, 2006", "January 2, 2006"}
+)
+
+// Formatter приводит значения ячеек таблицы к единому виду: убирает лишние
+// пробелы, разделители тысяч в числах и переводит даты в формат ГГГГ-ММ-ДД.
+type Formatter struct{}
+
+func (f *Formatter) Name() string { return "formatter" }
+
+func (f *Formatter) Before(ctx *Context, event *domain.Event) error {
+	if event.Type != domain.EventCellUpdate || ctx.RoomType() != domain.RoomTypeTable {
+		return nil
+	}
+
+	var payload domain.CellUpdatePayload
+	if err := domain.DecodePayload(*event, &payload); err != nil {
+		return nil
+	}
+
+	formatted := FormatValue(payload.Value)
+	if formatted != payload.Value {
+		payload.Value = formatted
+		event.Payload = payload
+	}
+	return nil
+}
+
+// FormatValue возвращает нормализованное значение ячейки.
+func FormatValue(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+
+	if numberPattern.MatchString(value) {
+		plain := strings.NewReplacer(",", "", " ", "").Replace(value)
+		if n, err := strconv.ParseFloat(plain, 64); err == nil {
+			return strconv.FormatFloat(n, 'f', -1, 64)
+		}
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+
+	return value
+}
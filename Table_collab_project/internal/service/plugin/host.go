@@ -0,0 +1,184 @@
+package plugin
+
+import (
+	"errors"
+	"log/slog"
+	"path"
+	"reflect"
+	"sort"
+	"time"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+	"table_collab/internal/logging"
+)
+
+// Host создаёт плагины для комнат по конфигурации и вызывает их хуки.
+// Все методы вызываются из горутины hub.
+type Host struct {
+	cfg   config.PluginConfig
+	rooms map[string][]Plugin
+
+	// Usernames находит имя участника по ID; его задаёт hub.
+	Usernames func(userID string) string
+}
+
+func NewHost(cfg config.PluginConfig) *Host {
+	h := &Host{cfg: cfg, rooms: make(map[string][]Plugin)}
+
+	names := append([]string{}, cfg.Default...)
+	for _, list := range cfg.Rooms {
+		names = append(names, list...)
+	}
+	for _, name := range names {
+		if _, ok := lookup(name); !ok {
+			slog.Warn("Plugin is not registered, ignoring", "plugin", name, "available", Registered())
+		}
+	}
+
+	return h
+}
+
+// Active сообщает, включён ли хоть один плагин хоть где-то.
+func (h *Host) Active() bool {
+	if len(h.cfg.Default) > 0 {
+		return true
+	}
+	for _, list := range h.cfg.Rooms {
+		if len(list) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled возвращает имена плагинов, включённых для комнаты: точное совпадение
+// ID важнее шаблона, а шаблоны проверяются в алфавитном порядке.
+func (h *Host) Enabled(roomID string) []string {
+	if list, ok := h.cfg.Rooms[roomID]; ok {
+		return list
+	}
+
+	patterns := make([]string, 0, len(h.cfg.Rooms))
+	for pattern := range h.cfg.Rooms {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, roomID); ok {
+			return h.cfg.Rooms[pattern]
+		}
+	}
+	return h.cfg.Default
+}
+
+// Before пропускает событие через BeforeHook всех плагинов комнаты по порядку.
+// Изменения, внесённые одним плагином, видят следующие. Плагин может менять
+// только payload: отправитель, комната и порядковые поля остаются прежними.
+// Вместе с решением возвращаются события, которые плагины хотят отправить.
+func (h *Host) Before(room *domain.Room, event *domain.Event) ([]domain.Event, error) {
+	var emitted []domain.Event
+	for _, p := range h.instances(room.ID) {
+		hook, ok := p.(BeforeHook)
+		if !ok {
+			continue
+		}
+
+		candidate := *event
+		ctx := h.context(room, p)
+		err := guard(p, "Before", func() error { return hook.Before(ctx, &candidate) })
+		emitted = append(emitted, ctx.emitted...)
+
+		var veto *VetoError
+		switch {
+		case errors.As(err, &veto):
+			veto.Plugin = p.Name()
+			return emitted, veto
+		case errors.Is(err, ErrDrop):
+			return emitted, ErrDrop
+		case err != nil:
+			// Сломанный плагин не должен блокировать комнату
+			slog.Warn("Plugin failed", "plugin", p.Name(), logging.KeyRoom, room.ID, logging.KeyEvent, event.Type, logging.Err(err))
+			continue
+		}
+
+		payload, err := normalize(candidate.Payload)
+		if err != nil {
+			slog.Warn("Plugin produced an invalid payload", "plugin", p.Name(), logging.KeyRoom, room.ID, logging.KeyEvent, event.Type, logging.Err(err))
+			continue
+		}
+		event.Payload = payload
+	}
+	return emitted, nil
+}
+
+// After вызывает AfterHook всех плагинов комнаты, кроме отправившего событие
+// бота, и возвращает события, которые плагины хотят отправить.
+func (h *Host) After(room *domain.Room, event domain.Event) []domain.Event {
+	var emitted []domain.Event
+	for _, p := range h.instances(room.ID) {
+		hook, ok := p.(AfterHook)
+		if !ok || event.UserID == BotPrefix+p.Name() {
+			continue
+		}
+
+		ctx := h.context(room, p)
+		guard(p, "After", func() error { hook.After(ctx, event); return nil })
+		emitted = append(emitted, ctx.emitted...)
+	}
+	return emitted
+}
+
+// Tick вызывает TickHook для комнат, где плагины уже созданы.
+func (h *Host) Tick(rooms []*domain.Room, now time.Time) []domain.Event {
+	var emitted []domain.Event
+	for _, room := range rooms {
+		for _, p := range h.rooms[room.ID] {
+			hook, ok := p.(TickHook)
+			if !ok {
+				continue
+			}
+
+			ctx := h.context(room, p)
+			guard(p, "Tick", func() error { hook.Tick(ctx, now); return nil })
+			emitted = append(emitted, ctx.emitted...)
+		}
+	}
+	return emitted
+}
+
+// Forget удаляет экземпляры плагинов закрытой комнаты.
+func (h *Host) Forget(roomID string) {
+	delete(h.rooms, roomID)
+}
+
+func (h *Host) instances(roomID string) []Plugin {
+	if plugins, ok := h.rooms[roomID]; ok {
+		return plugins
+	}
+
+	var plugins []Plugin
+	for _, name := range h.Enabled(roomID) {
+		if factory, ok := lookup(name); ok {
+			plugins = append(plugins, factory(h.cfg))
+		}
+	}
+	h.rooms[roomID] = plugins
+	return plugins
+}
+
+func (h *Host) context(room *domain.Room, p Plugin) *Context {
+	return &Context{room: room, plugin: p.Name(), username: h.Usernames}
+}
+
+// guard не даёт панике в плагине уронить hub.
+func guard(p Plugin, hook string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Plugin panicked", "plugin", p.Name(), "type", reflect.TypeOf(p).String(), "hook", hook, "panic", r)
+			err = nil
+		}
+	}()
+	return fn()
+}
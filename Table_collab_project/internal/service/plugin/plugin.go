@@ -0,0 +1,214 @@
+// Package plugin — встроенные в сервер плагины и боты. Плагин видит события
+// комнаты до и после их обработки, может отклонить или изменить событие и
+// отправлять свои события от имени бота.
+//
+// Хуки вызываются из горутины hub, поэтому должны работать быстро и не
+// блокироваться. Для каждой комнаты создаётся свой экземпляр плагина, так что
+// состояние комнат не смешивается.
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+// BotPrefix — префикс UserID событий, отправленных плагинами.
+const BotPrefix = "bot:"
+
+// maxEmitPerHook ограничивает число событий, которые плагин может отправить за один вызов хука.
+const maxEmitPerHook = 20
+
+var (
+	// ErrDrop — событие обработано плагином и дальше не идёт (например, команда чата).
+	ErrDrop = errors.New("event consumed by plugin")
+
+	ErrTooManyEvents    = errors.New("plugin emitted too many events")
+	ErrEventNotAllowed  = errors.New("event type is not allowed for bots")
+	ErrUnknownPlugin    = errors.New("unknown plugin")
+	ErrPluginRegistered = errors.New("plugin is already registered")
+)
+
+// VetoError — плагин отклонил событие; Reason показывается отправителю.
+type VetoError struct {
+	Plugin string
+	Reason string
+}
+
+func (e *VetoError) Error() string {
+	return e.Plugin + ": " + e.Reason
+}
+
+// Veto отклоняет событие с объяснением для отправителя.
+func Veto(reason string) error {
+	return &VetoError{Reason: reason}
+}
+
+// Plugin — базовый интерфейс; возможности плагина определяются хуками,
+// которые он реализует.
+type Plugin interface {
+	Name() string
+}
+
+// BeforeHook вызывается до применения события. Плагин может изменить event,
+// вернуть Veto(...) или ErrDrop.
+type BeforeHook interface {
+	Before(ctx *Context, event *domain.Event) error
+}
+
+// AfterHook вызывается после того, как событие применено и разослано.
+type AfterHook interface {
+	After(ctx *Context, event domain.Event)
+}
+
+// TickHook вызывается периодически для каждой комнаты, где включён плагин.
+type TickHook interface {
+	Tick(ctx *Context, now time.Time)
+}
+
+// Factory создаёт экземпляр плагина для одной комнаты.
+type Factory func(cfg config.PluginConfig) Plugin
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register добавляет плагин в реестр. Вызывается из init.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic(fmt.Errorf("%w: %s", ErrPluginRegistered, name))
+	}
+	registry[name] = factory
+}
+
+// Registered возвращает имена всех зарегистрированных плагинов.
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookup(name string) (Factory, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	factory, ok := registry[name]
+	return factory, ok
+}
+
+// Context — песочница плагина: доступ к комнате только на чтение и отправка
+// событий от имени бота только в эту комнату.
+type Context struct {
+	room     *domain.Room
+	plugin   string
+	username func(userID string) string
+	emitted  []domain.Event
+	err      error
+}
+
+func (c *Context) RoomID() string            { return c.room.ID }
+func (c *Context) RoomType() domain.RoomType { return c.room.Type }
+func (c *Context) Content() string           { return c.room.Content }
+func (c *Context) Version() int              { return c.room.Version }
+
+// BotID — идентификатор, от имени которого плагин отправляет события.
+func (c *Context) BotID() string {
+	return BotPrefix + c.plugin
+}
+
+// Username возвращает имя участника комнаты или сам userID, если имя неизвестно.
+func (c *Context) Username(userID string) string {
+	if c.username != nil {
+		if name := c.username(userID); name != "" {
+			return name
+		}
+	}
+	return userID
+}
+
+// Cell возвращает значение ячейки первого листа таблицы по адресу ("B3").
+// Для формулы возвращается вычисленное значение.
+func (c *Context) Cell(address string) string {
+	if len(c.room.Sheets) == 0 {
+		return ""
+	}
+	sheet := c.room.Sheets[0]
+	address = strings.ToUpper(address)
+	if value, ok := sheet.Values[address]; ok {
+		return value
+	}
+	return sheet.Cells[address]
+}
+
+// Say отправляет сообщение в чат комнаты от имени бота.
+func (c *Context) Say(text string) error {
+	return c.Send(domain.EventChatMessage, map[string]string{"text": text, "username": c.plugin})
+}
+
+// SetCell меняет ячейку первого листа таблицы от имени бота.
+func (c *Context) SetCell(address, value string) error {
+	return c.Send(domain.EventCellUpdate, domain.CellUpdatePayload{Cell: address, Value: value})
+}
+
+// Send ставит событие бота в очередь; hub обработает его после текущего хука.
+func (c *Context) Send(eventType domain.EventType, payload interface{}) error {
+	switch eventType {
+	case domain.EventChatMessage, domain.EventSystem, domain.EventTextUpdate, domain.EventCellUpdate:
+	default:
+		return fmt.Errorf("%w: %s", ErrEventNotAllowed, eventType)
+	}
+	if len(c.emitted) >= maxEmitPerHook {
+		c.err = ErrTooManyEvents
+		return ErrTooManyEvents
+	}
+
+	generic, err := normalize(payload)
+	if err != nil {
+		return err
+	}
+
+	c.emitted = append(c.emitted, domain.Event{
+		Type:      eventType,
+		RoomID:    c.room.ID,
+		UserID:    c.BotID(),
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   generic,
+	})
+	return nil
+}
+
+// normalize приводит payload к виду, в котором он приходит от клиентов (JSON-объект в map).
+func normalize(payload interface{}) (interface{}, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// IsBot сообщает, отправлено ли событие плагином.
+func IsBot(userID string) bool {
+	return strings.HasPrefix(userID, BotPrefix)
+}
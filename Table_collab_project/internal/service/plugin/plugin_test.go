@@ -0,0 +1,221 @@
+package plugin
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+func chat(userID, text string) domain.Event {
+	return domain.Event{
+		Type:    domain.EventChatMessage,
+		RoomID:  "room",
+		UserID:  userID,
+		Payload: map[string]interface{}{"text": text},
+	}
+}
+
+func botTexts(t *testing.T, events []domain.Event) []string {
+	t.Helper()
+
+	var texts []string
+	for _, event := range events {
+		if event.Type != domain.EventChatMessage || !IsBot(event.UserID) {
+			t.Fatalf("unexpected bot event %+v", event)
+		}
+		texts = append(texts, chatText(event))
+	}
+	return texts
+}
+
+func newTestHost(plugins ...string) (*Host, *domain.Room) {
+	host := NewHost(config.PluginConfig{Default: plugins, SummaryInterval: 3600})
+	host.Usernames = func(userID string) string { return "user-" + userID }
+	return host, &domain.Room{ID: "room", Type: domain.RoomTypeTable}
+}
+
+func TestPollFlow(t *testing.T) {
+	host, room := newTestHost("poll")
+
+	event := chat("a", "/poll Lunch? | Pizza | Sushi")
+	emitted, err := host.Before(room, &event)
+	if !errors.Is(err, ErrDrop) {
+		t.Fatalf("poll start: got %v, want ErrDrop", err)
+	}
+	if texts := botTexts(t, emitted); len(texts) != 1 || !strings.Contains(texts[0], "2) Sushi") {
+		t.Fatalf("poll announcement: %q", texts)
+	}
+
+	for _, vote := range []domain.Event{chat("a", "/vote 2"), chat("b", "/vote 1"), chat("a", "/vote 1")} {
+		if _, err := host.Before(room, &vote); !errors.Is(err, ErrDrop) {
+			t.Fatalf("vote: got %v, want ErrDrop", err)
+		}
+	}
+
+	bad := chat("c", "/vote 7")
+	_, err = host.Before(room, &bad)
+	var veto *VetoError
+	if !errors.As(err, &veto) || veto.Plugin != "poll" {
+		t.Fatalf("invalid vote: got %v, want a veto from poll", err)
+	}
+
+	results := chat("a", "/poll close")
+	emitted, _ = host.Before(room, &results)
+	if texts := botTexts(t, emitted); len(texts) != 1 || !strings.Contains(texts[0], "Pizza — 2") ||
+		!strings.Contains(texts[0], "Sushi — 0") {
+		t.Fatalf("final results: %q", texts)
+	}
+
+	plain := chat("a", "hello")
+	if emitted, err := host.Before(room, &plain); err != nil || len(emitted) != 0 {
+		t.Fatalf("plain chat: got %v, %v", emitted, err)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := map[string]string{
+		"  42  ":        "42",
+		"1,234,567":     "1234567",
+		"1 234.50":      "1234.5",
+		"-0012":         "-12",
+		"31.12.2024":    "2024-12-31",
+		"Jan 2, 2006":   "2006-01-02",
+		"hello   world": "hello world",
+		"12,34":         "12,34",
+	}
+	for in, want := range tests {
+		if got := FormatValue(in); got != want {
+			t.Errorf("FormatValue(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFormatterOnlyTouchesTableCells(t *testing.T) {
+	host, room := newTestHost("formatter")
+
+	event := domain.Event{Type: domain.EventCellUpdate, RoomID: "room", Payload: domain.CellUpdatePayload{Cell: "A1", Value: "1,000"}}
+	if _, err := host.Before(room, &event); err != nil {
+		t.Fatal(err)
+	}
+	var payload domain.CellUpdatePayload
+	domain.DecodePayload(event, &payload)
+	if payload.Value != "1000" || payload.Cell != "A1" {
+		t.Fatalf("formatted payload: %+v", payload)
+	}
+
+	room.Type = domain.RoomTypeDocument
+	event.Payload = domain.CellUpdatePayload{Cell: "A1", Value: "1,000"}
+	host.Before(room, &event)
+	domain.DecodePayload(event, &payload)
+	if payload.Value != "1,000" {
+		t.Fatalf("document room value changed: %+v", payload)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	host, room := newTestHost("summary")
+
+	start := time.Now()
+	host.After(room, domain.Event{Type: domain.EventJoinRoom, RoomID: "room", UserID: "b"})
+	host.After(room, chat("b", "hi"))
+	host.After(room, chat("a", "hello"))
+	host.After(room, domain.Event{Type: domain.EventCellUpdate, RoomID: "room", UserID: "a"})
+	host.After(room, chat(BotPrefix+"poll", "ignored"))
+
+	if emitted := host.Tick([]*domain.Room{room}, start.Add(time.Minute)); len(emitted) != 0 {
+		t.Fatalf("summary posted before the interval: %v", emitted)
+	}
+
+	emitted := host.Tick([]*domain.Room{room}, start.Add(2*time.Hour))
+	texts := botTexts(t, emitted)
+	if len(texts) != 1 || !strings.Contains(texts[0], "2 message(s), 1 edit(s), 1 join(s)") ||
+		!strings.Contains(texts[0], "active: user-a, user-b") {
+		t.Fatalf("summary: %q", texts)
+	}
+
+	// После сводки счётчики обнуляются, пустую сводку бот не публикует
+	if emitted := host.Tick([]*domain.Room{room}, start.Add(4*time.Hour)); len(emitted) != 0 {
+		t.Fatalf("empty summary posted: %v", emitted)
+	}
+}
+
+func TestEnabledMatchesRoomPatterns(t *testing.T) {
+	host := NewHost(config.PluginConfig{
+		Default: []string{"summary"},
+		Rooms: map[string][]string{
+			"team-*":   {"poll"},
+			"team-ops": {"formatter"},
+			"quiet-*":  {},
+			"[invalid": {"poll"},
+		},
+	})
+
+	tests := map[string][]string{
+		"team-dev": {"poll"},
+		"team-ops": {"formatter"},
+		"quiet-1":  {},
+		"other":    {"summary"},
+	}
+	for room, want := range tests {
+		if got := host.Enabled(room); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("Enabled(%q) = %v, want %v", room, got, want)
+		}
+	}
+}
+
+type panicky struct{}
+
+func (panicky) Name() string                         { return "panicky" }
+func (panicky) Before(*Context, *domain.Event) error { panic("boom") }
+func (panicky) After(*Context, domain.Event)         { panic("boom") }
+
+type vetoAll struct{}
+
+func (vetoAll) Name() string { return "veto-all" }
+func (vetoAll) Before(ctx *Context, event *domain.Event) error {
+	ctx.Say("nope")
+	return Veto("not today")
+}
+
+func init() {
+	Register("test-panicky", func(config.PluginConfig) Plugin { return panicky{} })
+	Register("test-veto", func(config.PluginConfig) Plugin { return vetoAll{} })
+}
+
+func TestHostGuardsPluginsAndStopsOnVeto(t *testing.T) {
+	host, room := newTestHost("test-panicky", "test-veto", "poll")
+
+	event := chat("a", "/poll Q | A | B")
+	emitted, err := host.Before(room, &event)
+
+	var veto *VetoError
+	if !errors.As(err, &veto) || veto.Plugin != "veto-all" || veto.Reason != "not today" {
+		t.Fatalf("got %v, want veto from veto-all", err)
+	}
+	// Плагины после отклонившего не вызываются: опрос не начат
+	if texts := botTexts(t, emitted); len(texts) != 1 || texts[0] != "nope" {
+		t.Fatalf("emitted: %q", texts)
+	}
+
+	host.After(room, event)
+}
+
+func TestContextLimits(t *testing.T) {
+	ctx := &Context{room: &domain.Room{ID: "room"}, plugin: "test"}
+
+	if err := ctx.Send(domain.EventJoinRoom, nil); !errors.Is(err, ErrEventNotAllowed) {
+		t.Fatalf("join from bot: got %v", err)
+	}
+	for i := 0; i < maxEmitPerHook; i++ {
+		if err := ctx.Say("hi"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ctx.Say("one too many"); !errors.Is(err, ErrTooManyEvents) {
+		t.Fatalf("got %v, want ErrTooManyEvents", err)
+	}
+}
@@ -0,0 +1,133 @@
+package plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+func init() {
+	Register("poll", func(config.PluginConfig) Plugin { return &Poll{} })
+}
+
+const pollUsage = "usage: /poll Question | Option 1 | Option 2, /vote <number>, /poll results, /poll close"
+
+// Poll — голосование в чате:
+//
+//	/poll Куда идём обедать? | Пицца | Суши
+//	/vote 2
+//	/poll results
+//	/poll close
+type Poll struct {
+	question string
+	options  []string
+	votes    map[string]int // UserID -> индекс варианта
+}
+
+func (p *Poll) Name() string { return "poll" }
+
+func (p *Poll) Before(ctx *Context, event *domain.Event) error {
+	if event.Type != domain.EventChatMessage {
+		return nil
+	}
+
+	text := strings.TrimSpace(chatText(*event))
+	command, args, _ := strings.Cut(text, " ")
+	args = strings.TrimSpace(args)
+
+	switch command {
+	case "/poll":
+		switch args {
+		case "results":
+			return p.report(ctx, "Current results")
+		case "close":
+			if err := p.report(ctx, "Final results"); err != nil {
+				return err
+			}
+			p.question, p.options, p.votes = "", nil, nil
+			return ErrDrop
+		}
+		return p.start(ctx, args)
+
+	case "/vote":
+		return p.vote(event.UserID, args)
+	}
+	return nil
+}
+
+func (p *Poll) start(ctx *Context, args string) error {
+	if p.question != "" {
+		return Veto("a poll is already running, finish it with /poll close")
+	}
+
+	parts := strings.Split(args, "|")
+	var options []string
+	for _, part := range parts[1:] {
+		if part = strings.TrimSpace(part); part != "" {
+			options = append(options, part)
+		}
+	}
+	question := strings.TrimSpace(parts[0])
+	if question == "" || len(options) < 2 {
+		return Veto(pollUsage)
+	}
+
+	p.question, p.options, p.votes = question, options, make(map[string]int)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 %s\n", question)
+	for i, option := range options {
+		fmt.Fprintf(&b, "%d) %s\n", i+1, option)
+	}
+	b.WriteString("Vote with /vote <number>")
+
+	ctx.Say(b.String())
+	return ErrDrop
+}
+
+func (p *Poll) vote(userID, args string) error {
+	if p.question == "" {
+		return Veto("there is no active poll, start one with /poll")
+	}
+
+	n, err := strconv.Atoi(args)
+	if err != nil || n < 1 || n > len(p.options) {
+		return Veto(fmt.Sprintf("vote with a number from 1 to %d", len(p.options)))
+	}
+
+	// Повторный голос заменяет предыдущий
+	p.votes[userID] = n - 1
+	return ErrDrop
+}
+
+func (p *Poll) report(ctx *Context, title string) error {
+	if p.question == "" {
+		return Veto("there is no active poll")
+	}
+
+	counts := make([]int, len(p.options))
+	for _, choice := range p.votes {
+		counts[choice]++
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 %s: %s\n", title, p.question)
+	for i, option := range p.options {
+		fmt.Fprintf(&b, "%s — %d\n", option, counts[i])
+	}
+	fmt.Fprintf(&b, "%d vote(s)", len(p.votes))
+
+	ctx.Say(b.String())
+	return ErrDrop
+}
+
+func chatText(event domain.Event) string {
+	var payload struct {
+		Text string `json:"text"`
+	}
+	domain.DecodePayload(event, &payload)
+	return payload.Text
+}
@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+func init() {
+	Register("summary", func(cfg config.PluginConfig) Plugin {
+		interval := time.Duration(cfg.SummaryInterval) * time.Second
+		if interval <= 0 {
+			interval = 24 * time.Hour
+		}
+		return &Summary{interval: interval}
+	})
+}
+
+// Summary раз в интервал (по умолчанию сутки) публикует сводку активности
+// комнаты; /summary показывает её сразу.
+type Summary struct {
+	interval time.Duration
+	since    time.Time
+
+	messages int
+	edits    int
+	joins    int
+	authors  map[string]string // UserID -> имя
+}
+
+func (s *Summary) Name() string { return "summary" }
+
+func (s *Summary) Before(ctx *Context, event *domain.Event) error {
+	if event.Type == domain.EventChatMessage && strings.TrimSpace(chatText(*event)) == "/summary" {
+		s.post(ctx, time.Now())
+		return ErrDrop
+	}
+	return nil
+}
+
+func (s *Summary) After(ctx *Context, event domain.Event) {
+	s.init(time.Now())
+	if IsBot(event.UserID) {
+		return
+	}
+
+	switch event.Type {
+	case domain.EventChatMessage:
+		s.messages++
+		s.author(ctx, event.UserID)
+	case domain.EventTextUpdate, domain.EventCellUpdate, domain.EventElementAdd:
+		s.edits++
+		s.author(ctx, event.UserID)
+	case domain.EventJoinRoom:
+		s.joins++
+		s.author(ctx, event.UserID)
+	}
+}
+
+func (s *Summary) Tick(ctx *Context, now time.Time) {
+	s.init(now)
+	if now.Sub(s.since) < s.interval {
+		return
+	}
+
+	if s.messages+s.edits+s.joins > 0 {
+		s.post(ctx, now)
+		return
+	}
+	s.reset(now)
+}
+
+func (s *Summary) post(ctx *Context, now time.Time) {
+	s.init(now)
+
+	names := make([]string, 0, len(s.authors))
+	for _, name := range s.authors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	text := fmt.Sprintf("🗒 Summary since %s: %d message(s), %d edit(s), %d join(s)",
+		s.since.UTC().Format("2006-01-02 15:04 MST"), s.messages, s.edits, s.joins)
+	if len(names) > 0 {
+		text += " — active: " + strings.Join(names, ", ")
+	}
+
+	ctx.Say(text)
+	s.reset(now)
+}
+
+func (s *Summary) author(ctx *Context, userID string) {
+	s.authors[userID] = ctx.Username(userID)
+}
+
+func (s *Summary) init(now time.Time) {
+	if s.authors == nil {
+		s.reset(now)
+	}
+}
+
+func (s *Summary) reset(now time.Time) {
+	s.since = now
+	s.messages, s.edits, s.joins = 0, 0, 0
+	s.authors = make(map[string]string)
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/logging"
+	"table_collab/internal/service/plugin"
+)
+
+// maxBotEvents ограничивает цепочку событий ботов, порождённую одним событием,
+// чтобы плагины не могли зациклить друг друга.
+const maxBotEvents = 64
+
+// runBefore пропускает событие через плагины комнаты. Ошибка означает, что
+// плагин отклонил событие (plugin.VetoError) или поглотил его (plugin.ErrDrop).
+func (h *Hub) runBefore(event *domain.Event) error {
+	room, err := h.rooms.Get(event.RoomID)
+	if err != nil {
+		return nil
+	}
+
+	emitted, err := h.plugins.Before(room, event)
+	h.emitBotEvents(emitted)
+	return err
+}
+
+// runAfter сообщает плагинам о применённом событии.
+func (h *Hub) runAfter(event domain.Event) {
+	room, err := h.rooms.Get(event.RoomID)
+	if err != nil {
+		return
+	}
+
+	h.emitBotEvents(h.plugins.After(room, event))
+}
+
+func (h *Hub) handlePluginTick(now time.Time) {
+	rooms, _ := h.rooms.GetAll()
+	h.emitBotEvents(h.plugins.Tick(rooms, now))
+}
+
+// emitBotEvents применяет и рассылает события ботов. Правки ботов проходят тот
+// же путь, что и правки клиентов, но без BeforeHook: плагины доверенные.
+func (h *Hub) emitBotEvents(queue []domain.Event) {
+	for i := 0; i < len(queue); i++ {
+		if i == maxBotEvents {
+			slog.Warn("Plugins emitted too many events in a chain", "limit", maxBotEvents, "dropped", len(queue)-i)
+			return
+		}
+
+		event := queue[i]
+		room, err := h.rooms.Get(event.RoomID)
+		if err != nil {
+			continue
+		}
+
+		if isEdit(event.Type) {
+			if room.ReadOnly {
+				slog.Info("Bot edit skipped, room is read-only", logging.KeyRoom, room.ID, logging.KeyClient, event.UserID, logging.KeyEvent, event.Type)
+				continue
+			}
+
+			committed, reply := h.commitEdit(event)
+			if reply.Type == domain.EventNack {
+				slog.Warn("Bot edit rejected", logging.KeyRoom, room.ID, logging.KeyClient, event.UserID, logging.KeyEvent, event.Type, "reply", reply.Payload)
+				continue
+			}
+			event = committed
+		} else {
+			h.handleBroadcast(event)
+			if event.Type == domain.EventChatMessage {
+				h.accept(event)
+			}
+		}
+
+		queue = append(queue, h.plugins.After(room, event)...)
+	}
+}
+
+// pluginRejection возвращает код и причину отказа плагина для nack и error.
+func pluginRejection(err error) (string, string) {
+	if errors.Is(err, plugin.ErrDrop) {
+		return "dropped", err.Error()
+	}
+	return "vetoed", err.Error()
+}
+
+// username ищет имя участника для плагинов; вызывается из Run.
+func (h *Hub) username(userID string) string {
+	if client, ok := h.clients[userID]; ok {
+		return client.Username
+	}
+	return ""
+}
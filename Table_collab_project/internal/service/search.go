@@ -0,0 +1,108 @@
+package service
+
+import (
+	"time"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/service/search"
+)
+
+// accept фиксирует принятое событие: дописывает его в журнал комнаты и
+// обновляет поисковый индекс. Вызывается из Run после применения события.
+func (h *Hub) accept(event domain.Event) {
+	h.appendLog(event)
+	h.indexEvent(event)
+}
+
+// indexEvent обновляет в индексе только то, что изменило событие.
+func (h *Hub) indexEvent(event domain.Event) {
+	switch event.Type {
+	case domain.EventRoomCreated:
+		var payload domain.RoomCreatedPayload
+		if domain.DecodePayload(event, &payload) == nil && payload.Room != nil {
+			h.search.PutRoom(payload.Room)
+		}
+
+	case domain.EventRoomClosed:
+		h.search.RemoveRoom(event.RoomID)
+
+	case domain.EventTextUpdate:
+		if room, err := h.rooms.Get(event.RoomID); err == nil {
+			h.search.Put(search.Document{
+				RoomID: room.ID,
+				Kind:   search.KindText,
+				Text:   room.Content,
+				Time:   time.UnixMilli(event.Timestamp),
+			})
+		}
+
+	case domain.EventCellUpdate:
+		var payload domain.CellUpdatePayload
+		if domain.DecodePayload(event, &payload) != nil {
+			return
+		}
+		h.search.Put(search.Document{
+			RoomID: event.RoomID,
+			Kind:   search.KindCell,
+			Key:    search.CellKey(payload.SheetID, payload.Cell),
+			Text:   payload.Value,
+			UserID: event.UserID,
+			Time:   time.UnixMilli(event.Timestamp),
+		})
+
+	case domain.EventSheetDuplicate, domain.EventSheetDelete:
+		if room, err := h.rooms.Get(event.RoomID); err == nil {
+			h.search.PutRoom(room)
+		}
+
+	case domain.EventChatMessage:
+		h.indexChat(event, h.username(event.UserID))
+	}
+}
+
+func (h *Hub) indexChat(event domain.Event, username string) {
+	var payload struct {
+		Text     string `json:"text"`
+		Username string `json:"username"`
+	}
+	if domain.DecodePayload(event, &payload) != nil {
+		return
+	}
+	// Имя бота приходит в самом сообщении, его нет среди клиентов
+	if username == "" {
+		username = payload.Username
+	}
+
+	h.search.AddChat(search.Document{
+		RoomID:   event.RoomID,
+		Text:     payload.Text,
+		UserID:   event.UserID,
+		Username: username,
+		Time:     time.UnixMilli(event.Timestamp),
+	})
+}
+
+// indexLoggedChat восстанавливает в индексе чат комнаты из её журнала: в
+// состоянии комнаты сообщений нет. Вызывается из NewHub после воспроизведения.
+func (h *Hub) indexLoggedChat(roomID string) error {
+	entries, err := h.eventLog.Entries(roomID, 0, 0)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		switch entry.Event.Type {
+		case domain.EventChatMessage:
+			h.indexChat(entry.Event, "")
+		case domain.EventRoomCreated:
+			// Комната с тем же ID создана заново: прежний чат к ней не относится
+			h.search.RemoveRoom(roomID)
+		}
+	}
+	return nil
+}
+
+// Search ищет по комнатам, названиям, тексту, ячейкам и чату. Вызывающий
+// передаёт в query.Rooms комнаты, доступные пользователю (nil — все).
+func (h *Hub) Search(query search.Query) search.Result {
+	return h.search.Search(query)
+}
@@ -0,0 +1,358 @@
+// Package search — встроенный полнотекстовый индекс по комнатам: названия,
+// текст документов, значения ячеек и сообщения чата. Индекс живёт в памяти и
+// обновляется по одному документу на каждое принятое событие.
+package search
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"table_collab/internal/domain"
+)
+
+// Kind — что именно найдено.
+type Kind string
+
+const (
+	KindRoom Kind = "room"
+	KindText Kind = "text"
+	KindCell Kind = "cell"
+	KindChat Kind = "chat"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Document — единица индексации. Key различает документы одного вида в
+// комнате: ячейку ("sheet1!B3", см. CellKey) или номер сообщения чата.
+type Document struct {
+	RoomID   string
+	Kind     Kind
+	Key      string
+	Text     string
+	UserID   string
+	Username string
+	Time     time.Time
+}
+
+// Query — поисковый запрос. Rooms == nil — искать во всех комнатах,
+// пустой срез — ни в одной.
+type Query struct {
+	Text  string
+	Rooms []string
+	Kinds []Kind
+	Limit int
+}
+
+type Hit struct {
+	RoomID   string    `json:"room_id"`
+	RoomName string    `json:"room_name"`
+	Kind     Kind      `json:"kind"`
+	Key      string    `json:"key,omitempty"`
+	Score    float64   `json:"score"`
+	UserID   string    `json:"user_id,omitempty"`
+	Username string    `json:"username,omitempty"`
+	Time     time.Time `json:"time"`
+	Snippet
+}
+
+type Result struct {
+	Total int   `json:"total"`
+	Hits  []Hit `json:"hits"`
+}
+
+type entry struct {
+	doc   Document
+	terms map[string]int
+}
+
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]*entry
+	postings map[string]map[string]int
+	rooms    map[string]map[string]struct{}
+	chat     map[string][]string
+	chatSeq  map[string]uint64
+	maxChat  int
+}
+
+// NewIndex создаёт индекс, хранящий не больше maxChat последних сообщений
+// чата на комнату (0 — без ограничения).
+func NewIndex(maxChat int) *Index {
+	return &Index{
+		docs:     make(map[string]*entry),
+		postings: make(map[string]map[string]int),
+		rooms:    make(map[string]map[string]struct{}),
+		chat:     make(map[string][]string),
+		chatSeq:  make(map[string]uint64),
+		maxChat:  maxChat,
+	}
+}
+
+// Put индексирует документ, заменяя прежнюю версию с тем же RoomID, Kind и Key.
+// Документ с пустым текстом удаляется.
+func (x *Index) Put(doc Document) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.put(doc)
+}
+
+func (x *Index) Remove(roomID string, kind Kind, key string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(docID(roomID, kind, key))
+}
+
+// AddChat добавляет сообщение чата под следующим номером в комнате и
+// вытесняет самые старые сверх лимита.
+func (x *Index) AddChat(doc Document) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.chatSeq[doc.RoomID]++
+	doc.Kind = KindChat
+	doc.Key = strconv.FormatUint(x.chatSeq[doc.RoomID], 10)
+	if !x.put(doc) {
+		return
+	}
+
+	ids := append(x.chat[doc.RoomID], docID(doc.RoomID, doc.Kind, doc.Key))
+	for x.maxChat > 0 && len(ids) > x.maxChat {
+		x.remove(ids[0])
+		ids = ids[1:]
+	}
+	x.chat[doc.RoomID] = ids
+}
+
+// CellKey — ключ документа ячейки: ID листа и адрес.
+func CellKey(sheetID, cell string) string {
+	return sheetID + "!" + strings.ToUpper(cell)
+}
+
+// PutRoom переиндексирует название, текст и ячейки всех листов комнаты. Чат
+// не трогает: его нет в состоянии комнаты.
+func (x *Index) PutRoom(room *domain.Room) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for id := range x.rooms[room.ID] {
+		if x.docs[id].doc.Kind != KindChat {
+			x.remove(id)
+		}
+	}
+
+	x.put(Document{RoomID: room.ID, Kind: KindRoom, Text: room.Name, Time: room.CreatedAt})
+	x.put(Document{RoomID: room.ID, Kind: KindText, Text: room.Content, Time: room.UpdatedAt})
+	for _, sheet := range room.Sheets {
+		for cell, text := range sheet.Cells {
+			x.put(Document{RoomID: room.ID, Kind: KindCell, Key: CellKey(sheet.ID, cell), Text: text, Time: room.UpdatedAt})
+		}
+	}
+}
+
+// RemoveRoom удаляет из индекса всё, что относится к комнате.
+func (x *Index) RemoveRoom(roomID string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for id := range x.rooms[roomID] {
+		x.remove(id)
+	}
+	delete(x.chat, roomID)
+	delete(x.chatSeq, roomID)
+}
+
+// Search находит документы, содержащие все слова запроса. Слово с "*" на
+// конце ищется как префикс. Результаты упорядочены по TF-IDF, при равенстве —
+// от новых к старым.
+func (x *Index) Search(q Query) Result {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	words := parseQuery(q.Text)
+	if len(words) == 0 {
+		return Result{Hits: []Hit{}}
+	}
+
+	var rooms map[string]bool
+	if q.Rooms != nil {
+		rooms = make(map[string]bool, len(q.Rooms))
+		for _, roomID := range q.Rooms {
+			rooms[roomID] = true
+		}
+	}
+	kinds := make(map[Kind]bool, len(q.Kinds))
+	for _, kind := range q.Kinds {
+		kinds[kind] = true
+	}
+
+	var scores map[string]float64
+	for _, word := range words {
+		matched := make(map[string]float64)
+		for _, term := range x.expand(word) {
+			docs := x.postings[term]
+			idf := math.Log(1 + float64(len(x.docs))/float64(len(docs)))
+			for id, tf := range docs {
+				if scores == nil || scores[id] > 0 {
+					matched[id] += float64(tf) * idf
+				}
+			}
+		}
+
+		// Документ остаётся, только если в нём нашлось каждое слово
+		for id, score := range matched {
+			if scores != nil {
+				matched[id] = score + scores[id]
+			}
+		}
+		scores = matched
+		if len(scores) == 0 {
+			break
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		doc := x.docs[id].doc
+		if rooms != nil && !rooms[doc.RoomID] || len(kinds) > 0 && !kinds[doc.Kind] {
+			continue
+		}
+		hits = append(hits, Hit{
+			RoomID:   doc.RoomID,
+			Kind:     doc.Kind,
+			Key:      doc.Key,
+			Score:    math.Round(score*1000) / 1000,
+			UserID:   doc.UserID,
+			Username: doc.Username,
+			Time:     doc.Time,
+		})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if !hits[i].Time.Equal(hits[j].Time) {
+			return hits[i].Time.After(hits[j].Time)
+		}
+		return docID(hits[i].RoomID, hits[i].Kind, hits[i].Key) < docID(hits[j].RoomID, hits[j].Kind, hits[j].Key)
+	})
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	result := Result{Total: len(hits)}
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	// Сниппеты строим только для отданной страницы
+	for i := range hits {
+		hit := &hits[i]
+		hit.RoomName = x.roomName(hit.RoomID)
+		hit.Snippet = makeSnippet(x.docs[docID(hit.RoomID, hit.Kind, hit.Key)].doc.Text, words)
+	}
+	result.Hits = hits
+	return result
+}
+
+// Stats возвращает число документов и различных слов в индексе.
+func (x *Index) Stats() (docs, terms int) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.docs), len(x.postings)
+}
+
+func (x *Index) put(doc Document) bool {
+	id := docID(doc.RoomID, doc.Kind, doc.Key)
+	x.remove(id)
+
+	terms := make(map[string]int)
+	for _, tok := range tokenize(doc.Text) {
+		terms[tok.term]++
+	}
+	if len(terms) == 0 {
+		return false
+	}
+
+	x.docs[id] = &entry{doc: doc, terms: terms}
+	for term, tf := range terms {
+		docs, ok := x.postings[term]
+		if !ok {
+			docs = make(map[string]int)
+			x.postings[term] = docs
+		}
+		docs[id] = tf
+	}
+
+	room, ok := x.rooms[doc.RoomID]
+	if !ok {
+		room = make(map[string]struct{})
+		x.rooms[doc.RoomID] = room
+	}
+	room[id] = struct{}{}
+	return true
+}
+
+func (x *Index) remove(id string) {
+	e, ok := x.docs[id]
+	if !ok {
+		return
+	}
+
+	for term := range e.terms {
+		docs := x.postings[term]
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(x.postings, term)
+		}
+	}
+	delete(x.docs, id)
+
+	if room := x.rooms[e.doc.RoomID]; room != nil {
+		delete(room, id)
+		if len(room) == 0 {
+			delete(x.rooms, e.doc.RoomID)
+		}
+	}
+}
+
+// expand возвращает слова индекса, подходящие под слово запроса.
+func (x *Index) expand(word queryWord) []string {
+	if !word.prefix {
+		if _, ok := x.postings[word.term]; ok {
+			return []string{word.term}
+		}
+		return nil
+	}
+
+	var terms []string
+	for term := range x.postings {
+		if strings.HasPrefix(term, word.term) {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+func (x *Index) roomName(roomID string) string {
+	if e, ok := x.docs[docID(roomID, KindRoom, "")]; ok {
+		return e.doc.Text
+	}
+	return roomID
+}
+
+func docID(roomID string, kind Kind, key string) string {
+	return roomID + "\x00" + string(kind) + "\x00" + key
+}
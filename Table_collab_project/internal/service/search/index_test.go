@@ -0,0 +1,139 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"table_collab/internal/domain"
+)
+
+func testIndex() *Index {
+	x := NewIndex(3)
+	x.PutRoom(&domain.Room{
+		ID:      "budget",
+		Name:    "Бюджет 2026",
+		Content: "Quarterly budget review. The marketing budget grows next quarter.",
+		Sheets: []*domain.Sheet{{ID: "s1", Name: "Costs", Cells: map[string]string{
+			"A1": "Marketing",
+			"B1": "1200",
+		}}},
+	})
+	x.PutRoom(&domain.Room{ID: "notes", Name: "Team notes", Content: "Retro: ship <b>faster</b>, review marketing plan"})
+	return x
+}
+
+func keys(result Result) []string {
+	var keys []string
+	for _, hit := range result.Hits {
+		keys = append(keys, hit.RoomID+"/"+string(hit.Kind)+"/"+hit.Key)
+	}
+	return keys
+}
+
+func TestSearch(t *testing.T) {
+	x := testIndex()
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"all words required", Query{Text: "marketing budget"}, []string{"budget/text/"}},
+		{"case insensitive", Query{Text: "MARKETING"}, []string{"budget/cell/s1!A1", "budget/text/", "notes/text/"}},
+		{"cyrillic room name", Query{Text: "бюджет"}, []string{"budget/room/"}},
+		{"prefix", Query{Text: "quart*"}, []string{"budget/text/"}},
+		{"no prefix without star", Query{Text: "quart"}, nil},
+		{"scoped to rooms", Query{Text: "marketing", Rooms: []string{"notes"}}, []string{"notes/text/"}},
+		{"empty scope", Query{Text: "marketing", Rooms: []string{}}, nil},
+		{"kinds", Query{Text: "marketing", Kinds: []Kind{KindCell}}, []string{"budget/cell/s1!A1"}},
+		{"number in cell", Query{Text: "1200"}, []string{"budget/cell/s1!B1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := keys(x.Search(tt.query))
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchRanksByFrequency(t *testing.T) {
+	x := testIndex()
+
+	// "budget" дважды встречается в тексте и ни разу — в ячейках
+	result := x.Search(Query{Text: "budget", Limit: 1})
+	if result.Total != 1 || result.Hits[0].RoomName != "Бюджет 2026" {
+		t.Fatalf("result = %+v", result)
+	}
+}
+
+func TestSnippetHighlighting(t *testing.T) {
+	x := testIndex()
+
+	hit := x.Search(Query{Text: "faster"}).Hits[0]
+	if hit.Snippet.Snippet != "Retro: ship <b>faster</b>, review marketing plan" {
+		t.Fatalf("snippet = %q", hit.Snippet.Snippet)
+	}
+	if len(hit.Highlights) != 1 || hit.Highlights[0] != (Range{Start: 15, End: 21}) {
+		t.Fatalf("highlights = %+v", hit.Highlights)
+	}
+	want := "Retro: ship &lt;b&gt;<mark>faster</mark>&lt;/b&gt;, review marketing plan"
+	if hit.Highlighted != want {
+		t.Fatalf("highlighted = %q", hit.Highlighted)
+	}
+}
+
+func TestSnippetWindow(t *testing.T) {
+	text := strings.Repeat("lorem ipsum ", 20) + "needle " + strings.Repeat("dolor sit ", 20)
+	snippet := makeSnippet(text, parseQuery("needle"))
+
+	if !strings.HasPrefix(snippet.Snippet, "…") || !strings.HasSuffix(snippet.Snippet, "…") {
+		t.Fatalf("snippet is not trimmed: %q", snippet.Snippet)
+	}
+	if len([]rune(snippet.Snippet)) > 2*snippetRadius+len("needle")+2 {
+		t.Fatalf("snippet is too long: %q", snippet.Snippet)
+	}
+	body := strings.Trim(snippet.Snippet, "…")
+	if strings.HasPrefix(body, "orem") || strings.HasSuffix(body, "olo") {
+		t.Fatalf("snippet cuts words: %q", snippet.Snippet)
+	}
+
+	r := snippet.Highlights[0]
+	if got := string([]rune(snippet.Snippet)[r.Start:r.End]); got != "needle" {
+		t.Fatalf("highlight points at %q", got)
+	}
+}
+
+func TestIncrementalUpdates(t *testing.T) {
+	x := testIndex()
+
+	x.Put(Document{RoomID: "budget", Kind: KindCell, Key: CellKey("s1", "a1"), Text: "Sales"})
+	if got := keys(x.Search(Query{Text: "marketing", Kinds: []Kind{KindCell}})); got != nil {
+		t.Fatalf("stale cell value still found: %v", got)
+	}
+	x.Put(Document{RoomID: "budget", Kind: KindCell, Key: CellKey("s1", "A1"), Text: ""})
+	if got := keys(x.Search(Query{Text: "sales"})); got != nil {
+		t.Fatalf("cleared cell still found: %v", got)
+	}
+
+	for i, text := range []string{"deploy one", "deploy two", "deploy three", "deploy four"} {
+		x.AddChat(Document{RoomID: "notes", Text: text, UserID: "u1", Time: time.Unix(int64(i), 0)})
+	}
+	// Лимит — 3 сообщения: первое вытеснено, новые идут первыми
+	if got := keys(x.Search(Query{Text: "deploy"})); strings.Join(got, ",") != "notes/chat/4,notes/chat/3,notes/chat/2" {
+		t.Fatalf("chat hits = %v", got)
+	}
+
+	x.PutRoom(&domain.Room{ID: "notes", Name: "Renamed"})
+	if x.Search(Query{Text: "deploy"}).Total != 3 {
+		t.Fatal("PutRoom must keep chat")
+	}
+
+	x.RemoveRoom("notes")
+	if docs, _ := x.Stats(); x.Search(Query{Text: "deploy renamed"}).Total != 0 || docs != 3 {
+		t.Fatalf("room is not removed: %d docs left", docs)
+	}
+}
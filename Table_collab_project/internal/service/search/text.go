@@ -0,0 +1,147 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// snippetRadius — сколько символов контекста показывать вокруг первого совпадения.
+const snippetRadius = 60
+
+type token struct {
+	term       string
+	start, end int // в рунах
+}
+
+type queryWord struct {
+	term   string
+	prefix bool
+}
+
+// Range — совпадение в сниппете, смещения в рунах.
+type Range struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Snippet — фрагмент документа вокруг совпадения. Highlighted — тот же текст
+// с экранированным HTML и совпадениями в <mark>.
+type Snippet struct {
+	Snippet     string  `json:"snippet"`
+	Highlights  []Range `json:"highlights"`
+	Highlighted string  `json:"highlighted"`
+}
+
+// tokenize разбивает текст на слова из букв и цифр в нижнем регистре.
+func tokenize(text string) []token {
+	var tokens []token
+	var word []rune
+	start, pos := 0, 0
+
+	flush := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, token{term: string(word), start: start, end: pos})
+			word = word[:0]
+		}
+	}
+
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if len(word) == 0 {
+				start = pos
+			}
+			word = append(word, unicode.ToLower(r))
+		} else {
+			flush()
+		}
+		pos++
+	}
+	flush()
+	return tokens
+}
+
+// parseQuery разбирает запрос на слова; "*" в конце слова запроса делает
+// последнюю его часть префиксом.
+func parseQuery(text string) []queryWord {
+	var words []queryWord
+	seen := make(map[queryWord]bool)
+	for _, field := range strings.Fields(text) {
+		tokens := tokenize(field)
+		for i, tok := range tokens {
+			word := queryWord{term: tok.term, prefix: i == len(tokens)-1 && strings.HasSuffix(field, "*")}
+			if !seen[word] {
+				seen[word] = true
+				words = append(words, word)
+			}
+		}
+	}
+	return words
+}
+
+func (w queryWord) matches(term string) bool {
+	if w.prefix {
+		return strings.HasPrefix(term, w.term)
+	}
+	return term == w.term
+}
+
+// makeSnippet вырезает из текста окно вокруг первого совпадения и отмечает
+// в нём все совпадения.
+func makeSnippet(text string, words []queryWord) Snippet {
+	runes := []rune(text)
+
+	var matches []token
+	for _, tok := range tokenize(text) {
+		for _, word := range words {
+			if word.matches(tok.term) {
+				matches = append(matches, tok)
+				break
+			}
+		}
+	}
+
+	// Без совпадений (например, нашлось только название комнаты) — начало текста
+	var anchor token
+	if len(matches) > 0 {
+		anchor = matches[0]
+	}
+	from := max(0, anchor.start-snippetRadius)
+	to := min(len(runes), anchor.end+snippetRadius)
+	// Не режем слова посередине
+	for from > 0 && from < anchor.start && !unicode.IsSpace(runes[from-1]) {
+		from++
+	}
+	for to < len(runes) && to > anchor.end && !unicode.IsSpace(runes[to]) {
+		to--
+	}
+
+	prefix, suffix := "", ""
+	if from > 0 {
+		prefix = "…"
+	}
+	if to < len(runes) {
+		suffix = "…"
+	}
+	shift := len([]rune(prefix)) - from
+
+	snippet := Snippet{Snippet: prefix + string(runes[from:to]) + suffix, Highlights: []Range{}}
+	var highlighted strings.Builder
+	highlighted.WriteString(prefix)
+	last := from
+	for _, m := range matches {
+		if m.start < from || m.end > to {
+			continue
+		}
+		snippet.Highlights = append(snippet.Highlights, Range{Start: m.start + shift, End: m.end + shift})
+		highlighted.WriteString(html.EscapeString(string(runes[last:m.start])))
+		highlighted.WriteString("<mark>")
+		highlighted.WriteString(html.EscapeString(string(runes[m.start:m.end])))
+		highlighted.WriteString("</mark>")
+		last = m.end
+	}
+	highlighted.WriteString(html.EscapeString(string(runes[last:to])))
+	highlighted.WriteString(suffix)
+	snippet.Highlighted = highlighted.String()
+	return snippet
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"table_collab/internal/domain"
+	"table_collab/pkg/utils"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found or expired")
+	ErrResumeGap       = errors.New("missed events are no longer available")
+)
+
+// session переживает обрыв соединения: хранит последние исходящие события клиента,
+// чтобы после переподключения дослать пропущенное. Доступ только из Hub.Run.
+type session struct {
+	token    string
+	clientID string
+	roomID   string
+	nextSeq  uint64
+	buffer   []domain.Event
+	limit    int
+	detached bool
+	timer    *time.Timer
+	ops      map[string]domain.Event
+	opOrder  []string
+}
+
+func newSession(client *Client, limit int) *session {
+	if limit <= 0 {
+		limit = 256
+	}
+	return &session{
+		token:    utils.GenerateToken(),
+		clientID: client.ID,
+		roomID:   client.RoomID,
+		buffer:   make([]domain.Event, 0, limit),
+		limit:    limit,
+		ops:      make(map[string]domain.Event),
+	}
+}
+
+func (s *session) record(event domain.Event) {
+	if len(s.buffer) == s.limit {
+		copy(s.buffer, s.buffer[1:])
+		s.buffer = s.buffer[:len(s.buffer)-1]
+	}
+	s.buffer = append(s.buffer, event)
+}
+
+// since возвращает события с seq больше lastSeq или ErrResumeGap, если часть уже вытеснена.
+func (s *session) since(lastSeq uint64) ([]domain.Event, error) {
+	if lastSeq > s.nextSeq {
+		return nil, ErrResumeGap
+	}
+	if lastSeq == s.nextSeq {
+		return nil, nil
+	}
+	if len(s.buffer) == 0 || s.buffer[0].Seq > lastSeq+1 {
+		return nil, ErrResumeGap
+	}
+
+	start := int(lastSeq + 1 - s.buffer[0].Seq)
+	missed := make([]domain.Event, len(s.buffer)-start)
+	copy(missed, s.buffer[start:])
+	return missed, nil
+}
+
+func (h *Hub) startSession(client *Client) {
+	s := newSession(client, h.config.WebSocket.ResumeBufferSize)
+	h.sessions[s.token] = s
+	client.session = s
+
+	h.sendSession(client, false)
+}
+
+func (h *Hub) sendSession(client *Client, resumed bool) {
+	event := domain.Event{
+		Type:      domain.EventSession,
+		RoomID:    client.RoomID,
+		UserID:    client.ID,
+		Timestamp: time.Now().UnixMilli(),
+		Payload: domain.SessionPayload{
+			ClientID:     client.ID,
+			ResumeToken:  client.session.token,
+			GraceSeconds: h.config.WebSocket.ResumeGracePeriod,
+			Resumed:      resumed,
+			LastSeq:      client.session.nextSeq,
+		},
+	}
+
+	client.send.push(event)
+}
+
+// detach держит место клиента в комнате в течение grace-периода вместо немедленного выхода.
+func (h *Hub) detach(client *Client) {
+	s := client.session
+	s.detached = true
+
+	grace := time.Duration(h.config.WebSocket.ResumeGracePeriod) * time.Second
+	s.timer = time.AfterFunc(grace, func() {
+		h.do(func() {
+			if s.detached && h.clients[s.clientID] == client {
+				client.logger().Info("Session expired")
+				h.removeClient(client)
+			}
+		})
+	})
+
+	client.logger().Info("Client detached, waiting for resume", "grace", grace)
+}
+
+// Resume переносит сессию на новое соединение и досылает пропущенные события.
+func (h *Hub) Resume(client *Client, token string, lastSeq uint64) error {
+	var result error
+	err := h.do(func() {
+		result = h.handleResume(client, token, lastSeq)
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+func (h *Hub) handleResume(client *Client, token string, lastSeq uint64) error {
+	s, ok := h.sessions[token]
+	if !ok || s.roomID != client.RoomID {
+		return ErrSessionNotFound
+	}
+	old, ok := h.clients[s.clientID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	missed, err := s.since(lastSeq)
+	if err == nil && len(missed) > client.send.capacity()-1 {
+		err = ErrResumeGap
+	}
+	if err != nil {
+		if !s.detached {
+			return err
+		}
+		h.removeClient(old)
+		return err
+	}
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.detached = false
+
+	client.ID = old.ID
+	client.Username = old.Username
+	client.Color = old.Color
+	client.ConnectedAt = old.ConnectedAt
+	client.muted = old.muted
+	client.sheet = old.sheet
+	client.session = s
+
+	h.mu.Lock()
+	h.clients[client.ID] = client
+	h.mu.Unlock()
+
+	// Старое соединение могло ещё не заметить обрыв: закрываем его без выхода из комнаты.
+	go old.Close()
+
+	h.sendSession(client, true)
+	client.send.setPolicy(old.send.policy)
+	for _, event := range missed {
+		client.send.push(event)
+	}
+
+	client.logger().Info("Client resumed session", "replayed", len(missed))
+	return nil
+}
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/logging"
+	"table_collab/internal/service/collaboration"
+	"table_collab/pkg/utils"
+)
+
+// MaxSharesPerRoom ограничивает число действующих ссылок share на комнату.
+const MaxSharesPerRoom = 50
+
+var (
+	ErrShareNotFound     = errors.New("share link not found or expired")
+	ErrTooManyShares     = errors.New("too many share links for the room")
+	ErrTooManySpectators = errors.New("too many spectators in the room")
+	ErrSpectator         = errors.New("spectators cannot send events")
+)
+
+// CreateShare создаёт ссылку только для чтения на существующую комнату.
+// ttl == 0 — бессрочная ссылка.
+func (h *Hub) CreateShare(roomID, label string, ttl time.Duration) (domain.ShareLink, error) {
+	var link domain.ShareLink
+	var result error
+	err := h.do(func() {
+		if _, err := h.rooms.Get(roomID); err != nil {
+			result = ErrRoomNotFound
+			return
+		}
+		if len(h.roomShares(roomID)) >= MaxSharesPerRoom {
+			result = ErrTooManyShares
+			return
+		}
+
+		created := &domain.ShareLink{
+			Token:     utils.GenerateToken(),
+			RoomID:    roomID,
+			Label:     label,
+			CreatedAt: time.Now(),
+		}
+		if ttl > 0 {
+			expires := created.CreatedAt.Add(ttl)
+			created.ExpiresAt = &expires
+		}
+		h.shares[created.Token] = created
+		h.saveShares()
+
+		slog.Info("Share link created", logging.KeyRoom, roomID, "label", label, "ttl", ttl)
+		link = *created
+	})
+	if err != nil {
+		return link, err
+	}
+	return link, result
+}
+
+// ListShares возвращает действующие ссылки комнаты, от старых к новым.
+func (h *Hub) ListShares(roomID string) ([]domain.ShareLink, error) {
+	var links []domain.ShareLink
+	err := h.do(func() {
+		for _, link := range h.roomShares(roomID) {
+			links = append(links, *link)
+		}
+	})
+
+	sort.Slice(links, func(i, j int) bool { return links[i].CreatedAt.Before(links[j].CreatedAt) })
+	return links, err
+}
+
+// RevokeShare отзывает ссылку и отключает зрителей, вошедших по ней.
+func (h *Hub) RevokeShare(roomID, token string) error {
+	var result error
+	err := h.do(func() {
+		link, ok := h.shares[token]
+		if !ok || link.RoomID != roomID {
+			result = ErrShareNotFound
+			return
+		}
+		delete(h.shares, token)
+		h.saveShares()
+
+		if a := h.audiences[roomID]; a != nil {
+			for _, spectator := range a.list() {
+				if spectator.share == token {
+					go spectator.CloseWithReason(websocket.ClosePolicyViolation, "share link revoked")
+				}
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// ShareRoom возвращает комнату, на которую ведёт ссылка share. Транспорты
+// вызывают его до открытия соединения, чтобы отказать обычным HTTP-ответом;
+// окончательно ссылку проверяет регистрация зрителя.
+func (h *Hub) ShareRoom(token string) (string, error) {
+	var roomID string
+	err := h.do(func() {
+		if link, ok := h.shares[token]; ok && h.share(link.RoomID, token) != nil {
+			roomID = link.RoomID
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if roomID == "" {
+		return "", ErrShareNotFound
+	}
+	return roomID, nil
+}
+
+// ConnectSpectator подключает анонимного зрителя по ссылке share. Зритель
+// входит в комнату сразу, без join_room: получает sync и дальше только
+// изменения содержимого. Отправлять события он не может.
+func (h *Hub) ConnectSpectator(ctx context.Context, transport Transport, roomID, token string) *Client {
+	client := NewClient(transport, h, roomID)
+	client.share = token
+	client.log = logging.FromContext(ctx).With("transport", transport.Name(), "spectator", true)
+	client.conn = trace.LinkFromContext(ctx)
+
+	var result error
+	if err := h.do(func() { result = h.addSpectator(client) }); err != nil {
+		result = err
+	}
+	if result != nil {
+		client.logger().Info("Spectator rejected", logging.Err(result))
+		client.CloseWithReason(websocket.ClosePolicyViolation, result.Error())
+		return client
+	}
+
+	client.logger().Info("Spectator connected", "remote", client.RemoteAddr)
+
+	go client.WritePump()
+	go client.ReadPump()
+
+	return client
+}
+
+// addSpectator вызывается из Run.
+func (h *Hub) addSpectator(client *Client) error {
+	if h.share(client.RoomID, client.share) == nil {
+		return ErrShareNotFound
+	}
+	room, err := h.rooms.Get(client.RoomID)
+	if err != nil {
+		return ErrRoomNotFound
+	}
+	if limit := h.config.App.MaxSpectatorsPerRoom; limit > 0 && room.SpectatorCount >= limit {
+		return ErrTooManySpectators
+	}
+
+	a := h.audiences[room.ID]
+	if a == nil {
+		a = newAudience(h.config.WebSocket)
+		h.audiences[room.ID] = a
+		go a.run()
+	}
+	room.SpectatorCount++
+	h.rooms.Save(room)
+
+	// Название комнаты, созданной входом, совпадает с её ID, а форк ссылается
+	// на исходную комнату: ни то, ни другое зритель не получает
+	name := room.Name
+	if name == room.ID {
+		name = ""
+	}
+
+	// Sync уходит через очередь audience, поэтому содержимое копируется. Зритель
+	// ничего не может менять и не видит присутствия, комментариев и блокировок.
+	a.add(client, domain.Event{
+		Type:      domain.EventSync,
+		RoomID:    room.ID,
+		Timestamp: time.Now().UnixMilli(),
+		Version:   room.Version,
+		Payload: domain.SyncPayload{
+			Name:         name,
+			Type:         room.Type,
+			Content:      room.Content,
+			Table:        collaboration.CloneTable(room.TableData),
+			Sheets:       collaboration.CloneSheets(room.Sheets),
+			Version:      room.Version,
+			ReadOnly:     true,
+			Spectator:    true,
+			Participants: []domain.Participant{},
+			Views:        visibleViews(room, ""),
+			Attachments:  cloneAttachments(room.Attachments),
+		},
+	})
+	return nil
+}
+
+// removeSpectator вызывается из Run, когда соединение зрителя закрылось.
+func (h *Hub) removeSpectator(client *Client) {
+	a := h.audiences[client.RoomID]
+	if a == nil || !a.remove(client) {
+		return
+	}
+	if a.size() == 0 {
+		a.stop()
+		delete(h.audiences, client.RoomID)
+	}
+
+	if room, err := h.rooms.Get(client.RoomID); err == nil && room.SpectatorCount > 0 {
+		room.SpectatorCount--
+		h.rooms.Save(room)
+	}
+	client.logger().Info("Spectator left")
+}
+
+// showSpectators отдаёт событие зрителям комнаты. Раздаёт его горутина
+// audience, поэтому Run тратит на это одно и то же время при любом числе
+// зрителей.
+func (h *Hub) showSpectators(event domain.Event) {
+	a := h.audiences[event.RoomID]
+	if a == nil || !forSpectators(event.Type) {
+		return
+	}
+	// Трасса заканчивается на хабе: спан отправки на каждого из сотен зрителей
+	// стоил бы дороже самой рассылки
+	event.TraceParent, event.TraceState = "", ""
+	if !a.push(event) {
+		slog.Warn("Spectator queue overflow, disconnecting spectators", logging.KeyRoom, event.RoomID)
+		h.closeSpectators(event.RoomID, CloseTooSlow, "too slow, resync")
+	}
+}
+
+// closeSpectators отключает всех зрителей комнаты; они уйдут из audience,
+// когда закроются их ReadPump.
+func (h *Hub) closeSpectators(roomID string, code int, reason string) {
+	if a := h.audiences[roomID]; a != nil {
+		for _, spectator := range a.list() {
+			go spectator.CloseWithReason(code, reason)
+		}
+	}
+}
+
+// forSpectators отбирает события, которые видят зрители: изменения
+// содержимого, но не присутствие, курсоры, чат, комментарии и блокировки.
+func forSpectators(eventType domain.EventType) bool {
+	switch eventType {
+	case domain.EventCellsComputed, domain.EventViewUpdated, domain.EventViewDelete,
+		domain.EventViewRows, domain.EventSystem,
+		domain.EventAttachmentAdded, domain.EventAttachmentRemoved:
+		return true
+	default:
+		return isEdit(eventType)
+	}
+}
+
+// share возвращает действующую ссылку комнаты; истёкшие ссылки удаляются.
+// Вызывается из Run.
+func (h *Hub) share(roomID, token string) *domain.ShareLink {
+	link, ok := h.shares[token]
+	if !ok || link.RoomID != roomID {
+		return nil
+	}
+	if link.Expired(time.Now()) {
+		delete(h.shares, token)
+		h.saveShares()
+		return nil
+	}
+	return link
+}
+
+// roomShares возвращает действующие ссылки комнаты. Вызывается из Run.
+func (h *Hub) roomShares(roomID string) []*domain.ShareLink {
+	var links []*domain.ShareLink
+	for token, link := range h.shares {
+		if link.RoomID == roomID && h.share(roomID, token) != nil {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// dropRoomShares отзывает ссылки закрытой комнаты.
+func (h *Hub) dropRoomShares(roomID string) {
+	dropped := false
+	for token, link := range h.shares {
+		if link.RoomID == roomID {
+			delete(h.shares, token)
+			dropped = true
+		}
+	}
+	if dropped {
+		h.saveShares()
+	}
+}
+
+func (h *Hub) loadShares() {
+	if h.shareStore == nil {
+		return
+	}
+
+	links, err := h.shareStore.Load()
+	if err != nil {
+		slog.Error("Failed to load share links", logging.Err(err))
+		return
+	}
+	now := time.Now()
+	for _, link := range links {
+		if !link.Expired(now) {
+			h.shares[link.Token] = link
+		}
+	}
+}
+
+func (h *Hub) saveShares() {
+	if h.shareStore == nil {
+		return
+	}
+
+	links := make([]*domain.ShareLink, 0, len(h.shares))
+	for _, link := range h.shares {
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].CreatedAt.Before(links[j].CreatedAt) })
+
+	if err := h.shareStore.Save(links); err != nil {
+		slog.Error("Failed to save share links", logging.Err(err))
+	}
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/service/collaboration"
+)
+
+// handleSheetView запоминает, какой лист смотрит клиент, и сообщает об этом
+// остальным участникам.
+func (h *Hub) handleSheetView(client *Client, event domain.Event) {
+	room, err := h.rooms.Get(client.RoomID)
+	if err != nil {
+		h.sendError(client, "room_not_found", ErrRoomNotFound.Error())
+		return
+	}
+
+	var payload domain.SheetViewPayload
+	domain.DecodePayload(event, &payload)
+	sheet, _, err := collaboration.FindSheet(room, payload.SheetID)
+	if err != nil {
+		h.sendError(client, sheetErrorCode(err), err.Error())
+		return
+	}
+	if client.sheet == sheet.ID {
+		return
+	}
+
+	client.sheet = sheet.ID
+	event.Payload = domain.SheetViewPayload{SheetID: sheet.ID}
+	h.handleBroadcast(event)
+}
+
+// sheetChanged досылает автору структурную правку с назначенными сервером ID
+// (остальные получили её рассылкой) и убирает следы удалённого листа.
+func (h *Hub) sheetChanged(room *domain.Room, event domain.Event) {
+	if author, ok := h.clients[event.UserID]; ok && author.RoomID == room.ID {
+		h.deliver(author, event)
+	}
+
+	if event.Type != domain.EventSheetDelete {
+		return
+	}
+	payload := event.Payload.(domain.SheetDeletePayload)
+	for _, client := range h.clients {
+		if client.RoomID == room.ID && client.sheet == payload.SheetID {
+			client.sheet = ""
+		}
+	}
+	h.releaseSheetLocks(room.ID, payload.SheetID)
+}
+
+// broadcastComputed рассылает всем участникам, включая автора правки,
+// пересчитанные значения формул.
+func (h *Hub) broadcastComputed(room *domain.Room, values map[string]map[string]string) {
+	h.handleBroadcast(domain.Event{
+		Type:      domain.EventCellsComputed,
+		RoomID:    room.ID,
+		Timestamp: time.Now().UnixMilli(),
+		Version:   room.Version,
+		Payload:   domain.CellsComputedPayload{Values: values},
+	})
+}
+
+// changedSheets возвращает листы, видимые значения ячеек которых изменила
+// правка: лист самой правки и листы с пересчитанными формулами.
+func changedSheets(event domain.Event, computed map[string]map[string]string) map[string]bool {
+	sheets := make(map[string]bool, len(computed)+1)
+	if payload, ok := event.Payload.(domain.CellUpdatePayload); ok {
+		sheets[payload.SheetID] = true
+	}
+	for sheetID := range computed {
+		sheets[sheetID] = true
+	}
+	return sheets
+}
+
+// participant ищет участника комнаты по имени для столбцов типа user.
+func (h *Hub) participant(roomID string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		for _, client := range h.clients {
+			if client.RoomID == roomID && strings.EqualFold(client.Username, name) {
+				return client.Username, true
+			}
+		}
+		return "", false
+	}
+}
+
+// sheetNack отвечает на отклонённую правку листа; нарушение правила столбца
+// сообщается с ячейкой и названием правила.
+func sheetNack(event domain.Event, err error) domain.Event {
+	reply := nack(event, sheetErrorCode(err), err.Error())
+	var violation *collaboration.RuleError
+	if errors.As(err, &violation) {
+		payload := reply.Payload.(domain.NackPayload)
+		payload.Cell, payload.Rule = violation.Cell, violation.Rule
+		reply.Payload = payload
+	}
+	return reply
+}
+
+func sheetErrorCode(err error) string {
+	switch {
+	case errors.Is(err, collaboration.ErrSheetNotFound):
+		return "sheet_not_found"
+	case errors.Is(err, collaboration.ErrSheetNameTaken):
+		return "sheet_name_taken"
+	case errors.Is(err, collaboration.ErrLastSheet):
+		return "last_sheet"
+	case errors.Is(err, collaboration.ErrTooManySheets):
+		return "too_many_sheets"
+	case errors.Is(err, collaboration.ErrNotTableRoom):
+		return "wrong_room_type"
+	case errors.Is(err, collaboration.ErrValidation):
+		return "validation_failed"
+	default:
+		return "invalid_payload"
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"table_collab/internal/logging"
+	"table_collab/internal/service/collaboration"
+	"table_collab/internal/service/webhook"
+)
+
+// Shutdown останавливает hub: обрабатывает уже поставленные в очередь события,
+// сохраняет комнаты, дожидается отправки исходящих очередей и закрывает
+// соединения с просьбой переподключиться через reconnectIn.
+func (h *Hub) Shutdown(ctx context.Context, reconnectIn time.Duration) error {
+	h.Stop()
+
+	select {
+	case <-h.stopped:
+	case <-ctx.Done():
+		return fmt.Errorf("hub did not stop: %w", ctx.Err())
+	}
+
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for _, client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+	// Run остановлен, и audiences больше никто не меняет
+	for _, a := range h.audiences {
+		clients = append(clients, a.list()...)
+	}
+
+	reason := fmt.Sprintf("server restarting, reconnect in %d s", int(reconnectIn.Seconds()))
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+	for _, client := range clients {
+		for client.send.len() > 0 && !client.isClosed() && ctx.Err() == nil {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+			}
+		}
+		client.CloseWithReason(websocket.CloseServiceRestart, reason)
+	}
+
+	slog.Info("Closed client connections", "count", len(clients))
+
+	if err := h.webhooks.Stop(ctx); err != nil {
+		return fmt.Errorf("webhook dispatcher did not stop: %w", err)
+	}
+	return ctx.Err()
+}
+
+func (h *Hub) handleShutdown() {
+	// Досылаем то, что уже успело попасть в очереди
+	for drained := false; !drained; {
+		select {
+		case event := <-h.broadcast:
+			h.handleBroadcast(event)
+		case in := <-h.incoming:
+			h.handleIncoming(in)
+		default:
+			drained = true
+		}
+	}
+
+	for _, s := range h.sessions {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+	}
+
+	// Зрители получают то, что уже стоит в очереди раздачи
+	for _, a := range h.audiences {
+		a.stop()
+		<-a.stopped
+	}
+
+	if err := h.persist(); err != nil {
+		slog.Error("Failed to save rooms", logging.Err(err))
+	}
+
+	// Свежие снапшоты, чтобы при старте не воспроизводить длинные хвосты
+	if h.eventLog != nil {
+		h.compactLog(true)
+		if err := h.eventLog.Close(); err != nil {
+			slog.Error("Failed to close event log", logging.Err(err))
+		}
+	}
+
+	slog.Info("Hub stopped")
+}
+
+func (h *Hub) persist() error {
+	if h.snapshots == nil {
+		return nil
+	}
+
+	rooms, _ := h.rooms.GetAll()
+	if err := h.snapshots.Save(rooms); err != nil {
+		return err
+	}
+
+	slog.Info("Saved rooms", "count", len(rooms))
+	h.webhooks.Publish(webhook.EventSnapshotSaved, "", webhook.SnapshotData{
+		Rooms: len(rooms),
+		Path:  h.config.App.SnapshotPath,
+	})
+	return nil
+}
+
+func (h *Hub) restore() {
+	if h.snapshots == nil {
+		return
+	}
+
+	rooms, err := h.snapshots.Load()
+	if err != nil {
+		slog.Error("Failed to load rooms", logging.Err(err))
+		return
+	}
+
+	restored := 0
+	for _, room := range rooms {
+		if _, err := h.rooms.Get(room.ID); err == nil {
+			continue
+		}
+
+		room.ClientCount = 0
+		collaboration.EnsureSheets(room)
+		h.rooms.Save(room)
+		h.recordVersion(room)
+		h.logRoomCreated(room)
+		restored++
+	}
+
+	if restored > 0 {
+		slog.Info("Restored rooms", "count", restored)
+	}
+}
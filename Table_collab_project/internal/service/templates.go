@@ -0,0 +1,340 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/logging"
+	"table_collab/internal/service/collaboration"
+	"table_collab/internal/service/webhook"
+	"table_collab/pkg/utils"
+)
+
+var roomIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+var (
+	ErrTemplateNotFound    = errors.New("template not found")
+	ErrInvalidTemplate     = errors.New("invalid template")
+	ErrMissingPlaceholders = errors.New("missing placeholder values")
+	ErrRoomExists          = errors.New("room already exists")
+	ErrInvalidRoomID       = errors.New("room id may contain only letters, digits, '-' and '_'")
+)
+
+// TemplateRequest описывает новый шаблон: снимок комнаты RoomID или, если
+// она не указана, явно заданное содержимое.
+type TemplateRequest struct {
+	RoomID      string
+	Name        string
+	Description string
+	RoomName    string
+	Type        domain.RoomType
+	Content     string
+	TableData   map[string]interface{}
+	Sheets      []*domain.Sheet
+}
+
+// NewRoomRequest — параметры комнаты, создаваемой из шаблона или форком.
+// Пустой RoomID генерируется; Version == 0 у форка означает текущую версию.
+type NewRoomRequest struct {
+	RoomID  string
+	Name    string
+	Values  map[string]string
+	Version int
+}
+
+func (h *Hub) CreateTemplate(req TemplateRequest) (*domain.RoomTemplate, error) {
+	var template *domain.RoomTemplate
+	var result error
+	err := h.do(func() {
+		template, result = h.createTemplate(req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return template, result
+}
+
+func (h *Hub) createTemplate(req TemplateRequest) (*domain.RoomTemplate, error) {
+	template := &domain.RoomTemplate{
+		ID:          "tpl_" + utils.GenerateID(),
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		RoomName:    req.RoomName,
+		Type:        req.Type,
+		Content:     req.Content,
+		TableData:   collaboration.CloneTable(req.TableData),
+		Sheets:      collaboration.CloneSheets(req.Sheets),
+		CreatedAt:   time.Now(),
+	}
+
+	if req.RoomID != "" {
+		room, err := h.rooms.Get(req.RoomID)
+		if err != nil {
+			return nil, ErrRoomNotFound
+		}
+		template.Type = room.Type
+		template.Content = room.Content
+		template.TableData = collaboration.CloneTable(room.TableData)
+		template.Sheets = collaboration.CloneSheets(room.Sheets)
+		template.SourceRoomID = room.ID
+		if template.RoomName == "" {
+			template.RoomName = room.Name
+		}
+	}
+
+	if template.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidTemplate)
+	}
+	switch template.Type {
+	case "":
+		template.Type = domain.RoomTypeDocument
+	case domain.RoomTypeDocument, domain.RoomTypeWhiteboard, domain.RoomTypeTable:
+	default:
+		return nil, fmt.Errorf("%w: unknown room type %q", ErrInvalidTemplate, template.Type)
+	}
+	if len(template.Sheets) > 0 {
+		if template.Type != domain.RoomTypeTable {
+			return nil, fmt.Errorf("%w: sheets are only allowed in table templates", ErrInvalidTemplate)
+		}
+		if err := collaboration.ValidateSheets(template.Sheets); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+		}
+	}
+	if template.RoomName == "" {
+		template.RoomName = template.Name
+	}
+	template.Placeholders = collaboration.Placeholders(template.TableData, template.Sheets, template.RoomName, template.Content)
+
+	h.templates[template.ID] = template
+	h.saveTemplates()
+
+	slog.Info("Template created", "template", template.ID, "name", template.Name)
+	return cloneTemplate(template), nil
+}
+
+func (h *Hub) ListTemplates() ([]*domain.RoomTemplate, error) {
+	var templates []*domain.RoomTemplate
+	err := h.do(func() {
+		for _, template := range h.templates {
+			templates = append(templates, cloneTemplate(template))
+		}
+	})
+
+	sort.Slice(templates, func(i, j int) bool { return templates[i].CreatedAt.Before(templates[j].CreatedAt) })
+	return templates, err
+}
+
+func (h *Hub) GetTemplate(id string) (*domain.RoomTemplate, error) {
+	var template *domain.RoomTemplate
+	err := h.do(func() {
+		if found, ok := h.templates[id]; ok {
+			template = cloneTemplate(found)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return nil, ErrTemplateNotFound
+	}
+	return template, nil
+}
+
+func (h *Hub) DeleteTemplate(id string) error {
+	var result error
+	err := h.do(func() {
+		if _, ok := h.templates[id]; !ok {
+			result = ErrTemplateNotFound
+			return
+		}
+		delete(h.templates, id)
+		h.saveTemplates()
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// CreateRoomFromTemplate создаёт комнату по шаблону. Кроме значений из запроса
+// доступны встроенные плейсхолдеры {{date}} и {{room_id}}.
+func (h *Hub) CreateRoomFromTemplate(templateID string, req NewRoomRequest) (*domain.Room, error) {
+	var room *domain.Room
+	var result error
+	err := h.do(func() {
+		template, ok := h.templates[templateID]
+		if !ok {
+			result = ErrTemplateNotFound
+			return
+		}
+		if req.RoomID, result = h.newRoomID(req.RoomID); result != nil {
+			return
+		}
+
+		values := map[string]string{
+			"date":    time.Now().Format("2006-01-02"),
+			"room_id": req.RoomID,
+		}
+		for name, value := range req.Values {
+			values[name] = value
+		}
+
+		var missing []string
+		for _, name := range template.Placeholders {
+			if _, ok := values[name]; !ok {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			result = fmt.Errorf("%w: %s", ErrMissingPlaceholders, strings.Join(missing, ", "))
+			return
+		}
+
+		fill := func(text string) string { return collaboration.FillPlaceholders(text, values) }
+		name := req.Name
+		if name == "" {
+			name = fill(template.RoomName)
+		}
+
+		room = h.createRoom(&domain.Room{
+			ID:        req.RoomID,
+			Name:      name,
+			Type:      template.Type,
+			Content:   fill(template.Content),
+			TableData: collaboration.MapStrings(template.TableData, fill),
+			Sheets:    collaboration.MapSheets(template.Sheets, fill),
+			Origin:    &domain.RoomOrigin{TemplateID: template.ID, CreatedAt: time.Now()},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return room, result
+}
+
+// ForkRoom создаёт независимую копию содержимого комнаты на текущей или одной
+// из сохранённых версий. Комментарии и участники не копируются.
+func (h *Hub) ForkRoom(sourceID string, req NewRoomRequest) (*domain.Room, error) {
+	var room *domain.Room
+	var result error
+	err := h.do(func() {
+		source, err := h.rooms.Get(sourceID)
+		if err != nil {
+			result = ErrRoomNotFound
+			return
+		}
+		version := req.Version
+		if version == 0 {
+			version = source.Version
+		}
+		snapshot, err := h.roomVersion(sourceID, version)
+		if err != nil {
+			result = err
+			return
+		}
+		if req.RoomID, result = h.newRoomID(req.RoomID); result != nil {
+			return
+		}
+
+		name := req.Name
+		if name == "" {
+			name = source.Name + " (fork)"
+		}
+
+		room = h.createRoom(&domain.Room{
+			ID:        req.RoomID,
+			Name:      name,
+			Type:      source.Type,
+			Content:   snapshot.Content,
+			TableData: snapshot.TableData,
+			Sheets:    snapshot.Sheets,
+			Origin:    &domain.RoomOrigin{RoomID: source.ID, Version: snapshot.Version, CreatedAt: time.Now()},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return room, result
+}
+
+func (h *Hub) newRoomID(id string) (string, error) {
+	if id == "" {
+		return "room_" + utils.GenerateID(), nil
+	}
+	if !roomIDPattern.MatchString(id) {
+		return "", ErrInvalidRoomID
+	}
+	if _, err := h.rooms.Get(id); err == nil {
+		return "", ErrRoomExists
+	}
+	return id, nil
+}
+
+// createRoom сохраняет новую комнату без участников и возвращает её копию.
+func (h *Hub) createRoom(room *domain.Room) *domain.Room {
+	room.CreatedAt = time.Now()
+	room.IsActive = true
+	room.MaxClients = h.config.App.MaxClientsPerRoom
+	collaboration.EnsureSheets(room)
+	collaboration.Recalculate(room)
+	h.rooms.Save(room)
+	h.recordVersion(room)
+	h.logRoomCreated(room)
+
+	slog.Info("Room created from origin", logging.KeyRoom, room.ID, "template", room.Origin.TemplateID, "source_room", room.Origin.RoomID, "version", room.Origin.Version)
+	h.webhooks.Publish(webhook.EventRoomCreated, room.ID, webhook.RoomData{
+		Name:   room.Name,
+		Type:   room.Type,
+		Origin: room.Origin,
+	})
+
+	copied := *room
+	copied.TableData = collaboration.CloneTable(room.TableData)
+	copied.Sheets = collaboration.CloneSheets(room.Sheets)
+	return &copied
+}
+
+func (h *Hub) loadTemplates() {
+	if h.templateStore == nil {
+		return
+	}
+
+	templates, err := h.templateStore.Load()
+	if err != nil {
+		slog.Error("Failed to load templates", logging.Err(err))
+		return
+	}
+	for _, template := range templates {
+		h.templates[template.ID] = template
+	}
+}
+
+func (h *Hub) saveTemplates() {
+	if h.templateStore == nil {
+		return
+	}
+
+	templates := make([]*domain.RoomTemplate, 0, len(h.templates))
+	for _, template := range h.templates {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].CreatedAt.Before(templates[j].CreatedAt) })
+
+	if err := h.templateStore.Save(templates); err != nil {
+		slog.Error("Failed to save templates", logging.Err(err))
+	}
+}
+
+func cloneTemplate(template *domain.RoomTemplate) *domain.RoomTemplate {
+	copied := *template
+	copied.TableData = collaboration.CloneTable(template.TableData)
+	copied.Sheets = collaboration.CloneSheets(template.Sheets)
+	copied.Placeholders = append([]string{}, template.Placeholders...)
+	return &copied
+}
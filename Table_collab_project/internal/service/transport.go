@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/logging"
+)
+
+// ErrTransportClosed возвращается из ReadEvent, когда клиент сам закрыл соединение.
+// Любая другая ошибка считается обрывом, после которого сессию можно продолжить.
+var ErrTransportClosed = errors.New("transport closed by peer")
+
+// Transport доставляет события между hub и клиентом: WebSocket, SSE или long-polling.
+// WriteEvent и Ping вызываются только из WritePump, ReadEvent — только из ReadPump.
+type Transport interface {
+	Name() string
+	RemoteAddr() string
+	ReadEvent() (domain.Event, error)
+	WriteEvent(event domain.Event) error
+	Ping() error
+	// Close закрывает соединение; code == 0 означает закрытие без объяснения причины.
+	Close(code int, reason string) error
+}
+
+// Connect создаёт клиента поверх транспорта, при необходимости продолжает
+// сессию по resumeToken и запускает ReadPump и WritePump. Из ctx берутся только
+// значения запроса для логов и трасс: соединение живёт дольше самого запроса.
+func (h *Hub) Connect(ctx context.Context, transport Transport, roomID, resumeToken string, lastSeq uint64) *Client {
+	client := NewClient(transport, h, roomID)
+	client.log = logging.FromContext(ctx).With("transport", transport.Name())
+	client.conn = trace.LinkFromContext(ctx)
+
+	if resumeToken != "" {
+		if err := h.Resume(client, resumeToken, lastSeq); err != nil {
+			client.send.push(domain.Event{
+				Type:      domain.EventError,
+				RoomID:    roomID,
+				Timestamp: client.ConnectedAt.UnixMilli(),
+				Payload:   domain.ErrorPayload{Code: "resume_failed", Message: err.Error()},
+			})
+		}
+	}
+
+	client.logger().Info("Client connected", "remote", client.RemoteAddr)
+
+	go client.WritePump()
+	go client.ReadPump()
+
+	return client
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/service/collaboration"
+	"table_collab/pkg/utils"
+)
+
+var ErrViewForbidden = errors.New("only the owner can make a shared view private")
+
+func isViewEvent(eventType domain.EventType) bool {
+	return eventType == domain.EventViewSave || eventType == domain.EventViewDelete
+}
+
+// handleView вызывается из Run. Личные представления можно вести и без права
+// на правку: они никого, кроме автора, не касаются. Общие меняются только
+// участниками, которые могут править комнату.
+func (h *Hub) handleView(client *Client, event domain.Event) {
+	room, err := h.rooms.Get(event.RoomID)
+	if err != nil {
+		h.sendError(client, "room_not_found", ErrRoomNotFound.Error())
+		return
+	}
+	if room.Type != domain.RoomTypeTable {
+		h.sendError(client, "wrong_room_type", "views are only allowed in table rooms")
+		return
+	}
+
+	switch event.Type {
+	case domain.EventViewSave:
+		err = h.saveView(client, room, event)
+	case domain.EventViewDelete:
+		err = h.deleteView(client, room, event)
+	}
+	if err != nil {
+		h.sendError(client, viewErrorCode(err), err.Error())
+	}
+}
+
+func (h *Hub) saveView(client *Client, room *domain.Room, event domain.Event) error {
+	var payload domain.ViewSavePayload
+	if err := domain.DecodePayload(event, &payload); err != nil {
+		return collaboration.ErrInvalidView
+	}
+	view := payload.View
+
+	var existing *domain.View
+	if view.ID != "" {
+		if existing, _ = collaboration.FindView(room, view.ID); existing == nil || !existing.VisibleTo(client.ID) {
+			return collaboration.ErrViewNotFound
+		}
+	}
+
+	if existing == nil {
+		if len(room.Views) >= collaboration.MaxViewsPerRoom {
+			return collaboration.ErrTooManyViews
+		}
+		view.ID = "view_" + utils.GenerateID()
+		view.Owner, view.OwnerID = client.Username, client.ID
+	} else {
+		view.Owner, view.OwnerID = existing.Owner, existing.OwnerID
+		// Сделать общее представление личным может только его автор
+		if view.Private && !existing.Private && existing.OwnerID != client.ID {
+			return ErrViewForbidden
+		}
+	}
+	if !view.Private || (existing != nil && !existing.Private) {
+		if err := h.authorizeShared(client, room, event); err != nil {
+			return err
+		}
+	}
+
+	if err := collaboration.ValidateView(room, &view); err != nil {
+		return err
+	}
+	view.UpdatedAt = time.Now()
+	view.Rows, view.Groups = nil, nil
+	collaboration.RefreshView(room, &view)
+
+	collaboration.ReplaceView(room, &view)
+	room.UpdatedAt = view.UpdatedAt
+	h.rooms.Save(room)
+
+	update := domain.Event{
+		Type:      domain.EventViewUpdated,
+		RoomID:    room.ID,
+		UserID:    client.ID,
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   view.Clone(),
+	}
+	h.deliverView(room.ID, client, update, view.VisibleTo)
+	h.accept(update)
+
+	// Общее представление, ставшее личным, у остальных пропадает
+	if existing != nil && !existing.Private && view.Private {
+		hidden := func(clientID string) bool { return !view.VisibleTo(clientID) }
+		h.deliverView(room.ID, client, domain.Event{
+			Type:      domain.EventViewDelete,
+			RoomID:    room.ID,
+			UserID:    client.ID,
+			Timestamp: update.Timestamp,
+			Payload:   domain.ViewDeletePayload{ViewID: view.ID},
+		}, hidden)
+	}
+
+	update.OpID = event.OpID
+	h.deliver(client, update)
+	return nil
+}
+
+func (h *Hub) deleteView(client *Client, room *domain.Room, event domain.Event) error {
+	var payload domain.ViewDeletePayload
+	if err := domain.DecodePayload(event, &payload); err != nil {
+		return collaboration.ErrInvalidView
+	}
+	view, _ := collaboration.FindView(room, payload.ViewID)
+	if view == nil || !view.VisibleTo(client.ID) {
+		return collaboration.ErrViewNotFound
+	}
+	if !view.Private {
+		if err := h.authorizeShared(client, room, event); err != nil {
+			return err
+		}
+	}
+
+	collaboration.RemoveView(room, view.ID)
+	room.UpdatedAt = time.Now()
+	h.rooms.Save(room)
+
+	removed := domain.Event{
+		Type:      domain.EventViewDelete,
+		RoomID:    room.ID,
+		UserID:    client.ID,
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   domain.ViewDeletePayload{ViewID: view.ID},
+	}
+	h.deliverView(room.ID, client, removed, view.VisibleTo)
+	h.accept(removed)
+
+	removed.OpID = event.OpID
+	h.deliver(client, removed)
+	return nil
+}
+
+// authorizeShared проверяет право менять общие представления: как и правка
+// содержимого, это недоступно заглушённым и в комнате только для чтения.
+func (h *Hub) authorizeShared(client *Client, room *domain.Room, event domain.Event) error {
+	if err := h.authorize(client, event); err != nil {
+		return err
+	}
+	if room.ReadOnly {
+		return ErrRoomReadOnly
+	}
+	return nil
+}
+
+// refreshViews пересчитывает представления изменённых листов и рассылает
+// новый порядок строк тем, кто эти представления видит.
+func (h *Hub) refreshViews(room *domain.Room, sheets map[string]bool) {
+	if len(room.Views) == 0 || len(sheets) == 0 {
+		return
+	}
+	for _, view := range collaboration.RefreshViews(room, sheets) {
+		h.deliverView(room.ID, nil, domain.Event{
+			Type:      domain.EventViewRows,
+			RoomID:    room.ID,
+			Timestamp: time.Now().UnixMilli(),
+			Version:   room.Version,
+			Payload: domain.ViewRowsPayload{
+				ViewID: view.ID,
+				Rows:   append([]int{}, view.Rows...),
+				Groups: append([]domain.ViewGroup(nil), view.Groups...),
+			},
+		}, view.VisibleTo)
+	}
+}
+
+// deliverView отправляет событие участникам комнаты, кроме skip, для которых
+// visible возвращает true.
+func (h *Hub) deliverView(roomID string, skip *Client, event domain.Event, visible func(clientID string) bool) {
+	for _, client := range h.clients {
+		if client.RoomID == roomID && client != skip && visible(client.ID) {
+			h.deliver(client, event)
+		}
+	}
+	// Зрители видят то же, что и участник без личных представлений
+	if visible("") {
+		h.showSpectators(event)
+	}
+}
+
+// dropPrivateViews вызывается из Run, когда сессия клиента закончилась:
+// его личные представления больше никто не увидит. Комнату сохраняет
+// вызывающий.
+func (h *Hub) dropPrivateViews(room *domain.Room, client *Client) {
+	var dropped []string
+	for _, view := range room.Views {
+		if view.Private && view.OwnerID == client.ID {
+			dropped = append(dropped, view.ID)
+		}
+	}
+	if len(dropped) == 0 {
+		return
+	}
+
+	for _, id := range dropped {
+		collaboration.RemoveView(room, id)
+		h.accept(domain.Event{
+			Type:      domain.EventViewDelete,
+			RoomID:    room.ID,
+			UserID:    client.ID,
+			Timestamp: time.Now().UnixMilli(),
+			Payload:   domain.ViewDeletePayload{ViewID: id},
+		})
+	}
+}
+
+// visibleViews возвращает копии представлений, которые видит участник с ID
+// clientID; зрителю ("") — только общие.
+func visibleViews(room *domain.Room, clientID string) []*domain.View {
+	var views []*domain.View
+	for _, view := range room.Views {
+		if view.VisibleTo(clientID) {
+			views = append(views, view.Clone())
+		}
+	}
+	return views
+}
+
+func viewErrorCode(err error) string {
+	switch {
+	case errors.Is(err, collaboration.ErrViewNotFound):
+		return "view_not_found"
+	case errors.Is(err, collaboration.ErrTooManyViews):
+		return "too_many_views"
+	case errors.Is(err, collaboration.ErrSheetNotFound):
+		return "sheet_not_found"
+	case errors.Is(err, ErrMuted):
+		return "muted"
+	case errors.Is(err, ErrRoomReadOnly):
+		return "read_only"
+	case errors.Is(err, ErrViewForbidden):
+		return "forbidden"
+	default:
+		return "invalid_view"
+	}
+}
@@ -0,0 +1,538 @@
+// Package webhook доставляет события комнат во внешние системы: подписки,
+// подпись HMAC, фоновая отправка с повторами и журнал доставок.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+	"table_collab/internal/logging"
+	"table_collab/internal/storage/file"
+	"table_collab/pkg/utils"
+)
+
+// Типы событий, на которые можно подписаться.
+const (
+	EventRoomCreated   = "room.created"
+	EventRoomClosed    = "room.closed"
+	EventUserJoined    = "user.joined"
+	EventUserLeft      = "user.left"
+	EventSnapshotSaved = "snapshot.saved"
+	EventChatMention   = "chat.mention"
+)
+
+var Events = []string{
+	EventRoomCreated, EventRoomClosed, EventUserJoined,
+	EventUserLeft, EventSnapshotSaved, EventChatMention,
+}
+
+const errStopped = "dispatcher stopped"
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+	ErrInvalidWebhook   = errors.New("invalid webhook")
+)
+
+// Payload — тело запроса, которое получает подписчик.
+type Payload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	RoomID    string      `json:"room_id,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type delivery struct {
+	domain.WebhookDelivery
+	secret string
+	body   []byte
+	timer  *time.Timer
+}
+
+// Dispatcher хранит подписки и доставляет события в фоне. Publish не
+// блокируется, поэтому его можно вызывать из горутины hub.
+type Dispatcher struct {
+	cfg    config.WebhookConfig
+	store  *file.WebhookStore
+	client *http.Client
+	saveMu sync.Mutex
+
+	mu       sync.Mutex
+	webhooks map[string]domain.Webhook
+	log      []*delivery
+	dead     []*delivery
+	retries  map[string]*delivery
+
+	queue   chan *delivery
+	stop    chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+	started bool
+	stopped bool
+}
+
+func NewDispatcher(cfg config.WebhookConfig) *Dispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 6
+	}
+	if cfg.InitialBackoffMs <= 0 {
+		cfg.InitialBackoffMs = 1000
+	}
+	if cfg.MaxBackoffMs < cfg.InitialBackoffMs {
+		cfg.MaxBackoffMs = cfg.InitialBackoffMs
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10
+	}
+	if cfg.LogSize <= 0 {
+		cfg.LogSize = 500
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		webhooks: make(map[string]domain.Webhook),
+		retries:  make(map[string]*delivery),
+		queue:    make(chan *delivery, cfg.QueueSize),
+		stop:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	if cfg.StorePath != "" {
+		d.store = file.NewWebhookStore(cfg.StorePath)
+		d.load()
+	}
+
+	return d
+}
+
+// Start запускает воркеры доставки.
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.started || d.stopped {
+		return
+	}
+	d.started = true
+
+	for i := 0; i < d.cfg.Workers; i++ {
+		d.workers.Add(1)
+		go d.worker()
+	}
+}
+
+// Stop доставляет то, что уже стоит в очереди, и останавливает воркеры.
+// Запланированные повторы отменяются и вместе со всем, что не успело уйти,
+// попадают в dead letter; незавершённые запросы прерываются, когда истекает ctx.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return nil
+	}
+	d.stopped = true
+	for id, dl := range d.retries {
+		dl.timer.Stop()
+		delete(d.retries, id)
+		d.kill(dl, errStopped)
+	}
+	d.mu.Unlock()
+
+	// Без воркеров очередь никто не разберёт
+	defer d.drop()
+
+	close(d.stop)
+
+	done := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(done)
+	}()
+
+	defer d.client.CloseIdleConnections()
+
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Subscribe проверяет и сохраняет подписку. Если секрет не задан, он
+// генерируется; полная подписка с секретом возвращается только здесь.
+func (d *Dispatcher) Subscribe(webhook domain.Webhook) (domain.Webhook, error) {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return domain.Webhook{}, fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidWebhook)
+	}
+	for _, event := range webhook.Events {
+		if !slices.Contains(Events, event) {
+			return domain.Webhook{}, fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+		}
+	}
+
+	webhook.ID = "wh_" + utils.GenerateID()
+	if webhook.Secret == "" {
+		webhook.Secret = utils.GenerateToken()
+	}
+	webhook.CreatedAt = time.Now()
+
+	d.mu.Lock()
+	d.webhooks[webhook.ID] = webhook
+	d.mu.Unlock()
+
+	d.save()
+	return webhook, nil
+}
+
+func (d *Dispatcher) Unsubscribe(id string) error {
+	d.mu.Lock()
+	if _, ok := d.webhooks[id]; !ok {
+		d.mu.Unlock()
+		return ErrWebhookNotFound
+	}
+	delete(d.webhooks, id)
+	d.mu.Unlock()
+
+	d.save()
+	return nil
+}
+
+// List возвращает подписки без секретов.
+func (d *Dispatcher) List() []domain.Webhook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make([]domain.Webhook, 0, len(d.webhooks))
+	for _, webhook := range d.webhooks {
+		webhook.Secret = ""
+		result = append(result, webhook)
+	}
+	slices.SortFunc(result, func(a, b domain.Webhook) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return result
+}
+
+// Publish ставит событие в очередь для всех подходящих подписок.
+// Пустой roomID означает событие уровня сервера — его получают только
+// подписки на все комнаты.
+func (d *Dispatcher) Publish(event, roomID string, data interface{}) {
+	payload := Payload{
+		ID:        "evt_" + utils.GenerateID(),
+		Event:     event,
+		RoomID:    roomID,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+
+	d.mu.Lock()
+	var targets []domain.Webhook
+	for _, webhook := range d.webhooks {
+		if webhook.RoomID != "" && webhook.RoomID != roomID {
+			continue
+		}
+		if len(webhook.Events) > 0 && !slices.Contains(webhook.Events, event) {
+			continue
+		}
+		targets = append(targets, webhook)
+	}
+	d.mu.Unlock()
+
+	if len(targets) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Failed to encode webhook payload", "webhook_event", event, logging.KeyRoom, roomID, logging.Err(err))
+		return
+	}
+
+	for _, webhook := range targets {
+		now := time.Now()
+		dl := &delivery{
+			WebhookDelivery: domain.WebhookDelivery{
+				ID:        "dlv_" + utils.GenerateID(),
+				WebhookID: webhook.ID,
+				EventID:   payload.ID,
+				Event:     event,
+				RoomID:    roomID,
+				URL:       webhook.URL,
+				Status:    domain.DeliveryPending,
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+			secret: webhook.Secret,
+			body:   body,
+		}
+
+		d.mu.Lock()
+		d.log = appendLimited(d.log, dl, d.cfg.LogSize)
+		d.mu.Unlock()
+
+		d.enqueue(dl)
+	}
+}
+
+// Deliveries возвращает журнал доставок, новые в конце.
+func (d *Dispatcher) Deliveries(webhookID string, limit int) []domain.WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return snapshot(d.log, webhookID, limit)
+}
+
+// DeadLetters возвращает доставки, для которых исчерпаны попытки.
+func (d *Dispatcher) DeadLetters(webhookID string, limit int) []domain.WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return snapshot(d.dead, webhookID, limit)
+}
+
+// Redeliver повторно отправляет доставку из списка dead letter.
+func (d *Dispatcher) Redeliver(deliveryID string) (domain.WebhookDelivery, error) {
+	d.mu.Lock()
+	i := slices.IndexFunc(d.dead, func(dl *delivery) bool { return dl.ID == deliveryID })
+	if i < 0 {
+		d.mu.Unlock()
+		return domain.WebhookDelivery{}, ErrDeliveryNotFound
+	}
+
+	dl := d.dead[i]
+	d.dead = slices.Delete(d.dead, i, i+1)
+	dl.Status = domain.DeliveryPending
+	dl.Attempts = 0
+	dl.LastError = ""
+	dl.LastStatusCode = 0
+	dl.UpdatedAt = time.Now()
+	result := dl.WebhookDelivery
+	d.mu.Unlock()
+
+	d.enqueue(dl)
+	return result, nil
+}
+
+// enqueue ставит доставку в очередь. Проверка stopped и отправка идут под
+// одной блокировкой, поэтому после Stop в очередь ничего не попадает.
+func (d *Dispatcher) enqueue(dl *delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stopped {
+		d.kill(dl, errStopped)
+		return
+	}
+
+	select {
+	case d.queue <- dl:
+	default:
+		d.kill(dl, "delivery queue is full")
+	}
+}
+
+// drop переносит в dead letter то, что осталось в очереди после остановки воркеров.
+func (d *Dispatcher) drop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for {
+		select {
+		case dl := <-d.queue:
+			d.kill(dl, errStopped)
+		default:
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) worker() {
+	defer d.workers.Done()
+
+	for {
+		select {
+		case dl := <-d.queue:
+			d.attempt(dl)
+		case <-d.stop:
+			// Досылаем то, что уже в очереди
+			for {
+				select {
+				case dl := <-d.queue:
+					d.attempt(dl)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) attempt(dl *delivery) {
+	status, err := d.send(dl)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dl.Attempts++
+	dl.LastStatusCode = status
+	dl.UpdatedAt = time.Now()
+	dl.NextAttemptAt = nil
+
+	if err == nil {
+		dl.Status = domain.DeliverySucceeded
+		dl.LastError = ""
+		return
+	}
+	dl.LastError = err.Error()
+
+	if !retryable(status) || dl.Attempts >= d.cfg.MaxAttempts || d.stopped {
+		d.kill(dl, dl.LastError)
+		return
+	}
+
+	backoff := d.backoff(dl.Attempts)
+	next := time.Now().Add(backoff)
+	dl.Status = domain.DeliveryRetrying
+	dl.NextAttemptAt = &next
+
+	d.retries[dl.ID] = dl
+	dl.timer = time.AfterFunc(backoff, func() {
+		d.mu.Lock()
+		delete(d.retries, dl.ID)
+		d.mu.Unlock()
+
+		d.enqueue(dl)
+	})
+}
+
+func (d *Dispatcher) send(dl *delivery) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, dl.URL, bytes.NewReader(dl.body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TableCollab-Webhooks/1.0")
+	req.Header.Set("X-TableCollab-Event", dl.Event)
+	req.Header.Set("X-TableCollab-Delivery", dl.ID)
+	req.Header.Set(SignatureHeader, Sign(dl.secret, time.Now().Unix(), dl.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff — экспоненциальная задержка перед попыткой attempt+1.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := time.Duration(d.cfg.InitialBackoffMs) * time.Millisecond
+	limit := time.Duration(d.cfg.MaxBackoffMs) * time.Millisecond
+
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+// kill переносит доставку в dead letter. Вызывается под d.mu.
+func (d *Dispatcher) kill(dl *delivery, reason string) {
+	dl.Status = domain.DeliveryDead
+	dl.LastError = reason
+	dl.UpdatedAt = time.Now()
+	d.dead = appendLimited(d.dead, dl, d.cfg.LogSize)
+
+	slog.Warn("Webhook delivery failed",
+		"delivery", dl.ID, "webhook", dl.WebhookID, "webhook_event", dl.Event, logging.KeyRoom, dl.RoomID,
+		"url", dl.URL, "attempts", dl.Attempts, "reason", reason)
+}
+
+// retryable: сетевые ошибки, 408, 429 и 5xx повторяем, остальные 4xx — нет.
+func retryable(status int) bool {
+	return status == 0 || status == http.StatusRequestTimeout ||
+		status == http.StatusTooManyRequests || status >= 500
+}
+
+func (d *Dispatcher) load() {
+	webhooks, err := d.store.Load()
+	if err != nil {
+		slog.Error("Failed to load webhooks", logging.Err(err))
+		return
+	}
+	for _, webhook := range webhooks {
+		d.webhooks[webhook.ID] = webhook
+	}
+}
+
+func (d *Dispatcher) save() {
+	if d.store == nil {
+		return
+	}
+
+	// Снимок и запись под одним замком, чтобы старый список не перезаписал новый
+	d.saveMu.Lock()
+	defer d.saveMu.Unlock()
+
+	d.mu.Lock()
+	webhooks := make([]domain.Webhook, 0, len(d.webhooks))
+	for _, webhook := range d.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	d.mu.Unlock()
+
+	if err := d.store.Save(webhooks); err != nil {
+		slog.Error("Failed to save webhooks", logging.Err(err))
+	}
+}
+
+func appendLimited(list []*delivery, dl *delivery, limit int) []*delivery {
+	if len(list) >= limit {
+		list = slices.Delete(list, 0, len(list)-limit+1)
+	}
+	return append(list, dl)
+}
+
+func snapshot(list []*delivery, webhookID string, limit int) []domain.WebhookDelivery {
+	result := make([]domain.WebhookDelivery, 0, len(list))
+	for _, dl := range list {
+		if webhookID == "" || dl.WebhookID == webhookID {
+			result = append(result, dl.WebhookDelivery)
+		}
+	}
+	if limit > 0 && limit < len(result) {
+		result = result[len(result)-limit:]
+	}
+	return result
+}
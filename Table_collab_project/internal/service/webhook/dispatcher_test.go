@@ -0,0 +1,293 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+type received struct {
+	header  http.Header
+	body    []byte
+	payload Payload
+}
+
+// receiver — локальный HTTP-получатель, отвечающий статусами из respond.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []received
+	calls    atomic.Int32
+	respond  func(call int) int
+}
+
+func newReceiver(t *testing.T, respond func(call int) int) *receiver {
+	rc := &receiver{respond: respond}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload Payload
+		json.Unmarshal(body, &payload)
+
+		rc.mu.Lock()
+		rc.requests = append(rc.requests, received{header: r.Header.Clone(), body: body, payload: payload})
+		rc.mu.Unlock()
+
+		w.WriteHeader(rc.respond(int(rc.calls.Add(1))))
+	}))
+	t.Cleanup(rc.Close)
+
+	return rc
+}
+
+func (rc *receiver) received() []received {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return append([]received(nil), rc.requests...)
+}
+
+func newTestDispatcher(t *testing.T) *Dispatcher {
+	d := NewDispatcher(config.WebhookConfig{
+		Workers:          2,
+		MaxAttempts:      3,
+		InitialBackoffMs: 10,
+		MaxBackoffMs:     40,
+		Timeout:          2,
+	})
+	d.Start()
+	t.Cleanup(func() { d.Stop(context.Background()) })
+
+	return d
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func lastStatus(d *Dispatcher) domain.WebhookDeliveryStatus {
+	deliveries := d.Deliveries("", 1)
+	if len(deliveries) == 0 {
+		return ""
+	}
+	return deliveries[0].Status
+}
+
+func TestDeliveryIsSignedAndLogged(t *testing.T) {
+	rc := newReceiver(t, func(int) int { return http.StatusOK })
+	d := newTestDispatcher(t)
+
+	webhook, err := d.Subscribe(domain.Webhook{URL: rc.URL, Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Publish(EventUserJoined, "room", UserData{ClientID: "c1", Username: "alice"})
+	waitFor(t, "delivery", func() bool { return lastStatus(d) == domain.DeliverySucceeded })
+
+	got := rc.received()
+	if len(got) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(got))
+	}
+	req := got[0]
+
+	if err := Verify("s3cret", req.header.Get(SignatureHeader), req.body, time.Minute); err != nil {
+		t.Fatalf("signature: %v", err)
+	}
+	if err := Verify("wrong", req.header.Get(SignatureHeader), req.body, time.Minute); err == nil {
+		t.Fatal("signature verified with a wrong secret")
+	}
+	if req.header.Get("X-TableCollab-Event") != EventUserJoined || req.payload.RoomID != "room" {
+		t.Fatalf("unexpected request: event=%s payload=%+v", req.header.Get("X-TableCollab-Event"), req.payload)
+	}
+
+	delivery := d.Deliveries(webhook.ID, 0)[0]
+	if delivery.Attempts != 1 || delivery.LastStatusCode != http.StatusOK {
+		t.Fatalf("unexpected log entry: %+v", delivery)
+	}
+}
+
+func TestRetriesWithBackoff(t *testing.T) {
+	rc := newReceiver(t, func(call int) int {
+		if call < 3 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusNoContent
+	})
+	d := newTestDispatcher(t)
+	d.Subscribe(domain.Webhook{URL: rc.URL})
+
+	d.Publish(EventRoomCreated, "room", RoomData{Name: "room"})
+	waitFor(t, "delivery", func() bool { return lastStatus(d) == domain.DeliverySucceeded })
+
+	if attempts := d.Deliveries("", 1)[0].Attempts; attempts != 3 {
+		t.Fatalf("attempts = %d, want 3", attempts)
+	}
+	if len(d.DeadLetters("", 0)) != 0 {
+		t.Fatal("successful delivery ended up in dead letters")
+	}
+}
+
+func TestDeadLetterAndRedeliver(t *testing.T) {
+	var healthy atomic.Bool
+	rc := newReceiver(t, func(int) int {
+		if healthy.Load() {
+			return http.StatusOK
+		}
+		return http.StatusInternalServerError
+	})
+	d := newTestDispatcher(t)
+	d.Subscribe(domain.Webhook{URL: rc.URL})
+
+	d.Publish(EventRoomClosed, "room", RoomClosedData{Reason: "done"})
+	waitFor(t, "dead letter", func() bool { return len(d.DeadLetters("", 0)) == 1 })
+
+	dead := d.DeadLetters("", 0)[0]
+	if dead.Attempts != 3 || dead.Status != domain.DeliveryDead {
+		t.Fatalf("unexpected dead letter: %+v", dead)
+	}
+
+	healthy.Store(true)
+	if _, err := d.Redeliver(dead.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "redelivery", func() bool { return lastStatus(d) == domain.DeliverySucceeded })
+
+	if len(d.DeadLetters("", 0)) != 0 {
+		t.Fatal("redelivered entry is still in dead letters")
+	}
+	if _, err := d.Redeliver(dead.ID); err != ErrDeliveryNotFound {
+		t.Fatalf("second redeliver: %v, want ErrDeliveryNotFound", err)
+	}
+}
+
+func TestClientErrorIsNotRetried(t *testing.T) {
+	rc := newReceiver(t, func(int) int { return http.StatusBadRequest })
+	d := newTestDispatcher(t)
+	d.Subscribe(domain.Webhook{URL: rc.URL})
+
+	d.Publish(EventUserLeft, "room", UserData{ClientID: "c1"})
+	waitFor(t, "dead letter", func() bool { return len(d.DeadLetters("", 0)) == 1 })
+
+	if calls := rc.calls.Load(); calls != 1 {
+		t.Fatalf("receiver called %d times, want 1", calls)
+	}
+}
+
+func TestSubscriptionFilters(t *testing.T) {
+	rc := newReceiver(t, func(int) int { return http.StatusOK })
+	d := newTestDispatcher(t)
+
+	d.Subscribe(domain.Webhook{URL: rc.URL + "/room", RoomID: "watched"})
+	d.Subscribe(domain.Webhook{URL: rc.URL + "/mentions", Events: []string{EventChatMention}})
+
+	d.Publish(EventUserJoined, "other", UserData{})
+	d.Publish(EventUserJoined, "watched", UserData{})
+	d.Publish(EventChatMention, "other", MentionData{})
+	d.Publish(EventSnapshotSaved, "", SnapshotData{})
+
+	waitFor(t, "deliveries", func() bool { return len(rc.received()) == 2 })
+	time.Sleep(50 * time.Millisecond)
+
+	got := rc.received()
+	if len(got) != 2 {
+		t.Fatalf("receiver got %d requests, want 2", len(got))
+	}
+	events := map[string]bool{}
+	for _, req := range got {
+		events[req.payload.Event+"@"+req.payload.RoomID] = true
+	}
+	if !events[EventUserJoined+"@watched"] || !events[EventChatMention+"@other"] {
+		t.Fatalf("unexpected deliveries: %v", events)
+	}
+}
+
+func TestSubscribeValidation(t *testing.T) {
+	d := NewDispatcher(config.WebhookConfig{})
+
+	for _, webhook := range []domain.Webhook{
+		{URL: "ftp://example.com"},
+		{URL: "/relative"},
+		{URL: "http://example.com", Events: []string{"room.exploded"}},
+	} {
+		if _, err := d.Subscribe(webhook); err == nil {
+			t.Errorf("Subscribe(%+v) succeeded, want error", webhook)
+		}
+	}
+
+	webhook, err := d.Subscribe(domain.Webhook{URL: "https://example.com/hook"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if webhook.Secret == "" {
+		t.Fatal("secret was not generated")
+	}
+	if listed := d.List(); len(listed) != 1 || listed[0].Secret != "" {
+		t.Fatalf("List must hide secrets: %+v", listed)
+	}
+}
+
+func TestVerifyRejectsOldSignature(t *testing.T) {
+	body := []byte(`{"event":"user.joined"}`)
+	header := Sign("secret", time.Now().Add(-time.Hour).Unix(), body)
+
+	if err := Verify("secret", header, body, 5*time.Minute); err != ErrSignatureExpired {
+		t.Fatalf("Verify = %v, want ErrSignatureExpired", err)
+	}
+	if err := Verify("secret", header, []byte(`{}`), 0); err != ErrInvalidSignature {
+		t.Fatalf("Verify with a changed body = %v, want ErrInvalidSignature", err)
+	}
+}
+
+// Доставки, которые Stop не успевает отправить, не висят в журнале как pending.
+func TestStopDeadLettersUndelivered(t *testing.T) {
+	rc := newReceiver(t, func(int) int { return http.StatusServiceUnavailable })
+	d := NewDispatcher(config.WebhookConfig{Workers: 1, MaxAttempts: 5, InitialBackoffMs: 60_000, MaxBackoffMs: 60_000})
+	d.Start()
+	d.Subscribe(domain.Webhook{URL: rc.URL})
+
+	d.Publish(EventRoomCreated, "room", RoomData{Name: "room"})
+	waitFor(t, "retry", func() bool { return lastStatus(d) == domain.DeliveryRetrying })
+
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.Publish(EventRoomClosed, "room", RoomClosedData{Reason: "late"})
+
+	for _, dl := range d.Deliveries("", 0) {
+		if dl.Status != domain.DeliveryDead || dl.LastError != errStopped {
+			t.Fatalf("%s after Stop: %s (%s)", dl.Event, dl.Status, dl.LastError)
+		}
+	}
+	if n := len(d.DeadLetters("", 0)); n != 2 {
+		t.Fatalf("%d dead letters, want 2", n)
+	}
+}
+
+// Stop без запущенных воркеров не оставляет очередь в состоянии pending.
+func TestStopWithoutWorkers(t *testing.T) {
+	d := NewDispatcher(config.WebhookConfig{})
+	d.Subscribe(domain.Webhook{URL: "http://127.0.0.1:1/hook"})
+	d.Publish(EventRoomCreated, "room", RoomData{Name: "room"})
+
+	d.Stop(context.Background())
+	if status := lastStatus(d); status != domain.DeliveryDead {
+		t.Fatalf("queued delivery is %s after Stop", status)
+	}
+}
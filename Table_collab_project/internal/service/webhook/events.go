@@ -0,0 +1,34 @@
+package webhook
+
+import "table_collab/internal/domain"
+
+// Данные событий в поле Payload.Data.
+
+type RoomData struct {
+	Name      string             `json:"name"`
+	Type      domain.RoomType    `json:"type"`
+	CreatedBy string             `json:"created_by,omitempty"`
+	Origin    *domain.RoomOrigin `json:"origin,omitempty"`
+}
+
+type RoomClosedData struct {
+	Reason string `json:"reason"`
+}
+
+type UserData struct {
+	ClientID  string `json:"client_id"`
+	Username  string `json:"username"`
+	Transport string `json:"transport,omitempty"`
+}
+
+type SnapshotData struct {
+	Rooms int    `json:"rooms"`
+	Path  string `json:"path"`
+}
+
+type MentionData struct {
+	ClientID  string   `json:"client_id"`
+	Username  string   `json:"username"`
+	Text      string   `json:"text"`
+	Mentioned []string `json:"mentioned"`
+}
@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader содержит "t=<unix-время>,v1=<hex HMAC-SHA256>". Подписывается
+// строка "<t>.<тело запроса>", поэтому перехваченный запрос нельзя повторить
+// позже допустимого окна.
+const SignatureHeader = "X-TableCollab-Signature"
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrSignatureExpired = errors.New("webhook signature timestamp is outside the tolerance")
+)
+
+// Sign возвращает значение заголовка SignatureHeader для тела запроса.
+func Sign(secret string, timestamp int64, body []byte) string {
+	return "t=" + strconv.FormatInt(timestamp, 10) + ",v1=" + hex.EncodeToString(mac(secret, timestamp, body))
+}
+
+// Verify проверяет подпись на стороне получателя. tolerance == 0 отключает
+// проверку времени.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var timestamp int64
+	var signature []byte
+
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signature, _ = hex.DecodeString(value)
+		}
+	}
+
+	if timestamp == 0 || signature == nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal(signature, mac(secret, timestamp, body)) {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		age := time.Since(time.Unix(timestamp, 0))
+		if age > tolerance || age < -tolerance {
+			return ErrSignatureExpired
+		}
+	}
+	return nil
+}
+
+func mac(secret string, timestamp int64, body []byte) []byte {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	m.Write([]byte("."))
+	m.Write(body)
+	return m.Sum(nil)
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/service/webhook"
+)
+
+var mentionPattern = regexp.MustCompile(`@([\p{L}\p{N}_.-]+)`)
+
+func (c *Client) webhookData() webhook.UserData {
+	return webhook.UserData{
+		ClientID:  c.ID,
+		Username:  c.Username,
+		Transport: c.Transport.Name(),
+	}
+}
+
+// notifyMentions публикует chat.mention, если сообщение упоминает
+// участников комнаты через @username.
+func (h *Hub) notifyMentions(client *Client, event domain.Event) {
+	var payload struct {
+		Text string `json:"text"`
+	}
+	if domain.DecodePayload(event, &payload) != nil || !strings.Contains(payload.Text, "@") {
+		return
+	}
+
+	present := make(map[string]string)
+	for _, other := range h.clients {
+		if other.RoomID == client.RoomID {
+			present[strings.ToLower(other.Username)] = other.Username
+		}
+	}
+
+	var mentioned []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(payload.Text, -1) {
+		// Точка в конце — обычно знак препинания, а не часть имени
+		name := strings.ToLower(strings.TrimRight(match[1], "."))
+		if username, ok := present[name]; ok && !seen[name] {
+			seen[name] = true
+			mentioned = append(mentioned, username)
+		}
+	}
+	if len(mentioned) == 0 {
+		return
+	}
+
+	h.webhooks.Publish(webhook.EventChatMention, client.RoomID, webhook.MentionData{
+		ClientID:  client.ID,
+		Username:  client.Username,
+		Text:      payload.Text,
+		Mentioned: mentioned,
+	})
+}
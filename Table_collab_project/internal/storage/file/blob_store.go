@@ -0,0 +1,120 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BlobStore хранит файлы в каталоге под SHA-256 их содержимого:
+// dir/ab/abcdef…. Файл сначала пишется во временный и переименовывается,
+// только когда записан целиком, поэтому читатели не видят недописанных файлов.
+type BlobStore struct {
+	dir string
+}
+
+func NewBlobStore(dir string) *BlobStore {
+	return &BlobStore{dir: dir}
+}
+
+func (s *BlobStore) Put(r io.Reader) (string, int64, error) {
+	tmpDir := filepath.Join(s.dir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return "", 0, err
+	}
+
+	tmp, err := os.CreateTemp(tmpDir, "upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hasher := sha256.New()
+	size, err := io.Copy(tmp, io.TeeReader(r, hasher))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	path := s.path(hash)
+
+	// Такое содержимое уже есть: освежаем время, чтобы очистка не удалила
+	// файл, на который вот-вот сошлётся новое вложение
+	if _, err := os.Stat(path); err == nil {
+		now := time.Now()
+		return hash, size, os.Chtimes(path, now, now)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, err
+	}
+	return hash, size, nil
+}
+
+func (s *BlobStore) Open(hash string) (io.ReadSeekCloser, error) {
+	if !validHash(hash) {
+		return nil, fmt.Errorf("blob %q: %w", hash, fs.ErrNotExist)
+	}
+	return os.Open(s.path(hash))
+}
+
+func (s *BlobStore) Remove(hash string) error {
+	if !validHash(hash) {
+		return fmt.Errorf("blob %q: %w", hash, fs.ErrNotExist)
+	}
+	return os.Remove(s.path(hash))
+}
+
+func (s *BlobStore) List() (map[string]time.Time, error) {
+	blobs := make(map[string]time.Time)
+	err := filepath.WalkDir(s.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == s.dir && os.IsNotExist(err) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == "tmp" {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		hash := entry.Name()
+		if !validHash(hash) || filepath.Base(filepath.Dir(path)) != hash[:2] {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		blobs[hash] = info.ModTime()
+		return nil
+	})
+	return blobs, err
+}
+
+func (s *BlobStore) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+// validHash не даёт выйти за пределы каталога через имя объекта.
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
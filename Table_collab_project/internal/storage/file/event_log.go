@@ -0,0 +1,501 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"table_collab/internal/domain"
+)
+
+var (
+	ErrOffsetCompacted  = errors.New("offset is older than the oldest kept snapshot")
+	ErrOffsetOutOfRange = errors.New("offset is beyond the end of the log")
+	ErrLogNotFound      = errors.New("room has no event log")
+)
+
+const (
+	logFileName    = "log.jsonl"
+	snapshotPrefix = "snapshot-"
+)
+
+// Имена каталогов, которые можно взять из ID комнаты как есть; остальные ID
+// кодируются в hex с префиксом "~", чтобы "..", "/" и т.п. не попали в путь.
+var plainRoomDir = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// LogEntry — принятое событие комнаты под своим смещением в журнале.
+type LogEntry struct {
+	Offset uint64       `json:"offset"`
+	Time   time.Time    `json:"time"`
+	Event  domain.Event `json:"event"`
+}
+
+// RoomSnapshot — состояние комнаты после применения записи Offset. Room == nil
+// означает, что комната к этому моменту закрыта.
+type RoomSnapshot struct {
+	Offset uint64       `json:"offset"`
+	Time   time.Time    `json:"time"`
+	Room   *domain.Room `json:"room"`
+}
+
+// ApplyFunc применяет событие журнала к состоянию комнаты и возвращает новое состояние.
+type ApplyFunc func(room *domain.Room, event domain.Event) (*domain.Room, error)
+
+// EventLog — журнал событий по комнатам: каталог на комнату, в нём log.jsonl
+// с записями в порядке смещений и снапшоты snapshot-<offset>.json.
+// Смещения в пределах комнаты начинаются с 1 и только растут, в том числе
+// после компакции.
+type EventLog struct {
+	dir  string
+	sync bool
+
+	mu        sync.Mutex
+	heads     map[string]uint64
+	snapshots map[string]uint64
+	files     map[string]*os.File
+}
+
+// NewEventLog создаёт журнал в каталоге dir. При sync каждая запись
+// сбрасывается на диск через fsync до возврата из Append.
+func NewEventLog(dir string, sync bool) *EventLog {
+	return &EventLog{
+		dir:       dir,
+		sync:      sync,
+		heads:     make(map[string]uint64),
+		snapshots: make(map[string]uint64),
+		files:     make(map[string]*os.File),
+	}
+}
+
+// Append дописывает событие в журнал комнаты и возвращает его смещение.
+func (l *EventLog) Append(roomID string, event domain.Event) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	head, err := l.head(roomID)
+	if err != nil {
+		return 0, err
+	}
+	f, err := l.file(roomID)
+	if err != nil {
+		return 0, err
+	}
+
+	entry := LogEntry{Offset: head + 1, Time: time.Now().UTC(), Event: event}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+
+	// Одна запись на строку одним вызовом Write: O_APPEND не перемешает строки
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	if l.sync {
+		if err := f.Sync(); err != nil {
+			return 0, err
+		}
+	}
+
+	l.heads[roomID] = entry.Offset
+	return entry.Offset, nil
+}
+
+// Head возвращает смещение последней записи комнаты (0 — журнал пуст).
+func (l *EventLog) Head(roomID string) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.head(roomID)
+}
+
+// Pending возвращает число записей после последнего снапшота комнаты.
+func (l *EventLog) Pending(roomID string) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	head, err := l.head(roomID)
+	if err != nil {
+		return 0, err
+	}
+	return head - l.snapshots[roomID], nil
+}
+
+// Rooms возвращает ID комнат, у которых есть журнал.
+func (l *EventLog) Rooms() ([]string, error) {
+	entries, err := os.ReadDir(l.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rooms []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if roomID, ok := roomFromDir(entry.Name()); ok {
+			rooms = append(rooms, roomID)
+		}
+	}
+	sort.Strings(rooms)
+	return rooms, nil
+}
+
+// Entries возвращает до limit записей, начиная со смещения from
+// (limit <= 0 — все).
+func (l *EventLog) Entries(roomID string, from uint64, limit int) ([]LogEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.entries(roomID, from, limit)
+}
+
+// SaveSnapshot записывает снапшот комнаты.
+func (l *EventLog) SaveSnapshot(roomID string, snapshot RoomSnapshot) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(l.roomDir(roomID), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	path := l.snapshotPath(roomID, snapshot.Offset)
+	if err := writeFileAtomic(path, data, l.sync); err != nil {
+		return err
+	}
+	if snapshot.Offset > l.snapshots[roomID] {
+		l.snapshots[roomID] = snapshot.Offset
+	}
+	return nil
+}
+
+// LoadSnapshot возвращает последний снапшот со смещением не больше at
+// или nil, если такого нет.
+func (l *EventLog) LoadSnapshot(roomID string, at uint64) (*RoomSnapshot, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.loadSnapshot(roomID, at)
+}
+
+// Compact оставляет keep последних снапшотов и удаляет записи журнала, уже
+// вошедшие в самый старый из оставленных: пересобрать комнату после этого
+// можно на любом смещении начиная с него. retain (может быть nil) получает
+// удаляемые записи и возвращает те, что нужно сохранить, — например, чат,
+// которого нет в снапшоте. Воспроизведение такие записи пропускает.
+func (l *EventLog) Compact(roomID string, keep int, retain func([]LogEntry) []LogEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if keep < 1 {
+		keep = 1
+	}
+	offsets, err := l.snapshotOffsets(roomID)
+	if err != nil || len(offsets) == 0 {
+		return err
+	}
+
+	if len(offsets) > keep {
+		for _, offset := range offsets[:len(offsets)-keep] {
+			if err := os.Remove(l.snapshotPath(roomID, offset)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		offsets = offsets[len(offsets)-keep:]
+	}
+
+	all, err := l.entries(roomID, 0, 0)
+	if err != nil {
+		return err
+	}
+	cut := sort.Search(len(all), func(i int) bool { return all[i].Offset > offsets[0] })
+	kept := all[cut:]
+	if retain != nil {
+		kept = append(retain(all[:cut]), kept...)
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range kept {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	if f, ok := l.files[roomID]; ok {
+		f.Close()
+		delete(l.files, roomID)
+	}
+	return writeFileAtomic(l.logPath(roomID), buf.Bytes(), l.sync)
+}
+
+// Rebuild восстанавливает состояние комнаты на смещении at (0 — конец журнала):
+// берёт ближайший снапшот не позже at и применяет к нему записи журнала.
+// Возвращает состояние (nil, если комната закрыта) и смещение, на котором оно получено.
+func (l *EventLog) Rebuild(roomID string, at uint64, apply ApplyFunc) (*domain.Room, uint64, error) {
+	l.mu.Lock()
+	head, err := l.head(roomID)
+	if err != nil {
+		l.mu.Unlock()
+		return nil, 0, err
+	}
+	if head == 0 {
+		l.mu.Unlock()
+		return nil, 0, ErrLogNotFound
+	}
+	if at == 0 {
+		at = head
+	}
+	if at > head {
+		l.mu.Unlock()
+		return nil, 0, fmt.Errorf("%w: %d > %d", ErrOffsetOutOfRange, at, head)
+	}
+
+	snapshot, err := l.loadSnapshot(roomID, at)
+	var entries []LogEntry
+	if err == nil {
+		var from uint64
+		if snapshot != nil {
+			from = snapshot.Offset
+		}
+		if at > from {
+			entries, err = l.entries(roomID, from+1, int(at-from))
+		}
+	}
+	l.mu.Unlock()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var room *domain.Room
+	offset := uint64(0)
+	if snapshot != nil {
+		room, offset = snapshot.Room, snapshot.Offset
+	}
+
+	for _, entry := range entries {
+		if entry.Offset != offset+1 {
+			return nil, 0, fmt.Errorf("%w: need %d, log continues at %d", ErrOffsetCompacted, offset+1, entry.Offset)
+		}
+		if room, err = apply(room, entry.Event); err != nil {
+			return nil, 0, fmt.Errorf("offset %d: %w", entry.Offset, err)
+		}
+		offset = entry.Offset
+	}
+	if offset != at {
+		return nil, 0, fmt.Errorf("%w: need %d, log ends at %d", ErrOffsetCompacted, at, offset)
+	}
+	return room, offset, nil
+}
+
+// Close закрывает открытые файлы журналов.
+func (l *EventLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var result error
+	for roomID, f := range l.files {
+		if err := f.Close(); err != nil && result == nil {
+			result = err
+		}
+		delete(l.files, roomID)
+	}
+	return result
+}
+
+// head лениво вычисляет конец журнала комнаты: последнее смещение в файле
+// или смещение последнего снапшота, если журнал уже сжат целиком.
+func (l *EventLog) head(roomID string) (uint64, error) {
+	if head, ok := l.heads[roomID]; ok {
+		return head, nil
+	}
+
+	offsets, err := l.snapshotOffsets(roomID)
+	if err != nil {
+		return 0, err
+	}
+	var head uint64
+	if len(offsets) > 0 {
+		head = offsets[len(offsets)-1]
+		l.snapshots[roomID] = head
+	}
+
+	entries, err := l.entries(roomID, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	if n := len(entries); n > 0 && entries[n-1].Offset > head {
+		head = entries[n-1].Offset
+	}
+
+	l.heads[roomID] = head
+	return head, nil
+}
+
+// file открывает журнал комнаты на дозапись. Недописанную последнюю строку
+// (сбой посреди записи) отрезает, иначе следующая запись склеится с ней.
+func (l *EventLog) file(roomID string) (*os.File, error) {
+	if f, ok := l.files[roomID]; ok {
+		return f, nil
+	}
+
+	if err := os.MkdirAll(l.roomDir(roomID), 0o755); err != nil {
+		return nil, err
+	}
+	path := l.logPath(roomID)
+	if data, err := os.ReadFile(path); err == nil && len(data) > 0 && data[len(data)-1] != '\n' {
+		if err := os.Truncate(path, int64(bytes.LastIndexByte(data, '\n')+1)); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l.files[roomID] = f
+	return f, nil
+}
+
+func (l *EventLog) entries(roomID string, from uint64, limit int) ([]LogEntry, error) {
+	f, err := os.Open(l.logPath(roomID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []LogEntry
+	reader := bufio.NewReader(f)
+	for limit <= 0 || len(entries) < limit {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// Строка без перевода — оборванная запись, её ещё не подтвердили
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var entry LogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("%s: %w", l.logPath(roomID), err)
+		}
+		if entry.Offset >= from {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (l *EventLog) loadSnapshot(roomID string, at uint64) (*RoomSnapshot, error) {
+	offsets, err := l.snapshotOffsets(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	i := sort.Search(len(offsets), func(i int) bool { return offsets[i] > at })
+	if i == 0 {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(l.snapshotPath(roomID, offsets[i-1]))
+	if err != nil {
+		return nil, err
+	}
+	var snapshot RoomSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (l *EventLog) snapshotOffsets(roomID string) ([]uint64, error) {
+	entries, err := os.ReadDir(l.roomDir(roomID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var offsets []uint64
+	for _, entry := range entries {
+		var offset uint64
+		name := entry.Name()
+		if !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		if _, err := fmt.Sscanf(name, snapshotPrefix+"%d.json", &offset); err == nil {
+			offsets = append(offsets, offset)
+		}
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets, nil
+}
+
+func (l *EventLog) roomDir(roomID string) string {
+	if plainRoomDir.MatchString(roomID) {
+		return filepath.Join(l.dir, roomID)
+	}
+	return filepath.Join(l.dir, "~"+hex.EncodeToString([]byte(roomID)))
+}
+
+func (l *EventLog) logPath(roomID string) string {
+	return filepath.Join(l.roomDir(roomID), logFileName)
+}
+
+func (l *EventLog) snapshotPath(roomID string, offset uint64) string {
+	return filepath.Join(l.roomDir(roomID), fmt.Sprintf("%s%020d.json", snapshotPrefix, offset))
+}
+
+func roomFromDir(name string) (string, bool) {
+	if encoded, ok := strings.CutPrefix(name, "~"); ok {
+		roomID, err := hex.DecodeString(encoded)
+		return string(roomID), err == nil && len(roomID) > 0
+	}
+	return name, plainRoomDir.MatchString(name)
+}
+
+// writeFileAtomic пишет во временный файл и переименовывает его, чтобы
+// читатель не увидел файл наполовину.
+func writeFileAtomic(path string, data []byte, sync bool) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
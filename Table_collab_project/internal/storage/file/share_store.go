@@ -0,0 +1,53 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"table_collab/internal/domain"
+)
+
+// ShareStore хранит ссылки share в JSON-файле. Токены дают доступ к комнатам,
+// поэтому файл, как и файл webhook-ов, доступен только владельцу.
+type ShareStore struct {
+	path string
+}
+
+func NewShareStore(path string) *ShareStore {
+	return &ShareStore{path: path}
+}
+
+func (s *ShareStore) Save(links []*domain.ShareLink) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(links, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *ShareStore) Load() ([]*domain.ShareLink, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var links []*domain.ShareLink
+	if err := json.Unmarshal(data, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
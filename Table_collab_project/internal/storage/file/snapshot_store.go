@@ -0,0 +1,53 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"table_collab/internal/domain"
+)
+
+// SnapshotStore сохраняет состояние всех комнат в один JSON-файл.
+type SnapshotStore struct {
+	path string
+}
+
+func NewSnapshotStore(path string) *SnapshotStore {
+	return &SnapshotStore{path: path}
+}
+
+func (s *SnapshotStore) Save(rooms []*domain.Room) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(rooms, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Пишем во временный файл и переименовываем, чтобы не оставить обрезанный снапшот
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *SnapshotStore) Load() ([]*domain.Room, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rooms []*domain.Room
+	if err := json.Unmarshal(data, &rooms); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
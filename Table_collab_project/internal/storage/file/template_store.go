@@ -0,0 +1,52 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"table_collab/internal/domain"
+)
+
+// TemplateStore хранит шаблоны комнат в JSON-файле.
+type TemplateStore struct {
+	path string
+}
+
+func NewTemplateStore(path string) *TemplateStore {
+	return &TemplateStore{path: path}
+}
+
+func (s *TemplateStore) Save(templates []*domain.RoomTemplate) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(templates, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *TemplateStore) Load() ([]*domain.RoomTemplate, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []*domain.RoomTemplate
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
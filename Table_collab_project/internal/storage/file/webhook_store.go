@@ -0,0 +1,53 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"table_collab/internal/domain"
+)
+
+// WebhookStore хранит подписки на webhook-и вместе с секретами,
+// поэтому файл доступен только владельцу.
+type WebhookStore struct {
+	path string
+}
+
+func NewWebhookStore(path string) *WebhookStore {
+	return &WebhookStore{path: path}
+}
+
+func (s *WebhookStore) Save(webhooks []domain.Webhook) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(webhooks, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *WebhookStore) Load() ([]domain.Webhook, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var webhooks []domain.Webhook
+	if err := json.Unmarshal(data, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
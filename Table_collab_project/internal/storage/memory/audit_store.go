@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"sync"
+
+	"table_collab/internal/domain"
+)
+
+type AuditStore struct {
+	entries []domain.AuditEntry
+	limit   int
+	mu      sync.RWMutex
+}
+
+func NewAuditStore(limit int) *AuditStore {
+	if limit <= 0 {
+		limit = 1000
+	}
+	return &AuditStore{
+		entries: make([]domain.AuditEntry, 0, limit),
+		limit:   limit,
+	}
+}
+
+func (s *AuditStore) Append(entry domain.AuditEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries) == s.limit {
+		copy(s.entries, s.entries[1:])
+		s.entries = s.entries[:len(s.entries)-1]
+	}
+	s.entries = append(s.entries, entry)
+}
+
+// List возвращает последние записи, новые в конце.
+func (s *AuditStore) List(limit int) []domain.AuditEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	start := 0
+	if limit > 0 && limit < len(s.entries) {
+		start = len(s.entries) - limit
+	}
+
+	result := make([]domain.AuditEntry, len(s.entries)-start)
+	copy(result, s.entries[start:])
+	return result
+}
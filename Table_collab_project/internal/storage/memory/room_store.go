@@ -59,6 +59,13 @@ func (s *RoomStore) GetAll() ([]*domain.Room, error) {
 	return rooms, nil
 }
 
+func (s *RoomStore) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.rooms)
+}
+
 var ErrNotFound = struct {
 	error
 }{}
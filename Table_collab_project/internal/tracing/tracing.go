@@ -0,0 +1,144 @@
+// Package tracing настраивает OpenTelemetry: экспорт трасс по OTLP или в
+// stdout, общие атрибуты спанов и перенос контекста трассы в конверте события.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+// Name — имя трассировщика сервера.
+const Name = "table_collab"
+
+// Атрибуты спанов, по которым трассы связываются с комнатой, клиентом и событием.
+const (
+	AttrRoom   = attribute.Key("room.id")
+	AttrClient = attribute.Key("client.id")
+	AttrEvent  = attribute.Key("event.type")
+	AttrOpID   = attribute.Key("event.op_id")
+	AttrSeq    = attribute.Key("event.seq")
+	// Транспорт соединения: websocket, sse или longpoll
+	AttrTransport = attribute.Key("transport")
+)
+
+// Контекст переносится только в формате W3C: он же используется в конверте события.
+var propagator = propagation.TraceContext{}
+
+// Setup ставит глобальный TracerProvider с экспортом по cfg. Возвращённая
+// функция дописывает накопленные спаны и останавливает экспорт. stdout
+// нужен только экспорту "stdout".
+func Setup(ctx context.Context, cfg config.TracingConfig, stdout io.Writer) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch strings.ToLower(cfg.Exporter) {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(stdout))
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s exporter: %w", cfg.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer возвращает трассировщик сервера из глобального провайдера.
+func Tracer() trace.Tracer {
+	return otel.Tracer(Name)
+}
+
+// Extract возвращает ctx с контекстом трассы из конверта события.
+func Extract(ctx context.Context, event domain.Event) context.Context {
+	return propagator.Extract(ctx, carrier{&event})
+}
+
+// ExtractHeader возвращает ctx с контекстом трассы из заголовков HTTP-запроса.
+func ExtractHeader(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject записывает в конверт события контекст трассы из ctx. Если в ctx нет
+// действительного контекста, конверт не меняется.
+func Inject(ctx context.Context, event *domain.Event) {
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		event.TraceParent, event.TraceState = "", ""
+		propagator.Inject(ctx, carrier{event})
+	}
+}
+
+// EventAttrs — атрибуты спана, обрабатывающего событие клиента clientID.
+func EventAttrs(roomID, clientID string, event domain.Event) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		AttrRoom.String(roomID),
+		AttrClient.String(clientID),
+		AttrEvent.String(string(event.Type)),
+	}
+	if event.OpID != "" {
+		attrs = append(attrs, AttrOpID.String(event.OpID))
+	}
+	return attrs
+}
+
+// carrier даёт пропагатору доступ к полям трассировки в конверте события.
+type carrier struct {
+	event *domain.Event
+}
+
+func (c carrier) Get(key string) string {
+	switch key {
+	case "traceparent":
+		return c.event.TraceParent
+	case "tracestate":
+		return c.event.TraceState
+	default:
+		return ""
+	}
+}
+
+func (c carrier) Set(key, value string) {
+	switch key {
+	case "traceparent":
+		c.event.TraceParent = value
+	case "tracestate":
+		c.event.TraceState = value
+	}
+}
+
+func (c carrier) Keys() []string {
+	return []string{"traceparent", "tracestate"}
+}
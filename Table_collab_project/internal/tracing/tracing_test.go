@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"table_collab/cmd/server/config"
+	"table_collab/internal/domain"
+)
+
+func TestEventEnvelope(t *testing.T) {
+	event := domain.Event{
+		Type:        domain.EventCellUpdate,
+		TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		TraceState:  "vendor=1",
+	}
+	remote := trace.SpanContextFromContext(Extract(context.Background(), event))
+	if !remote.IsValid() || !remote.IsRemote() || remote.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("extracted %+v", remote)
+	}
+
+	var out domain.Event
+	Inject(trace.ContextWithSpanContext(context.Background(), remote), &out)
+	if out.TraceParent != event.TraceParent || out.TraceState != event.TraceState {
+		t.Fatalf("injected %q / %q", out.TraceParent, out.TraceState)
+	}
+
+	// Без контекста конверт не меняется, а мусор в нём не ломает разбор
+	Inject(context.Background(), &out)
+	if out.TraceParent != event.TraceParent {
+		t.Fatalf("envelope overwritten: %q", out.TraceParent)
+	}
+	if Extract(context.Background(), domain.Event{TraceParent: "garbage"}) != context.Background() {
+		t.Fatal("invalid traceparent produced a context")
+	}
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.TracingConfig{}, nil)
+	if err != nil || shutdown(context.Background()) != nil {
+		t.Fatalf("disabled tracing: %v", err)
+	}
+	if _, err := Setup(context.Background(), config.TracingConfig{Exporter: "zipkin"}, nil); err == nil {
+		t.Fatal("unknown exporter accepted")
+	}
+}
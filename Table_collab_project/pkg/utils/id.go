@@ -2,6 +2,7 @@ package utils
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"math/big"
 	"time"
 )
@@ -18,6 +19,12 @@ func GenerateID() string {
 	return string(result)
 }
 
+func GenerateToken() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
 func GenerateColor() string {
 	colors := []string{
 		"#FF6B6B", "#4ECDC4", "#FFD166", "#06D6A0",
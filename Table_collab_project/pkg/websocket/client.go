@@ -1,33 +1,854 @@
 package websocket
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/gorilla/websocket"
+	gws "github.com/gorilla/websocket"
+
+	"table_collab/internal/domain"
+	"table_collab/internal/service/collaboration"
+	"table_collab/pkg/utils"
 )
 
+const Subprotocol = "tablecollab.v1"
+
+var sheetEditor = collaboration.NewService()
+
+var (
+	ErrClosed   = errors.New("client closed")
+	ErrKicked   = errors.New("disconnected by server")
+	ErrNotReady = errors.New("not connected")
+)
+
+type Handler func(Event)
+
+// Options настраивают подключение к комнате TableCollab.
+type Options struct {
+	// URL сервера: http(s):// или ws(s)://, например "http://localhost:8080".
+	URL      string
+	RoomID   string
+	Username string
+	Color    string
+	// RoomType используется, если комната создаётся этим подключением.
+	RoomType RoomType
+
+	// Token уходит в заголовке Authorization: Bearer <token>.
+	Token  string
+	Header http.Header
+	Dialer *gws.Dialer
+
+	// Reconnect включает автоматическое переподключение с продолжением сессии.
+	Reconnect      bool
+	MaxRetries     int // 0 — без ограничения
+	ReconnectDelay time.Duration
+	MaxDelay       time.Duration
+
+	// EventBuffer — размер канала Events(); при переполнении события в канал не попадают.
+	EventBuffer int
+}
+
+// Client — подключение к одной комнате. Методы безопасны для конкурентного вызова.
 type Client struct {
-	Conn *websocket.Conn
-	Send chan []byte
+	opts Options
+
+	mu          sync.Mutex
+	conn        *gws.Conn
+	clientID    string
+	resumeToken string
+	lastSeq     uint64
+	sync        SyncPayload
+	pending     map[string]*pendingOp
+
+	writeMu    sync.Mutex
+	handlersMu sync.RWMutex
+	handlers   map[EventType][]Handler
+	any        []Handler
+
+	events    chan Event
+	dropped   atomic.Uint64
+	opCounter atomic.Uint64
+
+	ready     chan struct{}
+	readyOnce sync.Once
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+type pendingOp struct {
+	event Event
+	reply chan Event
 }
 
-func NewClient(conn *websocket.Conn) *Client {
-	return &Client{
-		Conn: conn,
-		Send: make(chan []byte, 256),
+// Dial подключается к комнате, входит в неё и ждёт начальный sync.
+func Dial(ctx context.Context, opts Options) (*Client, error) {
+	if opts.RoomID == "" {
+		return nil, errors.New("room id is required")
+	}
+	if opts.Dialer == nil {
+		opts.Dialer = gws.DefaultDialer
+	}
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = 500 * time.Millisecond
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = 10 * time.Second
+	}
+	if opts.EventBuffer <= 0 {
+		opts.EventBuffer = 256
+	}
+
+	c := &Client{
+		opts:     opts,
+		pending:  make(map[string]*pendingOp),
+		handlers: make(map[EventType][]Handler),
+		events:   make(chan Event, opts.EventBuffer),
+		ready:    make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	conn, err := c.dial(ctx, "", 0)
+	if err != nil {
+		return nil, err
 	}
+	c.conn = conn
+
+	if err := c.join(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go c.run(conn)
+
+	select {
+	case <-c.ready:
+		return c, nil
+	case <-c.done:
+		return nil, c.Err()
+	case <-ctx.Done():
+		c.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// On регистрирует обработчик для событий одного типа. Обработчики вызываются
+// последовательно из горутины чтения, поэтому не должны надолго блокироваться.
+func (c *Client) On(eventType EventType, handler Handler) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.handlers[eventType] = append(c.handlers[eventType], handler)
+}
+
+// OnAny регистрирует обработчик для всех событий.
+func (c *Client) OnAny(handler Handler) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.any = append(c.any, handler)
+}
+
+// Events возвращает канал всех входящих событий.
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// Dropped — сколько событий не поместилось в канал Events().
+func (c *Client) Dropped() uint64 {
+	return c.dropped.Load()
+}
+
+func (c *Client) ClientID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.clientID
+}
+
+// State возвращает состояние комнаты: последний sync с учётом полученных после него изменений.
+func (c *Client) State() SyncPayload {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := c.sync
+	state.Locks = append([]Lock(nil), c.sync.Locks...)
+	state.Attachments = append([]*Attachment(nil), c.sync.Attachments...)
+	state.Sheets = collaboration.CloneSheets(c.sync.Sheets)
+	state.Comments = make([]*CommentThread, len(c.sync.Comments))
+	for i, thread := range c.sync.Comments {
+		state.Comments[i] = thread.Clone()
+	}
+	state.Views = make([]*View, len(c.sync.Views))
+	for i, view := range c.sync.Views {
+		state.Views[i] = view.Clone()
+	}
+	return state
+}
+
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err возвращает причину, по которой клиент перестал работать.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
 }
 
-func (c *Client) WriteMessage(message []byte) {
+// Send отправляет произвольное событие без ожидания подтверждения.
+func (c *Client) Send(eventType EventType, payload interface{}) error {
+	return c.write(c.currentConn(), outgoing{Type: eventType, Payload: payload})
+}
+
+func (c *Client) SendChat(text string) error {
+	return c.Send(EventChatMessage, ChatPayload{Text: text})
+}
+
+func (c *Client) SendCursor(x, y float64) error {
+	return c.Send(EventCursorMove, CursorPosition{X: x, Y: y})
+}
+
+// SendText заменяет текст документа и ждёт подтверждения сервера.
+func (c *Client) SendText(ctx context.Context, text string) (AckPayload, error) {
+	c.mu.Lock()
+	version := c.sync.Version
+	c.mu.Unlock()
+
+	return c.SendEdit(ctx, EventTextUpdate, TextUpdatePayload{Text: text, Version: version})
+}
+
+// SendCell меняет ячейку первого листа таблицы ("B3") и ждёт подтверждения сервера.
+func (c *Client) SendCell(ctx context.Context, cell, value string) (AckPayload, error) {
+	return c.SendEdit(ctx, EventCellUpdate, CellUpdatePayload{Cell: cell, Value: value})
+}
+
+// SendSheetCell меняет ячейку указанного листа. Значение, начинающееся с "=",
+// — формула; результат приходит событием cells_computed.
+func (c *Client) SendSheetCell(ctx context.Context, sheetID, cell, value string) (AckPayload, error) {
+	return c.SendEdit(ctx, EventCellUpdate, CellUpdatePayload{SheetID: sheetID, Cell: cell, Value: value})
+}
+
+// AddSheet добавляет лист в конец таблицы и возвращает его ID. Пустое имя
+// сервер заменит на свободное "SheetN".
+func (c *Client) AddSheet(ctx context.Context, name string) (string, error) {
+	id := "sheet_" + utils.GenerateID()
+	_, err := c.SendEdit(ctx, EventSheetAdd, SheetAddPayload{SheetID: id, Name: name})
+	return id, err
+}
+
+func (c *Client) RenameSheet(ctx context.Context, sheetID, name string) error {
+	_, err := c.SendEdit(ctx, EventSheetRename, SheetRenamePayload{SheetID: sheetID, Name: name})
+	return err
+}
+
+// MoveSheet переставляет лист на позицию index (с нуля).
+func (c *Client) MoveSheet(ctx context.Context, sheetID string, index int) error {
+	_, err := c.SendEdit(ctx, EventSheetMove, SheetMovePayload{SheetID: sheetID, Index: index})
+	return err
+}
+
+// DuplicateSheet копирует лист сразу за ним и возвращает ID копии.
+func (c *Client) DuplicateSheet(ctx context.Context, sheetID, name string) (string, error) {
+	id := "sheet_" + utils.GenerateID()
+	_, err := c.SendEdit(ctx, EventSheetDuplicate, SheetDuplicatePayload{SheetID: sheetID, NewSheetID: id, Name: name})
+	return id, err
+}
+
+func (c *Client) DeleteSheet(ctx context.Context, sheetID string) error {
+	_, err := c.SendEdit(ctx, EventSheetDelete, SheetDeletePayload{SheetID: sheetID})
+	return err
+}
+
+// UpdateColumn заменяет настройки столбца ("C"); пустые настройки сбрасывают их.
+func (c *Client) UpdateColumn(ctx context.Context, sheetID, column string, settings Column) error {
+	_, err := c.SendEdit(ctx, EventColumnUpdate, ColumnUpdatePayload{SheetID: sheetID, Column: column, Settings: settings})
+	return err
+}
+
+// ViewSheet сообщает остальным участникам, какой лист открыт у клиента.
+func (c *Client) ViewSheet(sheetID string) error {
+	return c.Send(EventSheetView, SheetViewPayload{SheetID: sheetID})
+}
+
+// SaveView создаёт представление листа (пустой ID) или заменяет существующее.
+// Сохранённое представление с вычисленными строками приходит событием
+// view_updated, отказ — событием error.
+func (c *Client) SaveView(view View) error {
+	return c.Send(EventViewSave, ViewSavePayload{View: view})
+}
+
+func (c *Client) DeleteView(viewID string) error {
+	return c.Send(EventViewDelete, ViewDeletePayload{ViewID: viewID})
+}
+
+// AddComment открывает ветку комментариев к диапазону текста или ячейке.
+// Созданная ветка приходит событием comment_thread.
+func (c *Client) AddComment(anchor CommentAnchor, text string) error {
+	return c.Send(EventCommentAdd, CommentAddPayload{Anchor: anchor, Text: text})
+}
+
+func (c *Client) ReplyComment(threadID, text string) error {
+	return c.Send(EventCommentReply, CommentReplyPayload{ThreadID: threadID, Text: text})
+}
+
+func (c *Client) ResolveComment(threadID string, resolved bool) error {
+	return c.Send(EventCommentResolve, CommentResolvePayload{ThreadID: threadID, Resolved: resolved})
+}
+
+// AcquireLock запрашивает мягкую блокировку области на время редактирования.
+// Выданная блокировка приходит событием lock_acquired, отказ — событием error
+// с кодом "locked". Повторный вызов для той же области продлевает блокировку.
+func (c *Client) AcquireLock(region LockRegion) error {
+	return c.Send(EventLockAcquire, LockAcquirePayload{Region: region})
+}
+
+func (c *Client) ReleaseLock(lockID string) error {
+	return c.Send(EventLockRelease, LockReleasePayload{LockID: lockID})
+}
+
+// SendEdit отправляет правку с уникальным op_id и ждёт ack или nack. После
+// переподключения неподтверждённые правки отправляются повторно с тем же op_id,
+// и сервер применяет их не более одного раза.
+func (c *Client) SendEdit(ctx context.Context, eventType EventType, payload interface{}) (AckPayload, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return AckPayload{}, err
+	}
+
+	op := &pendingOp{
+		event: Event{
+			Type:    eventType,
+			OpID:    c.nextOpID(),
+			Payload: raw,
+		},
+		reply: make(chan Event, 1),
+	}
+
+	c.mu.Lock()
+	c.pending[op.event.OpID] = op
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, op.event.OpID)
+		c.mu.Unlock()
+	}()
+
+	// Если соединения сейчас нет, правка уйдёт после переподключения
+	if err := c.write(c.currentConn(), op.event); err != nil && !errors.Is(err, ErrNotReady) {
+		return AckPayload{}, err
+	}
+
 	select {
-	case c.Send <- message:
+	case reply := <-op.reply:
+		if reply.Type == EventNack {
+			var nack NackPayload
+			reply.Decode(&nack)
+			return AckPayload{}, &NackError{nack}
+		}
+		var ack AckPayload
+		err := reply.Decode(&ack)
+		return ack, err
+	case <-c.done:
+		return AckPayload{}, c.Err()
+	case <-ctx.Done():
+		return AckPayload{}, ctx.Err()
+	}
+}
+
+// Close выходит из комнаты и закрывает соединение.
+func (c *Client) Close() error {
+	c.finish(ErrClosed)
+
+	conn := c.currentConn()
+	if conn == nil {
+		return nil
+	}
+
+	c.writeMu.Lock()
+	conn.WriteControl(gws.CloseMessage,
+		gws.FormatCloseMessage(gws.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+	return conn.Close()
+}
+
+func (c *Client) dial(ctx context.Context, resumeToken string, lastSeq uint64) (*gws.Conn, error) {
+	u, err := roomURL(c.opts.URL, c.opts.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	if resumeToken != "" {
+		q := u.Query()
+		q.Set("resume", resumeToken)
+		q.Set("last_seq", strconv.FormatUint(lastSeq, 10))
+		u.RawQuery = q.Encode()
+	}
+
+	header := http.Header{}
+	for key, values := range c.opts.Header {
+		header[key] = values
+	}
+	if c.opts.Token != "" {
+		header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+	header.Set("Sec-WebSocket-Protocol", Subprotocol)
+
+	conn, resp, err := c.opts.Dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("dial %s: %w (status %d)", u.Redacted(), err, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("dial %s: %w", u.Redacted(), err)
+	}
+	return conn, nil
+}
+
+func (c *Client) join() error {
+	return c.write(c.currentConn(), outgoing{
+		Type: EventJoinRoom,
+		Payload: JoinRoomPayload{
+			Username: c.opts.Username,
+			Color:    c.opts.Color,
+			RoomType: c.opts.RoomType,
+		},
+	})
+}
+
+// run читает события, а при обрыве переподключается, пока клиент не закрыт.
+func (c *Client) run(conn *gws.Conn) {
+	for {
+		err := c.readLoop(conn)
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+
+		resume, fatal := classify(err)
+		if fatal != nil || !c.opts.Reconnect {
+			if fatal == nil {
+				fatal = err
+			}
+			c.finish(fatal)
+			return
+		}
+
+		conn = c.reconnect(resume)
+		if conn == nil {
+			return
+		}
+	}
+}
+
+func (c *Client) readLoop(conn *gws.Conn) error {
+	for {
+		var event Event
+		if err := conn.ReadJSON(&event); err != nil {
+			return err
+		}
+		c.handle(conn, event)
+	}
+}
+
+func (c *Client) handle(conn *gws.Conn, event Event) {
+	c.mu.Lock()
+	if event.Seq > 0 {
+		c.lastSeq = event.Seq
+	}
+
+	var resend []Event
+	switch event.Type {
+	case EventSession:
+		var session SessionPayload
+		if event.Decode(&session) == nil {
+			c.clientID = session.ClientID
+			c.resumeToken = session.ResumeToken
+			if session.Resumed {
+				for _, op := range c.pending {
+					resend = append(resend, op.event)
+				}
+				c.readyOnce.Do(func() { close(c.ready) })
+			}
+		}
+
+	case EventSync:
+		var sync SyncPayload
+		if event.Decode(&sync) == nil {
+			c.sync = sync
+		}
+		c.readyOnce.Do(func() { close(c.ready) })
+
+	case EventTextUpdate:
+		var update TextUpdatePayload
+		if event.Decode(&update) == nil {
+			c.sync.Content = update.Text
+		}
+		c.sync.Version = event.Version
+
+	case EventElementAdd:
+		c.sync.Version = event.Version
+
+	case EventCellUpdate, EventSheetAdd, EventSheetRename, EventSheetMove,
+		EventSheetDuplicate, EventSheetDelete, EventColumnUpdate:
+		c.applySheetEdit(event)
+		c.sync.Version = event.Version
+
+	case EventCellsComputed:
+		var computed CellsComputedPayload
+		if event.Decode(&computed) == nil {
+			c.applyComputed(computed)
+		}
+
+	case EventSheetView:
+		var view SheetViewPayload
+		if event.Decode(&view) == nil {
+			for i := range c.sync.Participants {
+				if c.sync.Participants[i].ID == event.UserID {
+					c.sync.Participants[i].Sheet = view.SheetID
+				}
+			}
+		}
+
+	case EventViewUpdated:
+		var view View
+		if event.Decode(&view) == nil {
+			c.updateView(&view)
+		}
+
+	case EventViewDelete:
+		var removed ViewDeletePayload
+		if event.Decode(&removed) == nil {
+			c.removeView(removed.ViewID)
+		}
+
+	case EventViewRows:
+		var rows ViewRowsPayload
+		if event.Decode(&rows) == nil {
+			for _, view := range c.sync.Views {
+				if view.ID == rows.ViewID {
+					view.Rows, view.Groups = rows.Rows, rows.Groups
+				}
+			}
+		}
+
+	case EventAttachmentAdded:
+		var attachment Attachment
+		if event.Decode(&attachment) == nil {
+			c.sync.Attachments = append(c.sync.Attachments, &attachment)
+		}
+
+	case EventAttachmentRemoved:
+		var removed AttachmentRemovedPayload
+		if event.Decode(&removed) == nil {
+			for i, attachment := range c.sync.Attachments {
+				if attachment.ID == removed.AttachmentID {
+					c.sync.Attachments = append(c.sync.Attachments[:i:i], c.sync.Attachments[i+1:]...)
+					break
+				}
+			}
+		}
+
+	case EventCommentThread:
+		var thread CommentThread
+		if event.Decode(&thread) == nil {
+			c.updateThread(&thread)
+		}
+
+	case EventLockAcquired:
+		var lock Lock
+		if event.Decode(&lock) == nil {
+			c.updateLock(lock)
+		}
+
+	case EventLockReleased:
+		var released LockReleasedPayload
+		if event.Decode(&released) == nil {
+			for i, lock := range c.sync.Locks {
+				if lock.ID == released.LockID {
+					c.sync.Locks = append(c.sync.Locks[:i:i], c.sync.Locks[i+1:]...)
+					break
+				}
+			}
+		}
+
+	case EventCommentAnchors:
+		var moved CommentAnchorsPayload
+		if event.Decode(&moved) == nil {
+			for _, thread := range c.sync.Comments {
+				if anchor, ok := moved.Anchors[thread.ID]; ok {
+					thread.Anchor = anchor
+				}
+			}
+		}
+
+	case EventAck, EventNack:
+		var reply struct {
+			OpID    string `json:"op_id"`
+			Version int    `json:"version"`
+			Code    string `json:"code"`
+		}
+		if event.Decode(&reply) == nil {
+			// Сервер останавливается и правку не принял: она останется в pending
+			// и уйдёт повторно после переподключения
+			if op, ok := c.pending[reply.OpID]; ok && reply.Code != "shutting_down" {
+				select {
+				case op.reply <- event:
+				default:
+				}
+			}
+			if event.Type == EventAck && reply.Version > c.sync.Version {
+				c.sync.Version = reply.Version
+			}
+		}
+
+	case EventError:
+		var payload ErrorPayload
+		if event.Decode(&payload) == nil && payload.Code == "resume_failed" {
+			// Сессия потеряна: входим заново и получаем полный sync
+			c.resumeToken = ""
+			c.lastSeq = 0
+			for _, op := range c.pending {
+				resend = append(resend, op.event)
+			}
+			c.mu.Unlock()
+			c.join()
+			c.mu.Lock()
+		}
+	}
+	c.mu.Unlock()
+
+	for _, op := range resend {
+		c.write(conn, op)
+	}
+
+	c.dispatch(event)
+}
+
+// updateThread заменяет или добавляет ветку в State; вызывается под c.mu.
+func (c *Client) updateThread(thread *CommentThread) {
+	for i, existing := range c.sync.Comments {
+		if existing.ID == thread.ID {
+			c.sync.Comments[i] = thread
+			return
+		}
+	}
+	c.sync.Comments = append(c.sync.Comments, thread)
+}
+
+// updateView заменяет или добавляет представление в State; вызывается под c.mu.
+func (c *Client) updateView(view *View) {
+	for i, existing := range c.sync.Views {
+		if existing.ID == view.ID {
+			c.sync.Views[i] = view
+			return
+		}
+	}
+	c.sync.Views = append(c.sync.Views, view)
+}
+
+func (c *Client) removeView(viewID string) {
+	for i, view := range c.sync.Views {
+		if view.ID == viewID {
+			c.sync.Views = append(c.sync.Views[:i:i], c.sync.Views[i+1:]...)
+			return
+		}
+	}
+}
+
+// applySheetEdit применяет к листам в State правку, пришедшую от сервера, тем
+// же кодом, что и сервер; вызывается под c.mu.
+func (c *Client) applySheetEdit(event Event) {
+	room := &domain.Room{Type: c.sync.Type, Sheets: c.sync.Sheets, Views: c.sync.Views}
+	edit := domain.Event{Type: event.Type, Payload: event.Payload}
+
+	var err error
+	if event.Type == EventCellUpdate {
+		_, err = sheetEditor.ApplyCellUpdate(room, edit)
+	} else {
+		_, err = sheetEditor.ApplySheetEdit(room, edit)
+	}
+	if err != nil {
+		log.Printf("tablecollab: cannot apply %s to local state: %v", event.Type, err)
+		return
+	}
+	c.sync.Sheets, c.sync.Views = room.Sheets, room.Views
+}
+
+// applyComputed обновляет значения формул в State; вызывается под c.mu.
+func (c *Client) applyComputed(computed CellsComputedPayload) {
+	for _, sheet := range c.sync.Sheets {
+		for cell, value := range computed.Values[sheet.ID] {
+			if value == "" {
+				delete(sheet.Values, cell)
+				continue
+			}
+			if sheet.Values == nil {
+				sheet.Values = make(map[string]string)
+			}
+			sheet.Values[cell] = value
+		}
+	}
+}
+
+// updateLock заменяет или добавляет блокировку в State; вызывается под c.mu.
+func (c *Client) updateLock(lock Lock) {
+	for i, existing := range c.sync.Locks {
+		if existing.ID == lock.ID {
+			c.sync.Locks[i] = lock
+			return
+		}
+	}
+	c.sync.Locks = append(c.sync.Locks, lock)
+}
+
+func (c *Client) dispatch(event Event) {
+	c.handlersMu.RLock()
+	handlers := append(c.handlers[event.Type][:len(c.handlers[event.Type]):len(c.handlers[event.Type])], c.any...)
+	c.handlersMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+
+	select {
+	case c.events <- event:
 	default:
-		log.Println("Client send buffer full")
-		c.Close()
+		c.dropped.Add(1)
+	}
+}
+
+func (c *Client) reconnect(resume bool) *gws.Conn {
+	delay := c.opts.ReconnectDelay
+
+	for attempt := 1; c.opts.MaxRetries == 0 || attempt <= c.opts.MaxRetries; attempt++ {
+		select {
+		case <-time.After(delay):
+		case <-c.done:
+			return nil
+		}
+
+		c.mu.Lock()
+		token, lastSeq := c.resumeToken, c.lastSeq
+		if !resume {
+			token, lastSeq = "", 0
+		}
+		c.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		conn, err := c.dial(ctx, token, lastSeq)
+		cancel()
+		if err != nil {
+			log.Printf("tablecollab: reconnect attempt %d failed: %v", attempt, err)
+			delay = min(delay*2, c.opts.MaxDelay)
+			continue
+		}
+
+		c.mu.Lock()
+		c.conn = conn
+		if token == "" {
+			c.resumeToken, c.lastSeq = "", 0
+		}
+		c.mu.Unlock()
+
+		if token == "" {
+			if err := c.join(); err != nil {
+				conn.Close()
+				continue
+			}
+		}
+		return conn
+	}
+
+	c.finish(fmt.Errorf("reconnect failed after %d attempts", c.opts.MaxRetries))
+	return nil
+}
+
+// classify решает, что делать после ошибки чтения: resume — продолжить
+// сессию, fatal — больше не переподключаться.
+func classify(err error) (resume bool, fatal error) {
+	var closeErr *gws.CloseError
+	if !errors.As(err, &closeErr) {
+		return true, nil
+	}
+
+	switch closeErr.Code {
+	case gws.CloseServiceRestart, gws.CloseTryAgainLater, gws.CloseAbnormalClosure:
+		return true, nil
+	case 4001: // слишком медленный клиент: нужен полный sync
+		return false, nil
+	default:
+		return false, fmt.Errorf("%w: %d %s", ErrKicked, closeErr.Code, closeErr.Text)
 	}
 }
 
-func (c *Client) Close() {
-	c.Conn.Close()
-	close(c.Send)
+type outgoing struct {
+	Type    EventType   `json:"type"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+func (c *Client) write(conn *gws.Conn, v interface{}) error {
+	if conn == nil {
+		return ErrNotReady
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return conn.WriteJSON(v)
+}
+
+func (c *Client) currentConn() *gws.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.conn
+}
+
+func (c *Client) nextOpID() string {
+	return fmt.Sprintf("%s-%d-%d", c.opts.Username, time.Now().UnixNano(), c.opCounter.Add(1))
+}
+
+func (c *Client) finish(err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		close(c.done)
+	})
+}
+
+func roomURL(base, roomID string) (*url.URL, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return nil, fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+
+	u.Path = strings.TrimRight(u.Path, "/") + "/ws/" + url.PathEscape(roomID)
+	return u, nil
 }
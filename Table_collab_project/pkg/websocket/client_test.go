@@ -0,0 +1,333 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+
+	"table_collab/internal/domain"
+)
+
+const waitTimeout = 2 * time.Second
+
+// fakeServer — сервер комнаты, которым тест управляет вручную: каждое
+// подключение попадает в conns, дальше тест сам читает и пишет события.
+type fakeServer struct {
+	*httptest.Server
+	t     *testing.T
+	conns chan *fakeConn
+
+	mu   sync.Mutex
+	open []*fakeConn
+}
+
+type fakeConn struct {
+	t      *testing.T
+	conn   *gws.Conn
+	query  url.Values
+	header http.Header
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	s := &fakeServer{t: t, conns: make(chan *fakeConn, 8)}
+	upgrader := gws.Upgrader{Subprotocols: []string{Subprotocol}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := &fakeConn{t: t, conn: conn, query: r.URL.Query(), header: r.Header}
+		s.mu.Lock()
+		s.open = append(s.open, c)
+		s.mu.Unlock()
+		s.conns <- c
+	}))
+	t.Cleanup(func() {
+		s.mu.Lock()
+		for _, c := range s.open {
+			c.conn.Close()
+		}
+		s.mu.Unlock()
+		s.Close()
+	})
+	return s
+}
+
+func (s *fakeServer) accept() *fakeConn {
+	s.t.Helper()
+
+	select {
+	case c := <-s.conns:
+		return c
+	case <-time.After(waitTimeout):
+		s.t.Fatal("client did not connect")
+		return nil
+	}
+}
+
+// dial подключает клиента и проводит вход: session с токеном и sync.
+func (s *fakeServer) dial(opts Options) (*Client, *fakeConn) {
+	s.t.Helper()
+
+	opts.URL, opts.RoomID = s.URL, "room"
+	if opts.ReconnectDelay == 0 {
+		opts.ReconnectDelay = 10 * time.Millisecond
+	}
+
+	type result struct {
+		client *Client
+		err    error
+	}
+	dialed := make(chan result, 1)
+	go func() {
+		client, err := Dial(context.Background(), opts)
+		dialed <- result{client, err}
+	}()
+
+	conn := s.accept()
+	conn.expect(EventJoinRoom)
+	conn.write(domain.Event{Type: EventSession, Payload: SessionPayload{ClientID: "c1", ResumeToken: "token-1"}})
+	conn.write(domain.Event{Type: EventSync, Version: 1, Payload: SyncPayload{Content: "hello"}})
+
+	r := <-dialed
+	if r.err != nil {
+		s.t.Fatalf("dial: %v", r.err)
+	}
+	s.t.Cleanup(func() { r.client.Close() })
+	// Начальный sync уже лежит в Events(); тестам он не нужен
+	expectEvent(s.t, r.client, EventSync)
+	return r.client, conn
+}
+
+func (c *fakeConn) read() Event {
+	c.t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(waitTimeout))
+	var event Event
+	if err := c.conn.ReadJSON(&event); err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	return event
+}
+
+func (c *fakeConn) expect(eventType EventType) Event {
+	c.t.Helper()
+
+	event := c.read()
+	if event.Type != eventType {
+		c.t.Fatalf("got %s, want %s", event.Type, eventType)
+	}
+	return event
+}
+
+func (c *fakeConn) write(event domain.Event) {
+	c.t.Helper()
+
+	if err := c.conn.WriteJSON(event); err != nil {
+		c.t.Fatalf("write %s: %v", event.Type, err)
+	}
+}
+
+// drop рвёт соединение без close-фрейма.
+func (c *fakeConn) drop() {
+	c.conn.NetConn().Close()
+}
+
+func (c *fakeConn) closeWith(code int) {
+	c.conn.WriteControl(gws.CloseMessage, gws.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+	c.conn.Close()
+}
+
+func expectEvent(t *testing.T, client *Client, eventType EventType) Event {
+	t.Helper()
+
+	timeout := time.After(waitTimeout)
+	for {
+		select {
+		case event := <-client.Events():
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("no %s event", eventType)
+		}
+	}
+}
+
+func TestDialJoinsRoom(t *testing.T) {
+	s := newFakeServer(t)
+
+	client, conn := s.dial(Options{Username: "bot", Token: "secret"})
+	if got := conn.header.Get("Authorization"); got != "Bearer secret" {
+		t.Fatalf("Authorization = %q", got)
+	}
+	if client.ClientID() != "c1" || client.State().Content != "hello" {
+		t.Fatalf("client %s, state %+v", client.ClientID(), client.State())
+	}
+}
+
+func TestReconnectResumesSession(t *testing.T) {
+	s := newFakeServer(t)
+
+	client, conn := s.dial(Options{Reconnect: true})
+	conn.write(domain.Event{Type: EventChatMessage, Seq: 3, Payload: ChatPayload{Text: "before"}})
+	expectEvent(t, client, EventChatMessage)
+
+	conn.drop()
+	resumed := s.accept()
+	if resumed.query.Get("resume") != "token-1" || resumed.query.Get("last_seq") != "3" {
+		t.Fatalf("reconnected with %v", resumed.query)
+	}
+	resumed.write(domain.Event{Type: EventSession, Payload: SessionPayload{ClientID: "c1", ResumeToken: "token-1", Resumed: true}})
+	resumed.write(domain.Event{Type: EventChatMessage, Seq: 4, Payload: ChatPayload{Text: "after"}})
+
+	var chat ChatPayload
+	expectEvent(t, client, EventChatMessage).Decode(&chat)
+	if chat.Text != "after" || client.ClientID() != "c1" {
+		t.Fatalf("after resume: %q as %s", chat.Text, client.ClientID())
+	}
+}
+
+// Неподтверждённая правка уходит после resume с тем же op_id.
+func TestPendingEditRetriedAfterResume(t *testing.T) {
+	s := newFakeServer(t)
+
+	client, conn := s.dial(Options{Reconnect: true})
+	acked := make(chan AckPayload, 1)
+	go func() {
+		ack, err := client.SendText(context.Background(), "draft")
+		if err != nil {
+			t.Errorf("SendText: %v", err)
+		}
+		acked <- ack
+	}()
+
+	first := conn.expect(EventTextUpdate)
+	conn.drop()
+
+	resumed := s.accept()
+	resumed.write(domain.Event{Type: EventSession, Payload: SessionPayload{ClientID: "c1", ResumeToken: "token-1", Resumed: true}})
+	retry := resumed.expect(EventTextUpdate)
+	if retry.OpID != first.OpID {
+		t.Fatalf("retried with op_id %q, want %q", retry.OpID, first.OpID)
+	}
+	resumed.write(domain.Event{Type: EventAck, Version: 2, Payload: AckPayload{OpID: retry.OpID, Version: 2}})
+
+	select {
+	case ack := <-acked:
+		if ack.OpID != first.OpID || ack.Version != 2 {
+			t.Fatalf("ack %+v", ack)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("SendText did not return")
+	}
+}
+
+// Правку, отклонённую из-за остановки сервера, клиент не отдаёт вызывающему
+// как ошибку, а повторяет после переподключения.
+func TestShutdownNackIsRetried(t *testing.T) {
+	s := newFakeServer(t)
+
+	client, conn := s.dial(Options{Reconnect: true})
+	acked := make(chan error, 1)
+	go func() {
+		_, err := client.SendCell(context.Background(), "A1", "1")
+		acked <- err
+	}()
+
+	edit := conn.expect(EventCellUpdate)
+	conn.write(domain.Event{Type: EventNack, Payload: NackPayload{OpID: edit.OpID, Code: "shutting_down"}})
+	conn.closeWith(gws.CloseServiceRestart)
+
+	resumed := s.accept()
+	resumed.write(domain.Event{Type: EventSession, Payload: SessionPayload{ClientID: "c1", ResumeToken: "token-1", Resumed: true}})
+	retry := resumed.expect(EventCellUpdate)
+	resumed.write(domain.Event{Type: EventAck, Payload: AckPayload{OpID: retry.OpID, Version: 2}})
+
+	select {
+	case err := <-acked:
+		if err != nil || retry.OpID != edit.OpID {
+			t.Fatalf("SendCell: %v (retried %q, sent %q)", err, retry.OpID, edit.OpID)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("SendCell did not return")
+	}
+}
+
+// Если сессию продолжить нельзя, клиент входит заново и получает полный sync.
+func TestResumeFailedRejoins(t *testing.T) {
+	s := newFakeServer(t)
+
+	client, conn := s.dial(Options{Username: "bot", Reconnect: true})
+	conn.drop()
+
+	retry := s.accept()
+	retry.write(domain.Event{Type: EventError, Payload: ErrorPayload{Code: "resume_failed"}})
+	var join JoinRoomPayload
+	retry.expect(EventJoinRoom).Decode(&join)
+	if join.Username != "bot" {
+		t.Fatalf("rejoined as %+v", join)
+	}
+	retry.write(domain.Event{Type: EventSession, Payload: SessionPayload{ClientID: "c2", ResumeToken: "token-2"}})
+	retry.write(domain.Event{Type: EventSync, Version: 7, Payload: SyncPayload{Content: "fresh"}})
+
+	expectEvent(t, client, EventSync)
+	if state := client.State(); state.Content != "fresh" || client.ClientID() != "c2" {
+		t.Fatalf("after rejoin: %+v as %s", state, client.ClientID())
+	}
+}
+
+// Медленного клиента сервер отключает с потерей сессии: переподключение идёт
+// без resume и со входом заново.
+func TestSlowConsumerReconnectsWithoutResume(t *testing.T) {
+	s := newFakeServer(t)
+
+	_, conn := s.dial(Options{Reconnect: true})
+	conn.closeWith(4001)
+
+	retry := s.accept()
+	if retry.query.Has("resume") {
+		t.Fatalf("reconnected with %v", retry.query)
+	}
+	retry.expect(EventJoinRoom)
+}
+
+func TestKickStopsClient(t *testing.T) {
+	s := newFakeServer(t)
+
+	client, conn := s.dial(Options{Reconnect: true})
+	conn.closeWith(gws.ClosePolicyViolation)
+
+	select {
+	case <-client.Done():
+		if !errors.Is(client.Err(), ErrKicked) {
+			t.Fatalf("Err = %v", client.Err())
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("client kept running after a kick")
+	}
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	s := newFakeServer(t)
+
+	client, conn := s.dial(Options{Reconnect: true, MaxRetries: 2})
+	s.Listener.Close()
+	conn.drop()
+
+	select {
+	case <-client.Done():
+		if client.Err() == nil {
+			t.Fatal("no error after giving up")
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("client is still reconnecting")
+	}
+}
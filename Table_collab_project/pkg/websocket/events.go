@@ -0,0 +1,149 @@
+package websocket
+
+import (
+	"encoding/json"
+
+	"table_collab/internal/domain"
+)
+
+type EventType = domain.EventType
+
+const (
+	EventJoinRoom    = domain.EventJoinRoom
+	EventLeaveRoom   = domain.EventLeaveRoom
+	EventCursorMove  = domain.EventCursorMove
+	EventTextUpdate  = domain.EventTextUpdate
+	EventElementAdd  = domain.EventElementAdd
+	EventCellUpdate  = domain.EventCellUpdate
+	EventChatMessage = domain.EventChatMessage
+	EventError       = domain.EventError
+	EventSync        = domain.EventSync
+	EventSystem      = domain.EventSystem
+	EventSession     = domain.EventSession
+	EventAck         = domain.EventAck
+	EventNack        = domain.EventNack
+
+	EventCommentAdd     = domain.EventCommentAdd
+	EventCommentReply   = domain.EventCommentReply
+	EventCommentResolve = domain.EventCommentResolve
+	EventCommentThread  = domain.EventCommentThread
+	EventCommentAnchors = domain.EventCommentAnchors
+
+	EventLockAcquire  = domain.EventLockAcquire
+	EventLockRelease  = domain.EventLockRelease
+	EventLockAcquired = domain.EventLockAcquired
+	EventLockReleased = domain.EventLockReleased
+
+	EventSheetAdd       = domain.EventSheetAdd
+	EventSheetRename    = domain.EventSheetRename
+	EventSheetMove      = domain.EventSheetMove
+	EventSheetDuplicate = domain.EventSheetDuplicate
+	EventSheetDelete    = domain.EventSheetDelete
+	EventColumnUpdate   = domain.EventColumnUpdate
+	EventSheetView      = domain.EventSheetView
+	EventCellsComputed  = domain.EventCellsComputed
+	EventViewSave       = domain.EventViewSave
+	EventViewDelete     = domain.EventViewDelete
+	EventViewUpdated    = domain.EventViewUpdated
+	EventViewRows       = domain.EventViewRows
+
+	EventAttachmentAdded   = domain.EventAttachmentAdded
+	EventAttachmentRemoved = domain.EventAttachmentRemoved
+)
+
+type (
+	RoomType             = domain.RoomType
+	JoinRoomPayload      = domain.JoinRoomPayload
+	TextUpdatePayload    = domain.TextUpdatePayload
+	CellUpdatePayload    = domain.CellUpdatePayload
+	CursorPosition       = domain.CursorPosition
+	SyncPayload          = domain.SyncPayload
+	SessionPayload       = domain.SessionPayload
+	ErrorPayload         = domain.ErrorPayload
+	SystemMessagePayload = domain.SystemMessagePayload
+	AckPayload           = domain.AckPayload
+	NackPayload          = domain.NackPayload
+
+	CommentAnchor         = domain.CommentAnchor
+	Comment               = domain.Comment
+	CommentThread         = domain.CommentThread
+	CommentAddPayload     = domain.CommentAddPayload
+	CommentReplyPayload   = domain.CommentReplyPayload
+	CommentResolvePayload = domain.CommentResolvePayload
+	CommentAnchorsPayload = domain.CommentAnchorsPayload
+
+	Lock                = domain.Lock
+	LockRegion          = domain.LockRegion
+	LockAcquirePayload  = domain.LockAcquirePayload
+	LockReleasePayload  = domain.LockReleasePayload
+	LockReleasedPayload = domain.LockReleasedPayload
+
+	Sheet                 = domain.Sheet
+	Column                = domain.Column
+	ColumnType            = domain.ColumnType
+	ColumnRules           = domain.ColumnRules
+	SheetAddPayload       = domain.SheetAddPayload
+	SheetRenamePayload    = domain.SheetRenamePayload
+	SheetMovePayload      = domain.SheetMovePayload
+	SheetDuplicatePayload = domain.SheetDuplicatePayload
+	SheetDeletePayload    = domain.SheetDeletePayload
+	ColumnUpdatePayload   = domain.ColumnUpdatePayload
+	SheetViewPayload      = domain.SheetViewPayload
+	CellsComputedPayload  = domain.CellsComputedPayload
+
+	View              = domain.View
+	SortKey           = domain.SortKey
+	ViewGroup         = domain.ViewGroup
+	ViewSavePayload   = domain.ViewSavePayload
+	ViewDeletePayload = domain.ViewDeletePayload
+	ViewRowsPayload   = domain.ViewRowsPayload
+
+	Attachment               = domain.Attachment
+	AttachmentRemovedPayload = domain.AttachmentRemovedPayload
+)
+
+const (
+	RoomTypeDocument   = domain.RoomTypeDocument
+	RoomTypeWhiteboard = domain.RoomTypeWhiteboard
+	RoomTypeTable      = domain.RoomTypeTable
+)
+
+const (
+	ColumnText         = domain.ColumnText
+	ColumnNumber       = domain.ColumnNumber
+	ColumnDate         = domain.ColumnDate
+	ColumnCheckbox     = domain.ColumnCheckbox
+	ColumnSingleSelect = domain.ColumnSingleSelect
+	ColumnMultiSelect  = domain.ColumnMultiSelect
+	ColumnUser         = domain.ColumnUser
+)
+
+// Event — событие в том виде, в каком оно приходит с сервера.
+// Payload остаётся сырым JSON, его разбирают через Decode.
+type Event struct {
+	Type      EventType       `json:"type"`
+	RoomID    string          `json:"room_id,omitempty"`
+	UserID    string          `json:"user_id,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Timestamp int64           `json:"timestamp"`
+	Version   int             `json:"version,omitempty"`
+	Seq       uint64          `json:"seq,omitempty"`
+	OpID      string          `json:"op_id,omitempty"`
+}
+
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+type ChatPayload struct {
+	Text string `json:"text"`
+}
+
+// NackError — сервер отклонил правку.
+type NackError struct {
+	NackPayload
+}
+
+func (e *NackError) Error() string {
+	return "edit rejected: " + e.Code + ": " + e.Reason
+}
@@ -3,7 +3,16 @@ class TableCollabRoom {
 		this.roomId = window.location.pathname.split('/').pop()
 		this.userId = null
 		this.ws = null
+		this.sse = null
+		this.sseConnId = null
 		this.participants = new Map()
+		this.resumeToken = null
+		this.lastSeq = 0
+		this.version = 0
+		this.opCounter = 0
+		this.pendingOps = new Map()
+		this.comments = new Map()
+		this.locks = new Map()
 
 		this.init()
 	}
@@ -19,23 +28,45 @@ class TableCollabRoom {
 		this.setupEventListeners()
 	}
 
+	resumeQuery() {
+		return this.resumeToken
+			? `?resume=${this.resumeToken}&last_seq=${this.lastSeq}`
+			: ''
+	}
+
 	connectWebSocket() {
 		const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:'
-		const wsUrl = `${protocol}//${window.location.host}/ws/${this.roomId}`
+		const wsUrl = `${protocol}//${window.location.host}/ws/${
+			this.roomId
+		}${this.resumeQuery()}`
 
-		this.ws = new WebSocket(wsUrl)
+		let opened = false
+		this.ws = new WebSocket(wsUrl, ['tablecollab.v1'])
 
 		this.ws.onopen = () => {
+			opened = true
 			console.log('Connected to room:', this.roomId)
-			this.sendJoin()
+			if (!this.resumeToken) {
+				this.sendJoin()
+			}
 		}
 
 		this.ws.onmessage = event => {
-			this.handleMessage(JSON.parse(event.data))
+			this.receive(JSON.parse(event.data))
 		}
 
-		this.ws.onclose = () => {
-			console.log('Disconnected')
+		this.ws.onclose = event => {
+			console.log('Disconnected', event.code, event.reason)
+			this.ws = null
+			// WebSocket режет прокси — переходим на Server-Sent Events
+			if (!opened) {
+				this.connectSSE()
+				return
+			}
+			// 1006 — обрыв сети: пробуем продолжить сессию
+			if (event.code === 1006 && this.resumeToken) {
+				setTimeout(() => this.connectWebSocket(), 1000)
+			}
 		}
 
 		this.ws.onerror = error => {
@@ -43,22 +74,124 @@ class TableCollabRoom {
 		}
 	}
 
-	sendJoin() {
-		this.ws.send(
-			JSON.stringify({
-				type: 'join_room',
-				payload: {
-					username: this.username,
-					color: this.getUserColor(),
-				},
-			})
+	connectSSE() {
+		this.sse = new EventSource(`/sse/${this.roomId}${this.resumeQuery()}`)
+
+		this.sse.onmessage = event => {
+			this.receive(JSON.parse(event.data))
+		}
+
+		this.sse.onerror = () => {
+			// Переподключаемся сами, чтобы передать resume-токен
+			this.sse.close()
+			this.sse = null
+			this.sseConnId = null
+			if (this.resumeToken) {
+				setTimeout(() => this.connectSSE(), 1000)
+			}
+		}
+	}
+
+	receive(data) {
+		if (data.seq) {
+			this.lastSeq = data.seq
+		}
+
+		if (data.type === 'connected') {
+			this.sseConnId = data.payload.conn_id
+			console.log('Connected to room via SSE:', this.roomId)
+			if (!this.resumeToken) {
+				this.sendJoin()
+			}
+			return
+		}
+		if (data.type === 'close') {
+			this.sse.close()
+			this.sse = null
+			console.log('Disconnected', data.payload.code, data.payload.reason)
+			return
+		}
+
+		this.handleMessage(data)
+	}
+
+	isConnected() {
+		return (
+			(this.ws && this.ws.readyState === WebSocket.OPEN) ||
+			(this.sse && this.sseConnId)
 		)
 	}
 
+	send(event) {
+		if (this.ws && this.ws.readyState === WebSocket.OPEN) {
+			this.ws.send(JSON.stringify(event))
+		} else if (this.sse && this.sseConnId) {
+			fetch(`/sse/${this.roomId}/${this.sseConnId}`, {
+				method: 'POST',
+				headers: { 'Content-Type': 'application/json' },
+				body: JSON.stringify(event),
+			})
+		}
+	}
+
+	sendJoin() {
+		this.send({
+			type: 'join_room',
+			payload: {
+				username: this.username,
+				color: this.getUserColor(),
+			},
+		})
+	}
+
 	handleMessage(data) {
 		console.log('Received:', data)
 
 		switch (data.type) {
+			case 'session':
+				this.resumeToken = data.payload.resume_token
+				if (data.payload.resumed) {
+					this.resendPendingOps()
+				}
+				break
+
+			case 'error':
+				if (data.payload.code === 'resume_failed') {
+					this.resumeToken = null
+					this.lastSeq = 0
+					this.participants.clear()
+					this.updateParticipantsList()
+					this.sendJoin()
+				}
+				break
+
+			case 'ack':
+				this.pendingOps.delete(data.payload.op_id)
+				this.version = data.payload.version
+				this.setStatus(`Saved (v${this.version})`)
+				break
+
+			case 'nack':
+				this.pendingOps.delete(data.payload.op_id)
+				this.setStatus(`Edit rejected: ${data.payload.reason}`)
+				break
+
+			case 'sync':
+				this.version = data.payload.version
+				this.updateText({ text: data.payload.content })
+				this.participants.clear()
+				data.payload.participants.forEach(p =>
+					this.participants.set(p.id, { username: p.username, color: p.color })
+				)
+				this.updateParticipantsList()
+				this.comments.clear()
+				;(data.payload.comments || []).forEach(t => this.comments.set(t.id, t))
+				this.renderComments()
+				this.locks.clear()
+				;(data.payload.locks || []).forEach(l => this.locks.set(l.id, l))
+				this.renderLocks()
+				break
+
 			case 'join_room':
 				this.addParticipant(data.user_id, data.payload)
 				break
@@ -72,12 +205,37 @@ class TableCollabRoom {
 				break
 
 			case 'text_update':
+				this.version = data.version
 				this.updateText(data.payload)
+				this.renderComments()
 				break
 
 			case 'chat_message':
 				this.addChatMessage(data.user_id, data.payload)
 				break
+
+			case 'comment_thread':
+				this.comments.set(data.payload.id, data.payload)
+				this.renderComments()
+				break
+
+			case 'lock_acquired':
+				this.locks.set(data.payload.id, data.payload)
+				this.renderLocks()
+				break
+
+			case 'lock_released':
+				this.locks.delete(data.payload.lock_id)
+				this.renderLocks()
+				break
+
+			case 'comment_anchors':
+				Object.entries(data.payload.anchors).forEach(([id, anchor]) => {
+					const thread = this.comments.get(id)
+					if (thread) thread.anchor = anchor
+				})
+				this.renderComments()
+				break
 		}
 	}
 
@@ -118,6 +276,10 @@ class TableCollabRoom {
 		// Implementation for cursor tracking
 	}
 
+	setStatus(text) {
+		document.getElementById('editorStatus').textContent = text
+	}
+
 	updateText(payload) {
 		const editor = document.getElementById('editor')
 		if (editor.value !== payload.text) {
@@ -130,12 +292,95 @@ class TableCollabRoom {
 		const message = document.createElement('div')
 		message.className = 'chat-message'
 		message.innerHTML = `<strong>${
-			this.participants.get(userId)?.username || 'Unknown'
+			this.participants.get(userId)?.username ||
+			payload.username ||
+			'Unknown'
 		}:</strong> ${payload.text}`
 		chat.appendChild(message)
 		chat.scrollTop = chat.scrollHeight
 	}
 
+	renderComments() {
+		const list = document.getElementById('comments')
+		// Сервер считает позиции в символах, а не в UTF-16, как JS-строки
+		const chars = Array.from(document.getElementById('editor').value)
+
+		list.innerHTML = ''
+		this.comments.forEach(thread => {
+			const div = document.createElement('div')
+			div.className = 'comment-thread' + (thread.resolved ? ' resolved' : '')
+
+			const quote = document.createElement('div')
+			quote.className = 'comment-quote'
+			quote.textContent = thread.anchor.cell
+				? `Cell ${thread.anchor.cell}`
+				: `“${chars.slice(thread.anchor.start, thread.anchor.end).join('')}”`
+			div.appendChild(quote)
+
+			thread.comments.forEach(comment => {
+				const line = document.createElement('div')
+				line.textContent = `${comment.username}: ${comment.text}`
+				div.appendChild(line)
+			})
+
+			const actions = document.createElement('div')
+			actions.className = 'comment-actions'
+			const reply = document.createElement('input')
+			reply.placeholder = 'Reply...'
+			reply.addEventListener('keypress', e => {
+				if (e.key === 'Enter' && reply.value.trim()) {
+					this.send({
+						type: 'comment_reply',
+						payload: { thread_id: thread.id, text: reply.value },
+					})
+					reply.value = ''
+				}
+			})
+			const resolve = document.createElement('button')
+			resolve.textContent = thread.resolved ? 'Reopen' : 'Resolve'
+			resolve.addEventListener('click', () => {
+				this.send({
+					type: 'comment_resolve',
+					payload: { thread_id: thread.id, resolved: !thread.resolved },
+				})
+			})
+			actions.append(reply, resolve)
+			div.appendChild(actions)
+
+			list.appendChild(div)
+		})
+	}
+
+	renderLocks() {
+		const list = document.getElementById('locks')
+		list.innerHTML = ''
+		this.locks.forEach(lock => {
+			const div = document.createElement('div')
+			const region = lock.region.range || `text ${lock.region.start}–${lock.region.end}`
+			div.style.color = lock.color
+			div.textContent = `🔒 ${lock.username} is editing ${region}`
+			list.appendChild(div)
+		})
+	}
+
+	addCommentOnSelection() {
+		const editor = document.getElementById('editor')
+		const text = prompt('Comment')
+		if (!text || !this.isConnected()) return
+
+		const toChars = offset => Array.from(editor.value.slice(0, offset)).length
+		this.send({
+			type: 'comment_add',
+			payload: {
+				anchor: {
+					start: toChars(editor.selectionStart),
+					end: toChars(editor.selectionEnd),
+				},
+				text: text,
+			},
+		})
+	}
+
 	setupEventListeners() {
 		const editor = document.getElementById('editor')
 		const chatInput = document.getElementById('chatInput')
@@ -155,17 +400,19 @@ class TableCollabRoom {
 
 		const sendMessage = () => {
 			const text = chatInput.value.trim()
-			if (text && this.ws) {
-				this.ws.send(
-					JSON.stringify({
-						type: 'chat_message',
-						payload: { text: text },
-					})
-				)
+			if (text && this.isConnected()) {
+				this.send({
+					type: 'chat_message',
+					payload: { text: text },
+				})
 				chatInput.value = ''
 			}
 		}
 
+		document
+			.getElementById('commentBtn')
+			.addEventListener('click', () => this.addCommentOnSelection())
+
 		sendBtn.addEventListener('click', sendMessage)
 		chatInput.addEventListener('keypress', e => {
 			if (e.key === 'Enter') sendMessage()
@@ -173,24 +420,34 @@ class TableCollabRoom {
 	}
 
 	sendTextUpdate(text) {
-		if (this.ws) {
-			this.ws.send(
-				JSON.stringify({
-					type: 'text_update',
-					payload: { text: text, version: 1 },
-				})
-			)
+		const opId = `${this.resumeToken || 'op'}-${++this.opCounter}`
+		const event = {
+			type: 'text_update',
+			op_id: opId,
+			payload: { text: text, version: this.version },
 		}
+		this.pendingOps.set(opId, event)
+		this.sendEdit(event)
+	}
+
+	// Неподтверждённые правки повторяются с тем же op_id — сервер применит их один раз
+	sendEdit(event) {
+		if (this.isConnected()) {
+			this.send(event)
+		}
+	}
+
+	resendPendingOps() {
+		this.pendingOps.forEach(event => this.sendEdit(event))
 	}
 
 	sendCursorMove(x, y) {
-		if (this.ws) {
-			this.ws.send(
-				JSON.stringify({
-					type: 'cursor_move',
-					payload: { x: x, y: y },
-				})
-			)
+		// Курсоры через HTTP слишком дороги — шлём их только по WebSocket
+		if (this.ws && this.ws.readyState === WebSocket.OPEN) {
+			this.send({
+				type: 'cursor_move',
+				payload: { x: x, y: y },
+			})
 		}
 	}
 }